@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"github.com/spf13/cobra"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// apikeyCmd управляет ключами API в хранилище, выбранном в конфигурации (storage.driver)
+var apikeyCmd = &cobra.Command{
+	Use:   "apikey",
+	Short: "manage API keys for service-to-service access",
+	Long: `Issues, lists and revokes API keys that other services pass in the X-API-Key
+header. A key belongs to one tenant (the default one unless --tenant is given)
+and grants only its scopes: ` + strings.Join(entities.Scopes, ", ") + `.
+The key itself is shown once on creation: the storage keeps only its SHA-256 hash.
+The server accepts API keys when auth.api_keys is enabled.`,
+}
+
+var apikeyCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "issue a new API key and print it",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scopes, _ := cmd.Flags().GetStringSlice("scope")
+
+		return withAPIKeys(cmd, func(ctx context.Context, keys *usecases.APIKeyUsecases) error {
+			key, err := keys.Create(ctx, &usecases.CreateAPIKeyRequest{Name: args[0], Scopes: scopes})
+			if err != nil {
+				return err
+			}
+
+			_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "created API key %s with scopes %s, store it now: it is not shown again\n",
+				key.ID, strings.Join(key.Scopes, ","))
+			_, _ = fmt.Fprintln(cmd.OutOrStdout(), key.Key)
+			return nil
+		})
+	},
+}
+
+var apikeyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list API keys of the tenant, including revoked ones",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withAPIKeys(cmd, func(ctx context.Context, keys *usecases.APIKeyUsecases) error {
+			list, err := keys.List(ctx)
+			if err != nil {
+				return err
+			}
+
+			printAPIKeys(cmd.OutOrStdout(), list)
+			return nil
+		})
+	},
+}
+
+var apikeyRevokeCmd = &cobra.Command{
+	Use:   "revoke <id>",
+	Short: "revoke an API key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := entities.NewAPIKeyID(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid API key id %q", args[0])
+		}
+
+		return withAPIKeys(cmd, func(ctx context.Context, keys *usecases.APIKeyUsecases) error {
+			if err := keys.Revoke(ctx, id); err != nil {
+				return err
+			}
+
+			_, _ = fmt.Fprintln(cmd.OutOrStdout(), "revoked", id)
+			return nil
+		})
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(apikeyCmd)
+	apikeyCmd.AddCommand(apikeyCreateCmd, apikeyListCmd, apikeyRevokeCmd)
+
+	for _, c := range []*cobra.Command{apikeyCreateCmd, apikeyListCmd, apikeyRevokeCmd} {
+		addTenantFlag(c)
+	}
+	apikeyCreateCmd.Flags().StringSlice("scope", nil, "scope granted to the key, repeat or separate with commas (required)")
+	_ = apikeyCreateCmd.MarkFlagRequired("scope")
+}
+
+// withAPIKeys открывает хранилище и выполняет fn со сценариями ключей API арендатора из флага --tenant
+func withAPIKeys(cmd *cobra.Command, fn func(ctx context.Context, keys *usecases.APIKeyUsecases) error) error {
+	ctx, err := tenantContext(cmd)
+	if err != nil {
+		return err
+	}
+
+	storage, err := newPersistentEventStorage()
+	if err != nil {
+		return err
+	}
+	defer closeEventStorage(storage)
+
+	return fn(ctx, usecases.NewAPIKeyUsecases(storage))
+}
+
+// printAPIKeys выводит таблицу ключей API
+func printAPIKeys(w io.Writer, list []usecases.APIKeyResponse) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ID\tNAME\tPREFIX\tSCOPES\tCREATED\tREVOKED")
+
+	for _, k := range list {
+		revoked := "-"
+		if k.Revoked != nil {
+			revoked = k.Revoked.Format("2006-01-02 15:04:05 MST")
+		}
+
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", k.ID, k.Name, k.Prefix, strings.Join(k.Scopes, ","),
+			k.Created.Format("2006-01-02 15:04:05 MST"), revoked)
+	}
+
+	_ = tw.Flush()
+}
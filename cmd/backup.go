@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/mzelenkin/go-calendar/internal/backup"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"io"
+	"os"
+)
+
+// backupCmd сохраняет все события хранилища в архив
+var backupCmd = &cobra.Command{
+	Use:   "backup [file.tar.gz]",
+	Short: "back up all events of the configured storage",
+	Long: `Writes every calendar, event and API key of the configured storage into a portable archive:
+a gzipped tar with manifest.json (format version, counts, SHA-256 checksums),
+calendars.jsonl, events.jsonl and apikeys.jsonl (one record per line). API keys are
+saved as the storage keeps them: hashes, not the keys themselves. The archive can be
+restored into any storage driver. Without a file or with "-" the archive is written
+to standard output. Only the data of one tenant gets into the archive: the default one
+unless --tenant is given.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, err := tenantContext(cmd)
+		if err != nil {
+			return err
+		}
+
+		storage, err := newEventStorage()
+		if err != nil {
+			return err
+		}
+		defer closeEventStorage(storage)
+
+		var w io.Writer = cmd.OutOrStdout()
+		var f *os.File
+		if len(args) == 1 && args[0] != "-" {
+			// Архив пишется во временный файл, чтобы прерванное копирование не подменило прежний архив
+			if f, err = os.Create(args[0] + ".tmp"); err != nil {
+				return err
+			}
+			defer os.Remove(f.Name())
+			defer f.Close()
+			w = f
+		}
+
+		manifest, err := backup.Write(ctx, w, storage, viper.GetString("storage.driver"))
+		if err != nil {
+			return err
+		}
+
+		if f != nil {
+			if err = f.Sync(); err != nil {
+				return err
+			}
+			if err = f.Close(); err != nil {
+				return err
+			}
+			if err = os.Rename(f.Name(), args[0]); err != nil {
+				return err
+			}
+		}
+
+		_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "backed up %d calendars, %d events, %d API keys, sha256 %s\n",
+			manifest.Calendars, manifest.Events, manifest.APIKeys, manifest.SHA256)
+
+		return nil
+	},
+}
+
+// restoreCmd загружает события из архива в хранилище
+var restoreCmd = &cobra.Command{
+	Use:   "restore <file.tar.gz>",
+	Short: "restore events from a backup archive into the configured storage",
+	Long: `Loads events from an archive made by "backup" into the configured storage,
+which may use a different driver than the one the archive was made from.
+The whole archive is verified before the first event is written.
+Events that already exist are kept unless --overwrite is given.
+API keys that already exist are kept, but a key revoked in the archive gets revoked.
+Everything is restored into the default tenant unless --tenant is given,
+whichever tenant the archive was made from.
+Use "-" to read the archive from standard input.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, err := tenantContext(cmd)
+		if err != nil {
+			return err
+		}
+
+		var r io.Reader = os.Stdin
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+
+		storage, err := newPersistentEventStorage()
+		if err != nil {
+			return err
+		}
+		defer closeEventStorage(storage)
+
+		overwrite, _ := cmd.Flags().GetBool("overwrite")
+		report, err := backup.Restore(ctx, r, storage, overwrite)
+		if report != nil {
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "archive from %s made at %s: %d events\n",
+				report.Manifest.Source, report.Manifest.CreatedAt.Format("2006-01-02 15:04:05 MST"), report.Manifest.Events)
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "created: %d, overwritten: %d, skipped: %d, API keys: %d\n",
+				report.Created, report.Overwritten, report.Skipped, report.APIKeys)
+		}
+
+		return err
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(backupCmd, restoreCmd)
+
+	restoreCmd.Flags().Bool("overwrite", false, "replace events that already exist in the storage")
+	addTenantFlag(backupCmd)
+	addTenantFlag(restoreCmd)
+}
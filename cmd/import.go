@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"github.com/mzelenkin/go-calendar/internal/restapi"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// importCmd импортирует события из файла iCalendar
+var importCmd = &cobra.Command{
+	Use:   "import <file.ics>",
+	Short: "import events from an iCalendar file",
+	Long: `Imports events from an iCalendar (.ics) file through the API of a running server (POST /events/import),
+so the events end up in the storage the server works with.
+Events are matched by UID: new ones are created, known ones are updated.
+Use "-" to read the calendar from standard input.
+Events go to the default calendar unless --calendar is given,
+and to the default tenant unless --tenant is given.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var r io.Reader = os.Stdin
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+
+		server, _ := cmd.Flags().GetString("server")
+		if server == "" {
+			server = "http://" + viper.GetString("http.listen")
+		}
+
+		// События календаря по умолчанию доступны и по /events, других - по /calendars/{id}/events
+		path := "/events/import"
+		if value, _ := cmd.Flags().GetString("calendar"); value != "" {
+			calendarID, err := entities.NewCalendarID(value)
+			if err != nil {
+				return fmt.Errorf("invalid calendar id %q: %w", value, err)
+			}
+			path = "/calendars/" + calendarID.String() + path
+		}
+
+		req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(server, "/")+path, r)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "text/calendar")
+		if err = setTenantHeader(cmd, req); err != nil {
+			return err
+		}
+		if token, _ := cmd.Flags().GetString("token"); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if key, _ := cmd.Flags().GetString("api-key"); key != "" {
+			req.Header.Set(restapi.APIKeyHeader, key)
+		}
+
+		report, err := postImport(req)
+		if err != nil {
+			return err
+		}
+		printImportReport(cmd.OutOrStdout(), report)
+
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(importCmd)
+
+	importCmd.Flags().String("server", "", "base URL of the server API (default is http:// + http.listen)")
+	importCmd.Flags().String("calendar", "", "id of the calendar to import events into (default is the default calendar)")
+	addTenantFlag(importCmd)
+	importCmd.Flags().String("token", "", "JWT bearer token, if the server has auth.enabled")
+	importCmd.Flags().String("api-key", "", "API key with the events:write scope, if the server has auth.api_keys")
+}
+
+// setTenantHeader передает арендатора из флага --tenant в заголовке http.tenant_header, из которого его берет сервер
+func setTenantHeader(cmd *cobra.Command, req *http.Request) error {
+	id, _ := cmd.Flags().GetString("tenant")
+	if id == tenant.Default {
+		return nil
+	}
+	if !tenant.Valid(id) {
+		return fmt.Errorf("invalid tenant %q", id)
+	}
+
+	header := viper.GetString("http.tenant_header")
+	if header == "" {
+		return errors.New("--tenant needs http.tenant_header: without it the server works with the default tenant only")
+	}
+	req.Header.Set(header, id)
+
+	return nil
+}
+
+// postImport отправляет запрос импорта и разбирает отчет. Ошибка API возвращается с ее кодом и описанием
+func postImport(req *http.Request) (*usecases.ImportReport, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var problem restapi.Problem
+		if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil || problem.Code == "" {
+			return nil, fmt.Errorf("import failed: %s", resp.Status)
+		}
+
+		return nil, fmt.Errorf("import failed: %s (%s): %s", problem.Title, problem.Code, problem.Detail)
+	}
+
+	var report usecases.ImportReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, fmt.Errorf("invalid import report: %w", err)
+	}
+
+	return &report, nil
+}
+
+// printImportReport выводит результаты импорта по каждому событию и итог
+func printImportReport(w io.Writer, report *usecases.ImportReport) {
+	for _, item := range report.Items {
+		if item.Error != "" {
+			_, _ = fmt.Fprintf(w, "%-8s %s: %s\n", item.Status, item.UID, item.Error)
+		} else {
+			_, _ = fmt.Fprintf(w, "%-8s %s\n", item.Status, item.UID)
+		}
+	}
+
+	_, _ = fmt.Fprintf(w, "created: %d, updated: %d, skipped: %d, invalid: %d\n",
+		report.Created, report.Updated, report.Skipped, report.Invalid)
+}
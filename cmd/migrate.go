@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/mzelenkin/go-calendar/internal/storage/migrate"
+	"github.com/mzelenkin/go-calendar/internal/storage/registry"
+	"github.com/spf13/cobra"
+	"io"
+	"text/tabwriter"
+)
+
+// migrateCmd управляет схемой SQL-хранилища, выбранного в конфигурации (storage.driver)
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "manage schema migrations of the configured SQL storage",
+	Long: `Applies and rolls back versioned schema migrations embedded into the binary
+for the SQL storage selected by storage.driver (sqlite or postgres).
+Applied versions are tracked in the schema_migrations table. Each run is
+a single transaction under a lock, so concurrent runs are refused.`,
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "apply all pending migrations",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withMigrator(func(ctx context.Context, m *migrate.Migrator) error {
+			applied, err := m.Up(ctx)
+			if err != nil {
+				return err
+			}
+
+			printMigrations(cmd.OutOrStdout(), "applied", applied)
+			return nil
+		})
+	},
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "roll back the latest applied migrations",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		steps, _ := cmd.Flags().GetInt("steps")
+		if steps < 1 {
+			return fmt.Errorf("--steps must be positive, got %d", steps)
+		}
+
+		return withMigrator(func(ctx context.Context, m *migrate.Migrator) error {
+			rolledBack, err := m.Down(ctx, steps)
+			if err != nil {
+				return err
+			}
+
+			printMigrations(cmd.OutOrStdout(), "rolled back", rolledBack)
+			return nil
+		})
+	},
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "show applied and pending migrations",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withMigrator(func(ctx context.Context, m *migrate.Migrator) error {
+			status, err := m.Status(ctx)
+			if err != nil {
+				return err
+			}
+
+			printMigrationStatus(cmd.OutOrStdout(), status)
+			return nil
+		})
+	},
+}
+
+var migrateCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "create empty up and down files of the next migration",
+	Long: `Creates <version>_<name>.up.sql and <version>_<name>.down.sql in the migrations
+directory of the configured storage. Run it from the repository root: the files
+are embedded into the binary on the next build.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, _ := cmd.Flags().GetString("dir")
+		if dir == "" {
+			var err error
+			if dir, err = registry.Builtin().MigrationsDir(storageConfig()); err != nil {
+				return err
+			}
+		}
+
+		paths, err := migrate.Create(dir, args[0])
+		for _, p := range paths {
+			_, _ = fmt.Fprintln(cmd.OutOrStdout(), "created", p)
+		}
+
+		return err
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(migrateCmd)
+	migrateCmd.AddCommand(migrateUpCmd, migrateDownCmd, migrateStatusCmd, migrateCreateCmd)
+
+	migrateDownCmd.Flags().Int("steps", 1, "number of migrations to roll back")
+	migrateCreateCmd.Flags().String("dir", "", "migrations directory (default is the directory of storage.driver)")
+}
+
+// withMigrator подключается к базе выбранного хранилища и выполняет fn
+func withMigrator(fn func(ctx context.Context, m *migrate.Migrator) error) error {
+	ctx := context.Background()
+
+	m, db, err := registry.Builtin().Migrator(ctx, storageConfig())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return fn(ctx, m)
+}
+
+// printMigrations выводит выполненные миграции
+func printMigrations(w io.Writer, action string, list []migrate.Migration) {
+	if len(list) == 0 {
+		_, _ = fmt.Fprintln(w, "nothing to do")
+		return
+	}
+
+	for _, m := range list {
+		_, _ = fmt.Fprintf(w, "%s %04d_%s\n", action, m.Version, m.Name)
+	}
+}
+
+// printMigrationStatus выводит таблицу состояния версий
+func printMigrationStatus(w io.Writer, status []migrate.Status) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+
+	for _, s := range status {
+		name, state := s.Name, "pending"
+		if name == "" {
+			name = "(unknown)"
+		}
+		if s.Applied {
+			state = "applied"
+		}
+
+		_, _ = fmt.Fprintf(tw, "%04d\t%s\t%s\t%s\n", s.Version, name, state, s.AppliedAt)
+	}
+
+	_ = tw.Flush()
+}
@@ -13,7 +13,13 @@ var serveCmd = &cobra.Command{
 	Short: "start http server with configured api",
 	Long:  `Starts a http server and serves the configured api`,
 	Run: func(cmd *cobra.Command, args []string) {
-		server, err := restapi.NewServer()
+		storage, err := newEventStorage()
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer closeEventStorage(storage)
+
+		server, err := restapi.NewServer(storage)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -27,5 +33,13 @@ func init() {
 	// Здесь можно объявиить флаги и настройки
 	viper.SetDefault("http.listen", "localhost:7879")
 	viper.SetDefault("http.enable_cors", true)
+	viper.SetDefault("http.max_list_range", "8784h")
+	viper.SetDefault("http.tenant_header", "")
+	viper.SetDefault("auth.enabled", false)
+	viper.SetDefault("auth.api_keys", false)
+	viper.SetDefault("auth.jwks_refresh", "1h")
+	viper.SetDefault("auth.leeway", "30s")
+	viper.SetDefault("auth.subject_claim", "sub")
+	viper.SetDefault("auth.tenant_claim", "tenant")
 	viper.SetDefault("log.level", "debug")
 }
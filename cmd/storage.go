@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"github.com/mzelenkin/go-calendar/internal/storage/registry"
+	"github.com/spf13/viper"
+	"time"
+)
+
+func init() {
+	viper.SetDefault("storage.driver", "memory")
+	viper.SetDefault("storage.connect_timeout", 5*time.Second)
+	viper.SetDefault("storage.memory.dir", "")
+	viper.SetDefault("storage.memory.fsync", "always")
+	viper.SetDefault("storage.memory.fsync_interval", time.Second)
+	viper.SetDefault("storage.memory.snapshot_every", 10000)
+	viper.SetDefault("storage.sqlite.path", "runtime/calendar.db")
+	viper.SetDefault("storage.bolt.path", "runtime/calendar.bolt")
+	viper.SetDefault("storage.redis.url", "redis://localhost:6379/0")
+	viper.SetDefault("storage.redis.prefix", "calendar")
+	viper.SetDefault("storage.postgres.dsn", "postgres://localhost:5432/calendar?sslmode=disable")
+}
+
+// storageConfig читает раздел storage конфигурации
+// Ключи читаются по одному: в отличие от UnmarshalKey, так учитываются переменные окружения
+func storageConfig() registry.Config {
+	return registry.Config{
+		Driver:         viper.GetString("storage.driver"),
+		ConnectTimeout: viper.GetDuration("storage.connect_timeout"),
+		Memory: registry.MemoryConfig{
+			Dir:           viper.GetString("storage.memory.dir"),
+			Fsync:         viper.GetString("storage.memory.fsync"),
+			FsyncInterval: viper.GetDuration("storage.memory.fsync_interval"),
+			SnapshotEvery: viper.GetInt("storage.memory.snapshot_every"),
+		},
+		SQLite:   registry.SQLiteConfig{Path: viper.GetString("storage.sqlite.path")},
+		Bolt:     registry.BoltConfig{Path: viper.GetString("storage.bolt.path")},
+		Redis:    registry.RedisConfig{URL: viper.GetString("storage.redis.url"), Prefix: viper.GetString("storage.redis.prefix")},
+		Postgres: registry.PostgresConfig{DSN: viper.GetString("storage.postgres.dsn")},
+	}
+}
+
+// newEventStorage создает хранилище событий, выбранное в конфигурации (storage.driver),
+// и проверяет его доступность
+func newEventStorage() (usecases.Storage, error) {
+	return registry.Builtin().Open(context.Background(), storageConfig())
+}
+
+// newPersistentEventStorage создает хранилище, как newEventStorage, для команд, которые меняют данные и завершаются:
+// хранилище в памяти без storage.memory.dir потеряло бы изменения вместе с процессом
+func newPersistentEventStorage() (usecases.Storage, error) {
+	config := storageConfig()
+	if config.Driver == "memory" && config.Memory.Dir == "" {
+		return nil, errors.New("storage.driver memory keeps nothing after the command exits: set storage.memory.dir or choose another driver")
+	}
+
+	return registry.Builtin().Open(context.Background(), config)
+}
+
+// closeEventStorage освобождает ресурсы хранилища, если они у него есть
+func closeEventStorage(storage usecases.Storage) {
+	_ = registry.Close(storage)
+}
@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	"github.com/spf13/cobra"
+)
+
+// addTenantFlag добавляет команде флаг --tenant
+func addTenantFlag(cmd *cobra.Command) {
+	cmd.Flags().String("tenant", "", "tenant whose data the command works with (default is the default tenant)")
+}
+
+// tenantContext возвращает контекст с арендатором из флага --tenant
+func tenantContext(cmd *cobra.Command) (context.Context, error) {
+	id, _ := cmd.Flags().GetString("tenant")
+	if id != tenant.Default && !tenant.Valid(id) {
+		return nil, fmt.Errorf("invalid tenant %q", id)
+	}
+
+	return tenant.NewContext(context.Background(), id), nil
+}
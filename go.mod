@@ -1,16 +1,19 @@
 module github.com/mzelenkin/go-calendar
 
-go 1.14
+go 1.16
 
 require (
+	github.com/alicebob/miniredis/v2 v2.16.0
 	github.com/go-chi/chi v4.1.1+incompatible
 	github.com/go-chi/cors v1.1.1
 	github.com/go-chi/render v1.0.1
 	github.com/go-playground/validator/v10 v10.0.1
+	github.com/go-redis/redis/v8 v8.11.4
+	github.com/lib/pq v1.10.9
 	github.com/satori/go.uuid v1.2.0
 	github.com/sirupsen/logrus v1.2.0
 	github.com/spf13/cobra v1.0.0
 	github.com/spf13/viper v1.6.3
-	golang.org/x/crypto v0.0.0-20190506204251-e1dfcc566284 // indirect
-	golang.org/x/sys v0.0.0-20190508220229-2d0786266e9c // indirect
+	go.etcd.io/bbolt v1.3.7
+	modernc.org/sqlite v1.23.1
 )
@@ -0,0 +1,54 @@
+// Пакет проверяет токены доступа JWT и передает аутентифицированного субъекта (по токену или ключу API)
+// в контексте запроса.
+//
+// Поддерживаются подписи RS256, ES256 и HS256. Ключи проверки берутся из статического ключа (общий секрет
+// HS256 или открытый ключ PEM) либо из набора JWKS по URL, который кэшируется и перечитывается при ротации ключей.
+// Из токена берутся субъект и арендатор: арендатор из токена заменяет арендатора запроса (см. пакет tenant).
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrInvalidToken токен отсутствует, поврежден, подписан неизвестным ключом или не прошел проверку утверждений
+var ErrInvalidToken = errors.New("invalid token")
+
+// Principal аутентифицированный субъект запроса
+type Principal struct {
+	Subject string   // Утверждение субъекта токена (по умолчанию sub) или apikey:<id> для ключа API
+	Tenant  string   // Арендатор из токена или ключа API, пустой - арендатор по умолчанию
+	KeyID   string   // Идентификатор ключа API, пустой - субъект предъявил токен JWT
+	Scopes  []string // Разрешения ключа API
+}
+
+// Allows проверяет, что субъекту разрешено действие scope. Разрешения ограничивают только ключи API,
+// субъекту с токеном JWT разрешено все
+func (p Principal) Allows(scope string) bool {
+	if p.KeyID == "" {
+		return true
+	}
+
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// contextKey ключ контекста, под которым лежит субъект
+type contextKey struct{}
+
+// NewContext возвращает контекст с субъектом p
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext возвращает субъекта из контекста и признак того, что запрос аутентифицирован
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(Principal)
+
+	return p, ok
+}
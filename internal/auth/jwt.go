@@ -0,0 +1,267 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	"math"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// Утверждения токена по умолчанию
+const (
+	DefaultSubjectClaim = "sub"
+	DefaultTenantClaim  = "tenant"
+)
+
+// Config настройки проверки токенов. Источником ключей служит ровно одно из Secret, PublicKeyFile и JWKSURL
+type Config struct {
+	Secret        string        // Общий секрет HS256
+	PublicKeyFile string        // Файл открытого ключа RS256 или ES256 в формате PEM
+	JWKSURL       string        // URL набора ключей JWKS
+	JWKSRefresh   time.Duration // Срок кэширования набора JWKS, 0 - DefaultJWKSRefresh
+	Issuer        string        // Ожидаемый издатель (iss), пустой - не проверяется
+	Audience      string        // Ожидаемый получатель (aud), пустой - не проверяется
+	Leeway        time.Duration // Допустимое расхождение часов при проверке exp и nbf
+	SubjectClaim  string        // Утверждение с субъектом, пустое - DefaultSubjectClaim
+	TenantClaim   string        // Утверждение с арендатором, пустое - DefaultTenantClaim
+}
+
+// Verifier проверяет подпись и утверждения токенов JWT
+type Verifier struct {
+	keys         KeySource
+	issuer       string
+	audience     string
+	leeway       time.Duration
+	subjectClaim string
+	tenantClaim  string
+	now          func() time.Time
+}
+
+// New создает Verifier по настройкам cfg
+func New(cfg Config) (*Verifier, error) {
+	var keys KeySource
+	sources := 0
+
+	if cfg.Secret != "" {
+		keys = NewSecretKey([]byte(cfg.Secret))
+		sources++
+	}
+	if cfg.PublicKeyFile != "" {
+		data, err := os.ReadFile(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("auth: %w", err)
+		}
+		if keys, err = ParsePublicKey(data); err != nil {
+			return nil, err
+		}
+		sources++
+	}
+	if cfg.JWKSURL != "" {
+		jwks := NewJWKS(cfg.JWKSURL)
+		if cfg.JWKSRefresh > 0 {
+			jwks.Refresh = cfg.JWKSRefresh
+		}
+		keys = jwks
+		sources++
+	}
+
+	if sources != 1 {
+		return nil, errors.New("auth: exactly one of secret, public key file and JWKS URL must be set")
+	}
+
+	v := NewVerifier(keys)
+	v.issuer, v.audience, v.leeway = cfg.Issuer, cfg.Audience, cfg.Leeway
+	if cfg.SubjectClaim != "" {
+		v.subjectClaim = cfg.SubjectClaim
+	}
+	if cfg.TenantClaim != "" {
+		v.tenantClaim = cfg.TenantClaim
+	}
+
+	return v, nil
+}
+
+// NewVerifier создает Verifier с источником ключей keys, без проверки издателя и получателя
+func NewVerifier(keys KeySource) *Verifier {
+	return &Verifier{
+		keys:         keys,
+		subjectClaim: DefaultSubjectClaim,
+		tenantClaim:  DefaultTenantClaim,
+		now:          time.Now,
+	}
+}
+
+// header заголовок токена
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify проверяет токен и возвращает его субъекта. Токен должен содержать срок действия exp и субъекта,
+// арендатор необязателен. Ошибки токена оборачивают ErrInvalidToken, прочие (например, недоступен JWKS) - нет
+func (v *Verifier) Verify(ctx context.Context, token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+
+	// Прочие алгоритмы, в том числе none, не принимаются
+	if h.Alg != RS256 && h.Alg != ES256 && h.Alg != HS256 {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, h.Alg)
+	}
+
+	key, err := v.keys.Key(ctx, h.Kid, h.Alg)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !verifySignature(h.Alg, key, parts[0]+"."+parts[1], signature) {
+		return nil, fmt.Errorf("%w: signature verification failed", ErrInvalidToken)
+	}
+
+	var claims map[string]interface{}
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", ErrInvalidToken)
+	}
+
+	if err = v.validate(claims); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err.Error())
+	}
+
+	p := &Principal{}
+	if p.Subject, _ = claims[v.subjectClaim].(string); p.Subject == "" {
+		return nil, fmt.Errorf("%w: claim %s must be a non-empty string", ErrInvalidToken, v.subjectClaim)
+	}
+
+	if value, ok := claims[v.tenantClaim]; ok {
+		if p.Tenant, _ = value.(string); !tenant.Valid(p.Tenant) {
+			return nil, fmt.Errorf("%w: claim %s must contain a valid tenant", ErrInvalidToken, v.tenantClaim)
+		}
+	}
+
+	return p, nil
+}
+
+// validate проверяет срок действия, издателя и получателя токена
+func (v *Verifier) validate(claims map[string]interface{}) error {
+	now := v.now()
+
+	exp, ok, err := numericDate(claims, "exp")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("claim exp is required")
+	}
+	if !now.Before(exp.Add(v.leeway)) {
+		return errors.New("token is expired")
+	}
+
+	nbf, ok, err := numericDate(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(v.leeway).Before(nbf) {
+		return errors.New("token is not valid yet")
+	}
+
+	if v.issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.issuer {
+			return errors.New("unexpected issuer")
+		}
+	}
+
+	if v.audience != "" && !hasAudience(claims["aud"], v.audience) {
+		return errors.New("unexpected audience")
+	}
+
+	return nil
+}
+
+// numericDate возвращает время из утверждения name в секундах от начала эпохи
+func numericDate(claims map[string]interface{}, name string) (time.Time, bool, error) {
+	value, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+
+	n, ok := value.(float64)
+	if !ok || math.IsNaN(n) || math.IsInf(n, 0) {
+		return time.Time{}, false, fmt.Errorf("claim %s must be a number", name)
+	}
+
+	sec, frac := math.Modf(n)
+
+	return time.Unix(int64(sec), int64(frac*1e9)), true, nil
+}
+
+// hasAudience проверяет, что утверждение aud (строка или массив строк) содержит audience
+func hasAudience(aud interface{}, audience string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == audience
+	case []interface{}:
+		for _, v := range a {
+			if s, _ := v.(string); s == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// decodeSegment разбирает часть токена в base64url с JSON объектом
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// verifySignature проверяет подпись signature данных input ключом key по алгоритму alg
+func verifySignature(alg string, key interface{}, input string, signature []byte) bool {
+	if !suits(key, alg) {
+		return false
+	}
+
+	switch alg {
+	case HS256:
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write([]byte(input))
+		return hmac.Equal(signature, mac.Sum(nil))
+	case RS256:
+		sum := sha256.Sum256([]byte(input))
+		return rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), crypto.SHA256, sum[:], signature) == nil
+	case ES256:
+		// Подпись JWS ES256 - это r и s по 32 байта подряд (RFC 7518, раздел 3.4)
+		if len(signature) != 64 {
+			return false
+		}
+		sum := sha256.Sum256([]byte(input))
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(key.(*ecdsa.PublicKey), sum[:], r, s)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// sign подписывает токен с утверждениями claims ключом key по алгоритму alg, kid - идентификатор ключа в заголовке
+func sign(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	t.Helper()
+
+	h, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	c, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	sum := sha256.Sum256([]byte(input))
+
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(input))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, sum[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// claimsFor возвращает действующие утверждения субъекта sub
+func claimsFor(sub string) map[string]interface{} {
+	return map[string]interface{}{"sub": sub, "exp": time.Now().Add(time.Hour).Unix()}
+}
+
+// TestVerifier_Algorithms проверяет токены RS256, ES256 и HS256 со статическими ключами
+func TestVerifier_Algorithms(t *testing.T) {
+	ctx := context.Background()
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	secret := []byte("secret")
+
+	tests := []struct {
+		alg    string
+		signer interface{}
+		keys   KeySource
+	}{
+		{RS256, rsaKey, &StaticKey{key: &rsaKey.PublicKey}},
+		{ES256, ecKey, &StaticKey{key: &ecKey.PublicKey}},
+		{HS256, secret, NewSecretKey(secret)},
+	}
+
+	for _, tt := range tests {
+		claims := claimsFor("alice")
+		claims["tenant"] = "acme"
+
+		p, err := NewVerifier(tt.keys).Verify(ctx, sign(t, tt.alg, "", tt.signer, claims))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.alg, err)
+		}
+		if p.Subject != "alice" || p.Tenant != "acme" {
+			t.Errorf("%s: unexpected principal %+v", tt.alg, p)
+		}
+	}
+}
+
+// TestVerifier_Invalid проверяет отказ для поддельных, просроченных и неподходящих токенов
+func TestVerifier_Invalid(t *testing.T) {
+	ctx := context.Background()
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	der, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := New(Config{PublicKeyFile: path, Issuer: "https://issuer", Audience: "calendar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := func() map[string]interface{} {
+		c := claimsFor("alice")
+		c["iss"] = "https://issuer"
+		c["aud"] = []string{"other", "calendar"}
+		return c
+	}
+	with := func(name string, value interface{}) map[string]interface{} {
+		c := valid()
+		if value == nil {
+			delete(c, name)
+		} else {
+			c[name] = value
+		}
+		return c
+	}
+
+	if _, err = v.Verify(ctx, sign(t, RS256, "", rsaKey, valid())); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"malformed", "abc.def"},
+		{"alg none", sign(t, "none", "", []byte{}, valid())},
+		{"other key", sign(t, RS256, "", other, valid())},
+		// Открытый ключ RSA в роли общего секрета HS256
+		{"alg confusion", sign(t, HS256, "", der, valid())},
+		{"expired", sign(t, RS256, "", rsaKey, with("exp", time.Now().Add(-time.Minute).Unix()))},
+		{"no exp", sign(t, RS256, "", rsaKey, with("exp", nil))},
+		{"not yet valid", sign(t, RS256, "", rsaKey, with("nbf", time.Now().Add(time.Hour).Unix()))},
+		{"other issuer", sign(t, RS256, "", rsaKey, with("iss", "https://evil"))},
+		{"other audience", sign(t, RS256, "", rsaKey, with("aud", "other"))},
+		{"no subject", sign(t, RS256, "", rsaKey, with("sub", nil))},
+		{"invalid tenant", sign(t, RS256, "", rsaKey, with("tenant", "a/b"))},
+	}
+
+	for _, tt := range tests {
+		if _, err = v.Verify(ctx, tt.token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", tt.name, err)
+		}
+	}
+}
+
+// TestVerifier_Leeway проверяет допуск расхождения часов и настраиваемые утверждения
+func TestVerifier_Leeway(t *testing.T) {
+	secret := "secret"
+	v, err := New(Config{Secret: secret, Leeway: time.Minute, SubjectClaim: "email", TenantClaim: "org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := map[string]interface{}{"email": "a@example.com", "org": "acme", "exp": time.Now().Add(-30 * time.Second).Unix()}
+	p, err := v.Verify(context.Background(), sign(t, HS256, "", []byte(secret), claims))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Subject != "a@example.com" || p.Tenant != "acme" {
+		t.Errorf("unexpected principal %+v", p)
+	}
+
+	if _, err = New(Config{Secret: secret, JWKSURL: "http://localhost"}); err == nil {
+		t.Error("expected error for several key sources")
+	}
+	if _, err = New(Config{}); err == nil {
+		t.Error("expected error without key source")
+	}
+}
@@ -0,0 +1,277 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Алгоритмы подписи токенов
+const (
+	RS256 = "RS256"
+	ES256 = "ES256"
+	HS256 = "HS256"
+)
+
+// Настройки набора JWKS по умолчанию
+const (
+	DefaultJWKSRefresh     = time.Hour
+	DefaultJWKSMinInterval = time.Minute
+)
+
+// KeySource источник ключей проверки подписи
+type KeySource interface {
+	// Key возвращает ключ для идентификатора kid (может быть пустым) и алгоритма alg:
+	// []byte для HS256, *rsa.PublicKey для RS256 или *ecdsa.PublicKey для ES256.
+	// Если подходящего ключа нет, возвращает ErrInvalidToken
+	Key(ctx context.Context, kid, alg string) (interface{}, error)
+}
+
+// suits проверяет, что ключ key подходит алгоритму alg. Алгоритм жестко привязан к типу ключа,
+// чтобы токен HS256 нельзя было подписать открытым ключом RSA как общим секретом
+func suits(key interface{}, alg string) bool {
+	switch k := key.(type) {
+	case []byte:
+		return alg == HS256
+	case *rsa.PublicKey:
+		return alg == RS256
+	case *ecdsa.PublicKey:
+		return alg == ES256 && k.Curve == elliptic.P256()
+	default:
+		return false
+	}
+}
+
+// StaticKey источник из одного ключа, идентификатор ключа в токене не проверяется
+type StaticKey struct {
+	key interface{}
+}
+
+// NewSecretKey создает источник с общим секретом HS256
+func NewSecretKey(secret []byte) *StaticKey {
+	return &StaticKey{key: secret}
+}
+
+// ParsePublicKey создает источник с открытым ключом RSA (RS256) или EC P-256 (ES256) в формате PEM
+func ParsePublicKey(data []byte) (*StaticKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("auth: public key must be a PEM encoded PUBLIC KEY block")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("auth: %w", err)
+	}
+
+	if !suits(key, RS256) && !suits(key, ES256) {
+		return nil, errors.New("auth: public key must be RSA or EC P-256")
+	}
+
+	return &StaticKey{key: key}, nil
+}
+
+// Key реализует KeySource
+func (s *StaticKey) Key(_ context.Context, _, alg string) (interface{}, error) {
+	if !suits(s.key, alg) {
+		return nil, fmt.Errorf("%w: algorithm %s is not allowed for the key", ErrInvalidToken, alg)
+	}
+
+	return s.key, nil
+}
+
+// webKey ключ набора JWKS
+type webKey struct {
+	kid string
+	alg string // Пустой - ключ подходит любому алгоритму своего типа
+	key interface{}
+}
+
+// JWKS набор ключей, опубликованный по URL (RFC 7517).
+// Набор кэшируется и перечитывается по истечении срока Refresh, а также когда токен подписан ключом
+// с неизвестным идентификатором - так подхватываются новые ключи при ротации. Чтобы токены с чужими
+// идентификаторами не нагружали сервер ключей, набор перечитывается не чаще раза в MinInterval.
+// Если перечитать набор не удалось, используются ранее полученные ключи
+type JWKS struct {
+	URL         string
+	Client      *http.Client
+	Refresh     time.Duration
+	MinInterval time.Duration
+
+	now func() time.Time
+
+	mu        sync.Mutex
+	keys      []webKey
+	fetched   time.Time // Время последнего успешного чтения
+	attempted time.Time // Время последней попытки чтения
+	err       error     // Ошибка последней попытки, пока ключей нет
+}
+
+// NewJWKS создает набор ключей с URL url и настройками по умолчанию
+func NewJWKS(url string) *JWKS {
+	return &JWKS{
+		URL:         url,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		Refresh:     DefaultJWKSRefresh,
+		MinInterval: DefaultJWKSMinInterval,
+		now:         time.Now,
+	}
+}
+
+// Key реализует KeySource
+func (s *JWKS) Key(ctx context.Context, kid, alg string) (interface{}, error) {
+	// Чтение набора выполняется под блокировкой, чтобы одновременные запросы не читали его повторно
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	key, found := s.find(kid, alg)
+
+	stale := s.keys == nil || now.Sub(s.fetched) >= s.Refresh
+	if (stale || !found) && (s.attempted.IsZero() || now.Sub(s.attempted) >= s.MinInterval) {
+		s.attempted = now
+		keys, err := s.fetch(ctx)
+		if err == nil {
+			s.keys, s.fetched, s.err = keys, now, nil
+		} else if s.keys == nil {
+			s.err = err
+		}
+
+		key, found = s.find(kid, alg)
+	}
+
+	if !found {
+		if s.keys == nil && s.err != nil {
+			return nil, s.err
+		}
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+	}
+
+	return key, nil
+}
+
+// find ищет ключ kid, подходящий алгоритму alg. Токен без идентификатора ключа принимается,
+// только если в наборе ровно один подходящий ключ
+func (s *JWKS) find(kid, alg string) (interface{}, bool) {
+	var ret interface{}
+	n := 0
+
+	for _, k := range s.keys {
+		if kid != "" && k.kid != kid || k.alg != "" && k.alg != alg || !suits(k.key, alg) {
+			continue
+		}
+		ret = k.key
+		n++
+	}
+
+	return ret, n == 1
+}
+
+// fetch читает набор ключей. Ключи неподдерживаемых типов и не предназначенные для подписи пропускаются
+func (s *JWKS) fetch(ctx context.Context) ([]webKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("auth: jwks: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("auth: jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("auth: jwks: unexpected status %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("auth: jwks: %w", err)
+	}
+
+	keys := []webKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys = append(keys, webKey{kid: k.Kid, alg: k.Alg, key: key})
+		}
+	}
+
+	return keys, nil
+}
+
+// jsonWebKey ключ набора JWKS в формате JSON
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey возвращает открытый ключ RSA или EC P-256
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+// decodeInt разбирает целое число в base64url без дополнения
+func decodeInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("malformed integer")
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
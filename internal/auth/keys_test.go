@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// jwksServer локальный сервер ключей JWKS с подменяемым набором ключей
+type jwksServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	keys     []map[string]string
+	requests int
+}
+
+// newJWKSServer запускает сервер ключей
+func newJWKSServer(t *testing.T) *jwksServer {
+	s := &jwksServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.requests++
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": s.keys})
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// publish заменяет набор ключей сервера
+func (s *jwksServer) publish(keys ...map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys = keys
+}
+
+// count возвращает число запросов к серверу
+func (s *jwksServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+// encodeInt кодирует целое число в base64url без дополнения
+func encodeInt(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
+
+// rsaJWK возвращает открытый ключ RSA в формате JWK
+func rsaJWK(kid string, key *rsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA", "kid": kid, "use": "sig", "alg": RS256,
+		"n": encodeInt(key.N), "e": encodeInt(big.NewInt(int64(key.E))),
+	}
+}
+
+// ecJWK возвращает открытый ключ EC P-256 в формате JWK
+func ecJWK(kid string, key *ecdsa.PrivateKey) map[string]string {
+	return map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": encodeInt(key.X), "y": encodeInt(key.Y)}
+}
+
+// TestJWKS_Rotation проверяет кэширование набора и подхват новых ключей при ротации
+func TestJWKS_Rotation(t *testing.T) {
+	ctx := context.Background()
+	server := newJWKSServer(t)
+
+	first, _ := rsa.GenerateKey(rand.Reader, 2048)
+	second, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	server.publish(rsaJWK("k1", first), map[string]string{"kty": "oct", "kid": "skip", "k": "c2VjcmV0"})
+
+	now := time.Now()
+	jwks := NewJWKS(server.URL)
+	jwks.now = func() time.Time { return now }
+	v := NewVerifier(jwks)
+
+	for i := 0; i < 3; i++ {
+		if _, err := v.Verify(ctx, sign(t, RS256, "k1", first, claimsFor("alice"))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if server.count() != 1 {
+		t.Fatalf("expected cached key set, got %d requests", server.count())
+	}
+
+	// Новый ключ подхватывается по неизвестному идентификатору, но не чаще MinInterval
+	server.publish(rsaJWK("k1", first), ecJWK("k2", second))
+	token := sign(t, ES256, "k2", second, claimsFor("alice"))
+	if _, err := v.Verify(ctx, token); !errors.Is(err, ErrInvalidToken) || server.count() != 1 {
+		t.Fatalf("expected throttled refresh, got %v after %d requests", err, server.count())
+	}
+
+	now = now.Add(DefaultJWKSMinInterval)
+	if _, err := v.Verify(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+
+	// Старый ключ отозван: после срока Refresh набор перечитывается
+	server.publish(ecJWK("k2", second))
+	now = now.Add(DefaultJWKSRefresh)
+	if _, err := v.Verify(ctx, sign(t, RS256, "k1", first, claimsFor("alice"))); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected revoked key to be rejected, got %v", err)
+	}
+	if server.count() != 3 {
+		t.Errorf("expected 3 requests, got %d", server.count())
+	}
+
+	// Алгоритм токена должен подходить ключу
+	if _, err := v.Verify(ctx, sign(t, HS256, "k2", []byte("secret"), claimsFor("alice"))); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected HS256 token to be rejected, got %v", err)
+	}
+}
+
+// TestJWKS_Unavailable проверяет, что недоступный сервер ключей не выдается за неверный токен,
+// а ранее полученные ключи продолжают действовать
+func TestJWKS_Unavailable(t *testing.T) {
+	ctx := context.Background()
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	token := sign(t, RS256, "k1", key, claimsFor("alice"))
+
+	fail := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{rsaJWK("k1", key)}})
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	jwks := NewJWKS(server.URL)
+	jwks.now = func() time.Time { return now }
+	v := NewVerifier(jwks)
+
+	if _, err := v.Verify(ctx, token); err == nil || errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected key set error, got %v", err)
+	}
+
+	fail = false
+	now = now.Add(DefaultJWKSMinInterval)
+	if _, err := v.Verify(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+
+	fail = true
+	now = now.Add(DefaultJWKSRefresh)
+	if _, err := v.Verify(ctx, token); err != nil {
+		t.Errorf("expected cached key to be used, got %v", err)
+	}
+}
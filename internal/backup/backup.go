@@ -0,0 +1,483 @@
+// Пакет сохраняет события из любого хранилища в переносимый архив и загружает их обратно.
+//
+// Архив - tar, сжатый gzip, из четырех файлов: manifest.json с версией формата, числом календарей, событий и ключей API
+// и контрольными суммами, calendars.jsonl, events.jsonl и apikeys.jsonl, в которых каждая строка - календарь, событие
+// или ключ API в представлении eventjson. Архивы версии 1 не содержат calendars.jsonl, все их события - в календаре
+// по умолчанию, архивы версий 1 и 2 не содержат apikeys.jsonl.
+//
+// Архив содержит данные одного арендатора - арендатора из контекста, и загружается тоже в арендатора из контекста,
+// поэтому данные можно перенести от одного арендатора к другому.
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/storage/eventjson"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	"io"
+	"os"
+	"time"
+)
+
+// Format название формата в манифесте, отличает архив от других tar-файлов
+const Format = "go-calendar-backup"
+
+// Version текущая версия формата. Архивы более новых версий не загружаются
+const Version = 3
+
+// Файлы архива в порядке записи
+const (
+	manifestFile  = "manifest.json"
+	calendarsFile = "calendars.jsonl"
+	eventsFile    = "events.jsonl"
+	apiKeysFile   = "apikeys.jsonl"
+)
+
+// maxLineSize наибольшая длина строки с календарем, событием или ключом API в архиве
+const maxLineSize = 16 << 20
+
+// ErrInvalidArchive архив поврежден или создан не этой программой
+var ErrInvalidArchive = errors.New("backup: invalid archive")
+
+// applyError ошибка загрузки записи в хранилище: в отличие от ошибок разбора, архив в ней не виноват
+type applyError struct {
+	err error
+}
+
+func (e applyError) Error() string {
+	return e.err.Error()
+}
+
+// Manifest описание архива
+type Manifest struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Source    string    `json:"source"`           // Хранилище, из которого сделан архив
+	Tenant    string    `json:"tenant,omitempty"` // Арендатор, данные которого сохранены в архиве
+	Calendars int       `json:"calendars,omitempty"`
+	Events    int       `json:"events"`
+	SHA256    string    `json:"sha256"` // Контрольная сумма events.jsonl
+	// CalendarsSHA256 контрольная сумма calendars.jsonl
+	CalendarsSHA256 string `json:"calendars_sha256,omitempty"`
+	APIKeys         int    `json:"api_keys,omitempty"`
+	// APIKeysSHA256 контрольная сумма apikeys.jsonl
+	APIKeysSHA256 string `json:"api_keys_sha256,omitempty"`
+}
+
+// RestoreReport итог загрузки архива
+type RestoreReport struct {
+	Manifest    Manifest
+	Calendars   int // Созданные и замененные календари
+	Created     int // Новые события
+	Overwritten int // Уже существовавшие события, замененные событиями из архива
+	Skipped     int // Уже существовавшие события, оставленные без изменений
+	APIKeys     int // Созданные ключи API
+}
+
+// Write сохраняет все календари, события и ключи API арендатора из контекста в архив и возвращает его манифест.
+// Ключи сохраняются в том виде, в каком их хранит хранилище: хэш, а не сам ключ. source - название хранилища для манифеста
+func Write(ctx context.Context, w io.Writer, s usecases.Storage, source string) (*Manifest, error) {
+	calendars, err := s.FindCalendars(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Размер файла пишется в заголовок tar перед содержимым, поэтому файлы сериализуются заранее:
+	// календарей и ключей API немного, они собираются в памяти, а события пишутся во временный файл по мере выборки
+	var calendarsBuf bytes.Buffer
+	enc := json.NewEncoder(&calendarsBuf)
+	for i := range calendars {
+		if err = enc.Encode(eventjson.FromCalendar(&calendars[i])); err != nil {
+			return nil, err
+		}
+	}
+
+	keys, err := s.FindAPIKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var keysBuf bytes.Buffer
+	enc = json.NewEncoder(&keysBuf)
+	for i := range keys {
+		if err = enc.Encode(eventjson.FromAPIKey(&keys[i])); err != nil {
+			return nil, err
+		}
+	}
+
+	spool, err := os.CreateTemp("", "go-calendar-backup-*.jsonl")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	eventsHash := sha256.New()
+	events, err := writeEvents(ctx, io.MultiWriter(spool, eventsHash), s, calendars)
+	if err != nil {
+		return nil, err
+	}
+
+	eventsSize, err := spool.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = spool.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		Format:          Format,
+		Version:         Version,
+		CreatedAt:       time.Now().UTC(),
+		Source:          source,
+		Tenant:          tenant.FromContext(ctx),
+		Calendars:       len(calendars),
+		Events:          events,
+		SHA256:          hex.EncodeToString(eventsHash.Sum(nil)),
+		CalendarsSHA256: checksum(calendarsBuf.Bytes()),
+		APIKeys:         len(keys),
+		APIKeysSHA256:   checksum(keysBuf.Bytes()),
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	for _, f := range []struct {
+		name string
+		size int64
+		data io.Reader
+	}{
+		{manifestFile, int64(len(manifestData)), bytes.NewReader(manifestData)},
+		{calendarsFile, int64(calendarsBuf.Len()), &calendarsBuf},
+		{eventsFile, eventsSize, spool},
+		{apiKeysFile, int64(keysBuf.Len()), &keysBuf},
+	} {
+		header := &tar.Header{Name: f.name, Mode: 0644, Size: f.size, ModTime: manifest.CreatedAt}
+		if err = tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err = io.Copy(tw, f.data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tw.Close(); err != nil {
+		return nil, err
+	}
+	if err = gz.Close(); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// writeEvents пишет в w события календаря по умолчанию и календарей calendars по строке на событие
+// и возвращает их число. События выбираются по одному календарю, в памяти держатся только события одного календаря
+func writeEvents(ctx context.Context, w io.Writer, s usecases.Storage, calendars []entities.Calendar) (int, error) {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	// Интерфейс хранилища не перечисляет события, поэтому в каждом календаре выбираются все события до конца времен:
+	// время событий не выходит за начало нашей эры и entities.Forever (правило eventtime сценариев использования),
+	// а промежуток серии, повторения которой уходят дальше, Bounds обрезает по entities.Forever
+	ids := []entities.CalendarID{entities.DefaultCalendarID}
+	for i := range calendars {
+		ids = append(ids, calendars[i].ID)
+	}
+
+	n := 0
+	for _, id := range ids {
+		events, err := s.FindBySpan(ctx, id, time.Time{}, entities.Forever)
+		if err != nil {
+			return n, err
+		}
+
+		for i := range events {
+			if err = enc.Encode(eventjson.FromEntity(&events[i])); err != nil {
+				return n, err
+			}
+		}
+		n += len(events)
+	}
+
+	return n, bw.Flush()
+}
+
+// Restore загружает календари, события и ключи API из архива в хранилище s. Архив читается дважды: первый проход проверяет
+// его целиком (контрольные суммы, число и формат записей), поэтому поврежденный архив не оставляет в хранилище
+// часть событий, а второй загружает записи по одной, не держа архив в памяти. Архив, который нельзя перемотать
+// (например, стандартный ввод), сначала копируется во временный файл.
+// Существующие календари и события с теми же идентификаторами заменяются при overwrite, иначе остаются без изменений.
+// Новые события сохраняют версию из архива, замененные получают следующую после текущей.
+// Ключи API не изменяются, поэтому существующий ключ остается как есть, но отзыв ключа из архива переносится всегда:
+// восстановление не должно возвращать к жизни отозванный ключ
+func Restore(ctx context.Context, r io.Reader, s usecases.Storage, overwrite bool) (*RestoreReport, error) {
+	rs, cleanup, err := rewindable(r)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := read(rs, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = rs.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	report := &RestoreReport{Manifest: *manifest}
+
+	// Календари идут в архиве первыми, чтобы события не оказались в календарях, которых нет
+	restoreCalendar := func(calendar *entities.Calendar) error {
+		err := s.CreateCalendar(ctx, calendar)
+		if err == storage.EntityAlreadyExists && overwrite {
+			err = s.UpdateCalendar(ctx, calendar)
+		}
+
+		switch {
+		case err == nil:
+			report.Calendars++
+		case err != storage.EntityAlreadyExists:
+			return err
+		}
+
+		return nil
+	}
+
+	restoreEvent := func(event *entities.Event) error {
+		// Пересечения не проверяются: архив переносит данные как есть
+		err := s.Create(ctx, event)
+		switch {
+		case err == nil:
+			report.Created++
+		case err == storage.EntityAlreadyExists && overwrite:
+			// Событие из архива заменяет текущую версию, какой бы она ни была
+			current, err := s.FindByID(ctx, event.ID)
+			if err != nil {
+				return err
+			}
+			event.Version = current.Version
+			if err = s.Update(ctx, event); err != nil {
+				return err
+			}
+			report.Overwritten++
+		case err == storage.EntityAlreadyExists:
+			report.Skipped++
+		default:
+			return err
+		}
+
+		return nil
+	}
+
+	restoreAPIKey := func(key *entities.APIKey) error {
+		err := s.CreateAPIKey(ctx, key)
+		switch {
+		case err == nil:
+			report.APIKeys++
+		case err == storage.EntityAlreadyExists && key.IsRevoked():
+			// Ключ с тем же хэшем у другого арендатора этому арендатору не найти, его отзыв не переносится
+			if err = s.RevokeAPIKey(ctx, key.ID, key.Revoked); err != nil && err != storage.EntityNotFound {
+				return err
+			}
+		case err != storage.EntityAlreadyExists:
+			return err
+		}
+
+		return nil
+	}
+
+	_, err = read(rs, restoreCalendar, restoreEvent, restoreAPIKey)
+
+	return report, err
+}
+
+// rewindable возвращает r, если его можно перемотать, иначе копирует r во временный файл.
+// cleanup удаляет временный файл
+func rewindable(r io.Reader) (io.ReadSeeker, func(), error) {
+	if rs, ok := r.(io.ReadSeeker); ok {
+		// Стандартный ввод - тоже файл, но канал перемотать нельзя
+		if _, err := rs.Seek(0, io.SeekCurrent); err == nil {
+			return rs, func() {}, nil
+		}
+	}
+
+	f, err := os.CreateTemp("", "go-calendar-restore-*.tar.gz")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+
+	if _, err = io.Copy(f, r); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	return f, cleanup, nil
+}
+
+// read читает архив и проверяет его, передавая каждый календарь в onCalendar, каждое событие в onEvent,
+// а каждый ключ API в onAPIKey, если они заданы.
+// Записи передаются по мере чтения, до проверки контрольной суммы всего файла: загружать их можно только
+// из архива, уже проверенного проходом без обработчиков
+func read(r io.Reader, onCalendar func(calendar *entities.Calendar) error, onEvent func(event *entities.Event) error,
+	onAPIKey func(key *entities.APIKey) error) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+
+	// Манифест идет первым, чтобы неподдерживаемая версия отбрасывалась до чтения событий
+	header, err := tr.Next()
+	if err != nil || header.Name != manifestFile {
+		return nil, fmt.Errorf("%w: %s is missing", ErrInvalidArchive, manifestFile)
+	}
+
+	var manifest Manifest
+	if err = json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidArchive, manifestFile, err)
+	}
+	if manifest.Format != Format {
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidArchive, manifest.Format)
+	}
+	if manifest.Version < 1 || manifest.Version > Version {
+		return nil, fmt.Errorf("%w: unsupported version %d, expected up to %d", ErrInvalidArchive, manifest.Version, Version)
+	}
+
+	if manifest.Version >= 2 {
+		n, err := readFile(tr, calendarsFile, manifest.CalendarsSHA256, func(line []byte) error {
+			calendar, err := eventjson.UnmarshalCalendar(line)
+			if err != nil || onCalendar == nil {
+				return err
+			}
+			if err = onCalendar(calendar); err != nil {
+				return applyError{err}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if n != manifest.Calendars {
+			return nil, fmt.Errorf("%w: manifest lists %d calendars, archive contains %d",
+				ErrInvalidArchive, manifest.Calendars, n)
+		}
+	}
+
+	n, err := readFile(tr, eventsFile, manifest.SHA256, func(line []byte) error {
+		event, err := eventjson.Unmarshal(line)
+		if err != nil || onEvent == nil {
+			return err
+		}
+		if err = onEvent(event); err != nil {
+			return applyError{err}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if n != manifest.Events {
+		return nil, fmt.Errorf("%w: manifest lists %d events, archive contains %d", ErrInvalidArchive, manifest.Events, n)
+	}
+
+	if manifest.Version >= 3 {
+		n, err := readFile(tr, apiKeysFile, manifest.APIKeysSHA256, func(line []byte) error {
+			key, err := eventjson.UnmarshalAPIKey(line)
+			if err != nil || onAPIKey == nil {
+				return err
+			}
+			if err = onAPIKey(key); err != nil {
+				return applyError{err}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if n != manifest.APIKeys {
+			return nil, fmt.Errorf("%w: manifest lists %d API keys, archive contains %d",
+				ErrInvalidArchive, manifest.APIKeys, n)
+		}
+	}
+
+	return &manifest, nil
+}
+
+// readFile читает следующий файл архива построчно, проверяя его имя и контрольную сумму, и возвращает число строк.
+// Ошибка разбора строки в fn дополняется именем файла и номером строки, ошибка загрузки (applyError) возвращается как есть
+func readFile(tr *tar.Reader, name string, sum string, fn func(line []byte) error) (int, error) {
+	header, err := tr.Next()
+	if err != nil || header.Name != name {
+		return 0, fmt.Errorf("%w: %s is missing", ErrInvalidArchive, name)
+	}
+
+	hash := sha256.New()
+	scanner := bufio.NewScanner(io.TeeReader(tr, hash))
+	scanner.Buffer(nil, maxLineSize)
+
+	n := 0
+	for scanner.Scan() {
+		n++
+		if err = fn(scanner.Bytes()); err != nil {
+			if applyErr, ok := err.(applyError); ok {
+				return n, applyErr.err
+			}
+			return n, fmt.Errorf("%w: %s:%d: %v", ErrInvalidArchive, name, n, err)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return n, fmt.Errorf("%w: %s:%d: %v", ErrInvalidArchive, name, n+1, err)
+	}
+
+	if hex.EncodeToString(hash.Sum(nil)) != sum {
+		return n, fmt.Errorf("%w: %s: checksum mismatch", ErrInvalidArchive, name)
+	}
+
+	return n, nil
+}
+
+// checksum возвращает контрольную сумму SHA-256 в шестнадцатеричном виде
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
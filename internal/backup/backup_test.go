@@ -0,0 +1,524 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/storage/eventjson"
+	"github.com/mzelenkin/go-calendar/internal/storage/inmemory"
+	"github.com/mzelenkin/go-calendar/internal/storage/sqlite"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newEvents возвращает одиночное событие и серию с исключениями в зоне с переходом на летнее время
+func newEvents(t *testing.T) []entities.Event {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("timezone database is not available")
+	}
+
+	single, _ := entities.NewEventID("")
+	series, _ := entities.NewEventID("")
+	rule, _ := entities.ParseRecurrence("FREQ=WEEKLY;BYDAY=FR")
+	start := time.Date(2020, 3, 6, 9, 0, 0, 0, loc)
+
+	return []entities.Event{
+		{ID: single, Title: "Встреча", Start: start, End: start.Add(time.Hour), Description: "Обсуждение"},
+		{
+			ID:         series,
+			Title:      "Ретро",
+			Start:      start.Add(3 * time.Hour),
+			End:        start.Add(4 * time.Hour),
+			Recurrence: rule,
+			ExDates:    []time.Time{start.AddDate(0, 0, 7).Add(3 * time.Hour)},
+			Overrides: []entities.Override{{
+				OriginalStart: start.AddDate(0, 0, 14).Add(3 * time.Hour),
+				Title:         "Ретро (перенесено)",
+				Start:         start.AddDate(0, 0, 14).Add(5 * time.Hour),
+				End:           start.AddDate(0, 0, 14).Add(6 * time.Hour),
+			}},
+		},
+	}
+}
+
+// TestBackup_RoundTrip переносит календари и события из хранилища в памяти в SQLite
+func TestBackup_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	events := newEvents(t)
+
+	source, _ := inmemory.NewEventInMemoryStorage()
+	calendarID, _ := entities.NewCalendarID("")
+	calendar := entities.Calendar{ID: calendarID, Name: "Работа", Color: "#3366cc", Owner: "alice", Timezone: "America/New_York"}
+	if err := source.CreateCalendar(ctx, &calendar); err != nil {
+		t.Fatal(err)
+	}
+	events[1].CalendarID = calendarID
+
+	for i := range events {
+		if err := source.Create(ctx, &events[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var archive bytes.Buffer
+	manifest, err := Write(ctx, &archive, source, "memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Events != len(events) || manifest.Calendars != 1 || manifest.Source != "memory" || manifest.Version != Version {
+		t.Fatalf("unexpected manifest %+v", manifest)
+	}
+
+	target, err := sqlite.NewEventSQLiteStorage(ctx, filepath.Join(t.TempDir(), "calendar.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+
+	report, err := Restore(ctx, bytes.NewReader(archive.Bytes()), target, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != len(events) || report.Calendars != 1 || report.Manifest.SHA256 != manifest.SHA256 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	restored, err := target.FindCalendarByID(ctx, calendarID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*restored, calendar) {
+		t.Errorf("calendar restored as %+v", restored)
+	}
+
+	for i := range events {
+		found, err := target.FindByID(ctx, events[i].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := events[i].Occurrences(events[i].Start, events[i].Start.AddDate(0, 1, 0))
+		got := found.Occurrences(events[i].Start, events[i].Start.AddDate(0, 1, 0))
+		if found.Title != events[i].Title || !found.CalendarID.Equal(events[i].CalendarID) || found.Start.Location().String() != "America/New_York" || !reflect.DeepEqual(utc(got), utc(want)) {
+			t.Errorf("event %s restored as %+v", events[i].Title, found)
+		}
+	}
+}
+
+// TestBackup_EdgesOfTime проверяет, что в архив попадают события на границах времени: начинающееся в начале нашей эры,
+// заканчивающееся в entities.Forever и серия, повторения которой по правилу уходят за entities.Forever
+func TestBackup_EdgesOfTime(t *testing.T) {
+	ctx := context.Background()
+
+	first, _ := entities.NewEventID("")
+	last, _ := entities.NewEventID("")
+	long, _ := entities.NewEventID("")
+	start := time.Date(2020, 5, 12, 10, 0, 0, 0, time.UTC)
+	events := []entities.Event{
+		{ID: first, Title: "Первое", Start: time.Time{}, End: time.Time{}.Add(time.Hour)},
+		{ID: last, Title: "Последнее", Start: entities.Forever.Add(-time.Hour), End: entities.Forever},
+		{
+			ID:         long,
+			Title:      "Раз в сто лет",
+			Start:      start,
+			End:        start.Add(time.Hour),
+			Recurrence: &entities.Recurrence{Freq: entities.Yearly, Interval: 100, Count: entities.MaxCount},
+		},
+	}
+
+	memory, _ := inmemory.NewEventInMemoryStorage()
+	file, err := sqlite.NewEventSQLiteStorage(ctx, filepath.Join(t.TempDir(), "calendar.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	for name, source := range map[string]usecases.Storage{"memory": memory, "sqlite": file} {
+		t.Run(name, func(t *testing.T) {
+			for i := range events {
+				event := events[i]
+				if err := source.Create(ctx, &event); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			manifest, err := Write(ctx, io.Discard, source, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if manifest.Events != len(events) {
+				t.Fatalf("expected %d events in the archive, got %d", len(events), manifest.Events)
+			}
+		})
+	}
+}
+
+// TestBackup_APIKeys переносит ключи API вместе с отзывом: ключ действует в новом хранилище,
+// а отозванный в источнике ключ отзывается и там, где он уже был восстановлен
+func TestBackup_APIKeys(t *testing.T) {
+	ctx := tenant.NewContext(context.Background(), "alice")
+
+	source, _ := inmemory.NewEventInMemoryStorage()
+	keys := usecases.NewAPIKeyUsecases(source)
+	active, err := keys.Create(ctx, &usecases.CreateAPIKeyRequest{Name: "reports", Scopes: []string{entities.ScopeEventsRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := keys.Create(ctx, &usecases.CreateAPIKeyRequest{Name: "sync", Scopes: []string{entities.ScopeEventsWrite}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedID, _ := entities.NewAPIKeyID(revoked.ID)
+	if err = keys.Revoke(ctx, revokedID); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	manifest, err := Write(ctx, &archive, source, "memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.APIKeys != 2 {
+		t.Fatalf("unexpected manifest %+v", manifest)
+	}
+
+	target, err := sqlite.NewEventSQLiteStorage(ctx, filepath.Join(t.TempDir(), "calendar.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+
+	report, err := Restore(ctx, bytes.NewReader(archive.Bytes()), target, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.APIKeys != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	targetKeys := usecases.NewAPIKeyUsecases(target)
+	if key, err := targetKeys.Authenticate(context.Background(), active.Key); err != nil || key.Tenant != "alice" {
+		t.Fatalf("restored key must authenticate in tenant alice, got %+v, %v", key, err)
+	}
+	if _, err = targetKeys.Authenticate(context.Background(), revoked.Key); err != usecases.ErrorInvalidAPIKey {
+		t.Fatalf("revoked key must stay revoked, got %v", err)
+	}
+
+	// Ключ отозван в источнике после восстановления
+	activeID, _ := entities.NewAPIKeyID(active.ID)
+	if err = keys.Revoke(ctx, activeID); err != nil {
+		t.Fatal(err)
+	}
+	archive.Reset()
+	if _, err = Write(ctx, &archive, source, "memory"); err != nil {
+		t.Fatal(err)
+	}
+
+	if report, err = Restore(ctx, bytes.NewReader(archive.Bytes()), target, false); err != nil {
+		t.Fatal(err)
+	}
+	if report.APIKeys != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if _, err = targetKeys.Authenticate(context.Background(), active.Key); err != usecases.ErrorInvalidAPIKey {
+		t.Fatalf("key revoked in the archive must be revoked, got %v", err)
+	}
+}
+
+// TestRestore_Stream проверяет загрузку из потока, который нельзя перемотать, как стандартный ввод
+func TestRestore_Stream(t *testing.T) {
+	ctx := context.Background()
+	events := newEvents(t)
+
+	source, _ := inmemory.NewEventInMemoryStorage()
+	for i := range events {
+		if err := source.Create(ctx, &events[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var archive bytes.Buffer
+	if _, err := Write(ctx, &archive, source, "memory"); err != nil {
+		t.Fatal(err)
+	}
+
+	target, _ := inmemory.NewEventInMemoryStorage()
+	report, err := Restore(ctx, io.MultiReader(&archive), target, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != len(events) {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
+// TestBackup_Tenants проверяет, что в архив попадают данные только одного арендатора,
+// а загружаются они в арендатора из контекста
+func TestBackup_Tenants(t *testing.T) {
+	alice := tenant.NewContext(context.Background(), "alice")
+	bob := tenant.NewContext(context.Background(), "bob")
+	events := newEvents(t)
+
+	source, _ := inmemory.NewEventInMemoryStorage()
+	if err := source.Create(alice, &events[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.Create(context.Background(), &events[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	manifest, err := Write(alice, &archive, source, "memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Events != 1 || manifest.Tenant != "alice" {
+		t.Fatalf("unexpected manifest %+v", manifest)
+	}
+
+	target, _ := inmemory.NewEventInMemoryStorage()
+	if _, err = Restore(bob, bytes.NewReader(archive.Bytes()), target, false); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := target.FindByID(bob, events[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Tenant != "bob" {
+		t.Errorf("event restored into tenant %q", found.Tenant)
+	}
+	if _, err = target.FindByID(alice, events[0].ID); err != storage.EntityNotFound {
+		t.Errorf("event must not be restored into the source tenant, got %v", err)
+	}
+}
+
+// utc переводит время повторений в UTC для сравнения
+func utc(list []entities.Occurrence) []entities.Occurrence {
+	for i := range list {
+		list[i].Start, list[i].End, list[i].OriginalStart = list[i].Start.UTC(), list[i].End.UTC(), list[i].OriginalStart.UTC()
+	}
+
+	return list
+}
+
+// TestRestore_Existing проверяет загрузку в хранилище, где события уже есть
+func TestRestore_Existing(t *testing.T) {
+	ctx := context.Background()
+	events := newEvents(t)
+
+	source, _ := inmemory.NewEventInMemoryStorage()
+	for i := range events {
+		if err := source.Create(ctx, &events[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var archive bytes.Buffer
+	if _, err := Write(ctx, &archive, source, "memory"); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := events[0]
+	changed.Title = "Измененная встреча"
+	if err := source.Update(ctx, &changed); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Restore(ctx, bytes.NewReader(archive.Bytes()), source, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Skipped != 2 || report.Created != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if found, _ := source.FindByID(ctx, changed.ID); found.Title != changed.Title {
+		t.Errorf("existing event must be kept, got %q", found.Title)
+	}
+
+	if report, err = Restore(ctx, bytes.NewReader(archive.Bytes()), source, true); err != nil {
+		t.Fatal(err)
+	}
+	if report.Overwritten != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if found, _ := source.FindByID(ctx, changed.ID); found.Title != events[0].Title {
+		t.Errorf("existing event must be overwritten, got %q", found.Title)
+	}
+}
+
+// writeArchive собирает архив из манифеста и содержимого events.jsonl.
+// Пустой calendars.jsonl добавляется в архивы версии 2 и новее, пустой apikeys.jsonl - версии 3 и новее
+func writeArchive(t *testing.T, manifest Manifest, events string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	data, _ := json.Marshal(manifest)
+	type file struct {
+		name string
+		data []byte
+	}
+	files := []file{{manifestFile, data}}
+	if manifest.Version >= 2 {
+		files = append(files, file{calendarsFile, nil})
+	}
+	files = append(files, file{eventsFile, []byte(events)})
+	if manifest.Version >= 3 {
+		files = append(files, file{apiKeysFile, nil})
+	}
+
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tw.Close()
+	gz.Close()
+
+	return buf.Bytes()
+}
+
+// TestRestore_Invalid проверяет, что поврежденный архив не загружает ни одного события
+func TestRestore_Invalid(t *testing.T) {
+	ctx := context.Background()
+	events := newEvents(t)
+
+	source, _ := inmemory.NewEventInMemoryStorage()
+	for i := range events {
+		if err := source.Create(ctx, &events[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var archive bytes.Buffer
+	manifest, err := Write(ctx, &archive, source, "memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Содержимое events.jsonl из настоящего архива
+	var lines bytes.Buffer
+	_, err = read(bytes.NewReader(archive.Bytes()), nil, func(event *entities.Event) error {
+		data, _ := json.Marshal(eventjson.FromEntity(event))
+		lines.Write(append(data, '\n'))
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := lines.String()
+
+	newer := *manifest
+	newer.Version = Version + 1
+	foreign := *manifest
+	foreign.Format = "other"
+	miscounted := *manifest
+	miscounted.Events++
+	calendarsMiscounted := *manifest
+	calendarsMiscounted.Calendars++
+	keysMiscounted := *manifest
+	keysMiscounted.APIKeys++
+
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"not gzip", []byte("not an archive"), "invalid archive"},
+		{"newer version", writeArchive(t, newer, content), "unsupported version"},
+		{"foreign format", writeArchive(t, foreign, content), "unknown format"},
+		{"checksum", writeArchive(t, *manifest, strings.Replace(content, "Встреча", "Встреча!", 1)), "checksum"},
+		{"events count", writeArchive(t, miscounted, content), "manifest lists"},
+		{"calendars count", writeArchive(t, calendarsMiscounted, content), "manifest lists"},
+		{"api keys count", writeArchive(t, keysMiscounted, content), "manifest lists"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, _ := inmemory.NewEventInMemoryStorage()
+
+			_, err := Restore(ctx, bytes.NewReader(tt.data), target, false)
+			if !errors.Is(err, ErrInvalidArchive) || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected ErrInvalidArchive with %q, got %v", tt.err, err)
+			}
+
+			if found, _ := target.FindBySpan(ctx, entities.DefaultCalendarID, time.Time{}, entities.Forever); len(found) != 0 {
+				t.Errorf("invalid archive must not restore events, got %d", len(found))
+			}
+		})
+	}
+}
+
+// TestRestore_Version1 проверяет загрузку архива версии 1 без календарей: события попадают в календарь по умолчанию
+func TestRestore_Version1(t *testing.T) {
+	ctx := context.Background()
+	events := newEvents(t)
+
+	var lines bytes.Buffer
+	for i := range events {
+		data, _ := json.Marshal(eventjson.FromEntity(&events[i]))
+		lines.Write(append(data, '\n'))
+	}
+
+	sum := sha256.Sum256(lines.Bytes())
+	manifest := Manifest{Format: Format, Version: 1, Events: len(events), SHA256: hex.EncodeToString(sum[:])}
+
+	target, _ := inmemory.NewEventInMemoryStorage()
+	report, err := Restore(ctx, bytes.NewReader(writeArchive(t, manifest, lines.String())), target, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != len(events) || report.Calendars != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	found, err := target.FindBySpan(ctx, entities.DefaultCalendarID, time.Time{}, entities.Forever)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != len(events) {
+		t.Fatalf("expected %d events in the default calendar, got %d", len(events), len(found))
+	}
+}
+
+// TestRestore_Version2 проверяет загрузку архива версии 2 без ключей API
+func TestRestore_Version2(t *testing.T) {
+	ctx := context.Background()
+	events := newEvents(t)
+
+	var lines bytes.Buffer
+	for i := range events {
+		data, _ := json.Marshal(eventjson.FromEntity(&events[i]))
+		lines.Write(append(data, '\n'))
+	}
+
+	manifest := Manifest{Format: Format, Version: 2, Events: len(events), SHA256: checksum(lines.Bytes()), CalendarsSHA256: checksum(nil)}
+
+	target, _ := inmemory.NewEventInMemoryStorage()
+	report, err := Restore(ctx, bytes.NewReader(writeArchive(t, manifest, lines.String())), target, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != len(events) || report.APIKeys != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
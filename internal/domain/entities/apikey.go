@@ -0,0 +1,71 @@
+package entities
+
+import (
+	"github.com/satori/go.uuid"
+	"time"
+)
+
+// Разрешения ключей API
+const (
+	ScopeEventsRead     = "events:read"
+	ScopeEventsWrite    = "events:write"
+	ScopeCalendarsRead  = "calendars:read"
+	ScopeCalendarsWrite = "calendars:write"
+)
+
+// Scopes все разрешения ключей API
+var Scopes = []string{ScopeEventsRead, ScopeEventsWrite, ScopeCalendarsRead, ScopeCalendarsWrite}
+
+// APIKeyID уникальный идентификатор ключа API
+type APIKeyID struct {
+	value uuid.UUID
+}
+
+// NewAPIKeyID конструктор идентификатора ключа API. Пустая строка - новый идентификатор
+func NewAPIKeyID(id string) (APIKeyID, error) {
+	if id == "" {
+		return APIKeyID{value: uuid.NewV4()}, nil
+	}
+
+	value, err := uuid.FromString(id)
+
+	return APIKeyID{value: value}, err
+}
+
+func (k APIKeyID) String() string {
+	return k.value.String()
+}
+
+// Equal сравнение ID с другим. Возвращает true если идентификаторы равны
+func (k APIKeyID) Equal(other APIKeyID) bool {
+	return uuid.Equal(k.value, other.value)
+}
+
+// APIKey ключ API для доступа других сервисов к данным арендатора.
+// Сам ключ выдается один раз при создании и не хранится: хранилище знает только его хэш
+type APIKey struct {
+	ID      APIKeyID
+	Name    string   // Назначение ключа, например имя сервиса
+	Prefix  string   // Начало ключа, по нему ключ узнают в списке
+	Hash    string   // SHA-256 ключа в hex
+	Scopes  []string // Разрешения ключа
+	Tenant  string   // Арендатор, хранилище берет его из контекста при создании (см. пакет tenant)
+	Created time.Time
+	Revoked time.Time // Время отзыва, нулевое - ключ действует
+}
+
+// IsRevoked проверяет, что ключ отозван
+func (k APIKey) IsRevoked() bool {
+	return !k.Revoked.IsZero()
+}
+
+// Allows проверяет, что у ключа есть разрешение scope
+func (k APIKey) Allows(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,66 @@
+package entities
+
+import (
+	"github.com/satori/go.uuid"
+	"time"
+)
+
+// CalendarID уникальный идентификатор календаря
+// Нулевой идентификатор (DefaultCalendarID) - календарь по умолчанию: в нем лежат события,
+// созданные без указания календаря, в том числе до появления календарей
+type CalendarID struct {
+	value uuid.UUID
+}
+
+// DefaultCalendarID идентификатор календаря по умолчанию
+var DefaultCalendarID = CalendarID{}
+
+// NewCalendarID конструктор идентификатора календаря. Пустая строка - новый идентификатор
+func NewCalendarID(id string) (CalendarID, error) {
+	if id == "" {
+		return CalendarID{value: uuid.NewV4()}, nil
+	}
+
+	value, err := uuid.FromString(id)
+
+	return CalendarID{value: value}, err
+}
+
+func (c CalendarID) String() string {
+	return c.value.String()
+}
+
+// Equal сравнение ID с другим. Возвращает true если идентификаторы равны
+func (c CalendarID) Equal(other CalendarID) bool {
+	return uuid.Equal(c.value, other.value)
+}
+
+// IsDefault проверяет, что это идентификатор календаря по умолчанию
+func (c CalendarID) IsDefault() bool {
+	return uuid.Equal(c.value, uuid.Nil)
+}
+
+// Calendar календарь - именованный набор событий одного владельца
+// Пересечения событий проверяются только внутри календаря: события разных календарей друг другу не мешают
+type Calendar struct {
+	ID       CalendarID
+	Name     string
+	Color    string // Цвет в интерфейсе, #rrggbb
+	Owner    string // Идентификатор владельца
+	Timezone string // Зона IANA, в которой по умолчанию понимаются даты календаря, пустая - зона сервера
+	Tenant   string // Арендатор, хранилище берет его из контекста при создании (см. пакет tenant)
+}
+
+// Location возвращает зону календаря. Неизвестная зона (ее могли удалить из базы зон) заменяется зоной сервера
+func (c Calendar) Location() *time.Location {
+	if c.Timezone == "" {
+		return time.Local
+	}
+
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.Local
+	}
+
+	return loc
+}
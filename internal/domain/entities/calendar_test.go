@@ -0,0 +1,42 @@
+package entities
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCalendarID_Default проверяет, что нулевой идентификатор разбирается в календарь по умолчанию
+func TestCalendarID_Default(t *testing.T) {
+	id, err := NewCalendarID(DefaultCalendarID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !id.IsDefault() || !id.Equal(DefaultCalendarID) {
+		t.Errorf("expected default calendar, got %s", id)
+	}
+
+	id, err = NewCalendarID("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.IsDefault() {
+		t.Error("new calendar ID must not be default")
+	}
+
+	if _, err = NewCalendarID("calendar"); err == nil {
+		t.Error("expected error for a malformed ID")
+	}
+}
+
+// TestCalendar_Location проверяет зону календаря
+func TestCalendar_Location(t *testing.T) {
+	if loc := (Calendar{Timezone: "Europe/Moscow"}).Location(); loc.String() != "Europe/Moscow" {
+		t.Errorf("expected Europe/Moscow, got %s", loc)
+	}
+
+	for _, tz := range []string{"", "Mars/Olympus"} {
+		if loc := (Calendar{Timezone: tz}).Location(); loc != time.Local {
+			t.Errorf("%q: expected local zone, got %s", tz, loc)
+		}
+	}
+}
@@ -1,14 +1,207 @@
 package entities
 
 import (
+	"sort"
 	"time"
 )
 
+// Forever верхняя граница бесконечной серии повторяющихся событий
+var Forever = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+
+// ConflictHorizon горизонт проверки пересечений двух бесконечных серий.
+// Пересечения дальше этого срока от начала более поздней серии не ищутся
+const ConflictHorizon = 2 * 365 * 24 * time.Hour
+
 // Event событие в календаре
+// Если задано правило Recurrence, то Start и End описывают первое повторение серии,
+// а ExDates и Overrides - исключения из серии (см. exception.go)
 type Event struct {
 	ID          EventID
+	CalendarID  CalendarID // Календарь события, задается при создании и больше не меняется
+	Tenant      string     // Арендатор, хранилище берет его из контекста при создании (см. пакет tenant)
 	Title       string
 	Start       time.Time
 	End         time.Time
 	Description string
+	Recurrence  *Recurrence
+	ExDates     []time.Time // Исходные начала отмененных повторений (EXDATE)
+	Overrides   []Override  // Измененные повторения
+	Version     int64       // Версия: 1 при создании, хранилище увеличивает ее при каждом изменении
+}
+
+// Occurrence одно повторение события
+type Occurrence struct {
+	OriginalStart time.Time // Начало повторения по правилу серии, по нему повторение адресуется при изменении
+	Start         time.Time
+	End           time.Time
+	Title         string
+	Description   string
+}
+
+// Bounds возвращает промежуток, который занимает событие вместе со всеми повторениями.
+// Для бесконечной серии end равен Forever, для более длинных конечных серий end не превышает Forever
+func (e Event) Bounds() (start, end time.Time) {
+	if e.Recurrence == nil {
+		return e.Start, e.End
+	}
+
+	start = e.Start
+
+	duration := e.End.Sub(e.Start)
+
+	switch {
+	case !e.Recurrence.Until.IsZero():
+		// Последнее повторение начинается не позже UNTIL
+		end = e.Recurrence.Until.Add(duration)
+	case e.Recurrence.Count > 0:
+		e.Recurrence.iterate(e.Start, func(t time.Time) bool {
+			end = t.Add(duration)
+			return end.Before(Forever)
+		})
+	default:
+		end = Forever
+	}
+
+	if end.Before(e.End) {
+		end = e.End
+	}
+
+	// Измененные повторения могут быть перенесены за пределы серии
+	for _, o := range e.Overrides {
+		if o.Start.Before(start) {
+			start = o.Start
+		}
+		if o.End.After(end) {
+			end = o.End
+		}
+	}
+
+	if end.After(Forever) {
+		end = Forever
+	}
+
+	return start, end
+}
+
+// Occurrences возвращает по порядку повторения события, пересекающиеся с промежутком start..end
+// Для обычного события это само событие, если оно попадает в промежуток
+func (e Event) Occurrences(start, end time.Time) []Occurrence {
+	var ret []Occurrence
+
+	if e.Recurrence == nil {
+		if overlaps(start, end, e.Start, e.End) {
+			ret = append(ret, e.occurrence(e.Start))
+		}
+		return ret
+	}
+
+	e.Recurrence.iterate(e.Start, func(t time.Time) bool {
+		if !t.Before(end) {
+			return false
+		}
+
+		// Отмененные и измененные повторения пропускаем
+		if e.isExcluded(t) || e.override(t) != nil {
+			return true
+		}
+
+		if o := e.occurrence(t); overlaps(start, end, o.Start, o.End) {
+			ret = append(ret, o)
+		}
+
+		return true
+	})
+
+	// Измененные повторения проверяем отдельно, т.к. их могли перенести из-за пределов промежутка
+	for _, v := range e.Overrides {
+		if !e.isExcluded(v.OriginalStart) && overlaps(start, end, v.Start, v.End) {
+			ret = append(ret, v.occurrence())
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Start.Before(ret[j].Start)
+	})
+
+	return ret
+}
+
+// occurrence возвращает неизмененное повторение серии, начинающееся в t
+func (e Event) occurrence(t time.Time) Occurrence {
+	return Occurrence{
+		OriginalStart: t,
+		Start:         t,
+		End:           t.Add(e.End.Sub(e.Start)),
+		Title:         e.Title,
+		Description:   e.Description,
+	}
+}
+
+// Conflicts проверяет, пересекается ли хотя бы одно повторение события с каким-либо повторением other
+func (e Event) Conflicts(other Event) bool {
+	start1, end1 := e.Bounds()
+	start2, end2 := other.Bounds()
+
+	if !overlaps(start1, end1, start2, end2) {
+		return false
+	}
+
+	// Ищем пересечения только на общем промежутке обоих событий
+	from := start1
+	if start2.After(from) {
+		from = start2
+	}
+
+	to := end1
+	if end2.Before(to) {
+		to = end2
+	}
+
+	if horizon := from.Add(ConflictHorizon); to.After(horizon) {
+		to = horizon
+	}
+
+	return occurrencesOverlap(e.Occurrences(from, to), other.Occurrences(from, to))
+}
+
+// occurrencesOverlap проверяет, пересекается ли какое-либо повторение из a с каким-либо повторением из b.
+// Оба списка должны быть упорядочены по началу. Из-за измененных повторений длительности внутри списка
+// могут различаться, поэтому идем по объединенному списку и держим для каждой стороны повторения,
+// которые еще не закончились
+func occurrencesOverlap(a, b []Occurrence) bool {
+	var active [2][]Occurrence
+
+	for i, j := 0, 0; i < len(a) || j < len(b); {
+		var o Occurrence
+		var side int
+
+		if j == len(b) || i < len(a) && !b[j].Start.Before(a[i].Start) {
+			o, side = a[i], 0
+			i++
+		} else {
+			o, side = b[j], 1
+			j++
+		}
+
+		other := active[1-side][:0]
+		for _, v := range active[1-side] {
+			if !v.End.After(o.Start) {
+				continue // закончилось до начала текущего, дальше тоже не пересечется
+			}
+			if overlaps(o.Start, o.End, v.Start, v.End) {
+				return true
+			}
+			other = append(other, v)
+		}
+
+		active[1-side] = other
+		active[side] = append(active[side], o)
+	}
+
+	return false
+}
+
+// overlaps проверяет пересечение двух диапазонов дат
+func overlaps(start1, end1, start2, end2 time.Time) bool {
+	return start1.Before(end2) && end1.After(start2)
 }
@@ -8,6 +8,20 @@ type EventID struct {
 	value uuid.UUID
 }
 
+// uidNamespace пространство имен UUID v5 для идентификаторов, полученных из внешних UID
+var uidNamespace = uuid.Must(uuid.FromString("3f1f5c2e-8a4b-5d7e-9c61-2b0d4e8f7a13"))
+
+// NewEventIDFromUID возвращает идентификатор события для внешнего UID (например, из iCalendar)
+// UID в формате UUID используется как есть, иначе идентификатор детерминированно выводится из UID,
+// так что повторный импорт того же UID дает тот же идентификатор
+func NewEventIDFromUID(uid string) EventID {
+	if id, err := uuid.FromString(uid); err == nil {
+		return EventID{value: id}
+	}
+
+	return EventID{value: uuid.NewV5(uidNamespace, uid)}
+}
+
 // NewEventID конструктор идентификатора события
 func NewEventID(id string) (EventID, error) {
 	var err error
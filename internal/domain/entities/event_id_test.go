@@ -47,3 +47,17 @@ func TestEventID_Equal_Similar(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// TestEventID_FromUID проверяет получение идентификатора из внешнего UID
+func TestEventID_FromUID(t *testing.T) {
+	uid1 := NewEventIDFromUID("040000008200E00074C5B7101A82E008@example.com")
+	uid2 := NewEventIDFromUID("040000008200E00074C5B7101A82E008@example.com")
+	if !uid1.Equal(uid2) {
+		t.Error("the same UID must give the same ID")
+	}
+
+	uuid := "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	if NewEventIDFromUID(uuid).String() != uuid {
+		t.Error("UUID must be used as is")
+	}
+}
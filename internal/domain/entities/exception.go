@@ -0,0 +1,234 @@
+package entities
+
+import (
+	"time"
+)
+
+// Override измененное повторение серии (аналог VEVENT с RECURRENCE-ID из RFC 5545)
+// Повторение идентифицируется исходным началом OriginalStart, остальные поля заменяют значения серии
+type Override struct {
+	OriginalStart time.Time
+	Title         string
+	Start         time.Time
+	End           time.Time
+	Description   string
+}
+
+// occurrence возвращает измененное повторение
+func (o Override) occurrence() Occurrence {
+	return Occurrence{
+		OriginalStart: o.OriginalStart,
+		Start:         o.Start,
+		End:           o.End,
+		Title:         o.Title,
+		Description:   o.Description,
+	}
+}
+
+// HasOccurrence проверяет, что серия по своему правилу порождает повторение с началом originalStart
+// и это повторение не отменено
+func (e Event) HasOccurrence(originalStart time.Time) bool {
+	if e.Recurrence == nil {
+		return e.Start.Equal(originalStart)
+	}
+
+	if e.isExcluded(originalStart) {
+		return false
+	}
+
+	found := false
+	e.Recurrence.iterate(e.Start, func(t time.Time) bool {
+		found = t.Equal(originalStart)
+		return t.Before(originalStart)
+	})
+
+	return found
+}
+
+// Exclude отменяет повторение серии с исходным началом originalStart
+func (e *Event) Exclude(originalStart time.Time) {
+	e.removeOverride(originalStart)
+
+	if !e.isExcluded(originalStart) {
+		// Копируем, чтобы не затронуть другие копии события, разделяющие с ним память
+		e.ExDates = append(append([]time.Time(nil), e.ExDates...), originalStart)
+	}
+}
+
+// SetOverride изменяет одно повторение серии, заменяя прежние изменения этого повторения
+func (e *Event) SetOverride(o Override) {
+	e.removeOverride(o.OriginalStart)
+	e.Overrides = append(e.Overrides, o)
+}
+
+// Truncate завершает серию перед повторением с исходным началом originalStart.
+// Исключения, относящиеся к отброшенным повторениям, удаляются
+func (e *Event) Truncate(originalStart time.Time) {
+	if e.Recurrence == nil {
+		return
+	}
+
+	r := *e.Recurrence
+	r.Count = 0
+	r.Until = originalStart.Add(-time.Nanosecond)
+	e.Recurrence = &r
+
+	var exDates []time.Time
+	for _, t := range e.ExDates {
+		if t.Before(originalStart) {
+			exDates = append(exDates, t)
+		}
+	}
+	e.ExDates = exDates
+
+	var overrides []Override
+	for _, o := range e.Overrides {
+		if o.OriginalStart.Before(originalStart) {
+			overrides = append(overrides, o)
+		}
+	}
+	e.Overrides = overrides
+}
+
+// Split разделяет серию на две: текущая завершается перед повторением originalStart,
+// а возвращаемая серия (без идентификатора) содержит это и все последующие повторения вместе с их исключениями
+func (e *Event) Split(originalStart time.Time) Event {
+	tail := *e
+	tail.ID = EventID{}
+	tail.Start = originalStart
+	tail.End = originalStart.Add(e.End.Sub(e.Start))
+	tail.ExDates = nil
+	tail.Overrides = nil
+
+	if e.Recurrence != nil {
+		r := *e.Recurrence
+
+		// Повторения до точки разделения уже израсходовали часть COUNT
+		if r.Count > 0 {
+			n := 0
+			r.iterate(e.Start, func(t time.Time) bool {
+				if !t.Before(originalStart) {
+					return false
+				}
+				n++
+				return true
+			})
+			r.Count -= n
+		}
+
+		tail.Recurrence = &r
+	}
+
+	for _, t := range e.ExDates {
+		if !t.Before(originalStart) {
+			tail.ExDates = append(tail.ExDates, t)
+		}
+	}
+
+	for _, o := range e.Overrides {
+		if !o.OriginalStart.Before(originalStart) {
+			tail.Overrides = append(tail.Overrides, o)
+		}
+	}
+
+	e.Truncate(originalStart)
+
+	return tail
+}
+
+// Shift сдвигает серию вместе с ее исключениями на delta, а длительность повторений устанавливает в duration.
+// Дни недели BYDAY без порядковых номеров сдвигаются вместе с началом серии, остальные части правила не меняются:
+// допустимость сдвига проверяет CanShift. Измененные повторения сохраняют свое время, сдвигается только их привязка к серии
+func (e *Event) Shift(delta, duration time.Duration) {
+	days := e.shiftDays(delta)
+
+	e.Start = e.Start.Add(delta)
+	e.End = e.Start.Add(duration)
+
+	var exDates []time.Time
+	for _, t := range e.ExDates {
+		exDates = append(exDates, t.Add(delta))
+	}
+	e.ExDates = exDates
+
+	var overrides []Override
+	for _, o := range e.Overrides {
+		o.OriginalStart = o.OriginalStart.Add(delta)
+		overrides = append(overrides, o)
+	}
+	e.Overrides = overrides
+
+	if e.Recurrence == nil {
+		return
+	}
+
+	r := *e.Recurrence
+	if !r.Until.IsZero() {
+		r.Until = r.Until.Add(delta)
+	}
+	if days%7 != 0 && !r.hasNumberedByDay() {
+		byDay := make([]WeekdayNum, len(r.ByDay))
+		for i, wd := range r.ByDay {
+			wd.Day = time.Weekday(((int(wd.Day)+days)%7 + 7) % 7)
+			byDay[i] = wd
+		}
+		r.ByDay = byDay
+	}
+	e.Recurrence = &r
+}
+
+// CanShift проверяет, что правило повторения сдвигается на delta вместе с началом серии. Дни месяца BYMONTHDAY
+// и дни недели BYDAY с порядковыми номерами (1MO - первый понедельник) сдвиг на другой день не переносит:
+// первое повторение ушло бы на новый день, а остальные остались бы на прежних
+func (e Event) CanShift(delta time.Duration) bool {
+	if e.Recurrence == nil || e.shiftDays(delta) == 0 {
+		return true
+	}
+
+	return len(e.Recurrence.ByMonthDay) == 0 && !e.Recurrence.hasNumberedByDay()
+}
+
+// shiftDays возвращает число календарных дней, на которое сдвиг delta переносит начало серии
+func (e Event) shiftDays(delta time.Duration) int {
+	y, m, d := e.Start.Date()
+	from := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	y, m, d = e.Start.Add(delta).Date()
+	to := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+
+	return int(to.Sub(from) / (24 * time.Hour))
+}
+
+// isExcluded проверяет, отменено ли повторение с исходным началом t
+func (e Event) isExcluded(t time.Time) bool {
+	for _, v := range e.ExDates {
+		if v.Equal(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// override возвращает изменение повторения с исходным началом t или nil
+func (e Event) override(t time.Time) *Override {
+	for i := range e.Overrides {
+		if e.Overrides[i].OriginalStart.Equal(t) {
+			return &e.Overrides[i]
+		}
+	}
+
+	return nil
+}
+
+// removeOverride удаляет изменение повторения с исходным началом t
+// Срез копируется, чтобы не затронуть другие копии события, разделяющие с ним память
+func (e *Event) removeOverride(t time.Time) {
+	var overrides []Override
+	for _, o := range e.Overrides {
+		if !o.OriginalStart.Equal(t) {
+			overrides = append(overrides, o)
+		}
+	}
+
+	e.Overrides = overrides
+}
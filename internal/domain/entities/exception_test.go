@@ -0,0 +1,146 @@
+package entities
+
+import (
+	"testing"
+	"time"
+)
+
+// newWeekly создает еженедельную серию по понедельникам начиная с 6 января 2020
+func newWeekly(t *testing.T, rule string) Event {
+	r, err := ParseRecurrence(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2020, 1, 6, 10, 0, 0, 0, time.UTC)
+	return Event{Title: "Стендап", Start: start, End: start.Add(time.Hour), Recurrence: r}
+}
+
+// januaryStarts возвращает начала повторений события в январе 2020
+func januaryStarts(e Event) []time.Time {
+	var ret []time.Time
+	for _, o := range e.Occurrences(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		ret = append(ret, o.Start)
+	}
+
+	return ret
+}
+
+// TestEvent_Exclude проверяет отмену повторения
+func TestEvent_Exclude(t *testing.T) {
+	e := newWeekly(t, "FREQ=WEEKLY")
+	second := e.Start.AddDate(0, 0, 7)
+
+	e.Exclude(second)
+
+	starts := januaryStarts(e)
+	if len(starts) != 3 {
+		t.Fatalf("expected 3 occurrences, got %v", starts)
+	}
+	for _, s := range starts {
+		if s.Equal(second) {
+			t.Fatal("excluded occurrence is still listed")
+		}
+	}
+
+	if e.HasOccurrence(second) || !e.HasOccurrence(e.Start) || e.HasOccurrence(e.Start.Add(time.Hour)) {
+		t.Error("unexpected HasOccurrence result")
+	}
+}
+
+// TestEvent_SetOverride проверяет перенос одного повторения, в том числе за пределы промежутка выборки
+func TestEvent_SetOverride(t *testing.T) {
+	e := newWeekly(t, "FREQ=WEEKLY;COUNT=4")
+	last := e.Start.AddDate(0, 0, 21)
+	moved := time.Date(2020, 2, 3, 12, 0, 0, 0, time.UTC)
+
+	e.SetOverride(Override{OriginalStart: last, Title: "Перенесенный стендап", Start: moved, End: moved.Add(time.Hour)})
+
+	if starts := januaryStarts(e); len(starts) != 3 {
+		t.Fatalf("expected 3 occurrences in january, got %v", starts)
+	}
+
+	february := e.Occurrences(moved, moved.Add(time.Hour))
+	if len(february) != 1 || february[0].Title != "Перенесенный стендап" || !february[0].OriginalStart.Equal(last) {
+		t.Fatalf("unexpected moved occurrence %+v", february)
+	}
+
+	if _, end := e.Bounds(); !end.Equal(moved.Add(time.Hour)) {
+		t.Errorf("bounds must include moved occurrence, got %s", end)
+	}
+}
+
+// TestEvent_Split проверяет разделение серии с учетом COUNT и исключений
+func TestEvent_Split(t *testing.T) {
+	e := newWeekly(t, "FREQ=WEEKLY;COUNT=4")
+	third := e.Start.AddDate(0, 0, 14)
+	e.Exclude(e.Start.AddDate(0, 0, 21))
+
+	tail := e.Split(third)
+
+	if starts := januaryStarts(e); len(starts) != 2 {
+		t.Errorf("expected 2 occurrences in the head, got %v", starts)
+	}
+
+	if tail.Recurrence.Count != 2 || !tail.Start.Equal(third) || len(tail.ExDates) != 1 || len(e.ExDates) != 0 {
+		t.Fatalf("unexpected tail %+v", tail)
+	}
+
+	if starts := januaryStarts(tail); len(starts) != 1 || !starts[0].Equal(third) {
+		t.Errorf("unexpected tail occurrences %v", starts)
+	}
+}
+
+// TestEvent_Shift проверяет сдвиг серии с BYDAY на другой день: все повторения переезжают вместе с первым
+func TestEvent_Shift(t *testing.T) {
+	e := newWeekly(t, "FREQ=WEEKLY;BYDAY=MO,TH")
+	delta := 24 * time.Hour
+
+	if !e.CanShift(delta) {
+		t.Fatal("weekly series with BYDAY must be shiftable")
+	}
+	e.Shift(delta, time.Hour)
+
+	if got := e.Recurrence.String(); got != "FREQ=WEEKLY;BYDAY=TU,FR" {
+		t.Errorf("unexpected rule %s", got)
+	}
+
+	starts := januaryStarts(e)
+	if len(starts) != 8 || !starts[0].Equal(time.Date(2020, 1, 7, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected occurrences %v", starts)
+	}
+	for _, s := range starts {
+		if s.Weekday() != time.Tuesday && s.Weekday() != time.Friday {
+			t.Errorf("occurrence %v is not on tuesday or friday", s)
+		}
+	}
+
+	// Назад через воскресенье
+	e.Shift(-3*delta, time.Hour)
+	if got := e.Recurrence.String(); got != "FREQ=WEEKLY;BYDAY=SA,TU" {
+		t.Errorf("unexpected rule after shifting back %s", got)
+	}
+}
+
+// TestEvent_CanShift проверяет отказ сдвигать на другой день серию с днями месяца и номерами дней недели
+func TestEvent_CanShift(t *testing.T) {
+	tests := []struct {
+		rule  string
+		delta time.Duration
+		want  bool
+	}{
+		{"FREQ=WEEKLY", 24 * time.Hour, true},
+		{"FREQ=WEEKLY;BYDAY=MO", 2 * time.Hour, true},
+		{"FREQ=MONTHLY;BYMONTHDAY=6", 2 * time.Hour, true},
+		{"FREQ=MONTHLY;BYMONTHDAY=6", 24 * time.Hour, false},
+		{"FREQ=MONTHLY;BYDAY=1MO", 24 * time.Hour, false},
+		{"FREQ=MONTHLY;BYDAY=1MO", 7 * 24 * time.Hour, false},
+		{"FREQ=MONTHLY;BYDAY=MO", 24 * time.Hour, true},
+	}
+
+	for _, tt := range tests {
+		if got := newWeekly(t, tt.rule).CanShift(tt.delta); got != tt.want {
+			t.Errorf("%s shifted by %v: expected %v, got %v", tt.rule, tt.delta, tt.want, got)
+		}
+	}
+}
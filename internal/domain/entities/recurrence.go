@@ -0,0 +1,448 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency частота повторения события (FREQ в RFC 5545)
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// Форматы UNTIL из RFC 5545: дата-время в UTC, "плавающее" дата-время и дата
+const (
+	untilLayoutUTC      = "20060102T150405Z"
+	untilLayoutFloating = "20060102T150405"
+	untilLayoutDate     = "20060102"
+)
+
+// maxEmptyPeriods ограничение на число подряд идущих периодов без повторений.
+// Защищает от бесконечного цикла на правилах, которые никогда не срабатывают (например BYMONTHDAY=31 и FREQ=YEARLY)
+const maxEmptyPeriods = 1000
+
+// weekdayNames сокращения дней недели, используемые в BYDAY
+var weekdayNames = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// WeekdayNum элемент BYDAY: день недели с необязательным порядковым номером (1MO - первый понедельник, -1FR - последняя пятница)
+// N = 0 означает любой такой день недели в периоде
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+// String возвращает элемент BYDAY в формате RFC 5545
+func (w WeekdayNum) String() string {
+	day := strings.ToUpper(w.Day.String()[:2])
+	if w.N == 0 {
+		return day
+	}
+	return strconv.Itoa(w.N) + day
+}
+
+// MaxCount наибольшее число повторений в COUNT. Промежуток серии с COUNT (Event.Bounds) находится перебором
+// всех ее повторений, поэтому их число ограничено
+const MaxCount = 5000
+
+// Recurrence правило повторения события (RRULE из RFC 5545).
+// Поддерживается подмножество: FREQ, INTERVAL, BYDAY, BYMONTHDAY, COUNT, UNTIL.
+// Неделя всегда начинается с понедельника (WKST=MO)
+type Recurrence struct {
+	Freq       Frequency
+	Interval   int
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	Count      int
+	Until      time.Time
+}
+
+// ParseRecurrence разбирает правило повторения из строки вида FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10
+// Префикс "RRULE:" допускается
+func ParseRecurrence(rule string) (*Recurrence, error) {
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+	if rule == "" {
+		return nil, errors.New("rrule: empty rule")
+	}
+
+	r := &Recurrence{Interval: 1}
+	for _, part := range strings.Split(rule, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, fmt.Errorf("rrule: malformed part %q", part)
+		}
+
+		name, value := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+		var err error
+
+		switch name {
+		case "FREQ":
+			r.Freq = Frequency(value)
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(value)
+		case "COUNT":
+			// Нулевой Count в правиле означает отсутствие COUNT, поэтому COUNT=0 отклоняется здесь
+			if r.Count, err = strconv.Atoi(value); err == nil && r.Count < 1 {
+				err = errors.New("must be positive")
+			}
+		case "UNTIL":
+			r.Until, err = parseUntil(value)
+		case "BYDAY":
+			r.ByDay, err = parseByDay(value)
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = parseIntList(value)
+		case "WKST":
+			if value != "MO" {
+				err = errors.New("only MO is supported")
+			}
+		default:
+			err = errors.New("unsupported rule part")
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("rrule: %s: %v", name, err)
+		}
+	}
+
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Validate проверяет согласованность правила
+func (r *Recurrence) Validate() error {
+	switch r.Freq {
+	case Daily, Weekly, Monthly, Yearly:
+	case "":
+		return errors.New("rrule: FREQ is required")
+	default:
+		return fmt.Errorf("rrule: unsupported FREQ %q", r.Freq)
+	}
+
+	if r.Interval < 1 {
+		return errors.New("rrule: INTERVAL must be positive")
+	}
+	if r.Count < 0 {
+		return errors.New("rrule: COUNT must be positive")
+	}
+	if r.Count > MaxCount {
+		return fmt.Errorf("rrule: COUNT must not exceed %d", MaxCount)
+	}
+	if r.Until.After(Forever) {
+		return fmt.Errorf("rrule: UNTIL must not be after %s", Forever.Format(untilLayoutUTC))
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return errors.New("rrule: COUNT and UNTIL must not occur together")
+	}
+
+	for _, d := range r.ByMonthDay {
+		if d == 0 || d < -31 || d > 31 {
+			return fmt.Errorf("rrule: BYMONTHDAY %d out of range", d)
+		}
+	}
+
+	for _, wd := range r.ByDay {
+		if wd.N != 0 && r.Freq != Monthly {
+			return errors.New("rrule: numbered BYDAY is supported only with FREQ=MONTHLY")
+		}
+		if wd.N < -5 || wd.N > 5 {
+			return fmt.Errorf("rrule: BYDAY %s out of range", wd)
+		}
+	}
+
+	if r.Freq == Yearly && (len(r.ByDay) > 0 || len(r.ByMonthDay) > 0) {
+		return errors.New("rrule: BYDAY and BYMONTHDAY are not supported with FREQ=YEARLY")
+	}
+
+	return nil
+}
+
+// String возвращает правило в формате RFC 5545 (без префикса "RRULE:")
+func (r *Recurrence) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wd := range r.ByDay {
+			days[i] = wd.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilLayoutUTC))
+	}
+
+	return strings.Join(parts, ";")
+}
+
+// iterate перебирает по порядку начала повторений серии, начинающейся в dtstart,
+// пока fn возвращает true либо пока не будут исчерпаны COUNT или UNTIL
+func (r *Recurrence) iterate(dtstart time.Time, fn func(t time.Time) bool) {
+	n := 0
+	empty := 0
+
+	for period := 0; ; period++ {
+		found := false
+
+		for _, t := range r.candidates(dtstart, period) {
+			if t.Before(dtstart) {
+				continue
+			}
+			if !r.Until.IsZero() && t.After(r.Until) {
+				return
+			}
+
+			found = true
+			n++
+			if !fn(t) || r.Count > 0 && n >= r.Count {
+				return
+			}
+		}
+
+		if found {
+			empty = 0
+		} else if empty++; empty > maxEmptyPeriods {
+			return
+		}
+	}
+}
+
+// candidates возвращает отсортированные начала повторений внутри периода с номером period
+func (r *Recurrence) candidates(dtstart time.Time, period int) []time.Time {
+	year, month, day := dtstart.Date()
+	hour, min, sec := dtstart.Clock()
+	loc := dtstart.Location()
+
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, hour, min, sec, dtstart.Nanosecond(), loc)
+	}
+
+	var ret []time.Time
+
+	switch r.Freq {
+	case Daily:
+		t := at(year, month, day+period*r.Interval)
+		if r.matchMonthDay(t) && r.matchWeekday(t) {
+			ret = append(ret, t)
+		}
+
+	case Weekly:
+		// Понедельник недели, в которую попадает dtstart
+		offset := (int(dtstart.Weekday()) + 6) % 7
+		monday := day - offset + period*r.Interval*7
+
+		for i := 0; i < 7; i++ {
+			t := at(year, month, monday+i)
+			if len(r.ByDay) == 0 && t.Weekday() != dtstart.Weekday() {
+				continue
+			}
+			if r.matchWeekday(t) && r.matchMonthDay(t) {
+				ret = append(ret, t)
+			}
+		}
+
+	case Monthly:
+		first := time.Date(year, month+time.Month(period*r.Interval), 1, 0, 0, 0, 0, loc)
+		for _, d := range r.monthDays(first, day) {
+			ret = append(ret, at(first.Year(), first.Month(), d))
+		}
+
+	case Yearly:
+		if day <= daysIn(year+period*r.Interval, month) {
+			ret = append(ret, at(year+period*r.Interval, month, day))
+		}
+	}
+
+	return ret
+}
+
+// monthDays возвращает отсортированные номера дней месяца first, подходящих под правило
+// Если в правиле нет BYDAY и BYMONTHDAY, используется день начала серии dtstartDay
+func (r *Recurrence) monthDays(first time.Time, dtstartDay int) []int {
+	last := daysIn(first.Year(), first.Month())
+	var days []int
+
+	for d := 1; d <= last; d++ {
+		t := first.AddDate(0, 0, d-1)
+
+		switch {
+		case len(r.ByMonthDay) > 0:
+			// BYDAY в паре с BYMONTHDAY лишь ограничивает выборку
+			if !r.matchMonthDay(t) || !r.matchWeekday(t) {
+				continue
+			}
+		case len(r.ByDay) > 0:
+			if !r.matchNumberedWeekday(t, last) {
+				continue
+			}
+		default:
+			if d != dtstartDay {
+				continue
+			}
+		}
+
+		days = append(days, d)
+	}
+
+	return days
+}
+
+// matchWeekday проверяет, что день недели t указан в BYDAY (без учета порядковых номеров)
+func (r *Recurrence) matchWeekday(t time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+
+	for _, wd := range r.ByDay {
+		if wd.Day == t.Weekday() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasNumberedByDay проверяет, есть ли в BYDAY дни недели с порядковыми номерами
+func (r *Recurrence) hasNumberedByDay() bool {
+	for _, wd := range r.ByDay {
+		if wd.N != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchNumberedWeekday проверяет день t в месяце из last дней на соответствие BYDAY с учетом порядковых номеров
+func (r *Recurrence) matchNumberedWeekday(t time.Time, last int) bool {
+	nth := (t.Day()-1)/7 + 1
+	nthFromEnd := -((last-t.Day())/7 + 1)
+
+	for _, wd := range r.ByDay {
+		if wd.Day == t.Weekday() && (wd.N == 0 || wd.N == nth || wd.N == nthFromEnd) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchMonthDay проверяет, что день месяца t указан в BYMONTHDAY (отрицательные значения считаются с конца месяца)
+func (r *Recurrence) matchMonthDay(t time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+
+	last := daysIn(t.Year(), t.Month())
+	for _, d := range r.ByMonthDay {
+		if d == t.Day() || d < 0 && last+d+1 == t.Day() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// daysIn возвращает количество дней в месяце
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// parseUntil разбирает значение UNTIL. Дата без времени означает конец этого дня,
+// "плавающее" время считается заданным в UTC
+func parseUntil(value string) (time.Time, error) {
+	if t, err := time.Parse(untilLayoutUTC, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(untilLayoutFloating, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(untilLayoutDate, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return t.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+}
+
+// parseByDay разбирает список BYDAY вида MO,WE,-1FR
+func parseByDay(value string) ([]WeekdayNum, error) {
+	var ret []WeekdayNum
+
+	for _, item := range strings.Split(value, ",") {
+		if len(item) < 2 {
+			return nil, fmt.Errorf("malformed weekday %q", item)
+		}
+
+		day, ok := weekdayNames[item[len(item)-2:]]
+		if !ok {
+			return nil, fmt.Errorf("unknown weekday %q", item)
+		}
+
+		wd := WeekdayNum{Day: day}
+		if num := item[:len(item)-2]; num != "" {
+			n, err := strconv.Atoi(num)
+			if err != nil || n == 0 {
+				return nil, fmt.Errorf("malformed weekday %q", item)
+			}
+			wd.N = n
+		}
+
+		ret = append(ret, wd)
+	}
+
+	return ret, nil
+}
+
+// parseIntList разбирает список целых чисел через запятую
+func parseIntList(value string) ([]int, error) {
+	var ret []int
+
+	for _, item := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, n)
+	}
+
+	sort.Ints(ret)
+
+	return ret, nil
+}
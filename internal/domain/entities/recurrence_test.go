@@ -0,0 +1,174 @@
+package entities
+
+import (
+	"testing"
+	"time"
+)
+
+// TestParseRecurrence_RoundTrip проверяет разбор и обратную сериализацию правил
+func TestParseRecurrence_RoundTrip(t *testing.T) {
+	rules := []string{
+		"FREQ=DAILY",
+		"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=10",
+		"FREQ=MONTHLY;BYDAY=-1FR",
+		"FREQ=MONTHLY;BYMONTHDAY=1,15;UNTIL=20201231T235959Z",
+		"FREQ=YEARLY",
+	}
+
+	for _, rule := range rules {
+		r, err := ParseRecurrence(rule)
+		if err != nil {
+			t.Errorf("%s: %v", rule, err)
+			continue
+		}
+
+		if r.String() != rule {
+			t.Errorf("expected %s, got %s", rule, r.String())
+		}
+	}
+}
+
+// TestParseRecurrence_Invalid проверяет отказ на некорректных правилах
+func TestParseRecurrence_Invalid(t *testing.T) {
+	rules := []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;COUNT=2;UNTIL=20201231",
+		"FREQ=DAILY;COUNT=0",
+		"FREQ=DAILY;COUNT=-1",
+		"FREQ=DAILY;COUNT=20000000",
+		"FREQ=DAILY;UNTIL=99991231",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=YEARLY;BYDAY=MO",
+		"FREQ=DAILY;BYHOUR=10",
+	}
+
+	for _, rule := range rules {
+		if _, err := ParseRecurrence(rule); err == nil {
+			t.Errorf("%q: expected error", rule)
+		}
+	}
+}
+
+// occurrenceDays разворачивает повторения события в январе-марте 2020 и возвращает их даты
+func occurrenceDays(t *testing.T, start time.Time, rule string) []string {
+	r, err := ParseRecurrence(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := Event{Start: start, End: start.Add(time.Hour), Recurrence: r}
+
+	var ret []string
+	for _, o := range e.Occurrences(start, time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		ret = append(ret, o.Start.Format("01-02"))
+	}
+
+	return ret
+}
+
+// TestEvent_Occurrences проверяет развертывание серий по разным правилам
+func TestEvent_Occurrences(t *testing.T) {
+	// Среда, 1 января 2020
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		rule string
+		days []string
+	}{
+		{"FREQ=DAILY;COUNT=3", []string{"01-01", "01-02", "01-03"}},
+		{"FREQ=DAILY;INTERVAL=10;UNTIL=20200125", []string{"01-01", "01-11", "01-21"}},
+		{"FREQ=WEEKLY;COUNT=3", []string{"01-01", "01-08", "01-15"}},
+		{"FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4", []string{"01-01", "01-06", "01-08", "01-13"}},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=FR;COUNT=3", []string{"01-03", "01-17", "01-31"}},
+		{"FREQ=MONTHLY", []string{"01-01", "02-01", "03-01"}},
+		{"FREQ=MONTHLY;BYDAY=-1FR", []string{"01-31", "02-28", "03-27"}},
+		{"FREQ=MONTHLY;BYDAY=2TU", []string{"01-14", "02-11", "03-10"}},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", []string{"01-31", "02-29", "03-31"}},
+		{"FREQ=MONTHLY;BYMONTHDAY=13;BYDAY=FR", []string{"03-13"}},
+		{"FREQ=YEARLY;COUNT=2", []string{"01-01"}},
+	}
+
+	for _, tt := range tests {
+		days := occurrenceDays(t, start, tt.rule)
+		if len(days) != len(tt.days) {
+			t.Errorf("%s: expected %v, got %v", tt.rule, tt.days, days)
+			continue
+		}
+
+		for i := range days {
+			if days[i] != tt.days[i] {
+				t.Errorf("%s: expected %v, got %v", tt.rule, tt.days, days)
+				break
+			}
+		}
+	}
+
+	// 31 число есть не в каждом месяце, такие месяцы пропускаются
+	days := occurrenceDays(t, time.Date(2020, 1, 31, 10, 0, 0, 0, time.UTC), "FREQ=MONTHLY")
+	if len(days) != 2 || days[1] != "03-31" {
+		t.Errorf("unexpected monthly occurrences from 31st: %v", days)
+	}
+}
+
+// TestEvent_Bounds проверяет промежуток, занимаемый серией
+func TestEvent_Bounds(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	r, _ := ParseRecurrence("FREQ=WEEKLY;COUNT=3")
+	e := Event{Start: start, End: start.Add(time.Hour), Recurrence: r}
+
+	_, end := e.Bounds()
+	if !end.Equal(time.Date(2020, 1, 15, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected series end %s", end)
+	}
+
+	e.Recurrence, _ = ParseRecurrence("FREQ=WEEKLY")
+	if _, end := e.Bounds(); !end.Equal(Forever) {
+		t.Errorf("infinite series must end at Forever, got %s", end)
+	}
+
+	// Конечная серия, уходящая дальше Forever, заканчивается на Forever
+	e.Recurrence = &Recurrence{Freq: Yearly, Interval: 100, Count: MaxCount}
+	if _, end := e.Bounds(); !end.Equal(Forever) {
+		t.Errorf("long series must end at Forever, got %s", end)
+	}
+}
+
+// TestEvent_Conflicts проверяет поиск пересечений с учетом всех повторений
+func TestEvent_Conflicts(t *testing.T) {
+	// Понедельник, 6 января 2020
+	monday := time.Date(2020, 1, 6, 10, 0, 0, 0, time.UTC)
+	weekly, _ := ParseRecurrence("FREQ=WEEKLY;BYDAY=MO")
+	standup := Event{Start: monday, End: monday.Add(30 * time.Minute), Recurrence: weekly}
+
+	// Через четыре недели в понедельник в то же время
+	single := Event{Start: monday.AddDate(0, 0, 28), End: monday.AddDate(0, 0, 28).Add(time.Hour)}
+	if !standup.Conflicts(single) || !single.Conflicts(standup) {
+		t.Error("expected conflict with a later occurrence")
+	}
+
+	// Во вторник в то же время пересечений нет
+	single = Event{Start: monday.AddDate(0, 0, 1), End: monday.AddDate(0, 0, 1).Add(time.Hour)}
+	if standup.Conflicts(single) {
+		t.Error("unexpected conflict on tuesday")
+	}
+
+	// Две бесконечные серии: раз в две недели по средам и ежедневная в то же время с февраля
+	biweekly, _ := ParseRecurrence("FREQ=WEEKLY;INTERVAL=2;BYDAY=WE")
+	daily, _ := ParseRecurrence("FREQ=DAILY")
+	a := Event{Start: monday.AddDate(0, 0, 2), End: monday.AddDate(0, 0, 2).Add(time.Hour), Recurrence: biweekly}
+	b := Event{Start: monday.AddDate(0, 1, 0), End: monday.AddDate(0, 1, 0).Add(time.Hour), Recurrence: daily}
+	if !a.Conflicts(b) {
+		t.Error("expected conflict between infinite series")
+	}
+
+	// Та же ежедневная серия, но после окончания двухнедельной
+	a.Recurrence, _ = ParseRecurrence("FREQ=WEEKLY;INTERVAL=2;BYDAY=WE;COUNT=2")
+	if a.Conflicts(b) {
+		t.Error("unexpected conflict after the series end")
+	}
+}
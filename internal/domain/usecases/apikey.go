@@ -0,0 +1,170 @@
+package usecases
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix начало всех ключей API, по нему ключ легко узнать, например при поиске утечек в журналах
+const APIKeyPrefix = "gck_"
+
+// apiKeyShownPrefix длина начала ключа, которое хранится открыто и показывается в списке ключей
+const apiKeyShownPrefix = len(APIKeyPrefix) + 8
+
+// ErrorInvalidAPIKey - ключ API неизвестен или отозван
+const ErrorInvalidAPIKey = UsecaseError("invalid api key")
+
+// CreateAPIKeyRequest это DTO с входными данными для выпуска ключа API
+type CreateAPIKeyRequest struct {
+	Name   string   `validate:"required,max=100"`
+	Scopes []string `validate:"required,min=1,dive,oneof=events:read events:write calendars:read calendars:write"`
+}
+
+// APIKeyResponse это DTO ключа API. Сам ключ (Key) есть только в ответе на выпуск
+type APIKeyResponse struct {
+	ID      string     `json:"id"`
+	Name    string     `json:"name"`
+	Prefix  string     `json:"prefix"`
+	Scopes  []string   `json:"scopes"`
+	Created time.Time  `json:"created"`
+	Revoked *time.Time `json:"revoked,omitempty"`
+	Key     string     `json:"key,omitempty"`
+}
+
+// APIKeyUsecases сценарии использования для ключей API
+//
+// Ключ выдается один раз при выпуске, а хранилище знает только его хэш SHA-256. Медленное хэширование,
+// как для паролей, не нужно: ключ состоит из 32 случайных байт и перебору не поддается
+type APIKeyUsecases struct {
+	storage APIKeyStorage
+	now     func() time.Time
+}
+
+func NewAPIKeyUsecases(storage APIKeyStorage) *APIKeyUsecases {
+	return &APIKeyUsecases{storage: storage, now: time.Now}
+}
+
+// Create выпускает ключ API арендатора из контекста и возвращает его вместе с самим ключом
+func (u APIKeyUsecases) Create(ctx context.Context, data *CreateAPIKeyRequest) (*APIKeyResponse, error) {
+	err := validate.StructCtx(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := entities.NewAPIKeyID("")
+	if err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return nil, err
+	}
+	value := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	key := entities.APIKey{
+		ID:     id,
+		Name:   data.Name,
+		Prefix: value[:apiKeyShownPrefix],
+		Hash:   HashAPIKey(value),
+		Scopes: uniqueScopes(data.Scopes),
+		// Время с точностью до микросекунд, чтобы оно одинаково сохранялось во всех хранилищах
+		Created: u.now().UTC().Truncate(time.Microsecond),
+	}
+	if err = u.storage.CreateAPIKey(ctx, &key); err != nil {
+		return nil, err
+	}
+
+	ret := newAPIKeyResponse(&key)
+	ret.Key = value
+
+	return &ret, nil
+}
+
+// List возвращает ключи API арендатора, в том числе отозванные, по времени выпуска
+func (u APIKeyUsecases) List(ctx context.Context) ([]APIKeyResponse, error) {
+	keys, err := u.storage.FindAPIKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []APIKeyResponse{}
+	for i := range keys {
+		ret = append(ret, newAPIKeyResponse(&keys[i]))
+	}
+
+	return ret, nil
+}
+
+// Revoke отзывает ключ API арендатора. Отзыв уже отозванного ключа ничего не меняет
+func (u APIKeyUsecases) Revoke(ctx context.Context, id entities.APIKeyID) error {
+	return u.storage.RevokeAPIKey(ctx, id, u.now().UTC().Truncate(time.Microsecond))
+}
+
+// Authenticate возвращает действующий ключ API по его значению. Для неизвестного и отозванного ключа
+// возвращает ErrorInvalidAPIKey
+func (u APIKeyUsecases) Authenticate(ctx context.Context, value string) (*entities.APIKey, error) {
+	if !strings.HasPrefix(value, APIKeyPrefix) {
+		return nil, ErrorInvalidAPIKey
+	}
+
+	key, err := u.storage.FindAPIKeyByHash(ctx, HashAPIKey(value))
+	if errors.Is(err, storage.EntityNotFound) {
+		return nil, ErrorInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key.IsRevoked() {
+		return nil, ErrorInvalidAPIKey
+	}
+
+	return key, nil
+}
+
+// HashAPIKey возвращает хэш ключа API, под которым ключ хранится
+func HashAPIKey(value string) string {
+	sum := sha256.Sum256([]byte(value))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// uniqueScopes возвращает разрешения без повторов в порядке entities.Scopes
+func uniqueScopes(scopes []string) []string {
+	var ret []string
+	for _, s := range entities.Scopes {
+		for _, v := range scopes {
+			if v == s {
+				ret = append(ret, s)
+				break
+			}
+		}
+	}
+
+	return ret
+}
+
+// newAPIKeyResponse переводит ключ API в DTO без самого ключа
+func newAPIKeyResponse(key *entities.APIKey) APIKeyResponse {
+	ret := APIKeyResponse{
+		ID:      key.ID.String(),
+		Name:    key.Name,
+		Prefix:  key.Prefix,
+		Scopes:  key.Scopes,
+		Created: key.Created,
+	}
+	if key.IsRevoked() {
+		revoked := key.Revoked
+		ret.Revoked = &revoked
+	}
+
+	return ret
+}
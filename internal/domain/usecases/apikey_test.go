@@ -0,0 +1,100 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	storage2 "github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/storage/inmemory"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestAPIKeyUsecases_Lifecycle проверяет выпуск, проверку, список и отзыв ключа API
+func TestAPIKeyUsecases_Lifecycle(t *testing.T) {
+	ctx := tenant.NewContext(context.Background(), "acme")
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	usecase := NewAPIKeyUsecases(storage)
+
+	created, err := usecase.Create(ctx, &CreateAPIKeyRequest{
+		Name:   "Синхронизация",
+		Scopes: []string{entities.ScopeEventsWrite, entities.ScopeEventsRead, entities.ScopeEventsRead},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(created.Key, APIKeyPrefix) || !strings.HasPrefix(created.Key, created.Prefix) {
+		t.Fatalf("unexpected key %q with prefix %q", created.Key, created.Prefix)
+	}
+	if !reflect.DeepEqual(created.Scopes, []string{entities.ScopeEventsRead, entities.ScopeEventsWrite}) {
+		t.Errorf("unexpected scopes %v", created.Scopes)
+	}
+
+	// Хранится только хэш ключа
+	stored, err := storage.FindAPIKeyByHash(ctx, HashAPIKey(created.Key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(fmt.Sprintf("%+v", *stored), created.Key) {
+		t.Fatal("api key must not be stored as is")
+	}
+
+	// Ключ проверяется без арендатора в контексте и приносит своего арендатора
+	key, err := usecase.Authenticate(context.Background(), created.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Tenant != "acme" || !key.Allows(entities.ScopeEventsWrite) || key.Allows(entities.ScopeCalendarsRead) {
+		t.Errorf("unexpected api key %+v", key)
+	}
+
+	for _, value := range []string{"", "secret", APIKeyPrefix + "unknown", created.Key + "x"} {
+		if _, err = usecase.Authenticate(ctx, value); err != ErrorInvalidAPIKey {
+			t.Errorf("%q: expected ErrorInvalidAPIKey, got %v", value, err)
+		}
+	}
+
+	list, err := usecase.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != created.ID || list[0].Key != "" || list[0].Revoked != nil {
+		t.Fatalf("unexpected list %+v", list)
+	}
+
+	if err = usecase.Revoke(ctx, key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = usecase.Authenticate(ctx, created.Key); err != ErrorInvalidAPIKey {
+		t.Errorf("revoked key: expected ErrorInvalidAPIKey, got %v", err)
+	}
+	if list, err = usecase.List(ctx); err != nil || len(list) != 1 || list[0].Revoked == nil {
+		t.Fatalf("revoked key must stay in list, got %+v, %v", list, err)
+	}
+
+	// Другой арендатор не видит и не отзывает ключ
+	if err = usecase.Revoke(context.Background(), key.ID); !errors.Is(err, storage2.EntityNotFound) {
+		t.Errorf("revoke from another tenant: expected EntityNotFound, got %v", err)
+	}
+}
+
+// TestAPIKeyUsecases_Validation проверяет отказ для ключа без названия и с неизвестными разрешениями
+func TestAPIKeyUsecases_Validation(t *testing.T) {
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	usecase := NewAPIKeyUsecases(storage)
+
+	for _, req := range []CreateAPIKeyRequest{
+		{Scopes: []string{entities.ScopeEventsRead}},
+		{Name: "Без разрешений"},
+		{Name: "Неизвестное", Scopes: []string{"events:delete"}},
+	} {
+		var errs validator.ValidationErrors
+		if _, err := usecase.Create(context.Background(), &req); !errors.As(err, &errs) {
+			t.Errorf("%+v: expected validation error, got %v", req, err)
+		}
+	}
+}
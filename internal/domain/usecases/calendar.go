@@ -0,0 +1,164 @@
+package usecases
+
+import (
+	"context"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+)
+
+// DefaultCalendarName название календаря по умолчанию
+const DefaultCalendarName = "Default"
+
+// CreateCalendarRequest это DTO с входными данными для создания календаря
+type CreateCalendarRequest struct {
+	Name     string `validate:"required,max=50"`
+	Color    string `validate:"omitempty,hexcolor,len=7"` // #rrggbb
+	Owner    string `validate:"max=100"`
+	Timezone string `validate:"omitempty,timezone"` // Пустая - зона сервера
+}
+
+// UpdateCalendarRequest это DTO с входными данными для изменения календаря целиком
+type UpdateCalendarRequest struct {
+	ID       string `validate:"required,uuid"`
+	Name     string `validate:"required,max=50"`
+	Color    string `validate:"omitempty,hexcolor,len=7"`
+	Owner    string `validate:"max=100"`
+	Timezone string `validate:"omitempty,timezone"`
+}
+
+// CalendarResponse это DTO календаря
+type CalendarResponse struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Color    string `json:"color,omitempty"`
+	Owner    string `json:"owner,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+	Default  bool   `json:"default,omitempty"`
+}
+
+// CalendarUsecases сценарии использования для календаря
+//
+// Календарь по умолчанию (entities.DefaultCalendarID) существует всегда и не хранится в хранилище:
+// его нельзя изменить или удалить
+type CalendarUsecases struct {
+	storage CalendarStorage
+}
+
+func NewCalendarUsecases(storage CalendarStorage) *CalendarUsecases {
+	return &CalendarUsecases{storage: storage}
+}
+
+// Create создает календарь и возвращает его ID
+func (u CalendarUsecases) Create(ctx context.Context, data *CreateCalendarRequest) (string, error) {
+	err := validate.StructCtx(ctx, data)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := entities.NewCalendarID("")
+	if err != nil {
+		return "", err
+	}
+
+	calendar := entities.Calendar{
+		ID:       id,
+		Name:     data.Name,
+		Color:    data.Color,
+		Owner:    data.Owner,
+		Timezone: data.Timezone,
+	}
+
+	return id.String(), u.storage.CreateCalendar(ctx, &calendar)
+}
+
+// Get возвращает календарь по его идентификатору
+func (u CalendarUsecases) Get(ctx context.Context, id entities.CalendarID) (*CalendarResponse, error) {
+	calendar, err := u.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	item := newCalendarResponse(calendar)
+
+	return &item, nil
+}
+
+// Find возвращает сущность календаря по его идентификатору, в том числе календарь по умолчанию
+func (u CalendarUsecases) Find(ctx context.Context, id entities.CalendarID) (*entities.Calendar, error) {
+	return u.find(ctx, id)
+}
+
+// List возвращает календарь по умолчанию и календари владельца owner (пустой - всех владельцев) по названию
+func (u CalendarUsecases) List(ctx context.Context, owner string) ([]CalendarResponse, error) {
+	calendars, err := u.storage.FindCalendars(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []CalendarResponse{newCalendarResponse(defaultCalendar())}
+	for i := range calendars {
+		ret = append(ret, newCalendarResponse(&calendars[i]))
+	}
+
+	return ret, nil
+}
+
+// Update изменяет календарь целиком
+func (u CalendarUsecases) Update(ctx context.Context, data *UpdateCalendarRequest) error {
+	err := validate.StructCtx(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	id, err := entities.NewCalendarID(data.ID)
+	if err != nil {
+		return err
+	}
+	if id.IsDefault() {
+		return ErrorDefaultCalendar
+	}
+
+	calendar := entities.Calendar{
+		ID:       id,
+		Name:     data.Name,
+		Color:    data.Color,
+		Owner:    data.Owner,
+		Timezone: data.Timezone,
+	}
+
+	return u.storage.UpdateCalendar(ctx, &calendar)
+}
+
+// Delete удаляет календарь вместе со всеми его событиями
+func (u CalendarUsecases) Delete(ctx context.Context, id entities.CalendarID) error {
+	if id.IsDefault() {
+		return ErrorDefaultCalendar
+	}
+
+	return u.storage.DeleteCalendar(ctx, id)
+}
+
+// find возвращает календарь из хранилища или календарь по умолчанию
+func (u CalendarUsecases) find(ctx context.Context, id entities.CalendarID) (*entities.Calendar, error) {
+	if id.IsDefault() {
+		return defaultCalendar(), nil
+	}
+
+	return u.storage.FindCalendarByID(ctx, id)
+}
+
+// defaultCalendar возвращает календарь по умолчанию: без владельца, в зоне сервера
+func defaultCalendar() *entities.Calendar {
+	return &entities.Calendar{ID: entities.DefaultCalendarID, Name: DefaultCalendarName}
+}
+
+// newCalendarResponse маппит сущность Календарь на DTO
+func newCalendarResponse(calendar *entities.Calendar) CalendarResponse {
+	return CalendarResponse{
+		ID:       calendar.ID.String(),
+		Name:     calendar.Name,
+		Color:    calendar.Color,
+		Owner:    calendar.Owner,
+		Timezone: calendar.Timezone,
+		Default:  calendar.ID.IsDefault(),
+	}
+}
@@ -0,0 +1,206 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	storage2 "github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/storage/inmemory"
+	"testing"
+	"time"
+)
+
+// TestCalendarUsecases_CRUD проверяет создание, выборку, изменение и удаление календаря
+func TestCalendarUsecases_CRUD(t *testing.T) {
+	ctx := context.Background()
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	usecase := NewCalendarUsecases(storage)
+
+	id, err := usecase.Create(ctx, &CreateCalendarRequest{Name: "Работа", Color: "#3366cc", Owner: "alice", Timezone: "Europe/Moscow"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = usecase.Create(ctx, &CreateCalendarRequest{Name: "Спорт", Owner: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	calendarID, err := entities.NewCalendarID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calendar, err := usecase.Get(ctx, calendarID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calendar.Name != "Работа" || calendar.Color != "#3366cc" || calendar.Timezone != "Europe/Moscow" || calendar.Default {
+		t.Fatalf("unexpected calendar %+v", calendar)
+	}
+
+	// Календарь по умолчанию есть в каждом списке
+	list, err := usecase.List(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || !list[0].Default || list[1].ID != id {
+		t.Fatalf("unexpected calendars %+v", list)
+	}
+
+	err = usecase.Update(ctx, &UpdateCalendarRequest{ID: id, Name: "Офис", Owner: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calendar, _ = usecase.Get(ctx, calendarID); calendar.Name != "Офис" || calendar.Color != "" {
+		t.Fatalf("calendar must be updated, got %+v", calendar)
+	}
+
+	if err = usecase.Delete(ctx, calendarID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = usecase.Get(ctx, calendarID); err != storage2.EntityNotFound {
+		t.Fatalf("expected EntityNotFound, got %v", err)
+	}
+}
+
+// TestCalendarUsecases_Default проверяет, что календарь по умолчанию доступен, но не изменяется и не удаляется
+func TestCalendarUsecases_Default(t *testing.T) {
+	ctx := context.Background()
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	usecase := NewCalendarUsecases(storage)
+
+	calendar, err := usecase.Get(ctx, entities.DefaultCalendarID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !calendar.Default || calendar.Name != DefaultCalendarName {
+		t.Fatalf("unexpected default calendar %+v", calendar)
+	}
+
+	err = usecase.Update(ctx, &UpdateCalendarRequest{ID: entities.DefaultCalendarID.String(), Name: "Другое"})
+	if !errors.Is(err, ErrorDefaultCalendar) {
+		t.Fatalf("update: expected ErrorDefaultCalendar, got %v", err)
+	}
+	if err = usecase.Delete(ctx, entities.DefaultCalendarID); !errors.Is(err, ErrorDefaultCalendar) {
+		t.Fatalf("delete: expected ErrorDefaultCalendar, got %v", err)
+	}
+}
+
+// TestCalendarUsecases_Invalid проверяет валидацию календаря
+func TestCalendarUsecases_Invalid(t *testing.T) {
+	ctx := context.Background()
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	usecase := NewCalendarUsecases(storage)
+
+	tests := []CreateCalendarRequest{
+		{},
+		{Name: "Цвет", Color: "red"},
+		{Name: "Короткий цвет", Color: "#f00"},
+		{Name: "Зона", Timezone: "Mars/Olympus"},
+		{Name: "Зона сервера", Timezone: "Local"},
+	}
+
+	for _, tt := range tests {
+		if _, err := usecase.Create(ctx, &tt); err == nil {
+			t.Errorf("%+v: expected validation error", tt)
+		}
+	}
+}
+
+// TestEventUsecases_InCalendar проверяет, что сценарии видят только события своего календаря,
+// а пересечения проверяются внутри календаря
+func TestEventUsecases_InCalendar(t *testing.T) {
+	ctx := context.Background()
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	defaults := NewEventUsecases(storage)
+
+	calendarID, _ := NewCalendarUsecases(storage).Create(ctx, &CreateCalendarRequest{Name: "Работа"})
+	id, _ := entities.NewCalendarID(calendarID)
+	work := defaults.InCalendar(id)
+
+	start := time.Date(2020, 5, 12, 10, 0, 0, 0, time.Local)
+	request := CreateEventRequest{Title: "Совещание", Start: start, End: start.Add(time.Hour)}
+
+	defaultID, err := defaults.Create(ctx, &request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	workID, err := work.Create(ctx, &request)
+	if err != nil {
+		t.Fatalf("the same time in another calendar must be free: %v", err)
+	}
+	if _, err = work.Create(ctx, &request); err != ErrorDateBusy {
+		t.Fatalf("expected ErrorDateBusy, got %v", err)
+	}
+
+	for _, c := range []struct {
+		usecase *EventUsecases
+		own     string
+		foreign string
+	}{
+		{defaults, defaultID, workID},
+		{work, workID, defaultID},
+	} {
+		items, err := pageItems(c.usecase.ListDay(ctx, start, Page{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 1 || items[0].ID != c.own {
+			t.Fatalf("expected only event %s, got %+v", c.own, items)
+		}
+
+		foreign, _ := entities.NewEventID(c.foreign)
+		if _, err = c.usecase.Get(ctx, foreign); err != storage2.EntityNotFound {
+			t.Errorf("get: expected EntityNotFound, got %v", err)
+		}
+		err = c.usecase.Update(ctx, &UpdateEventRequest{ID: c.foreign, Title: "Чужое", Start: start, End: start.Add(time.Hour)})
+		if err != storage2.EntityNotFound {
+			t.Errorf("update: expected EntityNotFound, got %v", err)
+		}
+		if err = c.usecase.Delete(ctx, foreign, 0); err != storage2.EntityNotFound {
+			t.Errorf("delete: expected EntityNotFound, got %v", err)
+		}
+	}
+
+	// Курсор списка одного календаря не подходит для другого
+	_, err = defaults.Create(ctx, &CreateEventRequest{Title: "Обед", Start: start.Add(2 * time.Hour), End: start.Add(3 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := defaults.ListDay(ctx, start, Page{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = work.ListDay(ctx, start, Page{Limit: 1, Cursor: page.Next}); !errors.Is(err, ErrorInvalidPage) {
+		t.Errorf("expected ErrorInvalidPage, got %v", err)
+	}
+}
+
+// TestEventUsecases_ImportInCalendar проверяет, что одно событие можно импортировать в разные календари
+func TestEventUsecases_ImportInCalendar(t *testing.T) {
+	ctx := context.Background()
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	defaults := NewEventUsecases(storage)
+
+	calendarID, _ := NewCalendarUsecases(storage).Create(ctx, &CreateCalendarRequest{Name: "Работа"})
+	id, _ := entities.NewCalendarID(calendarID)
+	work := defaults.InCalendar(id)
+
+	start := time.Date(2020, 5, 12, 10, 0, 0, 0, time.Local)
+	items := []ImportEventRequest{{UID: "event@example.com", Title: "Совещание", Start: start, End: start.Add(time.Hour)}}
+
+	for _, u := range []*EventUsecases{defaults, work, work} {
+		if _, err := u.Import(ctx, items); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, u := range []*EventUsecases{defaults, work} {
+		list, err := pageItems(u.ListDay(ctx, start, Page{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 1 {
+			t.Fatalf("expected 1 imported event, got %d", len(list))
+		}
+	}
+}
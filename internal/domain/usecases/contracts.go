@@ -3,16 +3,82 @@ package usecases
 import (
 	"context"
 	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/storage"
 	"time"
 )
 
+// Storage хранилище календарей, их событий и ключей API. Все хранилища реализуют все три интерфейса:
+// удаление календаря вместе с событиями должно быть атомарным
+//
+// Данные разделены по арендаторам: каждая операция работает только с данными арендатора из контекста
+// (tenant.FromContext). Создание сохраняет событие или календарь с этим арендатором, а чужие события и календари
+// для операций не существуют - поиск их не находит, изменение и удаление возвращают storage.EntityNotFound
+type Storage interface {
+	EventStorage
+	CalendarStorage
+	APIKeyStorage
+}
+
 // EventStorage интерфейс хранилища событий (по сути это DAO) используется usecas'ами
 // Мы не разделяем его на более мелкие (см. interface segregation)
 // т.к. почти всегда используются все CRUD операции, однако по мере роста usecase'ов может понадобится разбиение
+//
+// Изменения защищены версиями событий (оптимистичная блокировка): Create сохраняет событие с версией 1
+// (или с переданной, если она задана, например при восстановлении из архива), а Update и UpdateIfFree
+// принимают событие только с версией, равной сохраненной, иначе возвращают storage.EntityVersionConflict.
+// После изменения версия увеличивается на 1, новая версия записывается и в переданное событие
+//
+// Выборки и проверка пересечений ограничены календарем события. Update и UpdateIfFree не переносят событие
+// в другой календарь: событие с тем же идентификатором, но из другого календаря, считается не найденным
 type EventStorage interface {
 	Create(ctx context.Context, event *entities.Event) error
+	// CreateIfFree атомарно проверяет, что событие не пересекается с сохраненными, и создает его.
+	// При пересечении возвращает storage.EntitySpanBusy
+	CreateIfFree(ctx context.Context, event *entities.Event) error
 	FindByID(ctx context.Context, id entities.EventID) (*entities.Event, error)
-	FindBySpan(ctx context.Context, start time.Time, end time.Time) ([]entities.Event, error)
+	FindBySpan(ctx context.Context, calendar entities.CalendarID, start time.Time, end time.Time) ([]entities.Event, error)
+	// FindPage возвращает не больше q.Limit событий календаря q.Calendar, пересекающихся с промежутком q.Start..q.End,
+	// в порядке q.Order: по началу промежутка серии (Bounds) или по убыванию его окончания, при равенстве - по идентификатору.
+	// Если задана позиция q.After, выборка начинается со следующего за ней события
+	FindPage(ctx context.Context, q storage.SpanQuery) ([]entities.Event, error)
 	Update(ctx context.Context, event *entities.Event) error
-	DeleteByID(ctx context.Context, id *entities.EventID) error
+	// UpdateIfFree атомарно проверяет, что событие не пересекается с другими сохраненными, и изменяет его.
+	// При пересечении возвращает storage.EntitySpanBusy
+	UpdateIfFree(ctx context.Context, event *entities.Event) error
+	// SplitIfFree атомарно изменяет серию head (усеченную при разделении, см. entities.Event.Split) и создает
+	// в ее календаре новую серию tail, если tail не пересекается с другими сохраненными событиями и с усеченной head.
+	// head сверяется с сохраненной как в Update (на пересечения не проверяется: усечение только освобождает время),
+	// tail создается как в CreateIfFree. При пересечении возвращает storage.EntitySpanBusy, а при любой ошибке
+	// не сохраняет ничего
+	//
+	// Если пересечения не удалось проверить из-за одновременных записей в тот же календарь, методы *IfFree
+	// возвращают storage.EntitySpanLocked, ничего не сохранив
+	SplitIfFree(ctx context.Context, head, tail *entities.Event) error
+	// DeleteByID удаляет событие. Если version не 0, событие удаляется только в этой версии
+	DeleteByID(ctx context.Context, id *entities.EventID, version int64) error
+}
+
+// CalendarStorage интерфейс хранилища календарей. Календарь по умолчанию в хранилище не сохраняется
+type CalendarStorage interface {
+	// CreateCalendar сохраняет новый календарь, при совпадении идентификатора возвращает storage.EntityAlreadyExists
+	CreateCalendar(ctx context.Context, calendar *entities.Calendar) error
+	FindCalendarByID(ctx context.Context, id entities.CalendarID) (*entities.Calendar, error)
+	// FindCalendars возвращает календари владельца owner (пустой - всех владельцев), упорядоченные по названию
+	FindCalendars(ctx context.Context, owner string) ([]entities.Calendar, error)
+	UpdateCalendar(ctx context.Context, calendar *entities.Calendar) error
+	// DeleteCalendar удаляет календарь вместе со всеми его событиями
+	DeleteCalendar(ctx context.Context, id entities.CalendarID) error
+}
+
+// APIKeyStorage интерфейс хранилища ключей API. Ключи хранятся только в виде хэшей
+type APIKeyStorage interface {
+	// CreateAPIKey сохраняет новый ключ, при совпадении идентификатора или хэша возвращает storage.EntityAlreadyExists
+	CreateAPIKey(ctx context.Context, key *entities.APIKey) error
+	// FindAPIKeyByHash ищет ключ по хэшу среди ключей всех арендаторов: арендатор запроса с ключом API
+	// становится известен только по найденному ключу. Отозванные ключи тоже находятся
+	FindAPIKeyByHash(ctx context.Context, hash string) (*entities.APIKey, error)
+	// FindAPIKeys возвращает ключи арендатора, в том числе отозванные, по времени создания
+	FindAPIKeys(ctx context.Context) ([]entities.APIKey, error)
+	// RevokeAPIKey отмечает ключ отозванным в момент at. Время отзыва уже отозванного ключа не меняется
+	RevokeAPIKey(ctx context.Context, id entities.APIKeyID, at time.Time) error
 }
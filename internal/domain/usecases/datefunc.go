@@ -58,3 +58,22 @@ func monthRange(t time.Time) (start, end time.Time) {
 
 	return
 }
+
+// quarterRange выдает диапазон дат начала и конца квартала по дате t
+func quarterRange(t time.Time) (start, end time.Time) {
+	year, month, _ := t.Date()
+	first := month - (month-1)%3
+
+	start = time.Date(year, first, 1, 0, 0, 0, 0, t.Location())
+	end = start.AddDate(0, 3, 0).Add(-time.Nanosecond)
+
+	return
+}
+
+// yearRange выдает диапазон дат начала и конца года по дате t
+func yearRange(t time.Time) (start, end time.Time) {
+	start = time.Date(t.Year(), 1, 1, 0, 0, 0, 0, t.Location())
+	end = start.AddDate(1, 0, 0).Add(-time.Nanosecond)
+
+	return
+}
@@ -41,3 +41,30 @@ func TestWeekRange(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestQuarterRange(t *testing.T) {
+	tests := []struct {
+		day, start time.Time
+	}{
+		{time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local), time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)},
+		{time.Date(2020, 3, 31, 23, 59, 0, 0, time.Local), time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)},
+		{time.Date(2020, 5, 12, 10, 0, 0, 0, time.Local), time.Date(2020, 4, 1, 0, 0, 0, 0, time.Local)},
+		{time.Date(2020, 12, 31, 10, 0, 0, 0, time.Local), time.Date(2020, 10, 1, 0, 0, 0, 0, time.Local)},
+	}
+
+	for _, tt := range tests {
+		start, end := quarterRange(tt.day)
+		if !start.Equal(tt.start) || !end.Equal(tt.start.AddDate(0, 3, 0).Add(-time.Nanosecond)) {
+			t.Errorf("%s: unexpected quarter %s - %s", tt.day, start, end)
+		}
+	}
+}
+
+func TestYearRange(t *testing.T) {
+	start, end := yearRange(time.Date(2020, 5, 12, 10, 0, 0, 0, time.Local))
+
+	if !start.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)) ||
+		!end.Equal(time.Date(2021, 1, 1, 0, 0, 0, 0, time.Local).Add(-time.Nanosecond)) {
+		t.Errorf("unexpected year %s - %s", start, end)
+	}
+}
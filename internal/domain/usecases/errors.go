@@ -1,6 +1,26 @@
 package usecases
 
 const ErrorDateBusy = UsecaseError("date busy")
+const ErrorNotRecurring = UsecaseError("event is not recurring")
+const ErrorOccurrenceNotFound = UsecaseError("occurrence not found")
+
+// ErrorShiftByRule - сдвиг серии меняет день, закрепленный в правиле повторения (BYMONTHDAY или BYDAY с номером)
+const ErrorShiftByRule = UsecaseError("shift changes the day fixed by the recurrence rule")
+
+// ErrorInvalidRange - некорректный промежуток или размер выборки списка событий
+const ErrorInvalidRange = UsecaseError("invalid range")
+
+// ErrorInvalidPatch - патч не является объектом JSON или содержит неизвестные поля
+const ErrorInvalidPatch = UsecaseError("invalid merge patch")
+
+// ErrorInvalidPage - некорректный размер страницы, порядок или курсор списка событий
+const ErrorInvalidPage = UsecaseError("invalid page")
+
+// ErrorConcurrentUpdate - событие без ожидаемой версии не удалось изменить: его меняли одновременно при каждой попытке
+const ErrorConcurrentUpdate = UsecaseError("event is changed concurrently, try again later")
+
+// ErrorDefaultCalendar - календарь по умолчанию нельзя изменить или удалить
+const ErrorDefaultCalendar = UsecaseError("default calendar cannot be changed")
 
 // UsecaseError тип для ошибок сценария использования
 type UsecaseError string
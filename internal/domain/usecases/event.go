@@ -2,26 +2,47 @@ package usecases
 
 import (
 	"context"
-	"github.com/go-playground/validator/v10"
+	"fmt"
 	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
 	"time"
 )
 
+// DefaultMaxRange максимальная длина промежутка ListRange по умолчанию, в него помещается високосный год
+const DefaultMaxRange = 366 * 24 * time.Hour
+
+// MaxAgendaSize максимальное число событий в повестке Agenda
+const MaxAgendaSize = 100
+
+// maxUnversionedAttempts наибольшее число попыток изменить событие без ожидаемой версии, пока его меняют одновременно
+const maxUnversionedAttempts = 16
+
+// Промежуток, на который разворачиваются серии при выборке по возрастанию: начинается с недели и удваивается,
+// пока повторений не хватает. Промежуток длиннее века сразу продлевается до конца списка
+const (
+	agendaWindow    = 7 * 24 * time.Hour
+	maxAgendaWindow = 100 * 365 * 24 * time.Hour
+)
+
 // CreateEventRequest это DTO с входными данными для создания объекта Событие
 type CreateEventRequest struct {
 	Title       string    `validate:"required,min=3,max=50"`
-	Start       time.Time `validate:"required,ltfield=End"`
-	End         time.Time `validate:"required,gtfield=Start"`
+	Start       time.Time `validate:"required,eventtime,ltfield=End"`
+	End         time.Time `validate:"required,eventtime,gtfield=Start"`
 	Description string
+	RRule       string `validate:"omitempty,rrule"` // Правило повторения RFC 5545, пустое для одиночного события
 }
 
 // UpdateEventRequest это DTO с входными данными для изменения объекта Событие целиком
 type UpdateEventRequest struct {
 	ID          string    `validate:"required,uuid"`
 	Title       string    `validate:"required,min=3,max=50"`
-	Start       time.Time `validate:"required,ltfield=End"`
-	End         time.Time `validate:"required,gtfield=Start"`
+	Start       time.Time `validate:"required,eventtime,ltfield=End"`
+	End         time.Time `validate:"required,eventtime,gtfield=Start"`
 	Description string
+	RRule       string `validate:"omitempty,rrule"` // Правило повторения RFC 5545, пустое для одиночного события
+	Version     int64  // Ожидаемая версия события, 0 - изменить любую текущую версию
 }
 
 type ListResponseItem struct {
@@ -30,37 +51,52 @@ type ListResponseItem struct {
 	Start       time.Time `json:"start"`
 	End         time.Time `json:"end"`
 	Description string    `json:"description"`
+	RRule       string    `json:"rrule,omitempty"`
+	// Исходное начало повторения серии, по нему повторение адресуется при изменении или удалении
+	OriginalStart *time.Time `json:"original_start,omitempty"`
+	Version       int64      `json:"version"`
 }
 
 // EventUsecases сценарии использования для события
 // При расширении эта структура может превратиться в фасад к use case'ам
+//
+// Сценарии работают с событиями одного календаря (см. InCalendar), по умолчанию - календаря по умолчанию.
+// События других календарей для них не существуют, а пересечения проверяются только внутри календаря.
+// Так же сценарии видят только события арендатора из контекста вызова (см. пакет tenant)
 type EventUsecases struct {
-	storage EventStorage
+	storage  EventStorage
+	calendar entities.CalendarID
+	maxRange time.Duration // Максимальная длина промежутка ListRange
 }
 
 func NewEventUsecases(storage EventStorage) *EventUsecases {
-	return &EventUsecases{storage: storage}
+	return &EventUsecases{storage: storage, maxRange: DefaultMaxRange}
 }
 
-// Create создает событие и возвращает его ID
-func (u EventUsecases) Create(ctx context.Context, data *CreateEventRequest) (string, error) {
-	validate := validator.New()
+// InCalendar возвращает те же сценарии для событий календаря id. Существование календаря не проверяется,
+// это делает вызывающий код (см. CalendarUsecases.Get)
+func (u EventUsecases) InCalendar(id entities.CalendarID) *EventUsecases {
+	u.calendar = id
 
-	err := validate.StructCtx(ctx, data)
-	if err != nil {
-		return "", err
+	return &u
+}
+
+// SetMaxRange задает максимальную длину промежутка ListRange, 0 - DefaultMaxRange
+func (u *EventUsecases) SetMaxRange(d time.Duration) {
+	if d <= 0 {
+		d = DefaultMaxRange
 	}
 
-	// В общем-то не важно, сколько тут повится записей, т.к. по идее либо что-то есть и тогда ошибка, либо их нет.
-	item, err := u.storage.FindBySpan(ctx, data.Start, data.End)
+	u.maxRange = d
+}
+
+// Create создает событие и возвращает его ID
+func (u EventUsecases) Create(ctx context.Context, data *CreateEventRequest) (string, error) {
+	err := validate.StructCtx(ctx, data)
 	if err != nil {
 		return "", err
 	}
 
-	if len(item) > 0 {
-		return "", ErrorDateBusy
-	}
-
 	id, err := entities.NewEventID("")
 	if err != nil {
 		return "", err
@@ -68,21 +104,23 @@ func (u EventUsecases) Create(ctx context.Context, data *CreateEventRequest) (st
 
 	event := entities.Event{
 		ID:          id,
+		CalendarID:  u.calendar,
 		Title:       data.Title,
 		Start:       data.Start,
 		End:         data.End,
 		Description: data.Description,
+		Recurrence:  recurrence(data.RRule),
 	}
 
-	err = u.storage.Create(ctx, &event)
+	// Проверка пересечений и запись выполняются хранилищем атомарно,
+	// иначе два одновременных запроса на одно время оба прошли бы проверку
+	err = u.storage.CreateIfFree(ctx, &event)
 
-	return id.String(), err
+	return id.String(), dateBusy(err)
 }
 
 // Update обновляет все событие целиком
 func (u EventUsecases) Update(ctx context.Context, data *UpdateEventRequest) error {
-	validate := validator.New()
-
 	err := validate.StructCtx(ctx, data)
 	if err != nil {
 		return err
@@ -94,27 +132,34 @@ func (u EventUsecases) Update(ctx context.Context, data *UpdateEventRequest) err
 		return err
 	}
 
-	item, err := u.storage.FindBySpan(ctx, data.Start, data.End)
-	if err != nil {
-		return err
-	}
-
-	// Если есть 1 событие и это не наше или событий больше 1, генерируем ошибку
-	if len(item) == 1 && !id.Equal(item[0].ID) || len(item) > 1 {
-		return ErrorDateBusy
-	}
-
-	event := entities.Event{
-		ID:          id,
-		Title:       data.Title,
-		Start:       data.Start,
-		End:         data.End,
-		Description: data.Description,
-	}
-
-	err = u.storage.Update(ctx, &event)
-
-	return err
+	// Без ожидаемой версии событие изменяется в той, которая прочитана, и перечитывается, если его успели изменить
+	return unversioned(ctx, data.Version, func() error {
+		current, err := u.find(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		event := entities.Event{
+			ID:          id,
+			CalendarID:  u.calendar,
+			Title:       data.Title,
+			Start:       data.Start,
+			End:         data.End,
+			Description: data.Description,
+			Recurrence:  recurrence(data.RRule),
+			Version:     current.Version,
+		}
+		if data.Version != 0 {
+			// Сверку с сохраненной версией выполняет хранилище атомарно с записью
+			event.Version = data.Version
+		}
+
+		keepExceptions(&event, current)
+
+		err = u.storage.UpdateIfFree(ctx, &event)
+
+		return dateBusy(err)
+	})
 }
 
 // Delete удаляет сущность Событие по ее идентификатору
@@ -124,65 +169,192 @@ func (u EventUsecases) Update(ctx context.Context, data *UpdateEventRequest) err
 // хранилище. Но основная причина в том, что при расширении нам может понадобиться
 // производить какие-то дополнительные действия и тогда мы можем добавить их сюда,
 // не затрагивая остальной код.
-func (u EventUsecases) Delete(ctx context.Context, id entities.EventID) error {
-	return u.storage.DeleteByID(ctx, &id)
-}
+//
+// Если version не 0, событие удаляется, только если его не успели изменить
+func (u EventUsecases) Delete(ctx context.Context, id entities.EventID, version int64) error {
+	// Календарь события не меняется, поэтому проверка принадлежности до удаления не устаревает
+	if _, err := u.find(ctx, id); err != nil {
+		return err
+	}
 
-// ListDay возвращает список событий за указанный день
-func (u EventUsecases) ListDay(ctx context.Context, day time.Time) ([]ListResponseItem, error) {
-	start := bod(day)
-	end := eod(day)
+	return u.storage.DeleteByID(ctx, &id, version)
+}
 
-	ret, err := u.findBySpan(ctx, start, end)
+// Get возвращает событие по его идентификатору
+func (u EventUsecases) Get(ctx context.Context, id entities.EventID) (*ListResponseItem, error) {
+	event, err := u.find(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	return ret, nil
+	item := newListResponseItem(event)
+
+	return &item, nil
 }
 
-// ListWeek возвращает список событий за указанную неделю
-func (u EventUsecases) ListWeek(ctx context.Context, day time.Time) ([]ListResponseItem, error) {
+// ListDay возвращает страницу списка событий за указанный день
+func (u EventUsecases) ListDay(ctx context.Context, day time.Time, page Page) (*ListPage, error) {
+	return u.list(ctx, bod(day), eod(day), page)
+}
+
+// ListWeek возвращает страницу списка событий за указанную неделю
+func (u EventUsecases) ListWeek(ctx context.Context, day time.Time, page Page) (*ListPage, error) {
 	start, end := weekRange(day)
 
-	ret, err := u.findBySpan(ctx, start, end)
-	if err != nil {
-		return nil, err
+	return u.list(ctx, start, end, page)
+}
+
+// ListMonth возвращает страницу списка событий за указанный месяц
+func (u EventUsecases) ListMonth(ctx context.Context, day time.Time, page Page) (*ListPage, error) {
+	start, end := monthRange(day)
+
+	return u.list(ctx, start, end, page)
+}
+
+// ListQuarter возвращает страницу списка событий за квартал, в который попадает указанный день
+func (u EventUsecases) ListQuarter(ctx context.Context, day time.Time, page Page) (*ListPage, error) {
+	start, end := quarterRange(day)
+
+	return u.list(ctx, start, end, page)
+}
+
+// ListYear возвращает страницу списка событий за год, в который попадает указанный день
+func (u EventUsecases) ListYear(ctx context.Context, day time.Time, page Page) (*ListPage, error) {
+	start, end := yearRange(day)
+
+	return u.list(ctx, start, end, page)
+}
+
+// ListRange возвращает страницу списка событий, пересекающихся с промежутком start..end
+// Промежуток не может быть длиннее заданного SetMaxRange
+func (u EventUsecases) ListRange(ctx context.Context, start time.Time, end time.Time, page Page) (*ListPage, error) {
+	if !end.After(start) {
+		return nil, fmt.Errorf("%w: end must be after start", ErrorInvalidRange)
+	}
+	if end.Sub(start) > u.maxRange {
+		return nil, fmt.Errorf("%w: range must not exceed %s", ErrorInvalidRange, u.maxRange)
 	}
 
-	return ret, nil
+	return u.list(ctx, start, end, page)
 }
 
-// ListMonth возвращает список событий за указанный месяц
-func (u EventUsecases) ListMonth(ctx context.Context, day time.Time) ([]ListResponseItem, error) {
-	start, end := monthRange(day)
+// Agenda возвращает не более n ближайших событий, которые заканчиваются после from, в порядке их начала
+// Серии разворачиваются в повторения, поэтому в повестку попадают и уже идущие события
+func (u EventUsecases) Agenda(ctx context.Context, from time.Time, n int) ([]ListResponseItem, error) {
+	if n < 1 || n > MaxAgendaSize {
+		return nil, fmt.Errorf("%w: agenda size must be between 1 and %d", ErrorInvalidRange, MaxAgendaSize)
+	}
 
-	ret, err := u.findBySpan(ctx, start, end)
+	items, _, err := u.scan(ctx, from, entities.Forever, storage.SortAsc, nil, n)
+
+	return items, err
+}
+
+// Export возвращает события, пересекающиеся с промежутком start..end, для выгрузки во внешние форматы
+// В отличие от списков, серии возвращаются целиком вместе с правилом повторения и исключениями
+func (u EventUsecases) Export(ctx context.Context, start time.Time, end time.Time) ([]entities.Event, error) {
+	return u.storage.FindBySpan(ctx, u.calendar, start, end)
+}
+
+// find возвращает событие календаря по идентификатору. Событие другого календаря или арендатора считается не найденным.
+// Чужих событий хранилище и так не отдает, проверка арендатора здесь - вторая линия защиты
+func (u EventUsecases) find(ctx context.Context, id entities.EventID) (*entities.Event, error) {
+	event, err := u.storage.FindByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	return ret, nil
+	if !event.CalendarID.Equal(u.calendar) || event.Tenant != tenant.FromContext(ctx) {
+		return nil, storage.EntityNotFound
+	}
+
+	return event, nil
 }
 
-// findBySpan ищет события из указанного промежутка и маппит их на DTO
-func (u EventUsecases) findBySpan(ctx context.Context, start time.Time, end time.Time) ([]ListResponseItem, error) {
-	items, err := u.storage.FindBySpan(ctx, start, end)
-	if err != nil {
-		return nil, err
+// unversioned выполняет изменение attempt. Если ожидаемая версия version не задана, изменение строится
+// на только что прочитанном событии, поэтому при storage.EntityVersionConflict оно повторяется с новым чтением,
+// но не больше maxUnversionedAttempts раз: клиент, не передавший версию, не должен получать конфликт версий.
+// Если событие менялось при каждой попытке, возвращает ErrorConcurrentUpdate
+func unversioned(ctx context.Context, version int64, attempt func() error) error {
+	if version != 0 {
+		return attempt()
 	}
 
-	var ret []ListResponseItem
+	for i := 0; i < maxUnversionedAttempts; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-	// Заполняем DTO
-	for _, v := range items {
-		ret = append(ret, ListResponseItem{
-			ID:          v.ID.String(),
-			Title:       v.Title,
-			Start:       v.Start,
-			End:         v.End,
-			Description: v.Description,
-		})
+		if err := attempt(); err != storage.EntityVersionConflict {
+			return err
+		}
 	}
-	return ret, nil
+
+	return ErrorConcurrentUpdate
+}
+
+// dateBusy переводит ошибку хранилища о пересечении событий в ошибку ErrorDateBusy
+func dateBusy(err error) error {
+	if err == storage.EntitySpanBusy {
+		return ErrorDateBusy
+	}
+
+	return err
+}
+
+// keepExceptions переносит в событие исключения серии current, только если сама серия не изменилась,
+// иначе они больше не соответствуют повторениям и сбрасываются
+func keepExceptions(event, current *entities.Event) {
+	if event.Recurrence != nil && current.Recurrence != nil &&
+		current.Start.Equal(event.Start) && current.Recurrence.String() == event.Recurrence.String() {
+		event.ExDates = current.ExDates
+		event.Overrides = current.Overrides
+		return
+	}
+
+	event.ExDates = nil
+	event.Overrides = nil
+}
+
+// recurrence возвращает правило повторения из DTO или nil для одиночного события
+// К этому моменту правило уже проверено валидатором
+func recurrence(rule string) *entities.Recurrence {
+	if rule == "" {
+		return nil
+	}
+
+	r, _ := entities.ParseRecurrence(rule)
+
+	return r
+}
+
+// newOccurrenceItem маппит повторение события на DTO
+func newOccurrenceItem(event *entities.Event, o entities.Occurrence) ListResponseItem {
+	item := newListResponseItem(event)
+	item.Title, item.Start, item.End, item.Description = o.Title, o.Start, o.End, o.Description
+
+	if event.Recurrence != nil {
+		originalStart := o.OriginalStart
+		item.OriginalStart = &originalStart
+	}
+
+	return item
+}
+
+// newListResponseItem маппит сущность Событие на DTO
+func newListResponseItem(event *entities.Event) ListResponseItem {
+	item := ListResponseItem{
+		ID:          event.ID.String(),
+		Title:       event.Title,
+		Start:       event.Start,
+		End:         event.End,
+		Description: event.Description,
+		Version:     event.Version,
+	}
+
+	if event.Recurrence != nil {
+		item.RRule = event.Recurrence.String()
+	}
+
+	return item
 }
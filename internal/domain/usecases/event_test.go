@@ -2,9 +2,12 @@ package usecases
 
 import (
 	"context"
+	"errors"
+	"github.com/go-playground/validator/v10"
 	"github.com/mzelenkin/go-calendar/internal/domain/entities"
 	storage2 "github.com/mzelenkin/go-calendar/internal/storage"
 	"github.com/mzelenkin/go-calendar/internal/storage/inmemory"
+	"sync"
 	"testing"
 	"time"
 )
@@ -47,7 +50,7 @@ func TestEventUsecases_CreateAndDelete(t *testing.T) {
 		t.Fail()
 	}
 
-	err = usecase.Delete(ctx, eventId)
+	err = usecase.Delete(ctx, eventId, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -58,6 +61,39 @@ func TestEventUsecases_CreateAndDelete(t *testing.T) {
 	}
 }
 
+// TestEventUsecases_CreateOutOfTime проверяет, что событие за пределами entities.Forever или до начала нашей эры
+// не создается: его не нашла бы выборка всех событий
+func TestEventUsecases_CreateOutOfTime(t *testing.T) {
+	ctx := context.Background()
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	usecase := NewEventUsecases(storage)
+
+	tests := []struct {
+		name       string
+		start, end time.Time
+		field      string
+	}{
+		{"after forever", entities.Forever.Add(-time.Hour), entities.Forever.Add(time.Second), "End"},
+		{"before era", time.Time{}.Add(-time.Hour), time.Time{}.Add(time.Hour), "Start"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := usecase.Create(ctx, &CreateEventRequest{Title: "Событие", Start: tt.start, End: tt.end})
+
+			var errs validator.ValidationErrors
+			if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Field() != tt.field || errs[0].Tag() != "eventtime" {
+				t.Fatalf("expected eventtime violation of %s, got %v", tt.field, err)
+			}
+		})
+	}
+
+	// Граница допустима
+	if _, err := usecase.Create(ctx, &CreateEventRequest{Title: "Событие", Start: entities.Forever.Add(-time.Hour), End: entities.Forever}); err != nil {
+		t.Fatal(err)
+	}
+}
+
 // TestEventUsecases_Update проверяет обновление
 func TestEventUsecases_Update(t *testing.T) {
 	ctx := context.Background()
@@ -108,6 +144,163 @@ func TestEventUsecases_Update(t *testing.T) {
 	}
 }
 
+// TestEventUsecases_Version проверяет, что изменение и удаление устаревшей версии события отклоняются
+func TestEventUsecases_Version(t *testing.T) {
+	ctx := context.Background()
+
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	usecase := NewEventUsecases(storage)
+
+	start := time.Date(2020, 5, 12, 10, 0, 0, 0, time.UTC)
+	id, err := usecase.Create(ctx, &CreateEventRequest{Title: "Событие", Start: start, End: start.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventID, _ := entities.NewEventID(id)
+
+	update := UpdateEventRequest{ID: id, Title: "Первое изменение", Start: start, End: start.Add(time.Hour), Version: 1}
+	if err = usecase.Update(ctx, &update); err != nil {
+		t.Fatal(err)
+	}
+
+	// Второй клиент изменяет событие, прочитанное до первого изменения
+	update.Title = "Второе изменение"
+	if err = usecase.Update(ctx, &update); err != storage2.EntityVersionConflict {
+		t.Fatalf("expected EntityVersionConflict, got %v", err)
+	}
+	if err = usecase.Delete(ctx, eventID, 1); err != storage2.EntityVersionConflict {
+		t.Fatalf("expected EntityVersionConflict, got %v", err)
+	}
+
+	item, err := usecase.Get(ctx, eventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Title != "Первое изменение" || item.Version != 2 {
+		t.Fatalf("unexpected event %+v", item)
+	}
+
+	// Без версии изменяется текущая версия
+	update.Version = 0
+	if err = usecase.Update(ctx, &update); err != nil {
+		t.Fatal(err)
+	}
+	if err = usecase.Delete(ctx, eventID, 3); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// racingStorage хранилище, в котором перед каждой из первых races записей событие успевает изменить другой клиент
+type racingStorage struct {
+	Storage
+	races int
+}
+
+// race изменяет событие id в обход сценария, как одновременный запрос
+func (s *racingStorage) race(ctx context.Context, id entities.EventID) {
+	if s.races == 0 {
+		return
+	}
+	s.races--
+
+	event, err := s.Storage.FindByID(ctx, id)
+	if err != nil {
+		return
+	}
+	event.Description += "+"
+	_ = s.Storage.Update(ctx, event)
+}
+
+func (s *racingStorage) Update(ctx context.Context, event *entities.Event) error {
+	s.race(ctx, event.ID)
+	return s.Storage.Update(ctx, event)
+}
+
+func (s *racingStorage) UpdateIfFree(ctx context.Context, event *entities.Event) error {
+	s.race(ctx, event.ID)
+	return s.Storage.UpdateIfFree(ctx, event)
+}
+
+func (s *racingStorage) SplitIfFree(ctx context.Context, head, tail *entities.Event) error {
+	s.race(ctx, head.ID)
+	return s.Storage.SplitIfFree(ctx, head, tail)
+}
+
+func (s *racingStorage) DeleteByID(ctx context.Context, id *entities.EventID, version int64) error {
+	s.race(ctx, *id)
+	return s.Storage.DeleteByID(ctx, id, version)
+}
+
+// TestEventUsecases_VersionRace проверяет, что изменение без ожидаемой версии не отказывает из-за одновременной записи,
+// а изменение с версией - отказывает
+func TestEventUsecases_VersionRace(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		change func(u *EventUsecases, id string, start time.Time, version int64) error
+	}{
+		{"update", func(u *EventUsecases, id string, start time.Time, version int64) error {
+			return u.Update(ctx, &UpdateEventRequest{ID: id, Title: "Ретро", Start: start, End: start.Add(time.Hour), Version: version})
+		}},
+		{"patch", func(u *EventUsecases, id string, start time.Time, version int64) error {
+			return u.Patch(ctx, &PatchEventRequest{ID: id, Patch: []byte(`{"title": "Ретро"}`), Version: version})
+		}},
+		{"patch times", func(u *EventUsecases, id string, start time.Time, version int64) error {
+			return u.Patch(ctx, &PatchEventRequest{ID: id, Patch: []byte(`{"end": "` + start.Add(time.Hour).Format(time.RFC3339) + `"}`), Version: version})
+		}},
+		{"update this", func(u *EventUsecases, id string, start time.Time, version int64) error {
+			return u.UpdateOccurrence(ctx, &UpdateOccurrenceRequest{ID: id, OriginalStart: start.AddDate(0, 0, 7), Mode: ModeThis,
+				Title: "Ретро", Start: start.AddDate(0, 0, 7), End: start.AddDate(0, 0, 7).Add(time.Hour), Version: version})
+		}},
+		{"update following", func(u *EventUsecases, id string, start time.Time, version int64) error {
+			return u.UpdateOccurrence(ctx, &UpdateOccurrenceRequest{ID: id, OriginalStart: start.AddDate(0, 0, 7), Mode: ModeFollowing,
+				Title: "Ретро", Start: start.AddDate(0, 0, 7), End: start.AddDate(0, 0, 7).Add(time.Hour), Version: version})
+		}},
+		{"delete this", func(u *EventUsecases, id string, start time.Time, version int64) error {
+			return u.DeleteOccurrence(ctx, &DeleteOccurrenceRequest{ID: id, OriginalStart: start.AddDate(0, 0, 7), Mode: ModeThis, Version: version})
+		}},
+		{"delete all", func(u *EventUsecases, id string, start time.Time, version int64) error {
+			return u.DeleteOccurrence(ctx, &DeleteOccurrenceRequest{ID: id, OriginalStart: start, Mode: ModeAll, Version: version})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory, _ := inmemory.NewEventInMemoryStorage()
+			racing := &racingStorage{Storage: memory}
+			usecase := NewEventUsecases(racing)
+
+			start := time.Date(2020, 1, 6, 10, 0, 0, 0, time.UTC)
+			id, err := usecase.Create(ctx, &CreateEventRequest{Title: "Стендап", Start: start, End: start.Add(15 * time.Minute), RRule: "FREQ=WEEKLY;COUNT=4"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			racing.races = 3
+			if err = tt.change(usecase, id, start, 0); err != nil {
+				t.Fatalf("change without version: %v", err)
+			}
+
+			// Создаем заново: удаление могло его удалить
+			id, err = usecase.Create(ctx, &CreateEventRequest{Title: "Стендап", Start: start.AddDate(1, 0, 0), End: start.AddDate(1, 0, 0).Add(15 * time.Minute), RRule: "FREQ=WEEKLY;COUNT=4"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			racing.races = 1
+			if err = tt.change(usecase, id, start.AddDate(1, 0, 0), 1); err != storage2.EntityVersionConflict {
+				t.Fatalf("expected EntityVersionConflict with version, got %v", err)
+			}
+
+			racing.races = maxUnversionedAttempts
+			if err = tt.change(usecase, id, start.AddDate(1, 0, 0), 0); err != ErrorConcurrentUpdate {
+				t.Fatalf("expected ErrorConcurrentUpdate, got %v", err)
+			}
+		})
+	}
+}
+
 // TestEventUsecases_Crosses проверяет пересекающиеся события
 func TestEventUsecases_Crosses(t *testing.T) {
 	var err error
@@ -139,6 +332,48 @@ func TestEventUsecases_Crosses(t *testing.T) {
 	}
 }
 
+// TestEventUsecases_CreateConcurrent проверяет, что одновременные запросы на одно время не создают двойную запись
+func TestEventUsecases_CreateConcurrent(t *testing.T) {
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	usecase := NewEventUsecases(storage)
+	start := time.Date(2020, 5, 12, 10, 0, 0, 0, time.Local)
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := usecase.Create(context.Background(), &CreateEventRequest{
+				Title: "Переговорная",
+				Start: start,
+				End:   start.Add(time.Hour),
+			})
+			errs <- err
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		switch err {
+		case nil:
+			created++
+		case ErrorDateBusy:
+		default:
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+
+	if created != 1 {
+		t.Errorf("expected exactly 1 created event, got %d", created)
+	}
+}
+
 // TestEventUsecases_Lists длинный длинный тест, проверяющий методы выборки за день, неделю и месяц
 // В будущем надо будет его распилить на несколько и вообще тестить ByRange
 func TestEventUsecases_Lists(t *testing.T) {
@@ -148,10 +383,13 @@ func TestEventUsecases_Lists(t *testing.T) {
 	storage, _ := inmemory.NewEventInMemoryStorage()
 	usecase := NewEventUsecases(storage)
 
+	// Среда в середине месяца: вся неделя и следующий за ней день попадают в тот же месяц
+	now := time.Date(2020, 5, 13, 12, 0, 0, 0, time.Local)
+
 	_, err = usecase.Create(ctx, &CreateEventRequest{
 		Title:       "Событие №1",
-		Start:       bod(time.Now()),
-		End:         bod(time.Now()).Add(1 * time.Hour),
+		Start:       bod(now),
+		End:         bod(now).Add(1 * time.Hour),
 		Description: "Это описание события номер 1",
 	})
 	if err != nil {
@@ -160,8 +398,8 @@ func TestEventUsecases_Lists(t *testing.T) {
 
 	_, err = usecase.Create(ctx, &CreateEventRequest{
 		Title:       "Событие №1",
-		Start:       bod(time.Now()).Add(19 * time.Hour),
-		End:         bod(time.Now()).Add(22 * time.Hour),
+		Start:       bod(now).Add(19 * time.Hour),
+		End:         bod(now).Add(22 * time.Hour),
 		Description: "Это описание события номер 2",
 	})
 	if err != nil {
@@ -170,15 +408,15 @@ func TestEventUsecases_Lists(t *testing.T) {
 
 	_, err = usecase.Create(ctx, &CreateEventRequest{
 		Title:       "Событие №3",
-		Start:       bod(time.Now()).Add(1*time.Hour).AddDate(0, 0, 1),
-		End:         bod(time.Now()).Add(5*time.Hour).AddDate(0, 0, 1),
+		Start:       bod(now).Add(1*time.Hour).AddDate(0, 0, 1),
+		End:         bod(now).Add(5*time.Hour).AddDate(0, 0, 1),
 		Description: "Это описание события за пределами дня",
 	})
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	events, err := usecase.ListDay(ctx, time.Now())
+	events, err := pageItems(usecase.ListDay(ctx, now, Page{}))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -190,7 +428,7 @@ func TestEventUsecases_Lists(t *testing.T) {
 	// ============================
 	// Чтобы два раза не создавать
 	// Проверка выборки за неделю
-	weekStart, weekEnd := weekRange(time.Now())
+	weekStart, weekEnd := weekRange(now)
 	_, err = usecase.Create(ctx, &CreateEventRequest{
 		Title:       "Событие №4",
 		Start:       weekStart.Add(1*time.Hour).AddDate(0, 0, 1),
@@ -211,7 +449,7 @@ func TestEventUsecases_Lists(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	weekEvents, err := usecase.ListWeek(ctx, time.Now())
+	weekEvents, err := pageItems(usecase.ListWeek(ctx, now, Page{}))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -224,7 +462,6 @@ func TestEventUsecases_Lists(t *testing.T) {
 	// ============================
 	// Чтобы два раза не создавать
 	// Проверка выборки за месяц
-	now := time.Now()
 	year := now.Year()
 	month := now.Month()
 	_, err = usecase.Create(ctx, &CreateEventRequest{
@@ -247,7 +484,7 @@ func TestEventUsecases_Lists(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	monthEvents, err := usecase.ListMonth(ctx, time.Now())
+	monthEvents, err := pageItems(usecase.ListMonth(ctx, now, Page{}))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -257,3 +494,62 @@ func TestEventUsecases_Lists(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// TestEventUsecases_Recurring проверяет развертывание серии в списках и поиск пересечений по всем повторениям
+func TestEventUsecases_Recurring(t *testing.T) {
+	ctx := context.Background()
+
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	usecase := NewEventUsecases(storage)
+
+	// Понедельник, 6 января 2020
+	monday := time.Date(2020, 1, 6, 10, 0, 0, 0, time.Local)
+	_, err := usecase.Create(ctx, &CreateEventRequest{
+		Title: "Стендап",
+		Start: monday,
+		End:   monday.Add(15 * time.Minute),
+		RRule: "FREQ=WEEKLY;BYDAY=MO,TH",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// В январе 2020 начиная с 6 числа 4 понедельника и 4 четверга
+	events, err := pageItems(usecase.ListMonth(ctx, monday, Page{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 8 {
+		t.Fatalf("expected 8 occurrences, got %d", len(events))
+	}
+
+	events, err = pageItems(usecase.ListDay(ctx, monday.AddDate(0, 2, 0), Page{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 6 марта 2020 пятница, повторений нет
+	if len(events) != 0 {
+		t.Fatalf("expected no occurrences, got %d", len(events))
+	}
+
+	// Событие на повторении через год пересекается с серией
+	_, err = usecase.Create(ctx, &CreateEventRequest{
+		Title: "Встреча",
+		Start: monday.AddDate(0, 0, 52*7),
+		End:   monday.AddDate(0, 0, 52*7).Add(time.Hour),
+	})
+	if err != ErrorDateBusy {
+		t.Fatalf("expected ErrorDateBusy, got %v", err)
+	}
+
+	// Некорректное правило не проходит валидацию
+	_, err = usecase.Create(ctx, &CreateEventRequest{
+		Title: "Встреча",
+		Start: monday.Add(time.Hour),
+		End:   monday.Add(2 * time.Hour),
+		RRule: "FREQ=SOMETIMES",
+	})
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+}
@@ -0,0 +1,162 @@
+package usecases
+
+import (
+	"context"
+	"github.com/go-playground/validator/v10"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	"time"
+)
+
+// ImportStatus результат импорта одного события
+type ImportStatus string
+
+const (
+	ImportCreated ImportStatus = "created" // Событие создано
+	ImportUpdated ImportStatus = "updated" // Существующее событие с тем же UID обновлено
+	ImportSkipped ImportStatus = "skipped" // Пропущено, т.к. пересекается с другими событиями
+	ImportInvalid ImportStatus = "invalid" // Событие некорректно
+)
+
+// ImportEventRequest это DTO с одним импортируемым событием
+// Идентификатор события выводится из внешнего UID, поэтому повторный импорт обновляет те же события.
+// В календарях, кроме календаря по умолчанию, идентификатор выводится из UID и календаря:
+// один файл можно импортировать в несколько календарей. Так же у арендаторов, кроме арендатора по умолчанию,
+// в идентификатор входит арендатор: идентификаторы событий общие для всех арендаторов
+type ImportEventRequest struct {
+	UID         string    `validate:"required"`
+	Title       string    `validate:"required,min=3,max=50"`
+	Start       time.Time `validate:"required,eventtime,ltfield=End"`
+	End         time.Time `validate:"required,eventtime,gtfield=Start"`
+	Description string
+	RRule       string `validate:"omitempty,rrule"`
+	ExDates     []time.Time
+	Overrides   []ImportOverrideRequest `validate:"dive"`
+
+	// Err ошибка разбора события из исходного формата, такое событие считается некорректным
+	Err error `validate:"-"`
+}
+
+// ImportOverrideRequest это DTO с измененным повторением импортируемой серии (VEVENT с RECURRENCE-ID).
+// Проверяется по тем же правилам, что и само событие
+type ImportOverrideRequest struct {
+	OriginalStart time.Time `validate:"required"`
+	Title         string    `validate:"required,min=3,max=50"`
+	Start         time.Time `validate:"required,eventtime,ltfield=End"`
+	End           time.Time `validate:"required,eventtime,gtfield=Start"`
+	Description   string
+}
+
+// ImportResult результат импорта одного события
+type ImportResult struct {
+	UID    string       `json:"uid"`
+	ID     string       `json:"id,omitempty"`
+	Status ImportStatus `json:"status"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// ImportReport отчет об импорте
+type ImportReport struct {
+	Created int            `json:"created"`
+	Updated int            `json:"updated"`
+	Skipped int            `json:"skipped"`
+	Invalid int            `json:"invalid"`
+	Items   []ImportResult `json:"items"`
+}
+
+// Import создает или обновляет события по их UID.
+// Некорректные и пересекающиеся с другими события не прерывают импорт, а отражаются в отчете;
+// ошибка возвращается только при сбое хранилища
+func (u EventUsecases) Import(ctx context.Context, items []ImportEventRequest) (*ImportReport, error) {
+	report := &ImportReport{Items: make([]ImportResult, 0, len(items))}
+
+	for i := range items {
+		result, err := u.importEvent(ctx, &items[i])
+		if err != nil {
+			return report, err
+		}
+
+		switch result.Status {
+		case ImportCreated:
+			report.Created++
+		case ImportUpdated:
+			report.Updated++
+		case ImportSkipped:
+			report.Skipped++
+		case ImportInvalid:
+			report.Invalid++
+		}
+
+		report.Items = append(report.Items, result)
+	}
+
+	return report, nil
+}
+
+// importEvent создает или обновляет одно событие
+func (u EventUsecases) importEvent(ctx context.Context, data *ImportEventRequest) (ImportResult, error) {
+	result := ImportResult{UID: data.UID, Status: ImportInvalid}
+
+	if data.Err != nil {
+		result.Error = data.Err.Error()
+		return result, nil
+	}
+
+	if err := validate.StructCtx(ctx, data); err != nil {
+		if _, ok := err.(validator.ValidationErrors); !ok {
+			return result, err
+		}
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	uid := data.UID
+	if !u.calendar.IsDefault() {
+		uid = u.calendar.String() + "/" + uid
+	}
+	if owner := tenant.FromContext(ctx); owner != tenant.Default {
+		uid = "tenant:" + owner + "/" + uid
+	}
+
+	event := entities.Event{
+		ID:          entities.NewEventIDFromUID(uid),
+		CalendarID:  u.calendar,
+		Title:       data.Title,
+		Start:       data.Start,
+		End:         data.End,
+		Description: data.Description,
+		Recurrence:  recurrence(data.RRule),
+		ExDates:     data.ExDates,
+	}
+	for _, o := range data.Overrides {
+		event.Overrides = append(event.Overrides, entities.Override(o))
+	}
+	result.ID = event.ID.String()
+
+	// Импорт заменяет событие, какой бы ни была его версия: если его успели изменить, оно перечитывается
+	err := unversioned(ctx, 0, func() error {
+		current, err := u.find(ctx, event.ID)
+		if err != nil && err != storage.EntityNotFound {
+			return err
+		}
+
+		if err == nil {
+			result.Status = ImportUpdated
+			event.Version = current.Version
+			return u.storage.UpdateIfFree(ctx, &event)
+		}
+
+		result.Status = ImportCreated
+		event.Version = 0
+		return u.storage.CreateIfFree(ctx, &event)
+	})
+
+	if err == storage.EntitySpanBusy {
+		result.Status = ImportSkipped
+		result.Error = ErrorDateBusy.Error()
+		return result, nil
+	}
+
+	return result, err
+}
@@ -0,0 +1,91 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/storage/inmemory"
+	"testing"
+	"time"
+)
+
+// TestEventUsecases_Import проверяет создание, повторный импорт по UID, пропуск пересечений и некорректные события
+func TestEventUsecases_Import(t *testing.T) {
+	ctx := context.Background()
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	usecase := NewEventUsecases(storage)
+
+	start := time.Date(2020, 1, 6, 10, 0, 0, 0, time.Local)
+	items := []ImportEventRequest{
+		{UID: "standup@example.com", Title: "Стендап", Start: start, End: start.Add(15 * time.Minute), RRule: "FREQ=DAILY;COUNT=5"},
+		{UID: "review@example.com", Title: "Ревью", Start: start.Add(5 * time.Minute), End: start.Add(time.Hour)},
+		{UID: "empty@example.com", Title: "", Start: start, End: start.Add(time.Hour)},
+		{UID: "broken@example.com", Err: errors.New("ical: unknown TZID")},
+	}
+
+	report, err := usecase.Import(ctx, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Created != 1 || report.Skipped != 1 || report.Invalid != 2 || report.Updated != 0 || len(report.Items) != 4 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	id := entities.NewEventIDFromUID("standup@example.com").String()
+	if report.Items[0].ID != id || report.Items[0].Status != ImportCreated {
+		t.Errorf("unexpected result %+v", report.Items[0])
+	}
+	if report.Items[3].Status != ImportInvalid || report.Items[3].Error == "" {
+		t.Errorf("parse error must be reported, got %+v", report.Items[3])
+	}
+
+	// Повторный импорт той же серии обновляет ее, а не создает копию
+	items[0].Title = "Утренний стендап"
+	report, err = usecase.Import(ctx, items[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Updated != 1 || report.Items[0].ID != id {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	event, err := usecase.Get(ctx, entities.NewEventIDFromUID("standup@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Title != "Утренний стендап" || event.RRule != "FREQ=DAILY;COUNT=5" {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
+
+// TestEventUsecases_Import_InvalidOverride проверяет, что измененные повторения проверяются так же, как события
+func TestEventUsecases_Import_InvalidOverride(t *testing.T) {
+	ctx := context.Background()
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	usecase := NewEventUsecases(storage)
+
+	start := time.Date(2020, 1, 6, 10, 0, 0, 0, time.Local)
+	second := start.AddDate(0, 0, 1)
+	series := func(o ImportOverrideRequest) ImportEventRequest {
+		return ImportEventRequest{
+			UID: "standup@example.com", Title: "Стендап", Start: start, End: start.Add(15 * time.Minute),
+			RRule: "FREQ=DAILY;COUNT=5", Overrides: []ImportOverrideRequest{o},
+		}
+	}
+
+	report, err := usecase.Import(ctx, []ImportEventRequest{
+		series(ImportOverrideRequest{OriginalStart: second, Title: "x", Start: second, End: second.Add(time.Hour)}),
+		series(ImportOverrideRequest{OriginalStart: second, Title: "Стендап", Start: second, End: second.Add(-time.Hour)}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Invalid != 2 || report.Created != 0 {
+		t.Fatalf("invalid overrides must be reported, got %+v", report)
+	}
+
+	if _, err = usecase.Get(ctx, entities.NewEventIDFromUID("standup@example.com")); err == nil {
+		t.Error("series with invalid override must not be stored")
+	}
+}
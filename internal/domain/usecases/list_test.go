@@ -0,0 +1,136 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"github.com/mzelenkin/go-calendar/internal/storage/inmemory"
+	"testing"
+	"time"
+)
+
+// newListUsecases создает сценарии поверх хранилища с событиями, заданными названием и началом. Событие длится час
+func newListUsecases(t *testing.T, events map[string]time.Time) *EventUsecases {
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	usecase := NewEventUsecases(storage)
+
+	for title, start := range events {
+		_, err := usecase.Create(context.Background(), &CreateEventRequest{Title: title, Start: start, End: start.Add(time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return usecase
+}
+
+// listTitles возвращает названия событий списка в его порядке
+func listTitles(items []ListResponseItem) []string {
+	var ret []string
+	for _, item := range items {
+		ret = append(ret, item.Title)
+	}
+
+	return ret
+}
+
+// TestEventUsecases_ListPeriods проверяет выборки за квартал, год и произвольный промежуток
+func TestEventUsecases_ListPeriods(t *testing.T) {
+	ctx := context.Background()
+	usecase := newListUsecases(t, map[string]time.Time{
+		"Март":    time.Date(2020, 3, 31, 22, 0, 0, 0, time.Local),
+		"Апрель":  time.Date(2020, 4, 1, 10, 0, 0, 0, time.Local),
+		"Июнь":    time.Date(2020, 6, 30, 10, 0, 0, 0, time.Local),
+		"Декабрь": time.Date(2020, 12, 31, 10, 0, 0, 0, time.Local),
+		"Январь":  time.Date(2021, 1, 1, 10, 0, 0, 0, time.Local),
+	})
+	day := time.Date(2020, 5, 12, 0, 0, 0, 0, time.Local)
+
+	quarter, err := pageItems(usecase.ListQuarter(ctx, day, Page{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quarter) != 2 {
+		t.Errorf("expected April and June in the quarter, got %v", listTitles(quarter))
+	}
+
+	year, err := pageItems(usecase.ListYear(ctx, day, Page{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(year) != 4 {
+		t.Errorf("expected 4 events in the year, got %v", listTitles(year))
+	}
+
+	items, err := pageItems(usecase.ListRange(ctx, time.Date(2020, 4, 1, 0, 0, 0, 0, time.Local), time.Date(2021, 1, 1, 0, 0, 0, 0, time.Local), Page{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 {
+		t.Errorf("expected 3 events in the range, got %v", listTitles(items))
+	}
+
+	tests := []struct {
+		name       string
+		start, end time.Time
+	}{
+		{"empty", day, day},
+		{"inverted", day, day.Add(-time.Hour)},
+		{"too long", day, day.Add(DefaultMaxRange + time.Nanosecond)},
+	}
+	for _, tt := range tests {
+		if _, err = usecase.ListRange(ctx, tt.start, tt.end, Page{}); !errors.Is(err, ErrorInvalidRange) {
+			t.Errorf("%s: expected ErrorInvalidRange, got %v", tt.name, err)
+		}
+	}
+
+	usecase.SetMaxRange(24 * time.Hour)
+	if _, err = usecase.ListRange(ctx, day, day.AddDate(0, 0, 2), Page{}); !errors.Is(err, ErrorInvalidRange) {
+		t.Errorf("expected ErrorInvalidRange for a range longer than the configured maximum, got %v", err)
+	}
+}
+
+// TestEventUsecases_Agenda проверяет выборку ближайших событий
+func TestEventUsecases_Agenda(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2020, 5, 12, 10, 30, 0, 0, time.Local)
+	usecase := newListUsecases(t, map[string]time.Time{
+		"Прошедшее": now.Add(-2 * time.Hour),
+		"Идущее":    now.Add(-30 * time.Minute),
+		"Завтра":    now.AddDate(0, 0, 1),
+		"Через год": now.AddDate(1, 0, 0),
+	})
+
+	// Серия по понедельникам, первое повторение после now - 18 мая
+	_, err := usecase.Create(ctx, &CreateEventRequest{
+		Title: "Стендап",
+		Start: time.Date(2020, 5, 4, 9, 0, 0, 0, time.Local),
+		End:   time.Date(2020, 5, 4, 9, 15, 0, 0, time.Local),
+		RRule: "FREQ=WEEKLY;COUNT=3",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := usecase.Agenda(ctx, now, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := listTitles(items); len(got) != 3 || got[0] != "Идущее" || got[1] != "Завтра" || got[2] != "Стендап" {
+		t.Fatalf("unexpected agenda %v", got)
+	}
+
+	// Дальние события находятся расширением промежутка поиска
+	items, err = usecase.Agenda(ctx, now, MaxAgendaSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := listTitles(items); len(got) != 4 || got[3] != "Через год" {
+		t.Fatalf("unexpected agenda %v", got)
+	}
+
+	for _, n := range []int{0, MaxAgendaSize + 1} {
+		if _, err = usecase.Agenda(ctx, now, n); !errors.Is(err, ErrorInvalidRange) {
+			t.Errorf("%d: expected ErrorInvalidRange, got %v", n, err)
+		}
+	}
+}
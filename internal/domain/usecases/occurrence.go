@@ -0,0 +1,176 @@
+package usecases
+
+import (
+	"context"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"time"
+)
+
+// OccurrenceMode область действия изменения или удаления повторения серии
+type OccurrenceMode string
+
+const (
+	ModeThis      OccurrenceMode = "this"      // Только это повторение
+	ModeFollowing OccurrenceMode = "following" // Это и все последующие повторения
+	ModeAll       OccurrenceMode = "all"       // Вся серия
+)
+
+// UpdateOccurrenceRequest это DTO с входными данными для изменения повторения серии
+// Повторение адресуется исходным началом OriginalStart (см. ListResponseItem.OriginalStart)
+type UpdateOccurrenceRequest struct {
+	ID            string         `validate:"required,uuid"`
+	OriginalStart time.Time      `validate:"required"`
+	Mode          OccurrenceMode `validate:"required,oneof=this following all"`
+	Title         string         `validate:"required,min=3,max=50"`
+	Start         time.Time      `validate:"required,eventtime,ltfield=End"`
+	End           time.Time      `validate:"required,eventtime,gtfield=Start"`
+	Description   string
+	Version       int64 // Ожидаемая версия серии, 0 - изменить любую текущую версию
+}
+
+// DeleteOccurrenceRequest это DTO с входными данными для удаления повторения серии
+type DeleteOccurrenceRequest struct {
+	ID            string         `validate:"required,uuid"`
+	OriginalStart time.Time      `validate:"required"`
+	Mode          OccurrenceMode `validate:"required,oneof=this following all"`
+	Version       int64          // Ожидаемая версия серии, 0 - изменить любую текущую версию
+}
+
+// UpdateOccurrence изменяет повторение серии:
+// ModeThis - сохраняет изменение только этого повторения,
+// ModeFollowing - отделяет это и последующие повторения в новую серию и изменяет ее,
+// ModeAll - изменяет всю серию, сдвигая ее так же, как сдвинуто это повторение
+func (u EventUsecases) UpdateOccurrence(ctx context.Context, data *UpdateOccurrenceRequest) error {
+	err := validate.StructCtx(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	return unversioned(ctx, data.Version, func() error {
+		mode := data.Mode
+
+		event, err := u.findOccurrence(ctx, data.ID, data.OriginalStart, data.Version)
+		if err != nil {
+			return err
+		}
+
+		delta := data.Start.Sub(data.OriginalStart)
+		duration := data.End.Sub(data.Start)
+
+		// Разделение на первом повторении равносильно изменению всей серии
+		if mode == ModeFollowing && data.OriginalStart.Equal(event.Start) {
+			mode = ModeAll
+		}
+
+		switch mode {
+		case ModeThis:
+			event.SetOverride(entities.Override{
+				OriginalStart: data.OriginalStart,
+				Title:         data.Title,
+				Start:         data.Start,
+				End:           data.End,
+				Description:   data.Description,
+			})
+
+		case ModeFollowing:
+			tail := event.Split(data.OriginalStart)
+			tail.ID, err = entities.NewEventID("")
+			if err != nil {
+				return err
+			}
+			// Новая серия создается первой версией, а не продолжает версии исходной
+			tail.Version = 0
+
+			if !tail.CanShift(delta) {
+				return ErrorShiftByRule
+			}
+
+			tail.Title = data.Title
+			tail.Description = data.Description
+			tail.Shift(delta, duration)
+
+			// Усечение и создание новой серии записываются хранилищем вместе: если время новой серии занято,
+			// исходная серия остается нетронутой
+			err = u.storage.SplitIfFree(ctx, event, &tail)
+
+			return dateBusy(err)
+
+		case ModeAll:
+			if !event.CanShift(delta) {
+				return ErrorShiftByRule
+			}
+
+			event.Title = data.Title
+			event.Description = data.Description
+			event.Shift(delta, duration)
+		}
+
+		err = u.storage.UpdateIfFree(ctx, event)
+
+		return dateBusy(err)
+	})
+}
+
+// DeleteOccurrence удаляет повторение серии:
+// ModeThis - отменяет только это повторение,
+// ModeFollowing - завершает серию перед этим повторением,
+// ModeAll - удаляет всю серию
+func (u EventUsecases) DeleteOccurrence(ctx context.Context, data *DeleteOccurrenceRequest) error {
+	err := validate.StructCtx(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	return unversioned(ctx, data.Version, func() error {
+		mode := data.Mode
+
+		event, err := u.findOccurrence(ctx, data.ID, data.OriginalStart, data.Version)
+		if err != nil {
+			return err
+		}
+
+		if mode == ModeFollowing && data.OriginalStart.Equal(event.Start) {
+			mode = ModeAll
+		}
+
+		switch mode {
+		case ModeThis:
+			event.Exclude(data.OriginalStart)
+		case ModeFollowing:
+			event.Truncate(data.OriginalStart)
+		case ModeAll:
+			return u.storage.DeleteByID(ctx, &event.ID, event.Version)
+		}
+
+		return u.storage.Update(ctx, event)
+	})
+}
+
+// findOccurrence находит серию с идентификатором id и проверяет, что у нее есть повторение originalStart
+// Если version не 0, серия изменяется только в этой версии: ее сверит хранилище при записи,
+// иначе - в прочитанной версии (см. unversioned)
+func (u EventUsecases) findOccurrence(ctx context.Context, id string, originalStart time.Time, version int64) (*entities.Event, error) {
+	eventID, err := entities.NewEventID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := u.find(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	if event.Recurrence == nil {
+		return nil, ErrorNotRecurring
+	}
+
+	if !event.HasOccurrence(originalStart) {
+		return nil, ErrorOccurrenceNotFound
+	}
+
+	if version != 0 {
+		event.Version = version
+	}
+
+	return event, nil
+}
@@ -0,0 +1,256 @@
+package usecases
+
+import (
+	"context"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/storage/inmemory"
+	"testing"
+	"time"
+)
+
+// createStandup создает серию стендапов по понедельникам января 2020 и возвращает ее ID и начало
+func createStandup(t *testing.T, usecase *EventUsecases) (string, time.Time) {
+	monday := time.Date(2020, 1, 6, 10, 0, 0, 0, time.Local)
+	id, err := usecase.Create(context.Background(), &CreateEventRequest{
+		Title: "Стендап",
+		Start: monday,
+		End:   monday.Add(15 * time.Minute),
+		RRule: "FREQ=WEEKLY;COUNT=4",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id, monday
+}
+
+// TestEventUsecases_UpdateOccurrence проверяет изменение повторений в режимах this, following и all
+func TestEventUsecases_UpdateOccurrence(t *testing.T) {
+	ctx := context.Background()
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	usecase := NewEventUsecases(storage)
+	id, monday := createStandup(t, usecase)
+
+	// Переносим второе повторение на вторник
+	second := monday.AddDate(0, 0, 7)
+	err := usecase.UpdateOccurrence(ctx, &UpdateOccurrenceRequest{
+		ID:            id,
+		OriginalStart: second,
+		Mode:          ModeThis,
+		Title:         "Стендап во вторник",
+		Start:         second.AddDate(0, 0, 1),
+		End:           second.AddDate(0, 0, 1).Add(15 * time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := pageItems(usecase.ListDay(ctx, second.AddDate(0, 0, 1), Page{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Title != "Стендап во вторник" || !events[0].OriginalStart.Equal(second) {
+		t.Fatalf("unexpected moved occurrence %+v", events)
+	}
+
+	// С третьего повторения стендап проходит на час позже
+	third := monday.AddDate(0, 0, 14)
+	err = usecase.UpdateOccurrence(ctx, &UpdateOccurrenceRequest{
+		ID:            id,
+		OriginalStart: third,
+		Mode:          ModeFollowing,
+		Title:         "Поздний стендап",
+		Start:         third.Add(time.Hour),
+		End:           third.Add(time.Hour + 15*time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err = pageItems(usecase.ListMonth(ctx, monday, Page{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("expected 4 occurrences, got %+v", events)
+	}
+
+	var late []ListResponseItem
+	for _, e := range events {
+		if e.Title == "Поздний стендап" {
+			late = append(late, e)
+		}
+	}
+	if len(late) != 2 || late[0].ID == id {
+		t.Fatalf("unexpected split series %+v", late)
+	}
+
+	// Переименовываем всю исходную серию, перенесенное повторение сохраняет свое название
+	err = usecase.UpdateOccurrence(ctx, &UpdateOccurrenceRequest{
+		ID:            id,
+		OriginalStart: monday,
+		Mode:          ModeAll,
+		Title:         "Утренний стендап",
+		Start:         monday,
+		End:           monday.Add(15 * time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err = pageItems(usecase.ListWeek(ctx, monday, Page{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Title != "Утренний стендап" {
+		t.Fatalf("unexpected series after update %+v", events)
+	}
+
+	// Повторения, которого нет в серии, не существует
+	err = usecase.UpdateOccurrence(ctx, &UpdateOccurrenceRequest{
+		ID:            id,
+		OriginalStart: monday.Add(time.Minute),
+		Mode:          ModeThis,
+		Title:         "Стендап",
+		Start:         monday,
+		End:           monday.Add(time.Minute),
+	})
+	if err != ErrorOccurrenceNotFound {
+		t.Fatalf("expected ErrorOccurrenceNotFound, got %v", err)
+	}
+}
+
+// TestEventUsecases_DeleteOccurrence проверяет удаление повторений в режимах this, following и all
+func TestEventUsecases_DeleteOccurrence(t *testing.T) {
+	ctx := context.Background()
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	usecase := NewEventUsecases(storage)
+	id, monday := createStandup(t, usecase)
+
+	count := func() int {
+		events, err := pageItems(usecase.ListMonth(ctx, monday, Page{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(events)
+	}
+
+	err := usecase.DeleteOccurrence(ctx, &DeleteOccurrenceRequest{ID: id, OriginalStart: monday.AddDate(0, 0, 7), Mode: ModeThis})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 3 {
+		t.Fatalf("expected 3 occurrences, got %d", n)
+	}
+
+	err = usecase.DeleteOccurrence(ctx, &DeleteOccurrenceRequest{ID: id, OriginalStart: monday.AddDate(0, 0, 14), Mode: ModeFollowing})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 1 {
+		t.Fatalf("expected 1 occurrence, got %d", n)
+	}
+
+	err = usecase.DeleteOccurrence(ctx, &DeleteOccurrenceRequest{ID: id, OriginalStart: monday, Mode: ModeAll})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eventID, _ := entities.NewEventID(id)
+	if _, err := usecase.Get(ctx, eventID); err == nil {
+		t.Fatal("series must be deleted")
+	}
+}
+
+// TestEventUsecases_UpdateOccurrence_ShiftByRule проверяет отказ переносить на другой день серию с днем месяца в правиле
+func TestEventUsecases_UpdateOccurrence_ShiftByRule(t *testing.T) {
+	ctx := context.Background()
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	usecase := NewEventUsecases(storage)
+
+	start := time.Date(2020, 1, 6, 10, 0, 0, 0, time.Local)
+	id, err := usecase.Create(ctx, &CreateEventRequest{
+		Title: "Отчет",
+		Start: start,
+		End:   start.Add(time.Hour),
+		RRule: "FREQ=MONTHLY;BYMONTHDAY=6",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second := start.AddDate(0, 1, 0)
+	for _, mode := range []OccurrenceMode{ModeAll, ModeFollowing} {
+		err = usecase.UpdateOccurrence(ctx, &UpdateOccurrenceRequest{
+			ID:            id,
+			OriginalStart: second,
+			Mode:          mode,
+			Title:         "Отчет",
+			Start:         second.AddDate(0, 0, 1),
+			End:           second.AddDate(0, 0, 1).Add(time.Hour),
+		})
+		if err != ErrorShiftByRule {
+			t.Errorf("%s: expected ErrorShiftByRule, got %v", mode, err)
+		}
+	}
+
+	// Перенос в пределах дня правило не затрагивает
+	err = usecase.UpdateOccurrence(ctx, &UpdateOccurrenceRequest{
+		ID:            id,
+		OriginalStart: second,
+		Mode:          ModeAll,
+		Title:         "Отчет",
+		Start:         second.Add(2 * time.Hour),
+		End:           second.Add(3 * time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestEventUsecases_UpdateOccurrence_FollowingBusy проверяет, что разделение серии на занятое время не меняет исходную серию
+func TestEventUsecases_UpdateOccurrence_FollowingBusy(t *testing.T) {
+	ctx := context.Background()
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	usecase := NewEventUsecases(storage)
+	id, monday := createStandup(t, usecase)
+
+	third := monday.AddDate(0, 0, 14)
+	_, err := usecase.Create(ctx, &CreateEventRequest{
+		Title: "Планирование",
+		Start: third.Add(time.Hour),
+		End:   third.Add(2 * time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = usecase.UpdateOccurrence(ctx, &UpdateOccurrenceRequest{
+		ID:            id,
+		OriginalStart: third,
+		Mode:          ModeFollowing,
+		Title:         "Поздний стендап",
+		Start:         third.Add(time.Hour),
+		End:           third.Add(time.Hour + 15*time.Minute),
+	})
+	if err != ErrorDateBusy {
+		t.Fatalf("expected ErrorDateBusy, got %v", err)
+	}
+
+	eventID, _ := entities.NewEventID(id)
+	series, err := usecase.Get(ctx, eventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if series.Version != 1 || series.RRule != "FREQ=WEEKLY;COUNT=4" {
+		t.Fatalf("series must stay untouched, got %+v", series)
+	}
+
+	events, err := pageItems(usecase.ListMonth(ctx, monday, Page{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 5 {
+		t.Fatalf("expected 4 occurrences and 1 event, got %+v", events)
+	}
+}
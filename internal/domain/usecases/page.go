@@ -0,0 +1,277 @@
+package usecases
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"sort"
+	"time"
+)
+
+// Размер страницы списка событий
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// Page параметры страницы списка событий
+type Page struct {
+	Limit  int               // Число событий на странице, 0 - DefaultPageSize
+	Order  storage.SortOrder // Порядок по началу повторений
+	Cursor string            // Курсор ListPage.Next или ListPage.Prev, пустой - первая страница
+}
+
+// ListPage страница списка событий и курсоры соседних страниц, пустые, если соседней страницы нет
+type ListPage struct {
+	Items []ListResponseItem
+	Next  string
+	Prev  string
+}
+
+// position позиция повторения в списке: начало, событие и исходное начало (для повторений серии)
+type position struct {
+	Start         time.Time `json:"s"`
+	ID            string    `json:"i"`
+	OriginalStart time.Time `json:"r,omitempty"`
+}
+
+// cursor содержимое курсора страницы. Курсор привязан к календарю, промежутку и порядку списка, в котором он выдан
+type cursor struct {
+	position
+	Back     bool              `json:"b,omitempty"` // Страница перед позицией, а не после нее
+	Order    storage.SortOrder `json:"o"`
+	From     time.Time         `json:"f"`
+	To       time.Time         `json:"t"`
+	Calendar string            `json:"c,omitempty"` // Пустой для календаря по умолчанию
+}
+
+// itemPosition возвращает позицию элемента списка
+func itemPosition(item *ListResponseItem) position {
+	p := position{Start: item.Start, ID: item.ID}
+	if item.OriginalStart != nil {
+		p.OriginalStart = *item.OriginalStart
+	}
+
+	return p
+}
+
+// before проверяет, что в списке с порядком order позиция p идет раньше other
+func (p position) before(other position, order storage.SortOrder) bool {
+	if order == storage.SortDesc {
+		p, other = other, p
+	}
+
+	switch {
+	case !p.Start.Equal(other.Start):
+		return p.Start.Before(other.Start)
+	case p.ID != other.ID:
+		return p.ID < other.ID
+	default:
+		return p.OriginalStart.Before(other.OriginalStart)
+	}
+}
+
+// encodeCursor кодирует курсор в непрозрачную для клиента строку
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor разбирает курсор и проверяет, что он выдан для того же списка
+func decodeCursor(value string, calendar string, start, end time.Time, order storage.SortOrder) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrorInvalidPage)
+	}
+
+	var c cursor
+	if err = json.Unmarshal(data, &c); err != nil || c.ID == "" {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrorInvalidPage)
+	}
+
+	if c.Order != order || !c.From.Equal(start) || !c.To.Equal(end) || c.Calendar != calendar {
+		return nil, fmt.Errorf("%w: cursor belongs to another listing", ErrorInvalidPage)
+	}
+
+	return &c, nil
+}
+
+// list возвращает страницу повторений событий, пересекающихся с промежутком start..end
+func (u EventUsecases) list(ctx context.Context, start, end time.Time, page Page) (*ListPage, error) {
+	limit := page.Limit
+	if limit == 0 {
+		limit = DefaultPageSize
+	}
+	if limit < 0 || limit > MaxPageSize {
+		return nil, fmt.Errorf("%w: page size must be between 1 and %d", ErrorInvalidPage, MaxPageSize)
+	}
+	if page.Order != storage.SortAsc && page.Order != storage.SortDesc {
+		return nil, fmt.Errorf("%w: unknown sort order", ErrorInvalidPage)
+	}
+
+	var c *cursor
+	if page.Cursor != "" {
+		var err error
+		if c, err = decodeCursor(page.Cursor, u.cursorCalendar(), start, end, page.Order); err != nil {
+			return nil, err
+		}
+	}
+
+	// Страница перед позицией - это страница после нее в обратном порядке
+	order := page.Order
+	var after *position
+	if c != nil {
+		after = &c.position
+		if c.Back {
+			order = order.Reverse()
+		}
+	}
+
+	items, more, err := u.scan(ctx, start, end, order, after, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	back := c != nil && c.Back
+	if back {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	ret := &ListPage{Items: items}
+	link := func(p position, back bool) string {
+		return encodeCursor(cursor{position: p, Back: back, Order: page.Order, From: start, To: end, Calendar: u.cursorCalendar()})
+	}
+
+	hasNext, hasPrev := more, c != nil
+	if back {
+		hasNext, hasPrev = true, more
+	}
+
+	switch {
+	case len(items) > 0:
+		if hasNext {
+			ret.Next = link(itemPosition(&items[len(items)-1]), false)
+		}
+		if hasPrev {
+			ret.Prev = link(itemPosition(&items[0]), true)
+		}
+	// Все события за позицией курсора удалены - остается вернуться с той же позиции обратно
+	case back:
+		ret.Next = link(c.position, false)
+	case c != nil:
+		ret.Prev = link(c.position, true)
+	}
+
+	return ret, nil
+}
+
+// cursorCalendar календарь списка в курсоре: пустой для календаря по умолчанию, чтобы курсоры,
+// выданные до появления календарей, оставались действительными
+func (u EventUsecases) cursorCalendar() string {
+	if u.calendar.IsDefault() {
+		return ""
+	}
+
+	return u.calendar.String()
+}
+
+// scan возвращает по порядку order не больше n повторений после позиции after (или с начала списка)
+// и признак того, что за ними есть еще повторения.
+//
+// Хранилище отдает события страницами по началу промежутка серии (по убыванию окончания для SortDesc).
+// Повторения еще не полученных событий начинаются не раньше начала последнего полученного (не позже его окончания),
+// поэтому повторения полученных событий по эту сторону границы уже окончательно упорядочены.
+// События запрашиваются, пока таких повторений не наберется больше n
+func (u EventUsecases) scan(ctx context.Context, start, end time.Time, order storage.SortOrder, after *position, n int) ([]ListResponseItem, bool, error) {
+	// Повторения до позиции after не нужны, поэтому промежуток выборки сужается до нее
+	if after != nil {
+		if order == storage.SortAsc && after.Start.After(start) {
+			start = after.Start
+		}
+		if order == storage.SortDesc && after.Start.Before(end) {
+			end = after.Start.Add(time.Nanosecond)
+		}
+	}
+
+	query := storage.SpanQuery{Calendar: u.calendar, Start: start, End: end, Order: order, Limit: n + 1}
+
+	var events []entities.Event
+	var items []ListResponseItem
+	for {
+		found, err := u.storage.FindPage(ctx, query)
+		if err != nil {
+			return nil, false, err
+		}
+		events = append(events, found...)
+
+		exhausted := len(found) < query.Limit
+		lo, hi := start, end
+		if !exhausted {
+			key := storage.Key(&found[len(found)-1], order)
+			query.After = &key
+
+			if order == storage.SortAsc {
+				hi = key.Bound
+			} else {
+				lo = key.Bound
+			}
+		}
+
+		// Бесконечные серии разворачиваются постепенно, начиная с недели, иначе повестка
+		// развернула бы их до конца времен
+		for window := agendaWindow; ; window *= 2 {
+			limit := hi
+			if order == storage.SortAsc && window < maxAgendaWindow && start.Add(window).Before(limit) {
+				limit = start.Add(window)
+			}
+
+			items = occurrenceItems(events, lo, limit, order, after, !exhausted && order == storage.SortDesc)
+			if len(items) > n || limit.Equal(hi) {
+				break
+			}
+		}
+
+		if len(items) > n || exhausted {
+			break
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return itemPosition(&items[i]).before(itemPosition(&items[j]), order)
+	})
+
+	if len(items) > n {
+		return items[:n], true, nil
+	}
+
+	return items, false, nil
+}
+
+// occurrenceItems разворачивает события в повторения, пересекающиеся с промежутком start..end
+// и идущие после позиции after. Если strict, повторения, начавшиеся до start, пропускаются
+func occurrenceItems(events []entities.Event, start, end time.Time, order storage.SortOrder, after *position, strict bool) []ListResponseItem {
+	var ret []ListResponseItem
+
+	for i := range events {
+		for _, o := range events[i].Occurrences(start, end) {
+			if strict && o.Start.Before(start) {
+				continue
+			}
+
+			item := newOccurrenceItem(&events[i], o)
+			if after != nil && !after.before(itemPosition(&item), order) {
+				continue
+			}
+
+			ret = append(ret, item)
+		}
+	}
+
+	return ret
+}
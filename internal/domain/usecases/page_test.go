@@ -0,0 +1,158 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	storage2 "github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/storage/inmemory"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// pageItems возвращает элементы страницы, чтобы проверки списков не зависели от постраничной выдачи
+func pageItems(page *ListPage, err error) ([]ListResponseItem, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return page.Items, nil
+}
+
+// newPageUsecases создает сценарии поверх хранилища с одиночными событиями, в том числе с одинаковым началом,
+// и серией, которая начинается раньше всех событий месяца и перемежается с ними
+func newPageUsecases(t *testing.T) *EventUsecases {
+	ctx := context.Background()
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	usecase := NewEventUsecases(storage)
+
+	day := time.Date(2020, 5, 4, 9, 0, 0, 0, time.Local)
+	for i := 0; i < 8; i++ {
+		// По два события на каждое начало, их пересечение проверять не нужно
+		start := day.AddDate(0, 0, i/2*7)
+		id, _ := entities.NewEventID("")
+		event := entities.Event{ID: id, Title: "Событие", Start: start, End: start.Add(time.Hour)}
+		if err := storage.Create(ctx, &event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	series := time.Date(2020, 1, 1, 18, 0, 0, 0, time.Local)
+	_, err := usecase.Create(ctx, &CreateEventRequest{
+		Title: "Серия",
+		Start: series,
+		End:   series.Add(time.Hour),
+		RRule: "FREQ=WEEKLY;BYDAY=WE",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return usecase
+}
+
+// positions возвращает позиции элементов списка
+func positions(items []ListResponseItem) []position {
+	var ret []position
+	for i := range items {
+		ret = append(ret, itemPosition(&items[i]))
+	}
+
+	return ret
+}
+
+// TestEventUsecases_Page проверяет, что страницы по курсорам next и prev покрывают весь список без повторов
+func TestEventUsecases_Page(t *testing.T) {
+	ctx := context.Background()
+	usecase := newPageUsecases(t)
+	day := time.Date(2020, 5, 12, 0, 0, 0, 0, time.Local)
+
+	for _, order := range []storage2.SortOrder{storage2.SortAsc, storage2.SortDesc} {
+		all, err := usecase.ListMonth(ctx, day, Page{Limit: MaxPageSize, Order: order})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 8 одиночных событий и 4 среды мая
+		if len(all.Items) != 12 || all.Next != "" || all.Prev != "" {
+			t.Fatalf("order %d: unexpected full page of %d items, next %q, prev %q", order, len(all.Items), all.Next, all.Prev)
+		}
+		for i := 1; i < len(all.Items); i++ {
+			if !itemPosition(&all.Items[i-1]).before(itemPosition(&all.Items[i]), order) {
+				t.Fatalf("order %d: items %d and %d are out of order", order, i-1, i)
+			}
+		}
+
+		var pages []*ListPage
+		page := Page{Limit: 5, Order: order}
+		for {
+			ret, err := usecase.ListMonth(ctx, day, page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pages = append(pages, ret)
+			if ret.Next == "" || len(pages) > 3 {
+				break
+			}
+			page.Cursor = ret.Next
+		}
+
+		var got []ListResponseItem
+		for _, p := range pages {
+			got = append(got, p.Items...)
+		}
+		if len(pages) != 3 || !reflect.DeepEqual(positions(got), positions(all.Items)) {
+			t.Fatalf("order %d: pages do not match the full list", order)
+		}
+		if pages[0].Prev != "" {
+			t.Errorf("order %d: first page must not have prev cursor", order)
+		}
+
+		// Обратно от последней страницы по курсорам prev
+		for i := len(pages) - 1; i > 0; i-- {
+			page.Cursor = pages[i].Prev
+			ret, err := usecase.ListMonth(ctx, day, page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(positions(ret.Items), positions(pages[i-1].Items)) {
+				t.Errorf("order %d: prev of page %d does not match page %d", order, i, i-1)
+			}
+			if (ret.Prev == "") != (i == 1) || ret.Next == "" {
+				t.Errorf("order %d: unexpected cursors of page %d: next %q, prev %q", order, i-1, ret.Next, ret.Prev)
+			}
+		}
+	}
+}
+
+// TestEventUsecases_PageInvalid проверяет отказ для некорректных параметров страницы
+func TestEventUsecases_PageInvalid(t *testing.T) {
+	ctx := context.Background()
+	usecase := newPageUsecases(t)
+	day := time.Date(2020, 5, 12, 0, 0, 0, 0, time.Local)
+
+	first, err := usecase.ListMonth(ctx, day, Page{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		list func() (*ListPage, error)
+	}{
+		{"negative limit", func() (*ListPage, error) { return usecase.ListMonth(ctx, day, Page{Limit: -1}) }},
+		{"large limit", func() (*ListPage, error) { return usecase.ListMonth(ctx, day, Page{Limit: MaxPageSize + 1}) }},
+		{"unknown order", func() (*ListPage, error) { return usecase.ListMonth(ctx, day, Page{Order: 7}) }},
+		{"malformed cursor", func() (*ListPage, error) { return usecase.ListMonth(ctx, day, Page{Cursor: "!"}) }},
+		{"other order", func() (*ListPage, error) {
+			return usecase.ListMonth(ctx, day, Page{Cursor: first.Next, Order: storage2.SortDesc})
+		}},
+		{"other listing", func() (*ListPage, error) { return usecase.ListWeek(ctx, day, Page{Cursor: first.Next}) }},
+	}
+
+	for _, tt := range tests {
+		if _, err = tt.list(); !errors.Is(err, ErrorInvalidPage) {
+			t.Errorf("%s: expected ErrorInvalidPage, got %v", tt.name, err)
+		}
+	}
+}
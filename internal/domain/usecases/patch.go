@@ -0,0 +1,171 @@
+package usecases
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"time"
+)
+
+// PatchEventRequest это DTO с входными данными для частичного изменения события
+// Patch - документ JSON Merge Patch (RFC 7396) над полями title, start, end, description и rrule
+type PatchEventRequest struct {
+	ID      string `validate:"required,uuid"`
+	Patch   []byte `validate:"required"`
+	Version int64  // Ожидаемая версия события, 0 - изменить любую текущую версию
+}
+
+// patchDocument изменяемые поля события в том виде, к которому применяется merge patch
+type patchDocument struct {
+	Title       string    `json:"title"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Description string    `json:"description"`
+	RRule       string    `json:"rrule"`
+}
+
+// Patch изменяет только переданные в патче поля события
+// Результат проверяется теми же правилами, что и полное изменение, а пересечения проверяются,
+// только если изменилось время события или правило повторения
+func (u EventUsecases) Patch(ctx context.Context, data *PatchEventRequest) error {
+	err := validate.StructCtx(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	id, err := entities.NewEventID(data.ID)
+	if err != nil {
+		return err
+	}
+
+	// Патч применяется к прочитанной версии события. Без ожидаемой версии событие перечитывается,
+	// если его успели изменить, и патч применяется заново
+	return unversioned(ctx, data.Version, func() error {
+		current, err := u.find(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		doc := patchDocument{
+			Title:       current.Title,
+			Start:       current.Start,
+			End:         current.End,
+			Description: current.Description,
+		}
+		if current.Recurrence != nil {
+			doc.RRule = current.Recurrence.String()
+		}
+
+		if err = applyMergePatch(&doc, data.Patch); err != nil {
+			return err
+		}
+
+		// Итоговое событие должно быть таким же корректным, как при изменении целиком
+		err = validate.StructCtx(ctx, &UpdateEventRequest{
+			ID:          data.ID,
+			Title:       doc.Title,
+			Start:       doc.Start,
+			End:         doc.End,
+			Description: doc.Description,
+			RRule:       doc.RRule,
+		})
+		if err != nil {
+			return err
+		}
+
+		event := *current
+		event.Title = doc.Title
+		event.Start = doc.Start
+		event.End = doc.End
+		event.Description = doc.Description
+		event.Recurrence = recurrence(doc.RRule)
+		if data.Version != 0 {
+			event.Version = data.Version
+		}
+
+		// Время не изменилось - занятость не проверяем
+		if !timesChanged(current, &event) {
+			return u.storage.Update(ctx, &event)
+		}
+
+		keepExceptions(&event, current)
+		err = u.storage.UpdateIfFree(ctx, &event)
+
+		return dateBusy(err)
+	})
+}
+
+// applyMergePatch применяет к документу doc merge patch (RFC 7396)
+func applyMergePatch(doc *patchDocument, patch []byte) error {
+	var p interface{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return fmt.Errorf("%w: %v", ErrorInvalidPatch, err)
+	}
+	if _, ok := p.(map[string]interface{}); !ok {
+		return fmt.Errorf("%w: patch must be a JSON object", ErrorInvalidPatch)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	var target interface{}
+	if err = json.Unmarshal(data, &target); err != nil {
+		return err
+	}
+
+	if data, err = json.Marshal(mergePatch(target, p)); err != nil {
+		return err
+	}
+
+	// Поля, удаленные патчем (null), получают нулевые значения
+	*doc = patchDocument{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(doc); err != nil {
+		return fmt.Errorf("%w: %v", ErrorInvalidPatch, err)
+	}
+
+	return nil
+}
+
+// mergePatch реализует алгоритм MergePatch из RFC 7396: объекты объединяются рекурсивно,
+// null удаляет поле, любое другое значение заменяет его целиком
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+
+	for name, value := range p {
+		if value == nil {
+			delete(t, name)
+			continue
+		}
+
+		t[name] = mergePatch(t[name], value)
+	}
+
+	return t
+}
+
+// timesChanged проверяет, изменилось ли время события или правило его повторения
+func timesChanged(current, event *entities.Event) bool {
+	if !current.Start.Equal(event.Start) || !current.End.Equal(event.End) {
+		return true
+	}
+
+	if (current.Recurrence == nil) != (event.Recurrence == nil) {
+		return true
+	}
+
+	return current.Recurrence != nil && current.Recurrence.String() != event.Recurrence.String()
+}
@@ -0,0 +1,151 @@
+package usecases
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-playground/validator/v10"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	storage2 "github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/storage/inmemory"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestEventUsecases_Patch проверяет частичное изменение события
+func TestEventUsecases_Patch(t *testing.T) {
+	ctx := context.Background()
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	usecase := NewEventUsecases(storage)
+
+	start := time.Date(2020, 5, 12, 10, 0, 0, 0, time.UTC)
+	id, err := usecase.Create(ctx, &CreateEventRequest{
+		Title:       "Планерка",
+		Start:       start,
+		End:         start.Add(time.Hour),
+		Description: "Еженедельная",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventID, _ := entities.NewEventID(id)
+
+	// Пересекающееся событие сохраняется в обход проверки, чтобы занятость проверялась только при смене времени
+	otherID, _ := entities.NewEventID("")
+	other := entities.Event{ID: otherID, Title: "Созвон", Start: start.Add(30 * time.Minute), End: start.Add(2 * time.Hour)}
+	if err = storage.Create(ctx, &other); err != nil {
+		t.Fatal(err)
+	}
+
+	patch := func(doc string) error {
+		return usecase.Patch(ctx, &PatchEventRequest{ID: id, Patch: []byte(doc)})
+	}
+
+	if err = patch(`{"title": "Ретроспектива", "description": null}`); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := storage.FindByID(ctx, eventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Title != "Ретроспектива" || found.Description != "" || !found.Start.Equal(start) || found.Version != 2 {
+		t.Fatalf("unexpected patched event %+v", found)
+	}
+
+	if err = patch(`{"end": "2020-05-12T10:45:00Z"}`); err != ErrorDateBusy {
+		t.Fatalf("expected ErrorDateBusy, got %v", err)
+	}
+	if err = patch(`{"start": "2020-05-12T08:00:00Z", "end": "2020-05-12T09:00:00Z"}`); err != nil {
+		t.Fatal(err)
+	}
+
+	var verr validator.ValidationErrors
+	if err = patch(`{"title": null}`); !errors.As(err, &verr) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	if err = patch(`{"end": "2020-05-12T07:00:00Z"}`); !errors.As(err, &verr) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+
+	for _, doc := range []string{`{"id": "42"}`, `["title"]`, `{"title": 1}`, `{`} {
+		if err = patch(doc); !errors.Is(err, ErrorInvalidPatch) {
+			t.Errorf("%s: expected ErrorInvalidPatch, got %v", doc, err)
+		}
+	}
+
+	err = usecase.Patch(ctx, &PatchEventRequest{ID: id, Patch: []byte(`{"title": "Разбор"}`), Version: 1})
+	if err != storage2.EntityVersionConflict {
+		t.Fatalf("expected EntityVersionConflict, got %v", err)
+	}
+}
+
+// TestEventUsecases_PatchSeries проверяет, что исключения серии сбрасываются только при изменении ее расписания
+func TestEventUsecases_PatchSeries(t *testing.T) {
+	ctx := context.Background()
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	usecase := NewEventUsecases(storage)
+	id, monday := createStandup(t, usecase)
+	eventID, _ := entities.NewEventID(id)
+
+	err := usecase.DeleteOccurrence(ctx, &DeleteOccurrenceRequest{ID: id, OriginalStart: monday.AddDate(0, 0, 7), Mode: ModeThis})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = usecase.Patch(ctx, &PatchEventRequest{ID: id, Patch: []byte(`{"title": "Планерка"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if found, _ := storage.FindByID(ctx, eventID); len(found.ExDates) != 1 || found.Recurrence == nil {
+		t.Fatalf("title patch must keep the series exceptions, got %+v", found)
+	}
+
+	if err = usecase.Patch(ctx, &PatchEventRequest{ID: id, Patch: []byte(`{"rrule": "FREQ=WEEKLY;COUNT=2"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if found, _ := storage.FindByID(ctx, eventID); len(found.ExDates) != 0 {
+		t.Fatalf("rule patch must reset the series exceptions, got %+v", found.ExDates)
+	}
+
+	if err = usecase.Patch(ctx, &PatchEventRequest{ID: id, Patch: []byte(`{"rrule": null}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if found, _ := storage.FindByID(ctx, eventID); found.Recurrence != nil {
+		t.Fatalf("null rrule must make the event single, got %v", found.Recurrence)
+	}
+}
+
+// TestMergePatch проверяет алгоритм на примерах из приложения A RFC 7396
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		target, patch, expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		var target, patch, expected interface{}
+		_ = json.Unmarshal([]byte(tt.target), &target)
+		_ = json.Unmarshal([]byte(tt.patch), &patch)
+		_ = json.Unmarshal([]byte(tt.expected), &expected)
+
+		if got := mergePatch(target, patch); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s + %s: expected %s, got %v", tt.target, tt.patch, tt.expected, got)
+		}
+	}
+}
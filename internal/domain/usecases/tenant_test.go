@@ -0,0 +1,81 @@
+package usecases
+
+import (
+	"context"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	storage2 "github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/storage/inmemory"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	"testing"
+	"time"
+)
+
+// TestEventUsecases_Tenants проверяет, что сценарии одного арендатора не видят и не меняют события другого
+func TestEventUsecases_Tenants(t *testing.T) {
+	alice := tenant.NewContext(context.Background(), "alice")
+	bob := tenant.NewContext(context.Background(), "bob")
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	usecase := NewEventUsecases(storage)
+
+	start := time.Date(2020, 5, 12, 10, 0, 0, 0, time.Local)
+	id, err := usecase.Create(alice, &CreateEventRequest{Title: "Совещание", Start: start, End: start.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventID, _ := entities.NewEventID(id)
+
+	// То же время у другого арендатора свободно
+	if _, err = usecase.Create(bob, &CreateEventRequest{Title: "Обед", Start: start, End: start.Add(time.Hour)}); err != nil {
+		t.Fatalf("event of another tenant must not conflict: %v", err)
+	}
+
+	if _, err = usecase.Get(bob, eventID); err != storage2.EntityNotFound {
+		t.Errorf("get: expected EntityNotFound, got %v", err)
+	}
+	err = usecase.Update(bob, &UpdateEventRequest{ID: id, Title: "Чужое", Start: start, End: start.Add(time.Hour)})
+	if err != storage2.EntityNotFound {
+		t.Errorf("update: expected EntityNotFound, got %v", err)
+	}
+	if err = usecase.Delete(bob, eventID, 0); err != storage2.EntityNotFound {
+		t.Errorf("delete: expected EntityNotFound, got %v", err)
+	}
+
+	for ctx, title := range map[context.Context]string{alice: "Совещание", bob: "Обед"} {
+		list, err := pageItems(usecase.ListDay(ctx, start, Page{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 1 || list[0].Title != title {
+			t.Errorf("tenant %q: expected only %q, got %+v", tenant.FromContext(ctx), title, list)
+		}
+	}
+
+	if item, err := usecase.Get(alice, eventID); err != nil || item.Title != "Совещание" {
+		t.Errorf("event must stay unchanged, got %+v, %v", item, err)
+	}
+}
+
+// TestEventUsecases_ImportTenants проверяет, что один файл импортируется у разных арендаторов в разные события
+func TestEventUsecases_ImportTenants(t *testing.T) {
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	usecase := NewEventUsecases(storage)
+
+	start := time.Date(2020, 5, 12, 10, 0, 0, 0, time.Local)
+	items := []ImportEventRequest{{UID: "event@example.com", Title: "Совещание", Start: start, End: start.Add(time.Hour)}}
+
+	ids := map[string]bool{}
+	for _, name := range []string{tenant.Default, "alice", "bob"} {
+		report, err := usecase.Import(tenant.NewContext(context.Background(), name), items)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Items[0].Status != ImportCreated {
+			t.Fatalf("tenant %q: expected created event, got %+v", name, report.Items[0])
+		}
+		ids[report.Items[0].ID] = true
+	}
+
+	if len(ids) != 3 {
+		t.Errorf("expected 3 distinct events, got %v", ids)
+	}
+}
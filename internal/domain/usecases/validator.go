@@ -0,0 +1,39 @@
+package usecases
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"time"
+)
+
+// validate валидатор DTO сценариев использования
+// validator.Validate безопасен для конкурентного использования и кэширует разобранные структуры
+var validate = newValidator()
+
+// newValidator создает валидатор с зарегистрированными правилами предметной области
+// rrule - строка является корректным правилом повторения RFC 5545
+// timezone - строка является названием зоны из базы IANA
+// eventtime - время не раньше начала нашей эры и не позже entities.Forever: в этих границах хранилища
+// находят событие по промежутку, а экспорт и резервная копия выбирают все события
+func newValidator() *validator.Validate {
+	v := validator.New()
+
+	_ = v.RegisterValidation("rrule", func(fl validator.FieldLevel) bool {
+		_, err := entities.ParseRecurrence(fl.Field().String())
+		return err == nil
+	})
+
+	_ = v.RegisterValidation("timezone", func(fl validator.FieldLevel) bool {
+		name := fl.Field().String()
+		_, err := time.LoadLocation(name)
+		// Пустая строка и Local - не названия зон, LoadLocation понимает их как UTC и зону сервера
+		return err == nil && name != "" && name != "Local"
+	})
+
+	_ = v.RegisterValidation("eventtime", func(fl validator.FieldLevel) bool {
+		t, ok := fl.Field().Interface().(time.Time)
+		return ok && !t.Before(time.Time{}) && !t.After(entities.Forever)
+	})
+
+	return v
+}
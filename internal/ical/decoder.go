@@ -0,0 +1,421 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotCalendar поток не содержит календаря VCALENDAR
+var ErrNotCalendar = errors.New("ical: not an iCalendar stream")
+
+// maxLineSize максимальный размер развернутой строки содержимого
+const maxLineSize = 1 << 20
+
+// Item событие, разобранное из VEVENT, вместе с его измененными повторениями (VEVENT с RECURRENCE-ID)
+type Item struct {
+	UID   string
+	Event entities.Event // Идентификатор события не заполняется, он выводится из UID при импорте
+	Err   error          // Ошибка разбора компонента, событие в этом случае может быть заполнено не полностью
+}
+
+// Decoder читает события из потока в формате iCalendar
+type Decoder struct {
+	r io.Reader
+}
+
+// NewDecoder конструктор декодировщика
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// property строка содержимого name;param=value:value
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// vevent свойства одного компонента VEVENT
+type vevent struct {
+	props []property
+	err   error
+}
+
+// Decode разбирает все VEVENT календаря. Ошибки отдельных компонентов не прерывают разбор,
+// а возвращаются в Item.Err; ошибка возвращается только если поток не удалось прочитать как календарь
+func (d *Decoder) Decode() ([]Item, error) {
+	lines, err := unfold(d.r)
+	if err != nil {
+		return nil, err
+	}
+
+	var stack []string
+	var components []*vevent
+	var current *vevent
+	calendar := false
+
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+
+		p, err := parseLine(line)
+		if err != nil {
+			if current != nil && current.err == nil {
+				current.err = err
+			}
+			continue
+		}
+
+		switch p.name {
+		case "BEGIN":
+			name := strings.ToUpper(p.value)
+			if len(stack) == 0 {
+				if name != "VCALENDAR" {
+					return nil, ErrNotCalendar
+				}
+				calendar = true
+			}
+			if name == "VEVENT" && len(stack) == 1 && stack[0] == "VCALENDAR" {
+				current = &vevent{}
+				components = append(components, current)
+			}
+			stack = append(stack, name)
+			continue
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1] != strings.ToUpper(p.value) {
+				return nil, fmt.Errorf("ical: unexpected END:%s", p.value)
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 1 {
+				current = nil
+			}
+			continue
+		}
+
+		// Свойства вложенных компонентов (например VALARM) к событию не относятся
+		if current != nil && len(stack) == 2 {
+			current.props = append(current.props, p)
+		}
+	}
+
+	if !calendar {
+		return nil, ErrNotCalendar
+	}
+	if len(stack) != 0 {
+		return nil, fmt.Errorf("ical: unterminated %s", stack[len(stack)-1])
+	}
+
+	return assemble(components), nil
+}
+
+// assemble собирает события из компонентов, присоединяя измененные повторения к своим сериям по UID
+func assemble(components []*vevent) []Item {
+	var items []Item
+	masters := map[string]int{}
+
+	type instance struct {
+		uid      string
+		override entities.Override
+	}
+	var instances []instance
+
+	for _, c := range components {
+		uid, recurrenceID, event, err := c.decode()
+
+		if recurrenceID != nil && err == nil {
+			instances = append(instances, instance{
+				uid: uid,
+				override: entities.Override{
+					OriginalStart: *recurrenceID,
+					Title:         event.Title,
+					Start:         event.Start,
+					End:           event.End,
+					Description:   event.Description,
+				},
+			})
+			continue
+		}
+
+		if _, ok := masters[uid]; ok && uid != "" && err == nil {
+			err = fmt.Errorf("ical: duplicate UID %s", uid)
+		}
+		if err == nil {
+			masters[uid] = len(items)
+		}
+
+		items = append(items, Item{UID: uid, Event: event, Err: err})
+	}
+
+	for _, i := range instances {
+		idx, ok := masters[i.uid]
+		if !ok {
+			items = append(items, Item{UID: i.uid, Err: errors.New("ical: RECURRENCE-ID without master event")})
+			continue
+		}
+
+		items[idx].Event.SetOverride(i.override)
+	}
+
+	return items
+}
+
+// decode переводит свойства VEVENT в событие. Для измененного повторения возвращается RECURRENCE-ID
+func (c *vevent) decode() (uid string, recurrenceID *time.Time, event entities.Event, err error) {
+	err = c.err
+
+	var duration *time.Duration
+	var dtstartIsDate bool
+
+	set := func(e error) {
+		if err == nil && e != nil {
+			err = e
+		}
+	}
+
+	for _, p := range c.props {
+		switch p.name {
+		case "UID":
+			uid = p.value
+		case "SUMMARY":
+			event.Title = unescapeText(p.value)
+		case "DESCRIPTION":
+			event.Description = unescapeText(p.value)
+		case "DTSTART":
+			var e error
+			event.Start, dtstartIsDate, e = parseDateTime(p, p.value)
+			set(e)
+		case "DTEND":
+			var e error
+			event.End, _, e = parseDateTime(p, p.value)
+			set(e)
+		case "DURATION":
+			d, e := parseDuration(p.value)
+			duration = &d
+			set(e)
+		case "RRULE":
+			var e error
+			event.Recurrence, e = entities.ParseRecurrence(p.value)
+			set(e)
+		case "EXDATE":
+			for _, v := range strings.Split(p.value, ",") {
+				t, _, e := parseDateTime(p, v)
+				set(e)
+				event.ExDates = append(event.ExDates, t)
+			}
+		case "RECURRENCE-ID":
+			t, _, e := parseDateTime(p, p.value)
+			set(e)
+			recurrenceID = &t
+		}
+	}
+
+	if uid == "" {
+		set(errors.New("ical: VEVENT without UID"))
+	}
+	if event.Start.IsZero() {
+		set(errors.New("ical: VEVENT without DTSTART"))
+	}
+
+	// Окончание события: DTEND, DURATION, а если нет обоих - день для даты и нулевая длительность для времени
+	if event.End.IsZero() {
+		switch {
+		case duration != nil:
+			event.End = event.Start.Add(*duration)
+		case dtstartIsDate:
+			event.End = event.Start.AddDate(0, 0, 1)
+		default:
+			event.End = event.Start
+		}
+	}
+
+	return uid, recurrenceID, event, err
+}
+
+// unfold читает строки содержимого, склеивая продолжения, начинающиеся с пробела или табуляции (RFC 5545, 3.1)
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), maxLineSize)
+
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines, scanner.Err()
+}
+
+// parseLine разбирает строку содержимого name;param=value;param="quoted:value":value
+func parseLine(line string) (property, error) {
+	p := property{params: map[string]string{}}
+
+	// Ищем двоеточие, отделяющее значение, пропуская двоеточия в кавычках внутри параметров
+	quoted := false
+	colon := -1
+	for i := 0; i < len(line) && colon < 0; i++ {
+		switch line[i] {
+		case '"':
+			quoted = !quoted
+		case ':':
+			if !quoted {
+				colon = i
+			}
+		}
+	}
+
+	if colon < 0 {
+		return p, fmt.Errorf("ical: malformed content line %q", line)
+	}
+
+	p.value = line[colon+1:]
+
+	head := splitQuoted(line[:colon], ';')
+	p.name = strings.ToUpper(head[0])
+	if p.name == "" {
+		return p, fmt.Errorf("ical: malformed content line %q", line)
+	}
+
+	for _, param := range head[1:] {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			return p, fmt.Errorf("ical: malformed parameter %q", param)
+		}
+		p.params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+	}
+
+	return p, nil
+}
+
+// splitQuoted разбивает строку по разделителю sep, не учитывая разделители внутри кавычек
+func splitQuoted(s string, sep byte) []string {
+	var ret []string
+	quoted := false
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				ret = append(ret, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(ret, s[start:])
+}
+
+// parseDateTime разбирает значение DATE или DATE-TIME свойства p с учетом параметров TZID и VALUE.
+// Время без зоны ("плавающее") и даты считаются заданными в местной зоне сервера
+func parseDateTime(p property, value string) (t time.Time, isDate bool, err error) {
+	loc := time.Local
+	if tzid := p.params["TZID"]; tzid != "" {
+		loc, err = time.LoadLocation(tzid)
+		if err != nil {
+			return t, false, fmt.Errorf("ical: %s: unknown TZID %q", p.name, tzid)
+		}
+	}
+
+	switch {
+	case p.params["VALUE"] == "DATE" || len(value) == len(dateLayout):
+		t, err = time.ParseInLocation(dateLayout, value, loc)
+		isDate = true
+	case strings.HasSuffix(value, "Z"):
+		t, err = time.Parse(dateTimeLayoutUTC, value)
+	default:
+		t, err = time.ParseInLocation(dateTimeLayoutLocal, value, loc)
+	}
+
+	if err != nil {
+		return t, isDate, fmt.Errorf("ical: %s: malformed date %q", p.name, value)
+	}
+
+	return t, isDate, nil
+}
+
+// parseDuration разбирает длительность вида [+-]P[nW][nD][T[nH][nM][nS]] (RFC 5545, 3.3.6)
+func parseDuration(value string) (time.Duration, error) {
+	s := value
+	sign := time.Duration(1)
+
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign, s = -1, s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, fmt.Errorf("ical: malformed duration %q", value)
+	}
+	s = s[1:]
+
+	units := map[byte]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour}
+	var d time.Duration
+	num := ""
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= '0' && c <= '9':
+			num += string(c)
+		case c == 'T':
+			units = map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+		default:
+			unit, ok := units[c]
+			n, err := strconv.Atoi(num)
+			if !ok || err != nil {
+				return 0, fmt.Errorf("ical: malformed duration %q", value)
+			}
+			d += time.Duration(n) * unit
+			num = ""
+		}
+	}
+
+	if num != "" {
+		return 0, fmt.Errorf("ical: malformed duration %q", value)
+	}
+
+	return sign * d, nil
+}
+
+// unescapeText снимает экранирование со значения типа TEXT (RFC 5545, 3.3.11)
+func unescapeText(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,180 @@
+package ical
+
+import (
+	"bytes"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Example//Example//EN\r\n" +
+	"BEGIN:VTIMEZONE\r\n" +
+	"TZID:Europe/Moscow\r\n" +
+	"BEGIN:STANDARD\r\n" +
+	"DTSTART:19700101T000000\r\n" +
+	"TZOFFSETFROM:+0300\r\n" +
+	"TZOFFSETTO:+0300\r\n" +
+	"END:STANDARD\r\n" +
+	"END:VTIMEZONE\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup@example.com\r\n" +
+	"DTSTART;TZID=Europe/Moscow:20200106T100000\r\n" +
+	"DURATION:PT15M\r\n" +
+	"SUMMARY:Стендап\\, команда\\; backend\r\n" +
+	"DESCRIPTION:Очень длинное описание, которое не поместилось в одну строку и по\r\n" +
+	" этому было перенесено\\nна несколько строк\r\n" +
+	"RRULE:FREQ=WEEKLY;BYDAY=MO;COUNT=4\r\n" +
+	"EXDATE;TZID=Europe/Moscow:20200113T100000,20200120T100000\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"ACTION:DISPLAY\r\n" +
+	"DESCRIPTION:Напоминание\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup@example.com\r\n" +
+	"RECURRENCE-ID;TZID=Europe/Moscow:20200127T100000\r\n" +
+	"DTSTART:20200127T090000Z\r\n" +
+	"DTEND:20200127T091500Z\r\n" +
+	"SUMMARY:Перенесенный стендап\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:holiday@example.com\r\n" +
+	"DTSTART;VALUE=DATE:20200101\r\n" +
+	"SUMMARY:Новый год\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:broken@example.com\r\n" +
+	"DTSTART;TZID=Mars/Olympus:20200101T100000\r\n" +
+	"SUMMARY:Сломанное событие\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+// TestDecoder_Decode проверяет разбор событий с TZID, переносами строк, экранированием и исключениями
+func TestDecoder_Decode(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skip("timezone database is not available")
+	}
+
+	items, err := NewDecoder(strings.NewReader(testCalendar)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 3 {
+		t.Fatalf("expected 3 items, got %d", len(items))
+	}
+
+	standup := items[0]
+	if standup.Err != nil {
+		t.Fatal(standup.Err)
+	}
+
+	start := time.Date(2020, 1, 6, 10, 0, 0, 0, moscow)
+	e := standup.Event
+	if standup.UID != "standup@example.com" || !e.Start.Equal(start) || !e.End.Equal(start.Add(15*time.Minute)) {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if e.Title != "Стендап, команда; backend" {
+		t.Errorf("unexpected title %q", e.Title)
+	}
+	if e.Description != "Очень длинное описание, которое не поместилось в одну строку и поэтому было перенесено\nна несколько строк" {
+		t.Errorf("unexpected description %q", e.Description)
+	}
+	if e.Recurrence == nil || e.Recurrence.String() != "FREQ=WEEKLY;BYDAY=MO;COUNT=4" || len(e.ExDates) != 2 {
+		t.Errorf("unexpected recurrence %+v %v", e.Recurrence, e.ExDates)
+	}
+	if len(e.Overrides) != 1 || e.Overrides[0].Title != "Перенесенный стендап" || !e.Overrides[0].OriginalStart.Equal(start.AddDate(0, 0, 21)) {
+		t.Errorf("unexpected overrides %+v", e.Overrides)
+	}
+
+	holiday := items[1].Event
+	if items[1].Err != nil || holiday.End.Sub(holiday.Start) != 24*time.Hour {
+		t.Errorf("all-day event must last a day: %+v %v", holiday, items[1].Err)
+	}
+
+	if items[2].UID != "broken@example.com" || items[2].Err == nil {
+		t.Errorf("unknown TZID must be reported, got %+v", items[2])
+	}
+}
+
+// TestDecoder_NotCalendar проверяет отказ на потоке, не являющемся календарем
+func TestDecoder_NotCalendar(t *testing.T) {
+	streams := []string{
+		"",
+		"hello world",
+		"BEGIN:VEVENT\r\nEND:VEVENT\r\n",
+		"BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\n",
+	}
+
+	for _, s := range streams {
+		if _, err := NewDecoder(strings.NewReader(s)).Decode(); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+// TestDecoder_RoundTrip проверяет, что выгруженный календарь читается обратно без потерь
+func TestDecoder_RoundTrip(t *testing.T) {
+	id, _ := entities.NewEventID("")
+	start := time.Date(2020, 1, 6, 10, 0, 0, 0, time.UTC)
+	rule, _ := entities.ParseRecurrence("FREQ=DAILY;COUNT=5")
+
+	event := entities.Event{
+		ID:          id,
+		Title:       "Событие с длинным названием; запятыми, и обратными \\ слэшами",
+		Start:       start,
+		End:         start.Add(time.Hour),
+		Description: strings.Repeat("Многострочное\nописание ", 10),
+		Recurrence:  rule,
+		ExDates:     []time.Time{start.AddDate(0, 0, 1)},
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode([]entities.Event{event}); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := NewDecoder(&buf).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 1 || items[0].Err != nil {
+		t.Fatalf("unexpected items %+v", items)
+	}
+
+	got := items[0].Event
+	if items[0].UID != id.String() || got.Title != event.Title || got.Description != event.Description ||
+		!got.Start.Equal(event.Start) || !got.End.Equal(event.End) ||
+		got.Recurrence.String() != rule.String() || len(got.ExDates) != 1 || !got.ExDates[0].Equal(event.ExDates[0]) {
+		t.Errorf("round trip mismatch: %+v", got)
+	}
+}
+
+// TestParseDuration проверяет разбор длительностей
+func TestParseDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"PT15M":     15 * time.Minute,
+		"P1D":       24 * time.Hour,
+		"P1W":       7 * 24 * time.Hour,
+		"P1DT2H30M": 26*time.Hour + 30*time.Minute,
+		"-PT10S":    -10 * time.Second,
+	}
+
+	for value, expected := range tests {
+		d, err := parseDuration(value)
+		if err != nil || d != expected {
+			t.Errorf("%s: expected %s, got %s (%v)", value, expected, d, err)
+		}
+	}
+
+	for _, value := range []string{"", "P", "PT", "15M", "PT15", "P1H"} {
+		if _, err := parseDuration(value); err == nil {
+			t.Errorf("%q: expected error", value)
+		}
+	}
+}
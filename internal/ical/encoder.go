@@ -0,0 +1,192 @@
+// Пакет реализует сериализацию событий календаря в формат iCalendar (RFC 5545).
+package ical
+
+import (
+	"bufio"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType тип содержимого iCalendar
+const ContentType = "text/calendar; charset=utf-8"
+
+// DefaultProdID идентификатор продукта, создавшего календарь (PRODID)
+const DefaultProdID = "-//go-calendar//go-calendar//RU"
+
+// Форматы дат iCalendar
+const (
+	dateTimeLayoutUTC   = "20060102T150405Z"
+	dateTimeLayoutLocal = "20060102T150405"
+	dateLayout          = "20060102"
+)
+
+// maxLineLength максимальная длина строки в октетах без учета CRLF (RFC 5545, 3.1)
+const maxLineLength = 75
+
+// Encoder пишет события в поток в формате iCalendar
+type Encoder struct {
+	w io.Writer
+
+	// ProdID значение PRODID календаря
+	ProdID string
+	// Name название календаря (X-WR-CALNAME), необязательно
+	Name string
+	// Now источник времени для DTSTAMP, подменяется в тестах
+	Now func() time.Time
+}
+
+// NewEncoder конструктор кодировщика
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		w:      w,
+		ProdID: DefaultProdID,
+		Now:    time.Now,
+	}
+}
+
+// Encode пишет календарь VCALENDAR с событиями events.
+// Повторяющиеся события пишутся с RRULE и EXDATE, а их измененные повторения - отдельными VEVENT с RECURRENCE-ID
+func (e *Encoder) Encode(events []entities.Event) error {
+	w := &lineWriter{w: bufio.NewWriter(e.w)}
+	stamp := e.Now().UTC().Format(dateTimeLayoutUTC)
+
+	w.line("BEGIN", nil, "VCALENDAR")
+	w.line("VERSION", nil, "2.0")
+	w.line("PRODID", nil, e.ProdID)
+	w.line("CALSCALE", nil, "GREGORIAN")
+	if e.Name != "" {
+		w.line("X-WR-CALNAME", nil, escapeText(e.Name))
+	}
+
+	// Время с TZID клиенты разбирают по описаниям зон VTIMEZONE (RFC 5545, 3.2.19)
+	zones := zoneSet{}
+	for i := range events {
+		zones.addEvent(&events[i])
+	}
+	w.timezones(zones)
+
+	for i := range events {
+		event := &events[i]
+		uid := event.ID.String()
+
+		w.line("BEGIN", nil, "VEVENT")
+		w.line("UID", nil, uid)
+		w.line("DTSTAMP", nil, stamp)
+		w.dateTime("DTSTART", event.Start)
+		w.dateTime("DTEND", event.End)
+		w.line("SUMMARY", nil, escapeText(event.Title))
+		if event.Description != "" {
+			w.line("DESCRIPTION", nil, escapeText(event.Description))
+		}
+		if event.Recurrence != nil {
+			w.line("RRULE", nil, event.Recurrence.String())
+		}
+		for _, t := range event.ExDates {
+			w.dateTime("EXDATE", t)
+		}
+		w.line("END", nil, "VEVENT")
+
+		for _, o := range event.Overrides {
+			w.line("BEGIN", nil, "VEVENT")
+			w.line("UID", nil, uid)
+			w.line("DTSTAMP", nil, stamp)
+			w.dateTime("RECURRENCE-ID", o.OriginalStart)
+			w.dateTime("DTSTART", o.Start)
+			w.dateTime("DTEND", o.End)
+			w.line("SUMMARY", nil, escapeText(o.Title))
+			if o.Description != "" {
+				w.line("DESCRIPTION", nil, escapeText(o.Description))
+			}
+			w.line("END", nil, "VEVENT")
+		}
+	}
+
+	w.line("END", nil, "VCALENDAR")
+
+	return w.flush()
+}
+
+// lineWriter пишет строки содержимого iCalendar с переносом длинных строк.
+// Первая ошибка записи запоминается и возвращается из flush
+type lineWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+// dateTime пишет свойство с датой-временем. Время в именованной зоне IANA пишется с параметром TZID,
+// чтобы повторения сохраняли местное время при переходе на летнее время, остальное - в UTC.
+// Описание зоны пишет timezones
+func (lw *lineWriter) dateTime(name string, t time.Time) {
+	if tzid, ok := zoneID(t); ok {
+		lw.line(name, []string{"TZID=" + tzid}, t.Format(dateTimeLayoutLocal))
+		return
+	}
+
+	lw.line(name, nil, t.UTC().Format(dateTimeLayoutUTC))
+}
+
+// line пишет строку содержимого name;params:value, сворачивая ее по 75 октетов
+func (lw *lineWriter) line(name string, params []string, value string) {
+	if lw.err != nil {
+		return
+	}
+
+	l := name
+	if len(params) > 0 {
+		l += ";" + strings.Join(params, ";")
+	}
+	l += ":" + value
+
+	_, lw.err = lw.w.WriteString(fold(l))
+}
+
+// flush сбрасывает буфер и возвращает первую ошибку записи
+func (lw *lineWriter) flush() error {
+	if lw.err != nil {
+		return lw.err
+	}
+
+	return lw.w.Flush()
+}
+
+// fold разбивает строку на части не длиннее 75 октетов, не разрывая символы UTF-8.
+// Продолжения начинаются с пробела (RFC 5545, 3.1), каждая часть завершается CRLF
+func fold(line string) string {
+	var b strings.Builder
+	limit := maxLineLength
+
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+
+		// Пробел в начале продолжения тоже занимает октет
+		limit = maxLineLength - 1
+	}
+
+	b.WriteString(line)
+	b.WriteString("\r\n")
+
+	return b.String()
+}
+
+// escapeText экранирует значение типа TEXT (RFC 5545, 3.3.11)
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+var textEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+)
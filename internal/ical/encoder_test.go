@@ -0,0 +1,201 @@
+package ical
+
+import (
+	"bytes"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// TestEncoder_Encode проверяет структуру календаря и сериализацию полей события
+func TestEncoder_Encode(t *testing.T) {
+	id, _ := entities.NewEventID("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	start := time.Date(2020, 1, 6, 10, 0, 0, 0, time.UTC)
+	rule, _ := entities.ParseRecurrence("FREQ=WEEKLY;COUNT=4")
+
+	event := entities.Event{
+		ID:          id,
+		Title:       "Стендап; команда, backend",
+		Start:       start,
+		End:         start.Add(15 * time.Minute),
+		Description: "Первая строка\nвторая \\ строка",
+		Recurrence:  rule,
+		ExDates:     []time.Time{start.AddDate(0, 0, 7)},
+		Overrides: []entities.Override{{
+			OriginalStart: start.AddDate(0, 0, 14),
+			Title:         "Перенесенный стендап",
+			Start:         start.AddDate(0, 0, 15),
+			End:           start.AddDate(0, 0, 15).Add(15 * time.Minute),
+		}},
+	}
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.Now = func() time.Time { return start }
+
+	if err := enc.Encode([]entities.Event{event}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:" + DefaultProdID,
+		"CALSCALE:GREGORIAN",
+		"BEGIN:VEVENT",
+		"UID:6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+		"DTSTAMP:20200106T100000Z",
+		"DTSTART:20200106T100000Z",
+		"DTEND:20200106T101500Z",
+		`SUMMARY:Стендап\; команда\, backend`,
+		`DESCRIPTION:Первая строка\nвторая \\ строка`,
+		"RRULE:FREQ=WEEKLY;COUNT=4",
+		"EXDATE:20200113T100000Z",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+		"DTSTAMP:20200106T100000Z",
+		"RECURRENCE-ID:20200120T100000Z",
+		"DTSTART:20200121T100000Z",
+		"DTEND:20200121T101500Z",
+		"SUMMARY:Перенесенный стендап",
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+
+	if buf.String() != expected {
+		t.Errorf("unexpected calendar:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+// TestEncoder_TZID проверяет запись времени в именованной зоне
+func TestEncoder_TZID(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skip("timezone database is not available")
+	}
+
+	id, _ := entities.NewEventID("")
+	start := time.Date(2020, 1, 6, 10, 0, 0, 0, loc)
+
+	var buf bytes.Buffer
+	err = NewEncoder(&buf).Encode([]entities.Event{{ID: id, Title: "Встреча", Start: start, End: start.Add(time.Hour)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), "\r\nDTSTART;TZID=Europe/Moscow:20200106T100000\r\n") {
+		t.Errorf("DTSTART with TZID expected:\n%s", buf.String())
+	}
+
+	// Без летнего времени зона описывается одним правилом
+	timezone := "BEGIN:VTIMEZONE\r\n" +
+		"TZID:Europe/Moscow\r\n" +
+		"BEGIN:STANDARD\r\n" +
+		"DTSTART:20200101T000000\r\n" +
+		"TZOFFSETFROM:+0300\r\n" +
+		"TZOFFSETTO:+0300\r\n" +
+		"TZNAME:MSK\r\n" +
+		"END:STANDARD\r\n" +
+		"END:VTIMEZONE\r\n"
+	if !strings.Contains(buf.String(), timezone) {
+		t.Errorf("VTIMEZONE expected:\n%s", buf.String())
+	}
+}
+
+// TestEncoder_VTIMEZONE проверяет описание зоны с летним временем: переходы по ежегодным правилам пишутся с RRULE,
+// чтобы клиенты верно разворачивали бесконечные серии, а зона описывается один раз
+func TestEncoder_VTIMEZONE(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("timezone database is not available")
+	}
+
+	rule, _ := entities.ParseRecurrence("FREQ=WEEKLY")
+	first, second := time.Date(2020, 1, 6, 10, 0, 0, 0, loc), time.Date(2021, 6, 1, 10, 0, 0, 0, loc)
+	events := []entities.Event{
+		{Title: "Стендап", Start: first, End: first.Add(time.Hour), Recurrence: rule},
+		{Title: "Встреча", Start: second, End: second.Add(time.Hour)},
+		{Title: "В UTC", Start: first.UTC(), End: first.UTC().Add(time.Hour)},
+	}
+
+	var buf bytes.Buffer
+	if err = NewEncoder(&buf).Encode(events); err != nil {
+		t.Fatal(err)
+	}
+
+	timezone := "BEGIN:VTIMEZONE\r\n" +
+		"TZID:Europe/Berlin\r\n" +
+		"BEGIN:STANDARD\r\n" +
+		"DTSTART:20200101T000000\r\n" +
+		"TZOFFSETFROM:+0100\r\n" +
+		"TZOFFSETTO:+0100\r\n" +
+		"TZNAME:CET\r\n" +
+		"END:STANDARD\r\n" +
+		"BEGIN:DAYLIGHT\r\n" +
+		"DTSTART:20200329T020000\r\n" +
+		"TZOFFSETFROM:+0100\r\n" +
+		"TZOFFSETTO:+0200\r\n" +
+		"TZNAME:CEST\r\n" +
+		"RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU\r\n" +
+		"END:DAYLIGHT\r\n" +
+		"BEGIN:STANDARD\r\n" +
+		"DTSTART:20201025T030000\r\n" +
+		"TZOFFSETFROM:+0200\r\n" +
+		"TZOFFSETTO:+0100\r\n" +
+		"TZNAME:CET\r\n" +
+		"RRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU\r\n" +
+		"END:STANDARD\r\n" +
+		"END:VTIMEZONE\r\n"
+	if !strings.Contains(buf.String(), timezone) || strings.Count(buf.String(), "BEGIN:VTIMEZONE") != 1 {
+		t.Errorf("single VTIMEZONE expected:\n%s", buf.String())
+	}
+}
+
+// TestFormatOffset проверяет запись смещения от UTC
+func TestFormatOffset(t *testing.T) {
+	for seconds, want := range map[int]string{0: "+0000", 3 * 3600: "+0300", -(9*3600 + 30*60): "-0930", 5*3600 + 30*60 + 28: "+053028"} {
+		if got := formatOffset(seconds); got != want {
+			t.Errorf("%d: expected %s, got %s", seconds, want, got)
+		}
+	}
+}
+
+// TestFold проверяет перенос длинных строк без разрыва символов UTF-8
+func TestFold(t *testing.T) {
+	line := "SUMMARY:" + strings.Repeat("Календарь", 20)
+	folded := fold(line)
+
+	parts := strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n")
+	if len(parts) < 2 {
+		t.Fatalf("line is not folded: %q", folded)
+	}
+
+	var unfolded strings.Builder
+	for i, p := range parts {
+		if len(p) > maxLineLength {
+			t.Errorf("part %d is %d octets long", i, len(p))
+		}
+		if i > 0 {
+			if p[0] != ' ' {
+				t.Errorf("continuation %d does not start with a space", i)
+			}
+			p = p[1:]
+		}
+		if !utf8.ValidString(p) {
+			t.Errorf("part %d breaks a UTF-8 sequence", i)
+		}
+		unfolded.WriteString(p)
+	}
+
+	if unfolded.String() != line {
+		t.Error("unfolded line differs from the original")
+	}
+
+	if fold("VERSION:2.0") != "VERSION:2.0\r\n" {
+		t.Error("short line must not be folded")
+	}
+}
@@ -0,0 +1,34 @@
+package ical
+
+import (
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+)
+
+// ImportRequests переводит разобранные события в DTO сценария импорта
+func ImportRequests(items []Item) []usecases.ImportEventRequest {
+	ret := make([]usecases.ImportEventRequest, 0, len(items))
+
+	for _, item := range items {
+		req := usecases.ImportEventRequest{
+			UID:         item.UID,
+			Title:       item.Event.Title,
+			Start:       item.Event.Start,
+			End:         item.Event.End,
+			Description: item.Event.Description,
+			ExDates:     item.Event.ExDates,
+			Err:         item.Err,
+		}
+
+		for _, o := range item.Event.Overrides {
+			req.Overrides = append(req.Overrides, usecases.ImportOverrideRequest(o))
+		}
+
+		if item.Event.Recurrence != nil {
+			req.RRule = item.Event.Recurrence.String()
+		}
+
+		ret = append(ret, req)
+	}
+
+	return ret
+}
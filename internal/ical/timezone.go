@@ -0,0 +1,254 @@
+package ical
+
+import (
+	"fmt"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"sort"
+	"time"
+)
+
+// transitionStep шаг поиска смен смещения зоны. Зоны не меняют смещение чаще, чем раз в несколько недель
+const transitionStep = 12 * time.Hour
+
+// transition смена смещения зоны
+type transition struct {
+	at       time.Time // Момент смены
+	from, to int       // Смещения от UTC до и после смены в секундах
+	name     string    // Сокращение зоны после смены (CEST, EET)
+	dst      bool      // После смены действует летнее время
+}
+
+// local возвращает местное время смены по смещению до нее: так его записывает DTSTART правила зоны
+func (t transition) local() time.Time {
+	return t.at.In(time.FixedZone("", t.from))
+}
+
+// rule возвращает ежегодное правило смены: месяц и день недели с номером в месяце (последний - -1)
+func (t transition) rule() string {
+	l := t.local()
+	n := (l.Day()-1)/7 + 1
+	if l.Day()+7 > daysIn(l.Year(), l.Month()) {
+		n = -1
+	}
+
+	return fmt.Sprintf("FREQ=YEARLY;BYMONTH=%d;BYDAY=%s", l.Month(), entities.WeekdayNum{N: n, Day: l.Weekday()})
+}
+
+// sameRule проверяет, что смены t и o происходят по одному ежегодному правилу в одно местное время
+func (t transition) sameRule(o transition) bool {
+	lt, lo := t.local(), o.local()
+
+	return t.rule() == o.rule() && t.from == o.from && t.to == o.to && t.name == o.name &&
+		lt.Hour() == lo.Hour() && lt.Minute() == lo.Minute() && lt.Second() == lo.Second()
+}
+
+// zoneUsage зона, время в которой пишется с TZID, и годы, в которые это время попадает
+type zoneUsage struct {
+	loc              *time.Location
+	minYear, maxYear int
+}
+
+// zoneSet зоны, используемые в календаре, по TZID
+type zoneSet map[string]*zoneUsage
+
+// add учитывает время t, если оно пишется с TZID
+func (zs zoneSet) add(t time.Time) {
+	tzid, ok := zoneID(t)
+	if !ok {
+		return
+	}
+
+	z, ok := zs[tzid]
+	if !ok {
+		zs[tzid] = &zoneUsage{loc: t.Location(), minYear: t.Year(), maxYear: t.Year()}
+		return
+	}
+	if t.Year() < z.minYear {
+		z.minYear = t.Year()
+	}
+	if t.Year() > z.maxYear {
+		z.maxYear = t.Year()
+	}
+}
+
+// addEvent учитывает все времена события, включая окончание серии и измененные повторения
+func (zs zoneSet) addEvent(event *entities.Event) {
+	zs.add(event.Start)
+	zs.add(event.End)
+	for _, t := range event.ExDates {
+		zs.add(t)
+	}
+	for _, o := range event.Overrides {
+		zs.add(o.OriginalStart)
+		zs.add(o.Start)
+		zs.add(o.End)
+	}
+
+	// UNTIL хранится в UTC, но продлевает серию в зоне ее начала
+	if event.Recurrence != nil && !event.Recurrence.Until.IsZero() {
+		zs.add(event.Recurrence.Until.In(event.Start.Location()))
+	}
+}
+
+// zoneID возвращает TZID времени в именованной зоне IANA. Остальное время пишется в UTC
+func zoneID(t time.Time) (string, bool) {
+	tzid := t.Location().String()
+
+	return tzid, tzid != "UTC" && tzid != "Local" && tzid != ""
+}
+
+// timezones пишет компоненты VTIMEZONE (RFC 5545, 3.6.5) для всех зон календаря в порядке TZID
+func (lw *lineWriter) timezones(zs zoneSet) {
+	ids := make([]string, 0, len(zs))
+	for id := range zs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		lw.timezone(id, zs[id])
+	}
+}
+
+// timezone пишет VTIMEZONE зоны z. Смены смещения за годы, в которые попадают события, пишутся по отдельности,
+// а начиная с года, с которого зона меняет смещение по неизменным ежегодным правилам, - правилами с RRULE:
+// так бесконечные серии получают верное смещение и после последнего известного года
+func (lw *lineWriter) timezone(tzid string, z *zoneUsage) {
+	start := time.Date(z.minYear, time.January, 1, 0, 0, 0, 0, z.loc)
+	end := time.Date(z.maxYear+1, time.January, 1, 0, 0, 0, 0, z.loc)
+	ts := transitions(z.loc, start, end)
+
+	// Смены последнего года, повторяющиеся из года в год, пишутся правилами с RRULE
+	var last []transition
+	for i := len(ts) - 1; i >= 0 && ts[i].local().Year() == z.maxYear; i-- {
+		last = append([]transition{ts[i]}, last...)
+	}
+	// Правила проверяются по следующему году: отмена летнего времени тоже оставляет в последнем году одну смену
+	next := transitions(z.loc, end, end.AddDate(1, 0, 0))
+	if len(next) != len(last) || !sameRules(next, last, z.maxYear+1) {
+		last = nil
+	}
+	regular := len(ts) - len(last)
+	for len(last) > 0 && regular >= len(last) {
+		prev := ts[regular-len(last) : regular]
+		if !sameRules(prev, last, ts[regular].local().Year()-1) {
+			break
+		}
+		regular -= len(last)
+	}
+
+	name, offset := start.Zone()
+
+	lw.line("BEGIN", nil, "VTIMEZONE")
+	lw.line("TZID", nil, tzid)
+	lw.observance(transition{at: start, from: offset, to: offset, name: name, dst: isDST(start)}, "")
+	for i, t := range ts {
+		if i < regular {
+			lw.observance(t, "")
+		} else if i < regular+len(last) {
+			lw.observance(t, t.rule())
+		}
+	}
+	lw.line("END", nil, "VTIMEZONE")
+}
+
+// observance пишет правило зоны STANDARD или DAYLIGHT, начинающееся со смены t и повторяющееся по rrule
+func (lw *lineWriter) observance(t transition, rrule string) {
+	kind := "STANDARD"
+	if t.dst {
+		kind = "DAYLIGHT"
+	}
+
+	lw.line("BEGIN", nil, kind)
+	lw.line("DTSTART", nil, t.local().Format(dateTimeLayoutLocal))
+	lw.line("TZOFFSETFROM", nil, formatOffset(t.from))
+	lw.line("TZOFFSETTO", nil, formatOffset(t.to))
+	if t.name != "" {
+		lw.line("TZNAME", nil, escapeText(t.name))
+	}
+	if rrule != "" {
+		lw.line("RRULE", nil, rrule)
+	}
+	lw.line("END", nil, kind)
+}
+
+// sameRules проверяет, что смены a происходят в году year по тем же ежегодным правилам, что и смены b
+func sameRules(a, b []transition, year int) bool {
+	for i := range a {
+		if a[i].local().Year() != year || !a[i].sameRule(b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// transitions возвращает смены смещения зоны loc в промежутке [start, end)
+func transitions(loc *time.Location, start, end time.Time) []transition {
+	var ret []transition
+
+	_, offset := start.In(loc).Zone()
+	for t := start; t.Before(end); t = t.Add(transitionStep) {
+		next := t.Add(transitionStep)
+		if _, o := next.In(loc).Zone(); o == offset {
+			continue
+		}
+
+		// Момент смены ищется с точностью до секунды
+		lo, hi := t, next
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2)
+			if _, o := mid.In(loc).Zone(); o == offset {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+
+		at := hi.In(loc)
+		name, o := at.Zone()
+		if !at.Before(end) {
+			break
+		}
+
+		ret = append(ret, transition{at: at, from: offset, to: o, name: name, dst: isDST(at)})
+		offset = o
+	}
+
+	return ret
+}
+
+// isDST проверяет, что в момент t действует летнее время: смещение больше наименьшего смещения зоны в этом году
+func isDST(t time.Time) bool {
+	_, winter := time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, t.Location()).Zone()
+	_, summer := time.Date(t.Year(), time.July, 1, 0, 0, 0, 0, t.Location()).Zone()
+	_, offset := t.Zone()
+
+	std := winter
+	if summer < std {
+		std = summer
+	}
+
+	return offset > std
+}
+
+// formatOffset записывает смещение от UTC в формате UTC-OFFSET (+0300, -0930, +053028)
+func formatOffset(seconds int) string {
+	sign := '+'
+	if seconds < 0 {
+		sign = '-'
+		seconds = -seconds
+	}
+
+	s := fmt.Sprintf("%c%02d%02d", sign, seconds/3600, seconds/60%60)
+	if seconds%60 != 0 {
+		s += fmt.Sprintf("%02d", seconds%60)
+	}
+
+	return s
+}
+
+// daysIn возвращает число дней в месяце
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -1,18 +1,41 @@
 package restapi
 
 import (
+	"errors"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/cors"
 	"github.com/go-chi/render"
+	"github.com/mzelenkin/go-calendar/internal/auth"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
 	"github.com/mzelenkin/go-calendar/internal/logging"
 	"net/http"
 	"time"
 )
 
+// Config настройки HTTP API
+type Config struct {
+	EnableCORS   bool          // Поддержка Cross-Origin Request Sharing
+	MaxListRange time.Duration // Максимальный промежуток списка событий, 0 - usecases.DefaultMaxRange
+	// TenantHeader заголовок, в котором доверенный прокси передает арендатора запроса.
+	// Пустой - арендаторов нет, все запросы работают с данными арендатора по умолчанию
+	TenantHeader string
+	// Auth проверка токенов доступа JWT, nil - без аутентификации по токену.
+	// Арендатор запроса берется из токена, поэтому вместе с TenantHeader не используется
+	Auth *auth.Verifier
+	// APIKeys принимать ключи API в заголовке X-API-Key. Арендатор запроса и разрешения берутся из ключа,
+	// поэтому вместе с TenantHeader не используется
+	APIKeys bool
+}
+
 // New конструктор HTTP API на базе Chi.
 // Он создает и настраивает необходимые компоненты для работы API
-func New(enableCORS bool) (*chi.Mux, error) {
+// storage - хранилище событий, с которым работают сценарии использования
+func New(cfg Config, storage usecases.Storage) (*chi.Mux, error) {
+	if (cfg.Auth != nil || cfg.APIKeys) && cfg.TenantHeader != "" {
+		return nil, errors.New("tenant header and authentication are mutually exclusive")
+	}
+
 	logger := logging.NewLogger()
 	r := chi.NewRouter()
 
@@ -26,8 +49,8 @@ func New(enableCORS bool) (*chi.Mux, error) {
 
 	// Если включена поддержка Cross-Origin Request Sharing (CORS), используем CORS middleware из пакета chi
 	// Требуется браузеру для ослабления правила "одного источника", когда домен запроса не совпадает с доменом API
-	if enableCORS {
-		r.Use(corsConfig().Handler)
+	if cfg.EnableCORS {
+		r.Use(corsConfig(cfg).Handler)
 	}
 
 	r.Get("/hello", func(w http.ResponseWriter, r *http.Request) {
@@ -41,18 +64,56 @@ func New(enableCORS bool) (*chi.Mux, error) {
 		}
 	})
 
+	events := usecases.NewEventUsecases(storage)
+	events.SetMaxRange(cfg.MaxListRange)
+	eventsResource := newEventsResource(events)
+	feed := newICalResource(events)
+	calendars := usecases.NewCalendarUsecases(storage)
+
+	var apiKeys *usecases.APIKeyUsecases
+	if cfg.APIKeys {
+		apiKeys = usecases.NewAPIKeyUsecases(storage)
+	}
+
+	// Ресурсы с данными арендатора
+	r.Group(func(r chi.Router) {
+		if cfg.Auth != nil || apiKeys != nil {
+			r.Use(authenticate(cfg.Auth, apiKeys))
+		}
+		if cfg.TenantHeader != "" {
+			r.Use(tenantCtx(cfg.TenantHeader))
+		}
+
+		events := requireScope(eventScopes)
+		r.With(events).Mount("/events", eventsResource.Routes())
+
+		// Выгрузка в формате iCalendar
+		r.With(events).Get("/calendar.ics", feed.Calendar)
+		r.With(events).Get("/events.ics", feed.Range)
+
+		// Календари. Ресурсы /events, /calendar.ics и /events.ics относятся к календарю по умолчанию,
+		// а те же ресурсы внутри /calendars/{calendarID} - к календарю из пути
+		r.Mount("/calendars", newCalendarsResource(calendars, eventsResource, feed).Routes())
+	})
+
 	return r, nil
 }
 
-func corsConfig() *cors.Cors {
+func corsConfig(cfg Config) *cors.Cors {
+	// Разрешенные заголовки: кроме общих, ключ API и заголовок арендатора, если он задан
+	headers := []string{"Accept", "Authorization", "Content-Type", "If-Match", "X-CSRF-Token", APIKeyHeader}
+	if cfg.TenantHeader != "" {
+		headers = append(headers, cfg.TenantHeader)
+	}
+
 	// Базовые настройки CORS
 	return cors.New(cors.Options{
 		// AllowedOrigins: []string{"https://foo.com"}, // Раскомментировать, если нужно указать конкретные хосты
 		AllowedOrigins: []string{"*"},
 		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},                 // Разрешенные методы
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"}, // Разрашенные заголовки
-		ExposedHeaders:   []string{"Link"},                                                    // Заголовки, которые может читать JS
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}, // Разрешенные методы
+		AllowedHeaders:   headers,
+		ExposedHeaders:   []string{"ETag", "Link"}, // Заголовки, которые может читать JS
 		AllowCredentials: true,
 		MaxAge:           86400, // Максимальное время, на которое предзапрос (CORS preflight) может быть закэширован
 	})
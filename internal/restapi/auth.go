@@ -0,0 +1,122 @@
+package restapi
+
+import (
+	"errors"
+	"github.com/mzelenkin/go-calendar/internal/auth"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"github.com/mzelenkin/go-calendar/internal/logging"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	"net/http"
+	"strings"
+)
+
+// APIKeyHeader заголовок, в котором сервисы передают ключ API
+const APIKeyHeader = "X-API-Key"
+
+// authenticate проверяет ключ API из заголовка X-API-Key (если keys не nil) или токен из заголовка
+// Authorization: Bearer (если v не nil) и передает сценариям в контексте запроса субъекта и его арендатора.
+// Запрос без ключа и токена или с неверным ключом или токеном отклоняется с 401
+func authenticate(v *auth.Verifier, keys *usecases.APIKeyUsecases) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var p *auth.Principal
+			var err error
+
+			token, bearer := bearerToken(r)
+			switch value := r.Header.Get(APIKeyHeader); {
+			case value != "" && keys != nil:
+				p, err = apiKeyPrincipal(r, keys, value)
+			case bearer && v != nil:
+				if p, err = v.Verify(r.Context(), token); errors.Is(err, auth.ErrInvalidToken) {
+					w.Header().Set("WWW-Authenticate", `Bearer realm="go-calendar", error="invalid_token"`)
+					err = ErrUnauthorized(err)
+				}
+			default:
+				challenge(w, v)
+				err = ErrUnauthorized(errors.New("authentication is required"))
+			}
+			if err != nil {
+				renderError(w, r, err)
+				return
+			}
+
+			logging.LogHTTPEntrySetFields(r, map[string]interface{}{"subject": p.Subject, "tenant": p.Tenant})
+			ctx := auth.NewContext(r.Context(), *p)
+			ctx = tenant.NewContext(ctx, p.Tenant)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// apiKeyPrincipal проверяет ключ API и возвращает субъекта с арендатором и разрешениями ключа
+func apiKeyPrincipal(r *http.Request, keys *usecases.APIKeyUsecases, value string) (*auth.Principal, error) {
+	key, err := keys.Authenticate(r.Context(), value)
+	if err == usecases.ErrorInvalidAPIKey {
+		return nil, ErrUnauthorized(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth.Principal{
+		Subject: "apikey:" + key.ID.String(),
+		Tenant:  key.Tenant,
+		KeyID:   key.ID.String(),
+		Scopes:  key.Scopes,
+	}, nil
+}
+
+// challenge выставляет заголовок WWW-Authenticate ответа на запрос без ключа и токена
+func challenge(w http.ResponseWriter, v *auth.Verifier) {
+	if v != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="go-calendar"`)
+		return
+	}
+
+	w.Header().Set("WWW-Authenticate", `APIKey realm="go-calendar", header="`+APIKeyHeader+`"`)
+}
+
+// bearerToken возвращает токен из заголовка Authorization со схемой Bearer
+func bearerToken(r *http.Request) (string, bool) {
+	value := r.Header.Get("Authorization")
+	if len(value) < 7 || !strings.EqualFold(value[:7], "Bearer ") {
+		return "", false
+	}
+
+	token := strings.TrimSpace(value[7:])
+
+	return token, token != ""
+}
+
+// scopes разрешения на чтение и изменение ресурса
+type scopes struct {
+	read  string
+	write string
+}
+
+// Разрешения ресурсов API
+var (
+	eventScopes    = scopes{read: entities.ScopeEventsRead, write: entities.ScopeEventsWrite}
+	calendarScopes = scopes{read: entities.ScopeCalendarsRead, write: entities.ScopeCalendarsWrite}
+)
+
+// requireScope пропускает запрос, только если субъекту разрешено чтение ресурса (GET и HEAD) или его изменение
+// (остальные методы). Запросы без аутентификации и с токеном JWT разрешениями не ограничены
+func requireScope(s scopes) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scope := s.write
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				scope = s.read
+			}
+
+			if p, ok := auth.FromContext(r.Context()); ok && !p.Allows(scope) {
+				renderError(w, r, ErrInsufficientScope(scope))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
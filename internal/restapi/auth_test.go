@@ -0,0 +1,238 @@
+package restapi
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/mzelenkin/go-calendar/internal/auth"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"github.com/mzelenkin/go-calendar/internal/storage/inmemory"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// signRS256 подписывает токен RS256 с идентификатором ключа kid
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	h, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	c, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+
+	sum := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// doAuthRequest выполняет запрос к API с токеном, пустой token - без заголовка Authorization
+func doAuthRequest(api http.Handler, token, method, url string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+
+	req := httptest.NewRequest(method, url, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+
+	return rec
+}
+
+// TestAuthenticate проверяет отказ без действующего токена и разделение данных по арендатору из токена
+func TestAuthenticate(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "k1", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer jwks.Close()
+
+	verifier, err := auth.New(auth.Config{JWKSURL: jwks.URL, Audience: "calendar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	if _, err = New(Config{Auth: verifier, TenantHeader: "X-Tenant-ID"}, storage); err == nil {
+		t.Fatal("expected error for tenant header with token authentication")
+	}
+	api, err := New(Config{Auth: verifier}, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := func(tenant string, exp time.Time) string {
+		claims := map[string]interface{}{"sub": "alice", "aud": "calendar", "exp": exp.Unix()}
+		if tenant != "" {
+			claims["tenant"] = tenant
+		}
+		return signRS256(t, key, "k1", claims)
+	}
+	valid := time.Now().Add(time.Hour)
+
+	for name, tok := range map[string]string{
+		"no token": "",
+		"expired":  token("acme", time.Now().Add(-time.Hour)),
+		"garbage":  "abc",
+	} {
+		rec := doAuthRequest(api, tok, http.MethodGet, "/events?day=2020-05-12", nil)
+		if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: unexpected status %d: %s", name, rec.Code, rec.Body.String())
+			continue
+		}
+		var p Problem
+		if err = json.Unmarshal(rec.Body.Bytes(), &p); err != nil || p.Code != CodeUnauthorized {
+			t.Errorf("%s: unexpected problem %s", name, rec.Body.String())
+		}
+	}
+
+	// Служебный ресурс доступен без токена
+	if rec := doAuthRequest(api, "", http.MethodGet, "/hello", nil); rec.Code != http.StatusOK {
+		t.Errorf("hello: unexpected status %d", rec.Code)
+	}
+
+	start := time.Date(2020, 5, 12, 10, 0, 0, 0, time.Local)
+	rec := doAuthRequest(api, token("acme", valid), http.MethodPost, "/events", EventRequest{Title: "Планерка", Start: start, End: start.Add(time.Hour)})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	location := rec.Header().Get("Location")
+
+	if rec = doAuthRequest(api, token("acme", valid), http.MethodGet, location, nil); rec.Code != http.StatusOK {
+		t.Errorf("get: unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	// Токены другого арендатора и без арендатора не видят событие
+	for _, other := range []string{"globex", ""} {
+		if rec = doAuthRequest(api, token(other, valid), http.MethodGet, location, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("get from tenant %q: unexpected status %d: %s", other, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+// doAPIKeyRequest выполняет запрос к API с ключом API, пустой key - без заголовка X-API-Key
+func doAPIKeyRequest(api http.Handler, key, method, url string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+
+	req := httptest.NewRequest(method, url, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(APIKeyHeader, key)
+	}
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+
+	return rec
+}
+
+// TestAuthenticate_APIKey проверяет аутентификацию по ключу API, арендатора ключа и разрешения на ресурсы
+func TestAuthenticate_APIKey(t *testing.T) {
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	if _, err := New(Config{APIKeys: true, TenantHeader: "X-Tenant-ID"}, storage); err == nil {
+		t.Fatal("expected error for tenant header with api keys")
+	}
+	api, err := New(Config{APIKeys: true}, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := usecases.NewAPIKeyUsecases(storage)
+	acme := tenant.NewContext(context.Background(), "acme")
+	newKey := func(ctx context.Context, scopes ...string) *usecases.APIKeyResponse {
+		key, err := keys.Create(ctx, &usecases.CreateAPIKeyRequest{Name: "service", Scopes: scopes})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	writer := newKey(acme, entities.ScopeEventsRead, entities.ScopeEventsWrite)
+	reader := newKey(acme, entities.ScopeEventsRead)
+	other := newKey(context.Background(), entities.ScopeEventsRead)
+	revoked := newKey(acme, entities.ScopeEventsRead)
+	id, _ := entities.NewAPIKeyID(revoked.ID)
+	if err = keys.Revoke(acme, id); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, key := range map[string]string{
+		"no key":  "",
+		"unknown": usecases.APIKeyPrefix + "unknown",
+		"revoked": revoked.Key,
+	} {
+		rec := doAPIKeyRequest(api, key, http.MethodGet, "/events?day=2020-05-12", nil)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: unexpected status %d: %s", name, rec.Code, rec.Body.String())
+			continue
+		}
+		var p Problem
+		if err = json.Unmarshal(rec.Body.Bytes(), &p); err != nil || p.Code != CodeUnauthorized {
+			t.Errorf("%s: unexpected problem %s", name, rec.Body.String())
+		}
+	}
+
+	start := time.Date(2020, 5, 12, 10, 0, 0, 0, time.Local)
+	event := EventRequest{Title: "Планерка", Start: start, End: start.Add(time.Hour)}
+	rec := doAPIKeyRequest(api, writer.Key, http.MethodPost, "/events", event)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	location := rec.Header().Get("Location")
+
+	// Ключ с чтением видит событие своего арендатора, ключ другого арендатора - нет
+	if rec = doAPIKeyRequest(api, reader.Key, http.MethodGet, location, nil); rec.Code != http.StatusOK {
+		t.Errorf("get: unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec = doAPIKeyRequest(api, other.Key, http.MethodGet, location, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("get from another tenant: unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	for _, c := range []struct {
+		method, url string
+		body        interface{}
+	}{
+		{http.MethodPost, "/events", event},
+		{http.MethodDelete, location, nil},
+		{http.MethodGet, "/calendars", nil},
+		{http.MethodPost, "/calendars", CalendarRequest{Name: "Работа"}},
+	} {
+		rec = doAPIKeyRequest(api, reader.Key, c.method, c.url, c.body)
+		var p Problem
+		if rec.Code != http.StatusForbidden || json.Unmarshal(rec.Body.Bytes(), &p) != nil || p.Code != CodeInsufficientScope {
+			t.Errorf("%s %s: unexpected response %d: %s", c.method, c.url, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+// TestAPIKey_CORS проверяет, что браузеру разрешено передавать ключ API
+func TestAPIKey_CORS(t *testing.T) {
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	api, err := New(Config{EnableCORS: true}, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := preflight(api, "Content-Type, "+APIKeyHeader); got != "Content-Type, X-Api-Key" {
+		t.Errorf("unexpected allowed headers %q", got)
+	}
+}
@@ -0,0 +1,214 @@
+package restapi
+
+import (
+	"context"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"github.com/mzelenkin/go-calendar/internal/logging"
+	"net/http"
+	"path"
+	"time"
+)
+
+// calendarsResource REST ресурс /calendars: календари и вложенные в них ресурсы событий
+type calendarsResource struct {
+	calendars *usecases.CalendarUsecases
+	events    *eventsResource
+	feed      *icalResource
+}
+
+// newCalendarsResource конструктор ресурса календарей
+func newCalendarsResource(calendars *usecases.CalendarUsecases, events *eventsResource, feed *icalResource) *calendarsResource {
+	return &calendarsResource{calendars: calendars, events: events, feed: feed}
+}
+
+// Routes возвращает роутер ресурса
+func (rs *calendarsResource) Routes() chi.Router {
+	r := chi.NewRouter()
+
+	calendars := requireScope(calendarScopes)
+	events := requireScope(eventScopes)
+
+	r.With(calendars).Get("/", rs.List)
+	r.With(calendars).Post("/", rs.Create)
+
+	r.Route("/{calendarID}", func(r chi.Router) {
+		r.With(calendars).Get("/", rs.Get)
+		r.With(calendars).Put("/", rs.Update)
+		r.With(calendars).Delete("/", rs.Delete)
+
+		// События календаря: те же маршруты, что и /events, но в календаре из пути
+		r.With(events, rs.calendarCtx).Mount("/events", rs.events.Routes())
+		r.With(events, rs.calendarCtx).Get("/calendar.ics", rs.feed.Calendar)
+		r.With(events, rs.calendarCtx).Get("/events.ics", rs.feed.Range)
+	})
+
+	return r
+}
+
+// CalendarRequest тело запроса на создание или изменение календаря
+type CalendarRequest struct {
+	Name     string `json:"name"`
+	Color    string `json:"color"`    // #rrggbb
+	Owner    string `json:"owner"`    // Идентификатор владельца
+	Timezone string `json:"timezone"` // Зона IANA, в которой понимаются даты в параметрах списков событий
+}
+
+// Bind реализует интерфейс render.Binder
+func (c *CalendarRequest) Bind(r *http.Request) error {
+	return nil
+}
+
+// List GET /calendars?owner= возвращает календарь по умолчанию и календари владельца (без owner - все календари)
+func (rs *calendarsResource) List(w http.ResponseWriter, r *http.Request) {
+	items, err := rs.calendars.List(r.Context(), r.URL.Query().Get("owner"))
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, items)
+}
+
+// Create POST /calendars создает календарь
+func (rs *calendarsResource) Create(w http.ResponseWriter, r *http.Request) {
+	data := &CalendarRequest{}
+	if err := render.Bind(r, data); err != nil {
+		renderError(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	id, err := rs.calendars.Create(r.Context(), &usecases.CreateCalendarRequest{
+		Name:     data.Name,
+		Color:    data.Color,
+		Owner:    data.Owner,
+		Timezone: data.Timezone,
+	})
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	logging.LogHTTPEntrySetField(r, "calendar_id", id)
+	w.Header().Set("Location", path.Join(r.URL.Path, id))
+
+	rs.renderCalendar(w, r, id, http.StatusCreated)
+}
+
+// Get GET /calendars/{calendarID} возвращает календарь
+func (rs *calendarsResource) Get(w http.ResponseWriter, r *http.Request) {
+	rs.renderCalendar(w, r, chi.URLParam(r, "calendarID"), http.StatusOK)
+}
+
+// Update PUT /calendars/{calendarID} изменяет календарь целиком
+func (rs *calendarsResource) Update(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "calendarID")
+	if _, err := entities.NewCalendarID(id); err != nil {
+		renderError(w, r, ErrNotFound)
+		return
+	}
+
+	data := &CalendarRequest{}
+	if err := render.Bind(r, data); err != nil {
+		renderError(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	err := rs.calendars.Update(r.Context(), &usecases.UpdateCalendarRequest{
+		ID:       id,
+		Name:     data.Name,
+		Color:    data.Color,
+		Owner:    data.Owner,
+		Timezone: data.Timezone,
+	})
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	rs.renderCalendar(w, r, id, http.StatusOK)
+}
+
+// Delete DELETE /calendars/{calendarID} удаляет календарь вместе с его событиями
+func (rs *calendarsResource) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := entities.NewCalendarID(chi.URLParam(r, "calendarID"))
+	if err != nil {
+		renderError(w, r, ErrNotFound)
+		return
+	}
+
+	if err = rs.calendars.Delete(r.Context(), id); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// renderCalendar отдает клиенту календарь с идентификатором id и кодом ответа status
+func (rs *calendarsResource) renderCalendar(w http.ResponseWriter, r *http.Request, id string, status int) {
+	calendarID, err := entities.NewCalendarID(id)
+	if err != nil {
+		renderError(w, r, ErrNotFound)
+		return
+	}
+
+	item, err := rs.calendars.Get(r.Context(), calendarID)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	render.Status(r, status)
+	render.JSON(w, r, item)
+}
+
+// calendarScopeKey ключ контекста запроса, под которым лежит calendarScope
+type calendarScopeKey struct{}
+
+// calendarScope календарь, к событиям которого относится запрос
+type calendarScope struct {
+	events   *usecases.EventUsecases // Сценарии для событий календаря
+	location *time.Location          // Зона, в которой понимаются даты в параметрах запроса
+}
+
+// calendarCtx находит календарь из пути и передает его обработчикам событий в контексте запроса.
+// Для несуществующего календаря отвечает 404
+func (rs *calendarsResource) calendarCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := entities.NewCalendarID(chi.URLParam(r, "calendarID"))
+		if err != nil {
+			renderError(w, r, ErrNotFound)
+			return
+		}
+
+		calendar, err := rs.calendars.Find(r.Context(), id)
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+
+		scope := calendarScope{events: rs.events.events.InCalendar(id), location: calendar.Location()}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), calendarScopeKey{}, scope)))
+	})
+}
+
+// scopedEvents возвращает сценарии для событий календаря запроса, вне календаря - events
+func scopedEvents(r *http.Request, events *usecases.EventUsecases) *usecases.EventUsecases {
+	if scope, ok := r.Context().Value(calendarScopeKey{}).(calendarScope); ok {
+		return scope.events
+	}
+
+	return events
+}
+
+// requestLocation возвращает зону календаря запроса, вне календаря - зону сервера
+func requestLocation(r *http.Request) *time.Location {
+	if scope, ok := r.Context().Value(calendarScopeKey{}).(calendarScope); ok {
+		return scope.location
+	}
+
+	return time.Local
+}
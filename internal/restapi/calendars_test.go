@@ -0,0 +1,129 @@
+package restapi
+
+import (
+	"encoding/json"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// createCalendar создает календарь через API и возвращает его
+func createCalendar(t *testing.T, api http.Handler, data CalendarRequest) usecases.CalendarResponse {
+	rec := doRequest(api, http.MethodPost, "/calendars", data)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create calendar: unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var created usecases.CalendarResponse
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+
+	return created
+}
+
+// TestCalendarsResource_CRUD проверяет полный цикл работы с календарем через REST API
+func TestCalendarsResource_CRUD(t *testing.T) {
+	api := newTestAPI(t)
+
+	created := createCalendar(t, api, CalendarRequest{Name: "Работа", Color: "#3366cc", Owner: "alice", Timezone: "Europe/Moscow"})
+	if created.Name != "Работа" || created.Timezone != "Europe/Moscow" || created.Default {
+		t.Fatalf("unexpected calendar %+v", created)
+	}
+
+	rec := doRequest(api, http.MethodGet, "/calendars?owner=alice", nil)
+	var list []usecases.CalendarResponse
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || !list[0].Default || list[1].ID != created.ID {
+		t.Fatalf("unexpected calendars %+v", list)
+	}
+
+	rec = doRequest(api, http.MethodPut, "/calendars/"+created.ID, CalendarRequest{Name: "Офис", Owner: "alice"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(api, http.MethodPost, "/calendars", CalendarRequest{Name: "Зона", Timezone: "Mars/Olympus"})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid timezone: unexpected status %d", rec.Code)
+	}
+
+	if rec = doRequest(api, http.MethodDelete, "/calendars/"+created.ID, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec = doRequest(api, http.MethodGet, "/calendars/"+created.ID, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("get deleted: unexpected status %d", rec.Code)
+	}
+
+	defaultPath := "/calendars/00000000-0000-0000-0000-000000000000"
+	if rec = doRequest(api, http.MethodDelete, defaultPath, nil); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("delete default: unexpected status %d", rec.Code)
+	}
+}
+
+// TestCalendarsResource_Events проверяет события внутри календаря: занятость и видимость ограничены календарем,
+// а даты списков понимаются в зоне календаря
+func TestCalendarsResource_Events(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip("timezone database is not available")
+	}
+
+	api := newTestAPI(t)
+	calendar := createCalendar(t, api, CalendarRequest{Name: "Токио", Timezone: "Asia/Tokyo"})
+	events := "/calendars/" + calendar.ID + "/events"
+
+	// 12 мая, 8:00 в Токио - еще 11 мая по UTC
+	start := time.Date(2020, 5, 12, 8, 0, 0, 0, loc)
+	request := EventRequest{Title: "Завтрак", Start: start, End: start.Add(time.Hour)}
+
+	if rec := doRequest(api, http.MethodPost, "/events", request); rec.Code != http.StatusCreated {
+		t.Fatalf("create in default calendar: unexpected status %d", rec.Code)
+	}
+	rec := doRequest(api, http.MethodPost, events, request)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("the same time in another calendar must be free, got %d: %s", rec.Code, rec.Body.String())
+	}
+	location := rec.Header().Get("Location")
+
+	var created usecases.ListResponseItem
+	if err = json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if location != events+"/"+created.ID {
+		t.Errorf("unexpected location %q", location)
+	}
+
+	if rec = doRequest(api, http.MethodPost, events, request); rec.Code != http.StatusConflict {
+		t.Errorf("busy time: unexpected status %d", rec.Code)
+	}
+	if rec = doRequest(api, http.MethodGet, "/events/"+created.ID, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("event of another calendar: unexpected status %d", rec.Code)
+	}
+	if rec = doRequest(api, http.MethodGet, location, nil); rec.Code != http.StatusOK {
+		t.Errorf("get: unexpected status %d", rec.Code)
+	}
+
+	rec = doRequest(api, http.MethodGet, events+"?day=2020-05-12", nil)
+	var items []usecases.ListResponseItem
+	if err = json.NewDecoder(rec.Body).Decode(&items); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].ID != created.ID {
+		t.Fatalf("expected only the calendar event on its local day, got %+v", items)
+	}
+
+	unknown := "/calendars/6ba7b810-9dad-11d1-80b4-00c04fd430c8/events?day=2020-05-12"
+	if rec = doRequest(api, http.MethodGet, unknown, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown calendar: unexpected status %d", rec.Code)
+	}
+
+	// Удаление календаря удаляет и его события
+	doRequest(api, http.MethodDelete, "/calendars/"+calendar.ID, nil)
+	if rec = doRequest(api, http.MethodGet, location, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("event of deleted calendar: unexpected status %d", rec.Code)
+	}
+}
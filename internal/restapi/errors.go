@@ -0,0 +1,210 @@
+package restapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"github.com/mzelenkin/go-calendar/internal/logging"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"net/http"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ContentTypeProblemJSON тип содержимого ответа с ошибкой (RFC 7807)
+const ContentTypeProblemJSON = "application/problem+json"
+
+// Стабильные коды ошибок, по которым клиенты могут различать ошибки не разбирая текст
+const (
+	CodeInvalidRequest      = "invalid_request"
+	CodePayloadTooLarge     = "payload_too_large"
+	CodeValidationFailed    = "validation_failed"
+	CodeNotFound            = "entity_not_found"
+	CodeAlreadyExists       = "entity_already_exists"
+	CodeDateBusy            = "date_busy"
+	CodeNotRecurring        = "not_recurring"
+	CodeOccurrenceNotFound  = "occurrence_not_found"
+	CodeShiftByRule         = "shift_by_rule"
+	CodeVersionConflict     = "version_conflict"
+	CodeTryAgain            = "try_again"
+	CodeDefaultCalendar     = "default_calendar"
+	CodeInvalidTenant       = "invalid_tenant"
+	CodeUnauthorized        = "unauthorized"
+	CodeInsufficientScope   = "insufficient_scope"
+	CodeInternalServerError = "internal_error"
+)
+
+// Problem тело ответа с ошибкой в формате application/problem+json (RFC 7807).
+// Помимо стандартных полей содержит расширения code и violations
+type Problem struct {
+	Type       string      `json:"type"`
+	Title      string      `json:"title"`
+	Status     int         `json:"status"`
+	Detail     string      `json:"detail,omitempty"`
+	Instance   string      `json:"instance,omitempty"`
+	Code       string      `json:"code"`
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// Violation нарушение правила валидации конкретного поля
+type Violation struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// ErrNotFound ответ для несуществующего ресурса
+var ErrNotFound = NewProblem(http.StatusNotFound, CodeNotFound, "resource not found")
+
+// NewProblem конструктор описания ошибки
+func NewProblem(status int, code string, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Error реализует интерфейс error
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+// ErrInvalidRequest ответ для некорректного запроса
+func ErrInvalidRequest(err error) *Problem {
+	return NewProblem(http.StatusBadRequest, CodeInvalidRequest, err.Error())
+}
+
+// ErrPayloadTooLarge ответ для запроса с телом длиннее limit байт
+func ErrPayloadTooLarge(limit int64) *Problem {
+	return NewProblem(http.StatusRequestEntityTooLarge, CodePayloadTooLarge, fmt.Sprintf("request body exceeds %d bytes", limit))
+}
+
+// ErrInvalidTenant ответ для запроса без арендатора или с некорректным арендатором
+func ErrInvalidTenant(err error) *Problem {
+	return NewProblem(http.StatusBadRequest, CodeInvalidTenant, err.Error())
+}
+
+// ErrUnauthorized ответ для запроса без токена доступа или с неверным токеном
+func ErrUnauthorized(err error) *Problem {
+	return NewProblem(http.StatusUnauthorized, CodeUnauthorized, err.Error())
+}
+
+// ErrInsufficientScope ответ для запроса с ключом API без разрешения scope
+func ErrInsufficientScope(scope string) *Problem {
+	return NewProblem(http.StatusForbidden, CodeInsufficientScope, "api key lacks scope "+scope)
+}
+
+// renderError переводит ошибку в HTTP ответ application/problem+json
+func renderError(w http.ResponseWriter, r *http.Request, err error) {
+	p := problemFromError(err)
+	p.Instance = r.URL.Path
+
+	if p.Status >= http.StatusInternalServerError {
+		logging.GetHTTPLogEntry(r).Error("Request error: ", err.Error())
+	}
+
+	w.Header().Set("Content-Type", ContentTypeProblemJSON)
+	if p.Code == CodeTryAgain {
+		w.Header().Set("Retry-After", "1")
+	}
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		logging.GetHTTPLogEntry(r).Error("Response writing error: ", err.Error())
+	}
+}
+
+// errorProblem сопоставление ошибки сценария использования или хранилища HTTP статусу и стабильному коду
+type errorProblem struct {
+	err    error
+	status int
+	code   string
+	// detail отдавать клиенту текст ошибки целиком, а не только текст err: подробности разбора запроса
+	detail bool
+}
+
+// errorProblems известные ошибки сценариев использования и хранилища. Ошибки ищутся с помощью errors.Is,
+// поэтому находятся и обернутыми
+var errorProblems = []errorProblem{
+	{err: usecases.ErrorInvalidPatch, status: http.StatusBadRequest, code: CodeInvalidRequest, detail: true},
+	{err: usecases.ErrorInvalidRange, status: http.StatusBadRequest, code: CodeInvalidRequest, detail: true},
+	{err: usecases.ErrorInvalidPage, status: http.StatusBadRequest, code: CodeInvalidRequest, detail: true},
+	{err: usecases.ErrorDateBusy, status: http.StatusConflict, code: CodeDateBusy},
+	{err: storage.EntitySpanBusy, status: http.StatusConflict, code: CodeDateBusy},
+	{err: storage.EntitySpanLocked, status: http.StatusServiceUnavailable, code: CodeTryAgain},
+	{err: usecases.ErrorConcurrentUpdate, status: http.StatusServiceUnavailable, code: CodeTryAgain},
+	{err: usecases.ErrorOccurrenceNotFound, status: http.StatusNotFound, code: CodeOccurrenceNotFound},
+	{err: usecases.ErrorNotRecurring, status: http.StatusUnprocessableEntity, code: CodeNotRecurring},
+	{err: usecases.ErrorShiftByRule, status: http.StatusUnprocessableEntity, code: CodeShiftByRule},
+	{err: usecases.ErrorDefaultCalendar, status: http.StatusUnprocessableEntity, code: CodeDefaultCalendar},
+	{err: usecases.ErrorInvalidAPIKey, status: http.StatusUnauthorized, code: CodeUnauthorized},
+	{err: storage.EntityNotFound, status: http.StatusNotFound, code: CodeNotFound},
+	{err: storage.EntityAlreadyExists, status: http.StatusConflict, code: CodeAlreadyExists},
+	{err: storage.EntityVersionConflict, status: http.StatusPreconditionFailed, code: CodeVersionConflict},
+}
+
+// problemFromError центральный транслятор ошибок сценариев использования, хранилища и валидации
+// в описание ошибки с HTTP статусом и стабильным кодом
+func problemFromError(err error) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		// Копируем, чтобы не портить разделяемые значения вроде ErrNotFound
+		c := *p
+		return &c
+	}
+
+	var errs validator.ValidationErrors
+	if errors.As(err, &errs) {
+		p = NewProblem(http.StatusUnprocessableEntity, CodeValidationFailed, "request validation failed")
+		p.Violations = violations(errs)
+		return p
+	}
+
+	for _, ep := range errorProblems {
+		if !errors.Is(err, ep.err) {
+			continue
+		}
+		if ep.detail {
+			return NewProblem(ep.status, ep.code, err.Error())
+		}
+		return NewProblem(ep.status, ep.code, ep.err.Error())
+	}
+
+	// Неизвестные и внутренние ошибки клиенту не раскрываем
+	return NewProblem(http.StatusInternalServerError, CodeInternalServerError, "")
+}
+
+// violations преобразует ошибки валидатора в список нарушений по полям
+func violations(errs validator.ValidationErrors) []Violation {
+	ret := make([]Violation, 0, len(errs))
+	for _, fe := range errs {
+		v := Violation{
+			Field: fieldName(fe.Field()),
+			Rule:  fe.Tag(),
+			Param: fe.Param(),
+		}
+
+		v.Message = v.Field + " must satisfy " + v.Rule
+		if v.Param != "" {
+			v.Message += "=" + fieldName(v.Param)
+		}
+
+		ret = append(ret, v)
+	}
+
+	return ret
+}
+
+// fieldName приводит имя поля структуры DTO к имени поля в JSON (Title -> title)
+func fieldName(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(r)) + name[size:]
+}
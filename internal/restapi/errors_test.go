@@ -0,0 +1,131 @@
+package restapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/storage/inmemory"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestProblemFromError проверяет сопоставление ошибок HTTP статусам и кодам
+func TestProblemFromError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{usecases.ErrorDateBusy, http.StatusConflict, CodeDateBusy},
+		{storage.EntityNotFound, http.StatusNotFound, CodeNotFound},
+		{storage.EntityAlreadyExists, http.StatusConflict, CodeAlreadyExists},
+		{usecases.ErrorDefaultCalendar, http.StatusUnprocessableEntity, CodeDefaultCalendar},
+		{usecases.ErrorOccurrenceNotFound, http.StatusNotFound, CodeOccurrenceNotFound},
+		{usecases.ErrorNotRecurring, http.StatusUnprocessableEntity, CodeNotRecurring},
+		{usecases.ErrorInvalidAPIKey, http.StatusUnauthorized, CodeUnauthorized},
+		{storage.EntityVersionConflict, http.StatusPreconditionFailed, CodeVersionConflict},
+		{storage.EntitySpanBusy, http.StatusConflict, CodeDateBusy},
+		{storage.EntitySpanLocked, http.StatusServiceUnavailable, CodeTryAgain},
+		{usecases.ErrorConcurrentUpdate, http.StatusServiceUnavailable, CodeTryAgain},
+		{ErrInvalidRequest(errors.New("bad")), http.StatusBadRequest, CodeInvalidRequest},
+		{ErrPayloadTooLarge(1024), http.StatusRequestEntityTooLarge, CodePayloadTooLarge},
+		// Обернутые ошибки сопоставляются так же, как исходные
+		{fmt.Errorf("update: %w", storage.EntityNotFound), http.StatusNotFound, CodeNotFound},
+		{fmt.Errorf("update: %w", storage.EntityVersionConflict), http.StatusPreconditionFailed, CodeVersionConflict},
+		{fmt.Errorf("create: %w", usecases.ErrorDateBusy), http.StatusConflict, CodeDateBusy},
+		{fmt.Errorf("%w: size", usecases.ErrorInvalidPage), http.StatusBadRequest, CodeInvalidRequest},
+		{fmt.Errorf("render: %w", ErrNotFound), http.StatusNotFound, CodeNotFound},
+		{usecases.UsecaseError("unmapped"), http.StatusInternalServerError, CodeInternalServerError},
+		{errors.New("connection refused"), http.StatusInternalServerError, CodeInternalServerError},
+	}
+
+	for _, tt := range tests {
+		p := problemFromError(tt.err)
+		if p.Status != tt.status || p.Code != tt.code {
+			t.Errorf("%v: expected %d %s, got %d %s", tt.err, tt.status, tt.code, p.Status, p.Code)
+		}
+	}
+
+	// Детали внутренних ошибок не должны уходить клиенту
+	if p := problemFromError(errors.New("connection refused")); p.Detail != "" {
+		t.Errorf("internal error detail leaked: %s", p.Detail)
+	}
+	// Обертка ошибки хранилища может содержать подробности хранилища, клиенту уходит только текст самой ошибки
+	if p := problemFromError(fmt.Errorf("row 42: %w", storage.EntityNotFound)); p.Detail != storage.EntityNotFound.Error() {
+		t.Errorf("wrapped error detail leaked: %s", p.Detail)
+	}
+}
+
+// TestProblemFromError_Validation проверяет перечисление нарушенных правил по полям
+func TestProblemFromError_Validation(t *testing.T) {
+	s, _ := inmemory.NewEventInMemoryStorage()
+	now := time.Now()
+
+	_, err := usecases.NewEventUsecases(s).Create(context.Background(), &usecases.CreateEventRequest{
+		Title: "x",
+		Start: now,
+		End:   now.Add(-time.Hour),
+	})
+
+	p := problemFromError(err)
+	if p.Status != http.StatusUnprocessableEntity || p.Code != CodeValidationFailed {
+		t.Fatalf("unexpected problem %+v", p)
+	}
+
+	fields := map[string]string{}
+	for _, v := range p.Violations {
+		fields[v.Field] = v.Rule
+	}
+
+	if fields["title"] != "min" || fields["start"] != "ltfield" || fields["end"] != "gtfield" {
+		t.Errorf("unexpected violations %+v", p.Violations)
+	}
+}
+
+// TestRenderError проверяет формат ответа application/problem+json
+func TestRenderError(t *testing.T) {
+	api := newTestAPI(t)
+
+	rec := doRequest(api, http.MethodGet, "/events/6ba7b810-9dad-11d1-80b4-00c04fd430c8", nil)
+	if ct := rec.Header().Get("Content-Type"); ct != ContentTypeProblemJSON {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+
+	var p Problem
+	if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Status != http.StatusNotFound || p.Code != CodeNotFound || p.Instance == "" {
+		t.Errorf("unexpected problem %+v", p)
+	}
+}
+
+// lockedStorage хранилище, которое не может проверить пересечения из-за одновременных записей
+type lockedStorage struct {
+	usecases.Storage
+}
+
+func (lockedStorage) CreateIfFree(context.Context, *entities.Event) error {
+	return storage.EntitySpanLocked
+}
+
+// TestRenderError_TryAgain проверяет, что неудавшуюся из-за одновременных записей проверку клиенту предлагают повторить
+func TestRenderError_TryAgain(t *testing.T) {
+	s, _ := inmemory.NewEventInMemoryStorage()
+	api, err := New(Config{}, lockedStorage{s})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2020, 5, 12, 10, 0, 0, 0, time.UTC)
+	rec := doRequest(api, http.MethodPost, "/events", EventRequest{Title: "Планерка", Start: start, End: start.Add(time.Hour)})
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("unexpected status %d, Retry-After %q: %s", rec.Code, rec.Header().Get("Retry-After"), rec.Body.String())
+	}
+}
@@ -0,0 +1,529 @@
+package restapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"github.com/mzelenkin/go-calendar/internal/logging"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateLayout формат даты в параметрах запроса списка событий
+const dateLayout = "2006-01-02"
+
+// defaultAgendaSize число событий в повестке, если параметр limit не передан
+const defaultAgendaSize = 10
+
+// maxPatchSize максимальный размер тела PATCH
+const maxPatchSize = 1 << 20
+
+// eventsResource REST ресурс /events, транслирующий HTTP запросы в сценарии использования событий
+type eventsResource struct {
+	events *usecases.EventUsecases
+}
+
+// newEventsResource конструктор ресурса событий
+func newEventsResource(events *usecases.EventUsecases) *eventsResource {
+	return &eventsResource{events: events}
+}
+
+// Routes возвращает роутер ресурса
+func (rs *eventsResource) Routes() chi.Router {
+	r := chi.NewRouter()
+
+	r.Get("/", rs.List)
+	r.Get("/agenda", rs.Agenda)
+	r.Post("/", rs.Create)
+	r.Post("/import", rs.Import)
+
+	r.Route("/{id}", func(r chi.Router) {
+		r.Get("/", rs.Get)
+		r.Put("/", rs.Update)
+		r.Patch("/", rs.Patch)
+		r.Delete("/", rs.Delete)
+
+		// Повторение серии адресуется исходным началом в формате RFC 3339
+		r.Put("/occurrences/{start}", rs.UpdateOccurrence)
+		r.Delete("/occurrences/{start}", rs.DeleteOccurrence)
+	})
+
+	return r
+}
+
+// EventRequest тело запроса на создание или изменение события
+type EventRequest struct {
+	Title       string    `json:"title"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Description string    `json:"description"`
+	RRule       string    `json:"rrule"` // Правило повторения RFC 5545, например FREQ=WEEKLY;BYDAY=MO
+}
+
+// Bind реализует интерфейс render.Binder
+func (e *EventRequest) Bind(r *http.Request) error {
+	return nil
+}
+
+// List GET /events?day=|week=|month=|quarter=|year= возвращает список событий за день, неделю, месяц, квартал или год,
+// в который попадает переданная дата, а GET /events?start=&end= - за промежуток дней включительно.
+// Список отдается страницами (см. listPage), ссылки на соседние страницы передаются в заголовке Link
+func (rs *eventsResource) List(w http.ResponseWriter, r *http.Request) {
+	var list func(ctx context.Context, day time.Time, page usecases.Page) (*usecases.ListPage, error)
+	var value string
+
+	query := r.URL.Query()
+	if query.Get("start") != "" || query.Get("end") != "" {
+		rs.listRange(w, r)
+		return
+	}
+
+	switch {
+	case query.Get("day") != "":
+		list, value = scopedEvents(r, rs.events).ListDay, query.Get("day")
+	case query.Get("week") != "":
+		list, value = scopedEvents(r, rs.events).ListWeek, query.Get("week")
+	case query.Get("month") != "":
+		list, value = scopedEvents(r, rs.events).ListMonth, query.Get("month")
+	case query.Get("quarter") != "":
+		list, value = scopedEvents(r, rs.events).ListQuarter, query.Get("quarter")
+	case query.Get("year") != "":
+		list, value = scopedEvents(r, rs.events).ListYear, query.Get("year")
+	default:
+		renderError(w, r, ErrInvalidRequest(errors.New("one of day, week, month, quarter, year or start and end parameters is required")))
+		return
+	}
+
+	day, err := time.ParseInLocation(dateLayout, value, requestLocation(r))
+	if err != nil {
+		renderError(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	page, err := listPage(r)
+	if err != nil {
+		renderError(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	ret, err := list(r.Context(), day, page)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	renderPage(w, r, ret)
+}
+
+// listRange GET /events?start=YYYY-MM-DD&end=YYYY-MM-DD возвращает список событий за промежуток дней включительно
+func (rs *eventsResource) listRange(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	start, err := time.ParseInLocation(dateLayout, query.Get("start"), requestLocation(r))
+	if err != nil {
+		renderError(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	end, err := time.ParseInLocation(dateLayout, query.Get("end"), requestLocation(r))
+	if err != nil {
+		renderError(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	page, err := listPage(r)
+	if err != nil {
+		renderError(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	// Конец промежутка включительно, т.е. до начала следующего дня
+	ret, err := scopedEvents(r, rs.events).ListRange(r.Context(), start, end.AddDate(0, 0, 1), page)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	renderPage(w, r, ret)
+}
+
+// listPage читает параметры страницы списка: limit (по умолчанию usecases.DefaultPageSize),
+// sort=asc|desc - порядок по началу событий и cursor из ссылки на соседнюю страницу
+func listPage(r *http.Request) (usecases.Page, error) {
+	query := r.URL.Query()
+	page := usecases.Page{Cursor: query.Get("cursor")}
+
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if page.Limit, err = strconv.Atoi(value); err != nil {
+			return page, err
+		}
+		if page.Limit < 1 {
+			return page, errors.New("limit must be positive")
+		}
+	}
+
+	switch query.Get("sort") {
+	case "", "asc":
+		page.Order = storage.SortAsc
+	case "desc":
+		page.Order = storage.SortDesc
+	default:
+		return page, errors.New("sort must be asc or desc")
+	}
+
+	return page, nil
+}
+
+// renderPage отдает клиенту страницу списка событий, а ссылки на соседние страницы - в заголовке Link (RFC 8288)
+func renderPage(w http.ResponseWriter, r *http.Request, page *usecases.ListPage) {
+	var links []string
+	for _, l := range []struct{ rel, cursor string }{{"next", page.Next}, {"prev", page.Prev}} {
+		if l.cursor == "" {
+			continue
+		}
+
+		u := *r.URL
+		query := u.Query()
+		query.Set("cursor", l.cursor)
+		u.RawQuery = query.Encode()
+
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, u.String(), l.rel))
+	}
+
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	renderList(w, r, page.Items)
+}
+
+// Agenda GET /events/agenda?from=&limit= возвращает ближайшие события, которые заканчиваются после from
+// (RFC 3339 или дата, по умолчанию текущий момент), не более limit (по умолчанию 10)
+func (rs *eventsResource) Agenda(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	from := time.Now()
+	if value := query.Get("from"); value != "" {
+		var err error
+		if from, err = time.Parse(time.RFC3339Nano, value); err != nil {
+			if from, err = time.ParseInLocation(dateLayout, value, requestLocation(r)); err != nil {
+				renderError(w, r, ErrInvalidRequest(errors.New("from must be a date or an RFC 3339 time")))
+				return
+			}
+		}
+	}
+
+	limit := defaultAgendaSize
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil {
+			renderError(w, r, ErrInvalidRequest(err))
+			return
+		}
+	}
+
+	items, err := scopedEvents(r, rs.events).Agenda(r.Context(), from, limit)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	renderList(w, r, items)
+}
+
+// renderList отдает клиенту список событий, пустой список - как [], а не null
+func renderList(w http.ResponseWriter, r *http.Request, items []usecases.ListResponseItem) {
+	if items == nil {
+		items = []usecases.ListResponseItem{}
+	}
+
+	render.JSON(w, r, items)
+}
+
+// Create POST /events создает событие
+func (rs *eventsResource) Create(w http.ResponseWriter, r *http.Request) {
+	data := &EventRequest{}
+	if err := render.Bind(r, data); err != nil {
+		renderError(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	id, err := scopedEvents(r, rs.events).Create(r.Context(), &usecases.CreateEventRequest{
+		Title:       data.Title,
+		Start:       data.Start,
+		End:         data.End,
+		Description: data.Description,
+		RRule:       data.RRule,
+	})
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	logging.LogHTTPEntrySetField(r, "event_id", id)
+	w.Header().Set("Location", path.Join(r.URL.Path, id))
+
+	rs.renderEvent(w, r, id, http.StatusCreated)
+}
+
+// Get GET /events/{id} возвращает событие
+func (rs *eventsResource) Get(w http.ResponseWriter, r *http.Request) {
+	rs.renderEvent(w, r, chi.URLParam(r, "id"), http.StatusOK)
+}
+
+// Update PUT /events/{id} изменяет событие целиком
+func (rs *eventsResource) Update(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, err := entities.NewEventID(id); err != nil {
+		renderError(w, r, ErrNotFound)
+		return
+	}
+
+	version, err := ifMatch(r)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	data := &EventRequest{}
+	if err := render.Bind(r, data); err != nil {
+		renderError(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	err = scopedEvents(r, rs.events).Update(r.Context(), &usecases.UpdateEventRequest{
+		ID:          id,
+		Title:       data.Title,
+		Start:       data.Start,
+		End:         data.End,
+		Description: data.Description,
+		RRule:       data.RRule,
+		Version:     version,
+	})
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	rs.renderEvent(w, r, id, http.StatusOK)
+}
+
+// Patch PATCH /events/{id} изменяет только переданные поля события.
+// Тело - JSON Merge Patch (RFC 7396, application/merge-patch+json): null удаляет поле, например описание
+func (rs *eventsResource) Patch(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, err := entities.NewEventID(id); err != nil {
+		renderError(w, r, ErrNotFound)
+		return
+	}
+
+	version, err := ifMatch(r)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	patch, err := readBody(w, r, maxPatchSize)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	err = scopedEvents(r, rs.events).Patch(r.Context(), &usecases.PatchEventRequest{ID: id, Patch: patch, Version: version})
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	rs.renderEvent(w, r, id, http.StatusOK)
+}
+
+// Delete DELETE /events/{id} удаляет событие
+func (rs *eventsResource) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := entities.NewEventID(chi.URLParam(r, "id"))
+	if err != nil {
+		renderError(w, r, ErrNotFound)
+		return
+	}
+
+	version, err := ifMatch(r)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	if err = scopedEvents(r, rs.events).Delete(r.Context(), id, version); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateOccurrence PUT /events/{id}/occurrences/{start}?mode=this|following|all изменяет повторение серии
+func (rs *eventsResource) UpdateOccurrence(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	originalStart, err := time.Parse(time.RFC3339Nano, chi.URLParam(r, "start"))
+	if err != nil {
+		renderError(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	version, err := ifMatch(r)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	data := &EventRequest{}
+	if err := render.Bind(r, data); err != nil {
+		renderError(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	err = scopedEvents(r, rs.events).UpdateOccurrence(r.Context(), &usecases.UpdateOccurrenceRequest{
+		ID:            id,
+		OriginalStart: originalStart,
+		Mode:          occurrenceMode(r),
+		Title:         data.Title,
+		Start:         data.Start,
+		End:           data.End,
+		Description:   data.Description,
+		Version:       version,
+	})
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	rs.renderEvent(w, r, id, http.StatusOK)
+}
+
+// DeleteOccurrence DELETE /events/{id}/occurrences/{start}?mode=this|following|all удаляет повторение серии
+func (rs *eventsResource) DeleteOccurrence(w http.ResponseWriter, r *http.Request) {
+	originalStart, err := time.Parse(time.RFC3339Nano, chi.URLParam(r, "start"))
+	if err != nil {
+		renderError(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	version, err := ifMatch(r)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	err = scopedEvents(r, rs.events).DeleteOccurrence(r.Context(), &usecases.DeleteOccurrenceRequest{
+		ID:            chi.URLParam(r, "id"),
+		OriginalStart: originalStart,
+		Mode:          occurrenceMode(r),
+		Version:       version,
+	})
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// occurrenceMode возвращает область действия изменения серии из параметра mode, по умолчанию только это повторение
+func occurrenceMode(r *http.Request) usecases.OccurrenceMode {
+	if mode := r.URL.Query().Get("mode"); mode != "" {
+		return usecases.OccurrenceMode(mode)
+	}
+
+	return usecases.ModeThis
+}
+
+// ifMatch возвращает версию события из заголовка If-Match или 0, если заголовка нет или он равен "*".
+// Версия передается клиенту в ETag (см. renderEvent), другие значения ни с одной версией не совпадут
+func ifMatch(r *http.Request) (int64, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return 0, nil
+	}
+
+	version, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+	if err != nil || version < 1 || value != etag(version) {
+		return 0, NewProblem(http.StatusPreconditionFailed, CodeVersionConflict, "If-Match does not match any event version")
+	}
+
+	return version, nil
+}
+
+// readBody читает тело запроса не длиннее limit байт. Более длинное тело - ErrPayloadTooLarge
+func readBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, error) {
+	body := newLimitedBody(w, r, limit)
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, body.problem(err)
+	}
+
+	return data, nil
+}
+
+// limitedBody тело запроса, ограниченное http.MaxBytesReader, со счетчиком прочитанных байт.
+// MaxBytesReader отдает ровно limit байт, а дальше возвращает ошибку и закрывает соединение после ответа
+type limitedBody struct {
+	io.ReadCloser
+	read, limit int64
+	size        int64 // Заявленная длина тела (Content-Length), -1 - неизвестна
+}
+
+// newLimitedBody ограничивает тело запроса r длиной limit байт
+func newLimitedBody(w http.ResponseWriter, r *http.Request, limit int64) *limitedBody {
+	return &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, limit), limit: limit, size: r.ContentLength}
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+
+	return n, err
+}
+
+// problem переводит ошибку разбора тела в ответ: если тело длиннее ограничения - ErrPayloadTooLarge,
+// иначе ErrInvalidRequest. Разбор может остановиться раньше ограничения, поэтому учитывается и заявленная длина
+func (b *limitedBody) problem(err error) *Problem {
+	if b.read == b.limit || b.size > b.limit {
+		return ErrPayloadTooLarge(b.limit)
+	}
+
+	return ErrInvalidRequest(err)
+}
+
+// etag строгий тег сущности для версии события
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// renderEvent отдает клиенту событие с идентификатором id и кодом ответа status
+func (rs *eventsResource) renderEvent(w http.ResponseWriter, r *http.Request, id string, status int) {
+	eventID, err := entities.NewEventID(id)
+	if err != nil {
+		renderError(w, r, ErrNotFound)
+		return
+	}
+
+	item, err := scopedEvents(r, rs.events).Get(r.Context(), eventID)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(item.Version))
+	render.Status(r, status)
+	render.JSON(w, r, item)
+}
@@ -0,0 +1,345 @@
+package restapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"github.com/mzelenkin/go-calendar/internal/storage/inmemory"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestAPI создает API поверх пустого хранилища в памяти
+func newTestAPI(t *testing.T) http.Handler {
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	api, err := New(Config{}, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return api
+}
+
+// doRequest выполняет запрос к API, тело body сериализуется в JSON
+func doRequest(api http.Handler, method, url string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+
+	req := httptest.NewRequest(method, url, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+
+	return rec
+}
+
+// TestEventsResource_CRUD проверяет полный цикл работы с событием через REST API
+func TestEventsResource_CRUD(t *testing.T) {
+	api := newTestAPI(t)
+	start := time.Date(2020, 5, 12, 10, 0, 0, 0, time.Local)
+
+	rec := doRequest(api, http.MethodPost, "/events", EventRequest{
+		Title: "Планерка",
+		Start: start,
+		End:   start.Add(time.Hour),
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var created usecases.ListResponseItem
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == "" || created.Title != "Планерка" {
+		t.Fatalf("create: unexpected body %+v", created)
+	}
+
+	rec = doRequest(api, http.MethodGet, "/events/"+created.ID, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get: unexpected status %d", rec.Code)
+	}
+
+	rec = doRequest(api, http.MethodPut, "/events/"+created.ID, EventRequest{
+		Title: "Ретроспектива",
+		Start: start,
+		End:   start.Add(2 * time.Hour),
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(api, http.MethodGet, "/events?day=2020-05-12", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list: unexpected status %d", rec.Code)
+	}
+
+	var items []usecases.ListResponseItem
+	if err := json.NewDecoder(rec.Body).Decode(&items); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Title != "Ретроспектива" {
+		t.Fatalf("list: unexpected body %+v", items)
+	}
+
+	rec = doRequest(api, http.MethodDelete, "/events/"+created.ID, nil)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: unexpected status %d", rec.Code)
+	}
+
+	rec = doRequest(api, http.MethodGet, "/events/"+created.ID, nil)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("get deleted: unexpected status %d", rec.Code)
+	}
+}
+
+// TestEventsResource_Errors проверяет коды ответов для ошибочных запросов
+func TestEventsResource_Errors(t *testing.T) {
+	api := newTestAPI(t)
+	start := time.Date(2020, 5, 12, 10, 0, 0, 0, time.Local)
+
+	event := EventRequest{Title: "Планерка", Start: start, End: start.Add(time.Hour)}
+	if rec := doRequest(api, http.MethodPost, "/events", event); rec.Code != http.StatusCreated {
+		t.Fatalf("create: unexpected status %d", rec.Code)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   interface{}
+		status int
+	}{
+		{"busy", http.MethodPost, "/events", event, http.StatusConflict},
+		{"invalid", http.MethodPost, "/events", EventRequest{Title: "x"}, http.StatusUnprocessableEntity},
+		{"malformed", http.MethodPost, "/events", "{", http.StatusBadRequest},
+		{"no span", http.MethodGet, "/events", nil, http.StatusBadRequest},
+		{"bad date", http.MethodGet, "/events?week=12.05.2020", nil, http.StatusBadRequest},
+		{"bad id", http.MethodGet, "/events/42", nil, http.StatusNotFound},
+		{"missing", http.MethodDelete, "/events/6ba7b810-9dad-11d1-80b4-00c04fd430c8", nil, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		rec := doRequest(api, tt.method, tt.url, tt.body)
+		if rec.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, rec.Code)
+		}
+	}
+}
+
+// TestEventsResource_IfMatch проверяет, что изменение и удаление по устаревшему ETag отклоняются с 412
+func TestEventsResource_IfMatch(t *testing.T) {
+	api := newTestAPI(t)
+	start := time.Date(2020, 5, 12, 10, 0, 0, 0, time.Local)
+	event := EventRequest{Title: "Планерка", Start: start, End: start.Add(time.Hour)}
+
+	rec := doRequest(api, http.MethodPost, "/events", event)
+	if rec.Code != http.StatusCreated || rec.Header().Get("ETag") != `"1"` {
+		t.Fatalf("create: unexpected status %d, ETag %q", rec.Code, rec.Header().Get("ETag"))
+	}
+	url := rec.Header().Get("Location")
+
+	send := func(method, ifMatch string) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		_ = json.NewEncoder(&buf).Encode(event)
+
+		req := httptest.NewRequest(method, url, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", ifMatch)
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	event.Title = "Ретроспектива"
+	if rec = send(http.MethodPut, `"1"`); rec.Code != http.StatusOK || rec.Header().Get("ETag") != `"2"` {
+		t.Fatalf("update: unexpected status %d, ETag %q", rec.Code, rec.Header().Get("ETag"))
+	}
+
+	for _, tt := range []struct{ method, ifMatch string }{
+		{http.MethodPut, `"1"`},
+		{http.MethodPut, `W/"2"`},
+		{http.MethodPut, "2"},
+		{http.MethodDelete, `"1"`},
+	} {
+		rec = send(tt.method, tt.ifMatch)
+		if rec.Code != http.StatusPreconditionFailed || !bytes.Contains(rec.Body.Bytes(), []byte(CodeVersionConflict)) {
+			t.Errorf("%s If-Match %s: expected 412, got %d: %s", tt.method, tt.ifMatch, rec.Code, rec.Body.String())
+		}
+	}
+
+	if rec = send(http.MethodPut, "*"); rec.Code != http.StatusOK || rec.Header().Get("ETag") != `"3"` {
+		t.Fatalf("update any version: unexpected status %d, ETag %q", rec.Code, rec.Header().Get("ETag"))
+	}
+	if rec = send(http.MethodDelete, `"3"`); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: unexpected status %d", rec.Code)
+	}
+}
+
+// TestEventsResource_Patch проверяет частичное изменение события через JSON Merge Patch
+func TestEventsResource_Patch(t *testing.T) {
+	api := newTestAPI(t)
+	start := time.Date(2020, 5, 12, 10, 0, 0, 0, time.Local)
+
+	rec := doRequest(api, http.MethodPost, "/events", EventRequest{
+		Title:       "Планерка",
+		Start:       start,
+		End:         start.Add(time.Hour),
+		Description: "Еженедельная",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: unexpected status %d", rec.Code)
+	}
+	url := rec.Header().Get("Location")
+
+	rec = doRequest(api, http.MethodPatch, url, map[string]interface{}{"title": "Ретроспектива", "description": nil})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("patch: unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var patched usecases.ListResponseItem
+	if err := json.NewDecoder(rec.Body).Decode(&patched); err != nil {
+		t.Fatal(err)
+	}
+	if patched.Title != "Ретроспектива" || patched.Description != "" || !patched.Start.Equal(start) || patched.Version != 2 {
+		t.Fatalf("patch: unexpected body %+v", patched)
+	}
+
+	tests := []struct {
+		name   string
+		body   interface{}
+		status int
+	}{
+		{"unknown field", map[string]interface{}{"location": "Переговорная"}, http.StatusBadRequest},
+		{"not an object", []string{"title"}, http.StatusBadRequest},
+		{"invalid result", map[string]interface{}{"title": nil}, http.StatusUnprocessableEntity},
+		{"too large", map[string]interface{}{"description": strings.Repeat("x", maxPatchSize)}, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		if rec = doRequest(api, http.MethodPatch, url, tt.body); rec.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.name, tt.status, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+// TestEventsResource_ListPeriods проверяет выборки за квартал, год, промежуток дней и повестку
+func TestEventsResource_ListPeriods(t *testing.T) {
+	api := newTestAPI(t)
+
+	for i, start := range []time.Time{
+		time.Date(2020, 3, 31, 10, 0, 0, 0, time.Local),
+		time.Date(2020, 5, 12, 10, 0, 0, 0, time.Local),
+		time.Date(2020, 12, 31, 10, 0, 0, 0, time.Local),
+	} {
+		event := EventRequest{Title: "Событие " + strconv.Itoa(i+1), Start: start, End: start.Add(time.Hour)}
+		if rec := doRequest(api, http.MethodPost, "/events", event); rec.Code != http.StatusCreated {
+			t.Fatalf("create: unexpected status %d", rec.Code)
+		}
+	}
+
+	tests := []struct {
+		url    string
+		status int
+		count  int
+	}{
+		{"/events?quarter=2020-05-01", http.StatusOK, 1},
+		{"/events?year=2020-05-01", http.StatusOK, 3},
+		{"/events?start=2020-03-31&end=2020-05-12", http.StatusOK, 2},
+		{"/events?start=2020-01-01&end=2021-12-31", http.StatusBadRequest, 0},
+		{"/events?start=2020-05-12&end=2020-03-31", http.StatusBadRequest, 0},
+		{"/events?start=2020-05-12", http.StatusBadRequest, 0},
+		{"/events/agenda?from=2020-04-01&limit=1", http.StatusOK, 1},
+		{"/events/agenda?from=2020-04-01T00:00:00Z", http.StatusOK, 2},
+		{"/events/agenda?from=2021-01-01", http.StatusOK, 0},
+		{"/events/agenda?limit=1000", http.StatusBadRequest, 0},
+		{"/events/agenda?from=tomorrow", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		rec := doRequest(api, http.MethodGet, tt.url, nil)
+		if rec.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.url, tt.status, rec.Code, rec.Body.String())
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+
+		var items []usecases.ListResponseItem
+		if err := json.NewDecoder(rec.Body).Decode(&items); err != nil {
+			t.Fatal(err)
+		}
+		if items == nil || len(items) != tt.count {
+			t.Errorf("%s: expected %d events, got %+v", tt.url, tt.count, items)
+		}
+	}
+}
+
+// TestEventsResource_ListPage проверяет постраничную выдачу списка и ссылки на соседние страницы в заголовке Link
+func TestEventsResource_ListPage(t *testing.T) {
+	api := newTestAPI(t)
+
+	for i := 0; i < 5; i++ {
+		start := time.Date(2020, 5, 11+i, 10, 0, 0, 0, time.Local)
+		event := EventRequest{Title: "Событие " + strconv.Itoa(i+1), Start: start, End: start.Add(time.Hour)}
+		if rec := doRequest(api, http.MethodPost, "/events", event); rec.Code != http.StatusCreated {
+			t.Fatalf("create: unexpected status %d", rec.Code)
+		}
+	}
+
+	next := regexp.MustCompile(`<([^>]+)>; rel="next"`)
+	prev := regexp.MustCompile(`<([^>]+)>; rel="prev"`)
+
+	var titles []string
+	url := "/events?week=2020-05-12&limit=2&sort=desc"
+	for page := 0; url != "" && page < 5; page++ {
+		rec := doRequest(api, http.MethodGet, url, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status %d: %s", url, rec.Code, rec.Body.String())
+		}
+
+		var items []usecases.ListResponseItem
+		if err := json.NewDecoder(rec.Body).Decode(&items); err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range items {
+			titles = append(titles, item.Title)
+		}
+
+		link := rec.Header().Get("Link")
+		if (page == 0) == prev.MatchString(link) {
+			t.Errorf("page %d: unexpected prev link in %q", page, link)
+		}
+
+		url = ""
+		if m := next.FindStringSubmatch(link); m != nil {
+			url = m[1]
+		}
+	}
+
+	expected := []string{"Событие 5", "Событие 4", "Событие 3", "Событие 2", "Событие 1"}
+	if !reflect.DeepEqual(titles, expected) {
+		t.Errorf("expected %v, got %v", expected, titles)
+	}
+
+	for _, url := range []string{
+		"/events?week=2020-05-12&limit=0",
+		"/events?week=2020-05-12&limit=1000",
+		"/events?week=2020-05-12&sort=random",
+		"/events?week=2020-05-12&cursor=bogus",
+	} {
+		if rec := doRequest(api, http.MethodGet, url, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", url, rec.Code)
+		}
+	}
+}
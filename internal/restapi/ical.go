@@ -0,0 +1,108 @@
+package restapi
+
+import (
+	"errors"
+	"github.com/go-chi/render"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"github.com/mzelenkin/go-calendar/internal/ical"
+	"github.com/mzelenkin/go-calendar/internal/logging"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// maxImportSize максимальный размер загружаемого файла iCalendar
+const maxImportSize = 10 << 20
+
+// icalResource выгрузка событий в формате iCalendar для подписки из календарных клиентов
+type icalResource struct {
+	events *usecases.EventUsecases
+}
+
+// newICalResource конструктор ресурса выгрузки
+func newICalResource(events *usecases.EventUsecases) *icalResource {
+	return &icalResource{events: events}
+}
+
+// Calendar GET /calendar.ics выгружает весь календарь
+func (rs *icalResource) Calendar(w http.ResponseWriter, r *http.Request) {
+	rs.export(w, r, time.Time{}, entities.Forever)
+}
+
+// Range GET /events.ics?start=YYYY-MM-DD&end=YYYY-MM-DD выгружает события, попадающие в промежуток дней включительно
+func (rs *icalResource) Range(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("start") == "" || query.Get("end") == "" {
+		renderError(w, r, ErrInvalidRequest(errors.New("start and end parameters are required")))
+		return
+	}
+
+	start, err := time.ParseInLocation(dateLayout, query.Get("start"), requestLocation(r))
+	if err != nil {
+		renderError(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	end, err := time.ParseInLocation(dateLayout, query.Get("end"), requestLocation(r))
+	if err != nil {
+		renderError(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	if end.Before(start) {
+		renderError(w, r, ErrInvalidRequest(errors.New("end must not be before start")))
+		return
+	}
+
+	// Конец промежутка включительно, т.е. до начала следующего дня
+	rs.export(w, r, start, end.AddDate(0, 0, 1))
+}
+
+// export пишет в ответ события из промежутка start..end
+func (rs *icalResource) export(w http.ResponseWriter, r *http.Request, start, end time.Time) {
+	events, err := scopedEvents(r, rs.events).Export(r.Context(), start, end)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", ical.ContentType)
+	if err := ical.NewEncoder(w).Encode(events); err != nil {
+		logging.GetHTTPLogEntry(r).Error("Response writing error: ", err.Error())
+	}
+}
+
+// Import POST /events/import импортирует события из iCalendar.
+// Файл передается телом запроса (text/calendar) либо полем file формы multipart/form-data,
+// тело длиннее maxImportSize отклоняется с ErrPayloadTooLarge
+func (rs *eventsResource) Import(w http.ResponseWriter, r *http.Request) {
+	limited := newLimitedBody(w, r, maxImportSize)
+	r.Body = limited
+
+	var body io.Reader = r.Body
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			renderError(w, r, limited.problem(err))
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	items, err := ical.NewDecoder(body).Decode()
+	if err != nil {
+		renderError(w, r, limited.problem(err))
+		return
+	}
+
+	report, err := scopedEvents(r, rs.events).Import(r.Context(), ical.ImportRequests(items))
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, report)
+}
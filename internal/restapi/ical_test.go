@@ -0,0 +1,103 @@
+package restapi
+
+import (
+	"encoding/json"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"github.com/mzelenkin/go-calendar/internal/ical"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestICalResource проверяет выгрузку всего календаря и промежутка
+func TestICalResource(t *testing.T) {
+	api := newTestAPI(t)
+	start := time.Date(2020, 5, 12, 10, 0, 0, 0, time.Local)
+
+	rec := doRequest(api, http.MethodPost, "/events", EventRequest{Title: "Планерка", Start: start, End: start.Add(time.Hour)})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: unexpected status %d", rec.Code)
+	}
+
+	var created usecases.ListResponseItem
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+
+	rec = doRequest(api, http.MethodGet, "/calendar.ics", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != ical.ContentType {
+		t.Fatalf("calendar: unexpected response %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), "UID:"+created.ID+"\r\n") {
+		t.Errorf("calendar must contain the event:\n%s", rec.Body.String())
+	}
+
+	rec = doRequest(api, http.MethodGet, "/events.ics?start=2020-05-12&end=2020-05-12", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "BEGIN:VEVENT") {
+		t.Errorf("range must contain the event:\n%s", rec.Body.String())
+	}
+
+	rec = doRequest(api, http.MethodGet, "/events.ics?start=2020-05-13&end=2020-05-20", nil)
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "BEGIN:VEVENT") {
+		t.Errorf("range must not contain the event:\n%s", rec.Body.String())
+	}
+
+	if rec = doRequest(api, http.MethodGet, "/events.ics?start=2020-05-13", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("range without end: unexpected status %d", rec.Code)
+	}
+}
+
+// TestEventsResource_Import проверяет импорт календаря телом запроса и отказ на некорректном потоке
+func TestEventsResource_Import(t *testing.T) {
+	api := newTestAPI(t)
+	calendar := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" +
+		"BEGIN:VEVENT\r\nUID:meeting@example.com\r\nDTSTART:20200512T070000Z\r\nDTEND:20200512T080000Z\r\nSUMMARY:Планерка\r\nEND:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	req := httptest.NewRequest(http.MethodPost, "/events/import", strings.NewReader(calendar))
+	req.Header.Set("Content-Type", ical.ContentType)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("import: unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var report usecases.ImportReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != 1 || len(report.Items) != 1 || report.Items[0].UID != "meeting@example.com" {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	if rec = doRequest(api, http.MethodGet, "/events/"+report.Items[0].ID, nil); rec.Code != http.StatusOK {
+		t.Errorf("imported event: unexpected status %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/events/import", strings.NewReader("not a calendar"))
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("not a calendar: unexpected status %d", rec.Code)
+	}
+
+	// Длина тела без Content-Length выясняется при чтении, а с ним - сразу
+	large := "BEGIN:VCALENDAR\r\n" + strings.Repeat("X-FILLER:"+strings.Repeat("a", 1000)+"\r\n", maxImportSize/1000)
+	req = httptest.NewRequest(http.MethodPost, "/events/import", strings.NewReader(large))
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("too large: unexpected status %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/events/import", strings.NewReader("not a calendar"+large))
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("too large with length: unexpected status %d", rec.Code)
+	}
+}
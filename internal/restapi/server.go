@@ -2,6 +2,8 @@ package restapi
 
 import (
 	"context"
+	"github.com/mzelenkin/go-calendar/internal/auth"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
 	"github.com/mzelenkin/go-calendar/internal/logging"
 	"github.com/spf13/viper"
 	"log"
@@ -15,9 +17,20 @@ type Server struct {
 }
 
 // NewServer конструктор REST API сервера
-func NewServer() (*Server, error) {
+func NewServer(storage usecases.Storage) (*Server, error) {
 	log.Println("configuring server...")
-	api, err := New(viper.GetBool("http.enable_cors"))
+	verifier, err := newVerifier()
+	if err != nil {
+		return nil, err
+	}
+
+	api, err := New(Config{
+		EnableCORS:   viper.GetBool("http.enable_cors"),
+		MaxListRange: viper.GetDuration("http.max_list_range"),
+		TenantHeader: viper.GetString("http.tenant_header"),
+		Auth:         verifier,
+		APIKeys:      viper.GetBool("auth.api_keys"),
+	}, storage)
 	if err != nil {
 		return nil, err
 	}
@@ -33,6 +46,25 @@ func NewServer() (*Server, error) {
 	return &Server{&srv}, nil
 }
 
+// newVerifier создает проверку токенов доступа по секции auth настроек, nil - аутентификация выключена
+func newVerifier() (*auth.Verifier, error) {
+	if !viper.GetBool("auth.enabled") {
+		return nil, nil
+	}
+
+	return auth.New(auth.Config{
+		Secret:        viper.GetString("auth.secret"),
+		PublicKeyFile: viper.GetString("auth.public_key_file"),
+		JWKSURL:       viper.GetString("auth.jwks_url"),
+		JWKSRefresh:   viper.GetDuration("auth.jwks_refresh"),
+		Issuer:        viper.GetString("auth.issuer"),
+		Audience:      viper.GetString("auth.audience"),
+		Leeway:        viper.GetDuration("auth.leeway"),
+		SubjectClaim:  viper.GetString("auth.subject_claim"),
+		TenantClaim:   viper.GetString("auth.tenant_claim"),
+	})
+}
+
 // Start запускает сервер, а также корректно отрабатывает завершение его работы
 func (srv *Server) Start() {
 	logger := logging.NewLogger()
@@ -0,0 +1,26 @@
+package restapi
+
+import (
+	"errors"
+	"github.com/mzelenkin/go-calendar/internal/logging"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	"net/http"
+)
+
+// tenantCtx берет арендатора запроса из заголовка header и передает его сценариям в контексте запроса.
+// Заголовок выставляет доверенный прокси перед сервером (например, шлюз, проверивший аутентификацию),
+// поэтому сервер принимает его как есть. Запрос без заголовка или с некорректным арендатором отклоняется
+func tenantCtx(header string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(header)
+			if !tenant.Valid(id) {
+				renderError(w, r, ErrInvalidTenant(errors.New("header "+header+" must contain a valid tenant")))
+				return
+			}
+
+			logging.LogHTTPEntrySetField(r, "tenant", id)
+			next.ServeHTTP(w, r.WithContext(tenant.NewContext(r.Context(), id)))
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package restapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/mzelenkin/go-calendar/internal/storage/inmemory"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// doTenantRequest выполняет запрос к API от имени арендатора, пустой tenant - без заголовка
+func doTenantRequest(api http.Handler, tenant, method, url string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+
+	req := httptest.NewRequest(method, url, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if tenant != "" {
+		req.Header.Set("X-Tenant-ID", tenant)
+	}
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+
+	return rec
+}
+
+// TestTenantHeader проверяет, что арендаторы из заголовка не видят и не меняют данные друг друга
+func TestTenantHeader(t *testing.T) {
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	api, err := New(Config{TenantHeader: "X-Tenant-ID"}, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2020, 5, 12, 10, 0, 0, 0, time.Local)
+	rec := doTenantRequest(api, "alice", http.MethodPost, "/events", EventRequest{Title: "Планерка", Start: start, End: start.Add(time.Hour)})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	location := rec.Header().Get("Location")
+
+	// То же время у другого арендатора свободно
+	rec = doTenantRequest(api, "bob", http.MethodPost, "/events", EventRequest{Title: "Обед", Start: start, End: start.Add(time.Hour)})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create in another tenant: unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doTenantRequest(api, "bob", http.MethodPost, "/calendars", CalendarRequest{Name: "Работа"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create calendar: unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	calendar := rec.Header().Get("Location")
+
+	for _, tt := range []struct {
+		name   string
+		method string
+		url    string
+		body   interface{}
+	}{
+		{"get event", http.MethodGet, location, nil},
+		{"update event", http.MethodPut, location, EventRequest{Title: "Чужое", Start: start, End: start.Add(time.Hour)}},
+		{"delete event", http.MethodDelete, location, nil},
+		{"get calendar", http.MethodGet, calendar, nil},
+		{"calendar events", http.MethodGet, calendar + "/events?day=2020-05-12", nil},
+	} {
+		other := "alice"
+		if tt.url == location {
+			other = "bob"
+		}
+		if rec = doTenantRequest(api, other, tt.method, tt.url, tt.body); rec.Code != http.StatusNotFound {
+			t.Errorf("%s from another tenant: unexpected status %d: %s", tt.name, rec.Code, rec.Body.String())
+		}
+	}
+
+	for tenant, title := range map[string]string{"alice": "Планерка", "bob": "Обед"} {
+		rec = doTenantRequest(api, tenant, http.MethodGet, "/events?day=2020-05-12", nil)
+		var list []struct{ Title string }
+		if err = json.NewDecoder(rec.Body).Decode(&list); err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 1 || list[0].Title != title {
+			t.Errorf("tenant %s: expected only %q, got %+v", tenant, title, list)
+		}
+	}
+
+	for _, tenant := range []string{"", "team a", "team:a"} {
+		rec = doTenantRequest(api, tenant, http.MethodGet, "/events?day=2020-05-12", nil)
+		var p Problem
+		if err = json.NewDecoder(rec.Body).Decode(&p); err != nil || rec.Code != http.StatusBadRequest || p.Code != CodeInvalidTenant {
+			t.Errorf("tenant %q: unexpected status %d: %+v", tenant, rec.Code, p)
+		}
+	}
+
+	if rec = doTenantRequest(api, "", http.MethodGet, "/hello", nil); rec.Code != http.StatusOK {
+		t.Errorf("hello must not require tenant, got status %d", rec.Code)
+	}
+}
+
+// preflight выполняет предзапрос CORS с заголовком headers и возвращает разрешенные заголовки
+func preflight(api http.Handler, headers string) string {
+	req := httptest.NewRequest(http.MethodOptions, "/events", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", headers)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+
+	return rec.Header().Get("Access-Control-Allow-Headers")
+}
+
+// TestTenantHeader_CORS проверяет, что браузеру разрешено передавать заголовок арендатора
+func TestTenantHeader_CORS(t *testing.T) {
+	storage, _ := inmemory.NewEventInMemoryStorage()
+	api, err := New(Config{EnableCORS: true, TenantHeader: "X-Tenant-ID"}, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := preflight(api, "Content-Type, X-Tenant-ID"); got != "Content-Type, X-Tenant-Id" {
+		t.Errorf("unexpected allowed headers %q", got)
+	}
+}
@@ -0,0 +1,127 @@
+package boltdb
+
+import (
+	"context"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/storage/eventjson"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	bolt "go.etcd.io/bbolt"
+	"time"
+)
+
+// CreateAPIKey сохраняет новый ключ API
+func (s *EventBoltStorage) CreateAPIKey(ctx context.Context, key *entities.APIKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	key.Tenant = tenant.FromContext(ctx)
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(apiKeysBucket).Get([]byte(key.ID.String())) != nil ||
+			tx.Bucket(apiKeysByHashBucket).Get([]byte(key.Hash)) != nil {
+			return storage.EntityAlreadyExists
+		}
+
+		if err := tx.Bucket(apiKeysByHashBucket).Put([]byte(key.Hash), []byte(key.ID.String())); err != nil {
+			return err
+		}
+
+		return putAPIKey(tx, key)
+	})
+}
+
+// FindAPIKeyByHash ищет ключ API по хэшу среди ключей всех арендаторов
+func (s *EventBoltStorage) FindAPIKeyByHash(ctx context.Context, hash string) (*entities.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var key *entities.APIKey
+	err := s.db.View(func(tx *bolt.Tx) error {
+		id := tx.Bucket(apiKeysByHashBucket).Get([]byte(hash))
+		if id == nil {
+			return storage.EntityNotFound
+		}
+
+		var err error
+		key, err = findAPIKey(tx, id)
+		return err
+	})
+
+	return key, err
+}
+
+// FindAPIKeys возвращает ключи API арендатора по времени создания
+func (s *EventBoltStorage) FindAPIKeys(ctx context.Context) ([]entities.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var ret []entities.APIKey
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(apiKeysBucket).ForEach(func(_, data []byte) error {
+			key, err := eventjson.UnmarshalAPIKey(data)
+			if err != nil {
+				return err
+			}
+
+			if key.Tenant == tenant.FromContext(ctx) {
+				ret = append(ret, *key)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	storage.SortAPIKeys(ret)
+
+	return ret, nil
+}
+
+// RevokeAPIKey отмечает ключ API отозванным
+func (s *EventBoltStorage) RevokeAPIKey(ctx context.Context, id entities.APIKeyID, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		key, err := findAPIKey(tx, []byte(id.String()))
+		if err != nil {
+			return err
+		}
+		if key.Tenant != tenant.FromContext(ctx) {
+			return storage.EntityNotFound
+		}
+		if key.IsRevoked() {
+			return nil
+		}
+
+		key.Revoked = at
+
+		return putAPIKey(tx, key)
+	})
+}
+
+// findAPIKey читает ключ API по идентификатору
+func findAPIKey(tx *bolt.Tx, id []byte) (*entities.APIKey, error) {
+	data := tx.Bucket(apiKeysBucket).Get(id)
+	if data == nil {
+		return nil, storage.EntityNotFound
+	}
+
+	return eventjson.UnmarshalAPIKey(data)
+}
+
+// putAPIKey записывает ключ API
+func putAPIKey(tx *bolt.Tx, key *entities.APIKey) error {
+	data, err := eventjson.MarshalAPIKey(key)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(apiKeysBucket).Put([]byte(key.ID.String()), data)
+}
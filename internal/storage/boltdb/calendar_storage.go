@@ -0,0 +1,162 @@
+package boltdb
+
+import (
+	"context"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/storage/eventjson"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	bolt "go.etcd.io/bbolt"
+)
+
+// CreateCalendar сохраняет новый календарь
+func (s *EventBoltStorage) CreateCalendar(ctx context.Context, calendar *entities.Calendar) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	calendar.Tenant = tenant.FromContext(ctx)
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(calendarsBucket).Get([]byte(calendar.ID.String())) != nil {
+			return storage.EntityAlreadyExists
+		}
+
+		return putCalendar(tx, calendar)
+	})
+}
+
+func (s *EventBoltStorage) FindCalendarByID(ctx context.Context, id entities.CalendarID) (*entities.Calendar, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var calendar *entities.Calendar
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		calendar, err = findCalendar(tx, []byte(id.String()), tenant.FromContext(ctx))
+		return err
+	})
+
+	return calendar, err
+}
+
+// FindCalendars возвращает календари владельца, пустой owner - всех владельцев арендатора
+func (s *EventBoltStorage) FindCalendars(ctx context.Context, owner string) ([]entities.Calendar, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var ret []entities.Calendar
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(calendarsBucket).ForEach(func(_, data []byte) error {
+			calendar, err := eventjson.UnmarshalCalendar(data)
+			if err != nil {
+				return err
+			}
+
+			if calendar.Tenant == tenant.FromContext(ctx) && (owner == "" || calendar.Owner == owner) {
+				ret = append(ret, *calendar)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	storage.SortCalendars(ret)
+
+	return ret, nil
+}
+
+func (s *EventBoltStorage) UpdateCalendar(ctx context.Context, calendar *entities.Calendar) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	calendar.Tenant = tenant.FromContext(ctx)
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if _, err := findCalendar(tx, []byte(calendar.ID.String()), calendar.Tenant); err != nil {
+			return err
+		}
+
+		return putCalendar(tx, calendar)
+	})
+}
+
+// DeleteCalendar удаляет календарь и его события в одной транзакции.
+// События календаря ищутся полным просмотром: календари удаляются редко, и отдельный индекс того не стоит
+func (s *EventBoltStorage) DeleteCalendar(ctx context.Context, id entities.CalendarID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	owner := tenant.FromContext(ctx)
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		key := []byte(id.String())
+		if _, err := findCalendar(tx, key, owner); err != nil {
+			return err
+		}
+
+		var keys [][]byte
+		var events []*entities.Event
+		err := tx.Bucket(eventsBucket).ForEach(func(k, data []byte) error {
+			event, err := eventjson.Unmarshal(data)
+			if err != nil {
+				return err
+			}
+
+			if event.Tenant == owner && event.CalendarID.Equal(id) {
+				keys = append(keys, append([]byte(nil), k...))
+				events = append(events, event)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Корзину нельзя менять, пока по ней идет ForEach, поэтому события удаляются после обхода
+		for i, k := range keys {
+			if err = tx.Bucket(byStartBucket).Delete(startKey(events[i], k)); err != nil {
+				return err
+			}
+			if err = tx.Bucket(eventsBucket).Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return tx.Bucket(calendarsBucket).Delete(key)
+	})
+}
+
+// findCalendar читает календарь арендатора owner по ключу, календарь другого арендатора считается не найденным
+func findCalendar(tx *bolt.Tx, key []byte, owner string) (*entities.Calendar, error) {
+	data := tx.Bucket(calendarsBucket).Get(key)
+	if data == nil {
+		return nil, storage.EntityNotFound
+	}
+
+	calendar, err := eventjson.UnmarshalCalendar(data)
+	if err != nil {
+		return nil, err
+	}
+	if calendar.Tenant != owner {
+		return nil, storage.EntityNotFound
+	}
+
+	return calendar, nil
+}
+
+// putCalendar записывает календарь
+func putCalendar(tx *bolt.Tx, calendar *entities.Calendar) error {
+	data, err := eventjson.MarshalCalendar(calendar)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(calendarsBucket).Put([]byte(calendar.ID.String()), data)
+}
@@ -0,0 +1,437 @@
+// Пакет реализует хранилище событий во встраиваемой key-value базе bbolt.
+package boltdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/storage/eventjson"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	bolt "go.etcd.io/bbolt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Корзины базы
+var (
+	// eventsBucket события по идентификатору
+	eventsBucket = []byte("events")
+	// byStartBucket вторичный индекс: ключ - начало промежутка события и его идентификатор,
+	// значение - окончание промежутка. Ключи упорядочены по времени начала
+	byStartBucket = []byte("events_by_start")
+	// calendarsBucket календари по идентификатору
+	calendarsBucket = []byte("calendars")
+	// apiKeysBucket ключи API по идентификатору
+	apiKeysBucket = []byte("api_keys")
+	// apiKeysByHashBucket вторичный индекс: ключ - хэш ключа API, значение - его идентификатор
+	apiKeysByHashBucket = []byte("api_keys_by_hash")
+)
+
+// timeKeySize размер закодированного момента времени: секунды (8 байт) и наносекунды (4 байта)
+const timeKeySize = 12
+
+// EventBoltStorage хранилище событий в файле базы bbolt
+type EventBoltStorage struct {
+	db *bolt.DB
+}
+
+// NewEventBoltStorage открывает (или создает) базу в файле path
+func NewEventBoltStorage(path string) (*EventBoltStorage, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	// Файл базы блокируется одним процессом, второй процесс ждет блокировку не дольше секунды
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{eventsBucket, byStartBucket, calendarsBucket, apiKeysBucket, apiKeysByHashBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &EventBoltStorage{db: db}, nil
+}
+
+// Close закрывает базу
+func (s *EventBoltStorage) Close() error {
+	return s.db.Close()
+}
+
+func (s *EventBoltStorage) Create(ctx context.Context, event *entities.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	event.Tenant = tenant.FromContext(ctx)
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return create(tx, event)
+	})
+}
+
+// CreateIfFree создает событие, если оно не пересекается с сохраненными.
+// Пишущие транзакции bbolt выполняются по одной, поэтому проверка и запись атомарны
+func (s *EventBoltStorage) CreateIfFree(ctx context.Context, event *entities.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	event.Tenant = tenant.FromContext(ctx)
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(eventsBucket).Get([]byte(event.ID.String())) != nil {
+			return storage.EntityAlreadyExists
+		}
+
+		if err := checkFree(tx, event); err != nil {
+			return err
+		}
+
+		return create(tx, event)
+	})
+}
+
+func (s *EventBoltStorage) Update(ctx context.Context, event *entities.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	event.Tenant = tenant.FromContext(ctx)
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return update(tx, event)
+	})
+}
+
+// UpdateIfFree изменяет событие, если оно не пересекается с другими сохраненными
+func (s *EventBoltStorage) UpdateIfFree(ctx context.Context, event *entities.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	event.Tenant = tenant.FromContext(ctx)
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		current, err := find(tx, []byte(event.ID.String()), event.Tenant)
+		if err != nil {
+			return err
+		}
+		if !current.CalendarID.Equal(event.CalendarID) {
+			return storage.EntityNotFound
+		}
+		if current.Version != event.Version {
+			return storage.EntityVersionConflict
+		}
+
+		if err = checkFree(tx, event); err != nil {
+			return err
+		}
+
+		return update(tx, event)
+	})
+}
+
+// SplitIfFree изменяет серию head и создает отделенную от нее серию tail, если tail не пересекается с другими событиями.
+// Усеченная head записывается первой, поэтому проверка tail в той же транзакции видит уже ее.
+// Если tail пересекается, транзакция откатывается вместе с изменением head
+func (s *EventBoltStorage) SplitIfFree(ctx context.Context, head, tail *entities.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	head.Tenant = tenant.FromContext(ctx)
+	tail.Tenant = head.Tenant
+	tail.CalendarID = head.CalendarID
+	headVersion, tailVersion := head.Version, tail.Version
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := update(tx, head); err != nil {
+			return err
+		}
+		if err := checkFree(tx, tail); err != nil {
+			return err
+		}
+
+		return create(tx, tail)
+	})
+	if err != nil {
+		// Транзакция откатилась, поэтому версии остаются прежними
+		head.Version, tail.Version = headVersion, tailVersion
+	}
+
+	return err
+}
+
+// FindBySpan возвращает все события календаря, лежащие в указанном временном диапазоне start..end
+func (s *EventBoltStorage) FindBySpan(ctx context.Context, calendar entities.CalendarID, start time.Time, end time.Time) ([]entities.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var ret []entities.Event
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		ret, err = findBySpan(tx, tenant.FromContext(ctx), calendar, start, end)
+		return err
+	})
+
+	return ret, err
+}
+
+// FindPage возвращает страницу событий, пересекающихся с промежутком запроса, в порядке запроса
+func (s *EventBoltStorage) FindPage(ctx context.Context, q storage.SpanQuery) ([]entities.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var ret []entities.Event
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		if q.Order == storage.SortAsc {
+			ret, err = findPage(tx, tenant.FromContext(ctx), q)
+			return err
+		}
+
+		// Индекс упорядочен только по началу, поэтому страница по убыванию окончания вырезается из всей выборки
+		if ret, err = findBySpan(tx, tenant.FromContext(ctx), q.Calendar, q.Start, q.End); err != nil {
+			return err
+		}
+		ret = storage.Page(ret, q)
+		return nil
+	})
+
+	return ret, err
+}
+
+func (s *EventBoltStorage) FindByID(ctx context.Context, id entities.EventID) (*entities.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var event *entities.Event
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		event, err = find(tx, []byte(id.String()), tenant.FromContext(ctx))
+		return err
+	})
+
+	return event, err
+}
+
+func (s *EventBoltStorage) DeleteByID(ctx context.Context, id *entities.EventID, version int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		key := []byte(id.String())
+
+		current, err := find(tx, key, tenant.FromContext(ctx))
+		if err != nil {
+			return err
+		}
+		if version != 0 && current.Version != version {
+			return storage.EntityVersionConflict
+		}
+
+		if err = tx.Bucket(byStartBucket).Delete(startKey(current, key)); err != nil {
+			return err
+		}
+
+		return tx.Bucket(eventsBucket).Delete(key)
+	})
+}
+
+// create сохраняет новое событие и его запись во вторичном индексе
+func create(tx *bolt.Tx, event *entities.Event) error {
+	key := []byte(event.ID.String())
+	if tx.Bucket(eventsBucket).Get(key) != nil {
+		return storage.EntityAlreadyExists
+	}
+
+	// Новое событие без версии сохраняется первой версией
+	if event.Version < 1 {
+		event.Version = 1
+	}
+
+	return put(tx, key, event)
+}
+
+// update заменяет событие той же версии, увеличивая версию и перенося запись во вторичном индексе
+func update(tx *bolt.Tx, event *entities.Event) error {
+	key := []byte(event.ID.String())
+
+	current, err := find(tx, key, event.Tenant)
+	if err != nil {
+		return err
+	}
+	// Событие другого календаря не изменяется и считается не найденным
+	if !current.CalendarID.Equal(event.CalendarID) {
+		return storage.EntityNotFound
+	}
+	if current.Version != event.Version {
+		return storage.EntityVersionConflict
+	}
+
+	if err = tx.Bucket(byStartBucket).Delete(startKey(current, key)); err != nil {
+		return err
+	}
+
+	event.Version++
+
+	return put(tx, key, event)
+}
+
+// put записывает событие в обе корзины
+func put(tx *bolt.Tx, key []byte, event *entities.Event) error {
+	data, err := eventjson.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Bucket(eventsBucket).Put(key, data); err != nil {
+		return err
+	}
+
+	_, end := event.Bounds()
+
+	return tx.Bucket(byStartBucket).Put(startKey(event, key), encodeTime(end))
+}
+
+// get читает событие по ключу
+func get(tx *bolt.Tx, key []byte) (*entities.Event, error) {
+	data := tx.Bucket(eventsBucket).Get(key)
+	if data == nil {
+		return nil, storage.EntityNotFound
+	}
+
+	return eventjson.Unmarshal(data)
+}
+
+// find читает событие арендатора owner по ключу, событие другого арендатора считается не найденным
+func find(tx *bolt.Tx, key []byte, owner string) (*entities.Event, error) {
+	event, err := get(tx, key)
+	if err != nil {
+		return nil, err
+	}
+	if event.Tenant != owner {
+		return nil, storage.EntityNotFound
+	}
+
+	return event, nil
+}
+
+// findBySpan проходит вторичный индекс от самых ранних событий до начала end и выбирает события календаря
+// арендатора owner, которые заканчиваются после start. Касание границами пересечением не считается.
+// Индекс общий для всех календарей и арендаторов, чужие события отбрасываются после чтения
+func findBySpan(tx *bolt.Tx, owner string, calendar entities.CalendarID, start time.Time, end time.Time) ([]entities.Event, error) {
+	var ret []entities.Event
+
+	startBound := encodeTime(start)
+	endBound := encodeTime(end)
+
+	c := tx.Bucket(byStartBucket).Cursor()
+	for k, v := c.First(); k != nil && bytes.Compare(k[:timeKeySize], endBound) < 0; k, v = c.Next() {
+		if bytes.Compare(v, startBound) <= 0 {
+			continue
+		}
+
+		event, err := get(tx, k[timeKeySize:])
+		if err != nil {
+			return nil, err
+		}
+		if event.Tenant != owner || !event.CalendarID.Equal(calendar) {
+			continue
+		}
+
+		ret = append(ret, *event)
+	}
+
+	return ret, nil
+}
+
+// findPage проходит вторичный индекс с позиции q.After и выбирает не больше q.Limit событий арендатора owner,
+// пересекающихся с промежутком запроса. Ключи индекса упорядочены так же, как выборка SortAsc
+func findPage(tx *bolt.Tx, owner string, q storage.SpanQuery) ([]entities.Event, error) {
+	var ret []entities.Event
+
+	startBound := encodeTime(q.Start)
+	endBound := encodeTime(q.End)
+
+	c := tx.Bucket(byStartBucket).Cursor()
+	k, v := c.First()
+	if q.After != nil {
+		after := append(encodeTime(q.After.Bound), q.After.ID...)
+		if k, v = c.Seek(after); k != nil && bytes.Equal(k, after) {
+			k, v = c.Next()
+		}
+	}
+
+	for ; k != nil && bytes.Compare(k[:timeKeySize], endBound) < 0; k, v = c.Next() {
+		if bytes.Compare(v, startBound) <= 0 {
+			continue
+		}
+
+		event, err := get(tx, k[timeKeySize:])
+		if err != nil {
+			return nil, err
+		}
+		if event.Tenant != owner || !event.CalendarID.Equal(q.Calendar) {
+			continue
+		}
+
+		ret = append(ret, *event)
+		if q.Limit > 0 && len(ret) == q.Limit {
+			break
+		}
+	}
+
+	return ret, nil
+}
+
+// checkFree возвращает EntitySpanBusy, если событие пересекается с другими сохраненными
+func checkFree(tx *bolt.Tx, event *entities.Event) error {
+	start, end := event.Bounds()
+
+	candidates, err := findBySpan(tx, event.Tenant, event.CalendarID, start, end)
+	if err != nil {
+		return err
+	}
+
+	if storage.HasConflict(event, candidates) {
+		return storage.EntitySpanBusy
+	}
+
+	return nil
+}
+
+// startKey ключ события во вторичном индексе: начало промежутка события и идентификатор
+func startKey(event *entities.Event, id []byte) []byte {
+	start, _ := event.Bounds()
+
+	return append(encodeTime(start), id...)
+}
+
+// encodeTime кодирует момент времени так, что порядок байтов совпадает с хронологическим
+// Знаковый бит секунд инвертируется, чтобы моменты до 1970 года шли раньше последующих
+func encodeTime(t time.Time) []byte {
+	buf := make([]byte, timeKeySize)
+	binary.BigEndian.PutUint64(buf[0:8], uint64(t.Unix())^(1<<63))
+	binary.BigEndian.PutUint32(buf[8:12], uint32(t.Nanosecond()))
+
+	return buf
+}
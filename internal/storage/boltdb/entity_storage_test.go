@@ -0,0 +1,135 @@
+package boltdb
+
+import (
+	"bytes"
+	"context"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"github.com/mzelenkin/go-calendar/internal/storage/storagetest"
+	bolt "go.etcd.io/bbolt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestStorage создает хранилище во временном каталоге теста
+func newTestStorage(t *testing.T) *EventBoltStorage {
+	s, err := NewEventBoltStorage(filepath.Join(t.TempDir(), "calendar.bolt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+// newEvent возвращает одиночное событие, начинающееся в start
+func newEvent(start time.Time) entities.Event {
+	id, _ := entities.NewEventID("")
+
+	return entities.Event{ID: id, Title: "Событие", Start: start, End: start.Add(time.Hour)}
+}
+
+// TestEventBoltStorage_Conformance проверяет хранилище общим набором тестов
+func TestEventBoltStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) usecases.Storage {
+		return newTestStorage(t)
+	})
+}
+
+// TestEventBoltStorage_Reopen проверяет, что события переживают повторное открытие базы
+func TestEventBoltStorage_Reopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "calendar.bolt")
+	start := time.Date(2020, 1, 6, 10, 0, 0, 0, time.UTC)
+	event := newEvent(start)
+
+	s, err := NewEventBoltStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Create(ctx, &event); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s, err = NewEventBoltStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, err = s.FindByID(ctx, event.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := s.FindBySpan(ctx, entities.DefaultCalendarID, start, start.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || !found[0].ID.Equal(event.ID) {
+		t.Errorf("FindBySpan after reopen: got %d events, want the created one", len(found))
+	}
+}
+
+// TestEventBoltStorage_Index проверяет, что изменение и удаление не оставляют во вторичном индексе лишних ключей
+func TestEventBoltStorage_Index(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	start := time.Date(2020, 1, 6, 10, 0, 0, 0, time.UTC)
+
+	first, second := newEvent(start), newEvent(start.Add(2*time.Hour))
+	for _, e := range []*entities.Event{&first, &second} {
+		if err := s.Create(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first.Start, first.End = start.AddDate(0, 0, 1), start.AddDate(0, 0, 1).Add(time.Hour)
+	if err := s.Update(ctx, &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteByID(ctx, &second.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var keys [][]byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(byStartBucket).ForEach(func(k, v []byte) error {
+			keys = append(keys, append([]byte(nil), k...))
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := startKey(&first, []byte(first.ID.String()))
+	if len(keys) != 1 || !bytes.Equal(keys[0], want) {
+		t.Errorf("index keys: got %q, want [%q]", keys, want)
+	}
+}
+
+// TestEncodeTime проверяет, что порядок закодированных моментов совпадает с хронологическим
+func TestEncodeTime(t *testing.T) {
+	times := []time.Time{
+		time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(1969, 12, 31, 23, 59, 59, 999999999, time.UTC),
+		time.Unix(0, 0),
+		time.Unix(0, 1),
+		time.Date(2020, 1, 6, 10, 0, 0, 0, time.UTC),
+		entities.Forever,
+	}
+
+	for i := 1; i < len(times); i++ {
+		if bytes.Compare(encodeTime(times[i-1]), encodeTime(times[i])) >= 0 {
+			t.Errorf("encodeTime(%s) >= encodeTime(%s)", times[i-1], times[i])
+		}
+	}
+
+	// Представление не зависит от зоны
+	moscow := time.FixedZone("MSK", 3*60*60)
+	if !bytes.Equal(encodeTime(times[4]), encodeTime(times[4].In(moscow))) {
+		t.Error("encodeTime depends on location")
+	}
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+)
+
+// HasConflict проверяет, пересекается ли событие event с каким-либо из событий candidates.
+// Событие с тем же идентификатором (прежняя версия самого event) не учитывается.
+// Используется хранилищами для атомарной проверки при сохранении: candidates - это события,
+// найденные по промежутку event.Bounds() под той же блокировкой или в той же транзакции, что и запись
+func HasConflict(event *entities.Event, candidates []entities.Event) bool {
+	for i := range candidates {
+		if candidates[i].ID.Equal(event.ID) {
+			continue
+		}
+
+		if event.Conflicts(candidates[i]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasSplitConflict проверяет, пересекается ли новая серия tail, отделенная от серии head (см. SplitIfFree хранилищ),
+// с событиями candidates или с самой усеченной серией head. Сохраненная версия head среди candidates
+// не учитывается: ее заменяет усеченная
+func HasSplitConflict(head, tail *entities.Event, candidates []entities.Event) bool {
+	if tail.Conflicts(*head) {
+		return true
+	}
+
+	for i := range candidates {
+		if candidates[i].ID.Equal(head.ID) || candidates[i].ID.Equal(tail.ID) {
+			continue
+		}
+
+		if tail.Conflicts(candidates[i]) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -7,6 +7,16 @@ package storage
 const EntityNotFound = StorageError("entity not found")
 const EntityAlreadyExists = StorageError("entity already exists")
 
+// EntitySpanBusy - время сущности пересекается с уже сохраненными (см. CreateIfFree и UpdateIfFree хранилищ)
+const EntitySpanBusy = StorageError("entity span is busy")
+
+// EntitySpanLocked - пересечения не удалось проверить: записи в тот же календарь не давали сделать это слишком долго.
+// Ничего не сохранено, запрос можно повторить
+const EntitySpanLocked = StorageError("entity span is locked by concurrent writes, try again later")
+
+// EntityVersionConflict - версия изменяемой сущности не совпадает с сохраненной, т.е. ее уже кто-то изменил
+const EntityVersionConflict = StorageError("entity version conflict")
+
 // StorageError тип для ошибок репозитория
 type StorageError string
 
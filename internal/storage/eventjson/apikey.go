@@ -0,0 +1,76 @@
+package eventjson
+
+import (
+	"encoding/json"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"time"
+)
+
+// APIKey ключ API в виде документа JSON
+type APIKey struct {
+	ID      string     `json:"id"`
+	Name    string     `json:"name,omitempty"`
+	Prefix  string     `json:"prefix"`
+	Hash    string     `json:"hash"`
+	Scopes  []string   `json:"scopes"`
+	Tenant  string     `json:"tenant,omitempty"`
+	Created time.Time  `json:"created"`
+	Revoked *time.Time `json:"revoked,omitempty"`
+}
+
+// FromAPIKey переводит ключ API в документ
+func FromAPIKey(key *entities.APIKey) APIKey {
+	doc := APIKey{
+		ID:      key.ID.String(),
+		Name:    key.Name,
+		Prefix:  key.Prefix,
+		Hash:    key.Hash,
+		Scopes:  key.Scopes,
+		Tenant:  key.Tenant,
+		Created: key.Created,
+	}
+	if key.IsRevoked() {
+		revoked := key.Revoked
+		doc.Revoked = &revoked
+	}
+
+	return doc
+}
+
+// Entity восстанавливает ключ API из документа
+func (doc APIKey) Entity() (*entities.APIKey, error) {
+	id, err := entities.NewAPIKeyID(doc.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &entities.APIKey{
+		ID:      id,
+		Name:    doc.Name,
+		Prefix:  doc.Prefix,
+		Hash:    doc.Hash,
+		Scopes:  doc.Scopes,
+		Tenant:  doc.Tenant,
+		Created: doc.Created,
+	}
+	if doc.Revoked != nil {
+		key.Revoked = *doc.Revoked
+	}
+
+	return key, nil
+}
+
+// MarshalAPIKey сериализует ключ API в JSON
+func MarshalAPIKey(key *entities.APIKey) ([]byte, error) {
+	return json.Marshal(FromAPIKey(key))
+}
+
+// UnmarshalAPIKey восстанавливает ключ API из JSON
+func UnmarshalAPIKey(data []byte) (*entities.APIKey, error) {
+	var doc APIKey
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	return doc.Entity()
+}
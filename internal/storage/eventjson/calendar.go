@@ -0,0 +1,60 @@
+package eventjson
+
+import (
+	"encoding/json"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+)
+
+// Calendar календарь в виде документа JSON
+type Calendar struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Color    string `json:"color,omitempty"`
+	Owner    string `json:"owner,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+	Tenant   string `json:"tenant,omitempty"`
+}
+
+// FromCalendar переводит календарь в документ
+func FromCalendar(calendar *entities.Calendar) Calendar {
+	return Calendar{
+		ID:       calendar.ID.String(),
+		Name:     calendar.Name,
+		Color:    calendar.Color,
+		Owner:    calendar.Owner,
+		Timezone: calendar.Timezone,
+		Tenant:   calendar.Tenant,
+	}
+}
+
+// Entity восстанавливает календарь из документа
+func (doc Calendar) Entity() (*entities.Calendar, error) {
+	id, err := entities.NewCalendarID(doc.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entities.Calendar{
+		ID:       id,
+		Name:     doc.Name,
+		Color:    doc.Color,
+		Owner:    doc.Owner,
+		Timezone: doc.Timezone,
+		Tenant:   doc.Tenant,
+	}, nil
+}
+
+// MarshalCalendar сериализует календарь в JSON
+func MarshalCalendar(calendar *entities.Calendar) ([]byte, error) {
+	return json.Marshal(FromCalendar(calendar))
+}
+
+// UnmarshalCalendar восстанавливает календарь из JSON
+func UnmarshalCalendar(data []byte) (*entities.Calendar, error) {
+	var doc Calendar
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	return doc.Entity()
+}
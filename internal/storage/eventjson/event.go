@@ -0,0 +1,137 @@
+// Пакет описывает представление события в JSON для хранилищ, сохраняющих события документами
+// (журнал хранилища в памяти, key-value базы, резервные копии).
+package eventjson
+
+import (
+	"encoding/json"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"time"
+)
+
+// Event событие в виде документа JSON
+// Время сериализуется со смещением, но без названия зоны, поэтому зона хранится отдельно в Timezone:
+// от нее зависит развертывание повторений (дни недели, переход на летнее время)
+type Event struct {
+	ID          string      `json:"id"`
+	CalendarID  string      `json:"calendar_id,omitempty"` // Пустой - календарь по умолчанию
+	Tenant      string      `json:"tenant,omitempty"`      // Пустой - арендатор по умолчанию
+	Title       string      `json:"title"`
+	Start       time.Time   `json:"start"`
+	End         time.Time   `json:"end"`
+	Timezone    string      `json:"timezone"`
+	Description string      `json:"description,omitempty"`
+	RRule       string      `json:"rrule,omitempty"`
+	ExDates     []time.Time `json:"ex_dates,omitempty"`
+	Overrides   []Override  `json:"overrides,omitempty"`
+	Version     int64       `json:"version,omitempty"`
+}
+
+// Override измененное повторение серии
+type Override struct {
+	OriginalStart time.Time `json:"original_start"`
+	Title         string    `json:"title"`
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+	Description   string    `json:"description,omitempty"`
+}
+
+// FromEntity переводит событие в документ
+func FromEntity(event *entities.Event) Event {
+	doc := Event{
+		ID:          event.ID.String(),
+		Tenant:      event.Tenant,
+		Title:       event.Title,
+		Start:       event.Start,
+		End:         event.End,
+		Timezone:    event.Start.Location().String(),
+		Description: event.Description,
+		ExDates:     event.ExDates,
+		Version:     event.Version,
+	}
+
+	if !event.CalendarID.IsDefault() {
+		doc.CalendarID = event.CalendarID.String()
+	}
+
+	if event.Recurrence != nil {
+		doc.RRule = event.Recurrence.String()
+	}
+
+	for _, o := range event.Overrides {
+		doc.Overrides = append(doc.Overrides, Override(o))
+	}
+
+	return doc
+}
+
+// Entity восстанавливает событие из документа, переводя время в зону события
+func (doc Event) Entity() (*entities.Event, error) {
+	id, err := entities.NewEventID(doc.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := time.LoadLocation(doc.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &entities.Event{
+		ID:          id,
+		Tenant:      doc.Tenant,
+		Title:       doc.Title,
+		Start:       doc.Start.In(loc),
+		End:         doc.End.In(loc),
+		Description: doc.Description,
+		Version:     doc.Version,
+	}
+
+	// Документы, сохраненные до появления версий
+	if event.Version == 0 {
+		event.Version = 1
+	}
+
+	// и до появления календарей
+	if doc.CalendarID != "" {
+		if event.CalendarID, err = entities.NewCalendarID(doc.CalendarID); err != nil {
+			return nil, err
+		}
+	}
+
+	if doc.RRule != "" {
+		if event.Recurrence, err = entities.ParseRecurrence(doc.RRule); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, t := range doc.ExDates {
+		event.ExDates = append(event.ExDates, t.In(loc))
+	}
+
+	for _, o := range doc.Overrides {
+		event.Overrides = append(event.Overrides, entities.Override{
+			OriginalStart: o.OriginalStart.In(loc),
+			Title:         o.Title,
+			Start:         o.Start.In(loc),
+			End:           o.End.In(loc),
+			Description:   o.Description,
+		})
+	}
+
+	return event, nil
+}
+
+// Marshal сериализует событие в JSON
+func Marshal(event *entities.Event) ([]byte, error) {
+	return json.Marshal(FromEntity(event))
+}
+
+// Unmarshal восстанавливает событие из JSON
+func Unmarshal(data []byte) (*entities.Event, error) {
+	var doc Event
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	return doc.Entity()
+}
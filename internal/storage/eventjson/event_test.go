@@ -0,0 +1,77 @@
+package eventjson
+
+import (
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestMarshal проверяет, что событие восстанавливается без потерь, включая зону и исключения серии
+func TestMarshal(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skip("timezone database is not available")
+	}
+
+	id, _ := entities.NewEventID("")
+	calendarID, _ := entities.NewCalendarID("")
+	rule, _ := entities.ParseRecurrence("FREQ=WEEKLY;BYDAY=MO;COUNT=4")
+	start := time.Date(2020, 1, 6, 10, 0, 0, 0, loc)
+
+	event := entities.Event{
+		ID:          id,
+		CalendarID:  calendarID,
+		Tenant:      "team-a",
+		Title:       "Стендап",
+		Start:       start,
+		End:         start.Add(15 * time.Minute),
+		Description: "Еженедельный стендап",
+		Recurrence:  rule,
+		ExDates:     []time.Time{start.AddDate(0, 0, 7)},
+		Overrides: []entities.Override{{
+			OriginalStart: start.AddDate(0, 0, 14),
+			Title:         "Перенесенный стендап",
+			Start:         start.AddDate(0, 0, 15),
+			End:           start.AddDate(0, 0, 15).Add(15 * time.Minute),
+		}},
+		Version: 3,
+	}
+
+	data, err := Marshal(&event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(FromEntity(restored), FromEntity(&event)) {
+		t.Errorf("events differ:\n%+v\n%+v", restored, event)
+	}
+	if restored.Start.Location().String() != "Europe/Moscow" {
+		t.Errorf("unexpected location %s", restored.Start.Location())
+	}
+	if !reflect.DeepEqual(restored.Occurrences(event.Bounds()), event.Occurrences(event.Bounds())) {
+		t.Error("occurrences differ")
+	}
+}
+
+// TestUnmarshal_Invalid проверяет отказ на некорректных документах
+func TestUnmarshal_Invalid(t *testing.T) {
+	documents := []string{
+		`{"id": "not-a-uuid", "timezone": "UTC"}`,
+		`{"id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "timezone": "Mars/Olympus"}`,
+		`{"id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "timezone": "UTC", "rrule": "FREQ=HOURLY"}`,
+		`{"id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "timezone": "UTC", "calendar_id": "work"}`,
+		`{`,
+	}
+
+	for _, doc := range documents {
+		if _, err := Unmarshal([]byte(doc)); err == nil {
+			t.Errorf("%s: expected error", doc)
+		}
+	}
+}
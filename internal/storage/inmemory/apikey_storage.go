@@ -0,0 +1,111 @@
+package inmemory
+
+import (
+	"context"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	"time"
+)
+
+// CreateAPIKey сохраняет новый ключ API
+func (i *EventInMemoryStorage) CreateAPIKey(ctx context.Context, key *entities.APIKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if _, ok := i.apiKeys[key.Hash]; ok || i.findAPIKey(key.ID) != nil {
+		return storage.EntityAlreadyExists
+	}
+
+	key.Tenant = tenant.FromContext(ctx)
+
+	return i.putAPIKey(key)
+}
+
+// FindAPIKeyByHash ищет ключ API по хэшу среди ключей всех арендаторов
+func (i *EventInMemoryStorage) FindAPIKeyByHash(ctx context.Context, hash string) (*entities.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	key, ok := i.apiKeys[hash]
+	if !ok {
+		return nil, storage.EntityNotFound
+	}
+
+	return &key, nil
+}
+
+// FindAPIKeys возвращает ключи API арендатора по времени создания
+func (i *EventInMemoryStorage) FindAPIKeys(ctx context.Context) ([]entities.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	var ret []entities.APIKey
+	for _, k := range i.apiKeys {
+		if k.Tenant == tenant.FromContext(ctx) {
+			ret = append(ret, k)
+		}
+	}
+
+	storage.SortAPIKeys(ret)
+
+	return ret, nil
+}
+
+// RevokeAPIKey отмечает ключ API отозванным
+func (i *EventInMemoryStorage) RevokeAPIKey(ctx context.Context, id entities.APIKeyID, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	key := i.findAPIKey(id)
+	if key == nil || key.Tenant != tenant.FromContext(ctx) {
+		return storage.EntityNotFound
+	}
+	if key.IsRevoked() {
+		return nil
+	}
+
+	key.Revoked = at
+
+	return i.putAPIKey(key)
+}
+
+// findAPIKey ищет ключ API по идентификатору, вызывается под блокировкой.
+// Ключи лежат по хэшу, а по идентификатору их ищут только при отзыве, поэтому полный просмотр допустим
+func (i *EventInMemoryStorage) findAPIKey(id entities.APIKeyID) *entities.APIKey {
+	for _, k := range i.apiKeys {
+		if k.ID.Equal(id) {
+			return &k
+		}
+	}
+
+	return nil
+}
+
+// putAPIKey сохраняет ключ API (сначала в журнал, если он есть), вызывается под блокировкой
+func (i *EventInMemoryStorage) putAPIKey(key *entities.APIKey) error {
+	if err := i.logAPIKey(key); err != nil {
+		return err
+	}
+
+	i.apiKeys[key.Hash] = *key
+	i.maybeSnapshot()
+
+	return nil
+}
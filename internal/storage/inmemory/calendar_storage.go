@@ -0,0 +1,132 @@
+package inmemory
+
+import (
+	"context"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+)
+
+// CreateCalendar сохраняет новый календарь
+func (i *EventInMemoryStorage) CreateCalendar(ctx context.Context, calendar *entities.Calendar) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	id := calendar.ID.String()
+	if _, ok := i.calendars[id]; ok {
+		return storage.EntityAlreadyExists
+	}
+
+	calendar.Tenant = tenant.FromContext(ctx)
+
+	return i.putCalendar(calendar)
+}
+
+func (i *EventInMemoryStorage) FindCalendarByID(ctx context.Context, id entities.CalendarID) (*entities.Calendar, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	calendar, ok := i.calendars[id.String()]
+	if !ok || calendar.Tenant != tenant.FromContext(ctx) {
+		return nil, storage.EntityNotFound
+	}
+
+	return &calendar, nil
+}
+
+// FindCalendars возвращает календари владельца, пустой owner - всех владельцев арендатора
+func (i *EventInMemoryStorage) FindCalendars(ctx context.Context, owner string) ([]entities.Calendar, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	var ret []entities.Calendar
+	for _, c := range i.calendars {
+		if c.Tenant == tenant.FromContext(ctx) && (owner == "" || c.Owner == owner) {
+			ret = append(ret, c)
+		}
+	}
+
+	storage.SortCalendars(ret)
+
+	return ret, nil
+}
+
+func (i *EventInMemoryStorage) UpdateCalendar(ctx context.Context, calendar *entities.Calendar) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	calendar.Tenant = tenant.FromContext(ctx)
+	if stored, ok := i.calendars[calendar.ID.String()]; !ok || stored.Tenant != calendar.Tenant {
+		return storage.EntityNotFound
+	}
+
+	return i.putCalendar(calendar)
+}
+
+// DeleteCalendar удаляет календарь вместе с событиями одной записью журнала
+func (i *EventInMemoryStorage) DeleteCalendar(ctx context.Context, id entities.CalendarID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if stored, ok := i.calendars[id.String()]; !ok || stored.Tenant != tenant.FromContext(ctx) {
+		return storage.EntityNotFound
+	}
+
+	if err := i.logCalendarDelete(id.String()); err != nil {
+		return err
+	}
+
+	i.deleteCalendar(id.String())
+	i.maybeSnapshot()
+
+	return nil
+}
+
+// putCalendar сохраняет календарь (сначала в журнал, если он есть), вызывается под блокировкой
+func (i *EventInMemoryStorage) putCalendar(calendar *entities.Calendar) error {
+	if err := i.logCalendar(calendar); err != nil {
+		return err
+	}
+
+	i.calendars[calendar.ID.String()] = *calendar
+	i.maybeSnapshot()
+
+	return nil
+}
+
+// deleteCalendar удаляет календарь и его события вместе с индексом календаря, вызывается под блокировкой
+func (i *EventInMemoryStorage) deleteCalendar(id string) {
+	calendar, ok := i.calendars[id]
+	if !ok {
+		return
+	}
+	delete(i.calendars, id)
+
+	key := spanKey{tenant: calendar.Tenant, calendar: id}
+	if index, ok := i.indexes[key]; ok {
+		index.each(func(eventID string) {
+			delete(i.data, eventID)
+		})
+		delete(i.indexes, key)
+	}
+}
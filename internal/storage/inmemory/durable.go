@@ -0,0 +1,382 @@
+package inmemory
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/storage/eventjson"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Файлы хранилища в каталоге Persistence.Dir
+const (
+	walFile      = "events.wal"
+	snapshotFile = "events.snapshot"
+)
+
+// SyncPolicy определяет, когда журнал сбрасывается на диск (fsync)
+type SyncPolicy string
+
+const (
+	// SyncAlways после каждой записи: подтвержденное изменение не теряется даже при сбое ОС
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval раз в Persistence.SyncInterval: при сбое ОС теряются изменения за последний интервал
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever на усмотрение ОС: изменения переживают падение процесса, но не сбой ОС
+	SyncNever SyncPolicy = "never"
+)
+
+// Persistence настройки сохранения хранилища на диск
+type Persistence struct {
+	Dir          string        // Каталог журнала и снимка
+	Sync         SyncPolicy    // Политика сброса журнала на диск
+	SyncInterval time.Duration // Период сброса для SyncInterval
+	// SnapshotEvery число записей в журнале, после которого хранилище сохраняет снимок и очищает журнал.
+	// 0 - снимок сохраняется только при закрытии
+	SnapshotEvery int
+}
+
+// NewDurableEventInMemoryStorage создает хранилище в памяти, которое сохраняет изменения в журнал
+// и периодически сжимает его в снимок. При создании данные восстанавливаются из снимка и журнала.
+// Хранилище нужно закрывать методом Close
+func NewDurableEventInMemoryStorage(p Persistence) (*EventInMemoryStorage, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(p.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s, _ := NewEventInMemoryStorage()
+	s.snapshotEvery = p.SnapshotEvery
+	s.dir = p.Dir
+
+	if err := s.loadSnapshot(); err != nil {
+		return nil, err
+	}
+
+	records, err := s.replayWAL()
+	if err != nil {
+		return nil, err
+	}
+
+	s.wal, err = openWAL(filepath.Join(p.Dir, walFile), p.Sync, p.SyncInterval, records)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Validate проверяет настройки
+func (p Persistence) Validate() error {
+	if p.Dir == "" {
+		return errors.New("inmemory: dir is required")
+	}
+
+	switch p.Sync {
+	case SyncAlways, SyncNever:
+	case SyncInterval:
+		if p.SyncInterval <= 0 {
+			return fmt.Errorf("inmemory: sync interval must be positive, got %s", p.SyncInterval)
+		}
+	default:
+		return fmt.Errorf("inmemory: unknown sync policy %q", p.Sync)
+	}
+
+	return nil
+}
+
+// Close сохраняет снимок и закрывает журнал. Для хранилища без журнала ничего не делает
+func (i *EventInMemoryStorage) Close() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.wal == nil {
+		return nil
+	}
+
+	err := i.snapshot()
+	if closeErr := i.wal.close(); err == nil {
+		err = closeErr
+	}
+	i.wal = nil
+
+	return err
+}
+
+// logEvent записывает в журнал создание или изменение события, вызывается под блокировкой
+func (i *EventInMemoryStorage) logEvent(op logOp, event *entities.Event) error {
+	if i.wal == nil {
+		return nil
+	}
+
+	doc := eventjson.FromEntity(event)
+
+	return i.wal.append(logRecord{Op: op, Event: &doc})
+}
+
+// logSplit записывает в журнал изменение серии head вместе с созданием отделенной от нее серии tail,
+// вызывается под блокировкой
+func (i *EventInMemoryStorage) logSplit(head, tail *entities.Event) error {
+	if i.wal == nil {
+		return nil
+	}
+
+	headDoc, tailDoc := eventjson.FromEntity(head), eventjson.FromEntity(tail)
+
+	return i.wal.append(logRecord{Op: opSplit, Event: &headDoc, Tail: &tailDoc})
+}
+
+// logDelete записывает в журнал удаление события, вызывается под блокировкой
+func (i *EventInMemoryStorage) logDelete(id string) error {
+	if i.wal == nil {
+		return nil
+	}
+
+	return i.wal.append(logRecord{Op: opDelete, ID: id})
+}
+
+// logCalendar записывает в журнал сохранение календаря, вызывается под блокировкой
+func (i *EventInMemoryStorage) logCalendar(calendar *entities.Calendar) error {
+	if i.wal == nil {
+		return nil
+	}
+
+	doc := eventjson.FromCalendar(calendar)
+
+	return i.wal.append(logRecord{Op: opCalendar, Calendar: &doc})
+}
+
+// logCalendarDelete записывает в журнал удаление календаря с событиями, вызывается под блокировкой
+func (i *EventInMemoryStorage) logCalendarDelete(id string) error {
+	if i.wal == nil {
+		return nil
+	}
+
+	return i.wal.append(logRecord{Op: opCalendarDelete, ID: id})
+}
+
+// logAPIKey записывает в журнал сохранение ключа API, вызывается под блокировкой
+func (i *EventInMemoryStorage) logAPIKey(key *entities.APIKey) error {
+	if i.wal == nil {
+		return nil
+	}
+
+	doc := eventjson.FromAPIKey(key)
+
+	return i.wal.append(logRecord{Op: opAPIKey, APIKey: &doc})
+}
+
+// maybeSnapshot сохраняет снимок, если журнал разросся. Вызывается под блокировкой после изменения данных.
+// Ошибка снимка не отменяет изменение, уже записанное в журнал: снимок будет повторен при следующем изменении,
+// а ошибка последней попытки вернется из Close
+func (i *EventInMemoryStorage) maybeSnapshot() {
+	if i.wal == nil || i.snapshotEvery <= 0 || i.wal.records < i.snapshotEvery {
+		return
+	}
+
+	_ = i.snapshot()
+}
+
+// snapshot сохраняет все календари, события и ключи API в снимок и очищает журнал, вызывается под блокировкой.
+// Снимок пишется во временный файл и атомарно подменяет прежний, поэтому при сбое остается либо прежний снимок
+// с полным журналом, либо новый снимок с журналом, повторное применение которого ничего не меняет
+func (i *EventInMemoryStorage) snapshot() error {
+	path := filepath.Join(i.dir, snapshotFile)
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	// Календари пишутся первыми, хотя восстановлению событий порядок и не важен
+	var records []logRecord
+	for _, c := range i.calendars {
+		doc := eventjson.FromCalendar(&c)
+		records = append(records, logRecord{Op: opCalendar, Calendar: &doc})
+	}
+	for _, v := range i.data {
+		doc := eventjson.FromEntity(&v.event)
+		records = append(records, logRecord{Op: opCreate, Event: &doc})
+	}
+	for _, k := range i.apiKeys {
+		doc := eventjson.FromAPIKey(&k)
+		records = append(records, logRecord{Op: opAPIKey, APIKey: &doc})
+	}
+
+	for _, r := range records {
+		data, err := encodeRecord(r)
+		if err != nil {
+			f.Close()
+			return err
+		}
+
+		if _, err = f.Write(data); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if err = syncDir(i.dir); err != nil {
+		return err
+	}
+
+	return i.wal.reset()
+}
+
+// loadSnapshot загружает события из снимка, если он есть
+func (i *EventInMemoryStorage) loadSnapshot() error {
+	f, err := os.Open(filepath.Join(i.dir, snapshotFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, torn, err := readRecords(f, i.replay)
+	if err != nil {
+		return err
+	}
+
+	// Снимок подменяется атомарно, поэтому оборванная запись в нем означает повреждение
+	if torn {
+		return fmt.Errorf("%w: snapshot is truncated", ErrCorrupted)
+	}
+
+	return nil
+}
+
+// replayWAL применяет записи журнала и отбрасывает оборванную последнюю запись. Возвращает число записей
+func (i *EventInMemoryStorage) replayWAL() (int, error) {
+	f, err := os.OpenFile(filepath.Join(i.dir, walFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	records := 0
+	valid, torn, err := readRecords(f, func(r logRecord) error {
+		records++
+		return i.replay(r)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if torn {
+		if err = f.Truncate(valid); err != nil {
+			return 0, err
+		}
+		if err = f.Sync(); err != nil {
+			return 0, err
+		}
+	}
+
+	return records, nil
+}
+
+// replay применяет запись журнала или снимка к данным в памяти.
+// Применение идемпотентно, т.к. журнал может содержать изменения, уже вошедшие в снимок
+func (i *EventInMemoryStorage) replay(r logRecord) error {
+	switch r.Op {
+	case opCreate, opUpdate:
+		if r.Event == nil {
+			return fmt.Errorf("%w: %s record without event", ErrCorrupted, r.Op)
+		}
+
+		event, err := r.Event.Entity()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrCorrupted, err)
+		}
+
+		id := event.ID.String()
+		if item, ok := i.data[id]; ok {
+			i.unindex(id, &item)
+		}
+		i.put(id, event)
+
+	case opSplit:
+		if r.Event == nil || r.Tail == nil {
+			return fmt.Errorf("%w: %s record without events", ErrCorrupted, r.Op)
+		}
+
+		for _, doc := range []*eventjson.Event{r.Event, r.Tail} {
+			event, err := doc.Entity()
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrCorrupted, err)
+			}
+
+			id := event.ID.String()
+			if item, ok := i.data[id]; ok {
+				i.unindex(id, &item)
+			}
+			i.put(id, event)
+		}
+
+	case opDelete:
+		if item, ok := i.data[r.ID]; ok {
+			i.unindex(r.ID, &item)
+			delete(i.data, r.ID)
+		}
+
+	case opCalendar:
+		if r.Calendar == nil {
+			return fmt.Errorf("%w: %s record without calendar", ErrCorrupted, r.Op)
+		}
+
+		calendar, err := r.Calendar.Entity()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrCorrupted, err)
+		}
+		i.calendars[r.Calendar.ID] = *calendar
+
+	case opCalendarDelete:
+		i.deleteCalendar(r.ID)
+
+	case opAPIKey:
+		if r.APIKey == nil {
+			return fmt.Errorf("%w: %s record without api key", ErrCorrupted, r.Op)
+		}
+
+		key, err := r.APIKey.Entity()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrCorrupted, err)
+		}
+		i.apiKeys[key.Hash] = *key
+
+	default:
+		return fmt.Errorf("%w: unknown operation %q", ErrCorrupted, r.Op)
+	}
+
+	return nil
+}
+
+// syncDir сбрасывает на диск каталог, чтобы переименование файла в нем пережило сбой ОС
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,265 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/storage/storagetest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openDurable открывает хранилище в каталоге dir
+func openDurable(t *testing.T, dir string, snapshotEvery int) *EventInMemoryStorage {
+	s, err := NewDurableEventInMemoryStorage(Persistence{Dir: dir, Sync: SyncAlways, SnapshotEvery: snapshotEvery})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// crash закрывает журнал без снимка, как если бы процесс завершился аварийно
+func crash(t *testing.T, s *EventInMemoryStorage) {
+	if err := s.wal.close(); err != nil {
+		t.Fatal(err)
+	}
+	s.wal = nil
+}
+
+// createEvents создает n событий по часу, идущих друг за другом
+func createEvents(t *testing.T, s *EventInMemoryStorage, n int) []entities.Event {
+	base := time.Date(2020, 5, 12, 10, 0, 0, 0, time.UTC)
+
+	var events []entities.Event
+	for i := 0; i < n; i++ {
+		id, _ := entities.NewEventID("")
+		start := base.Add(time.Duration(i) * time.Hour)
+		event := entities.Event{ID: id, Title: "Событие", Start: start, End: start.Add(time.Hour)}
+
+		if err := s.Create(context.Background(), &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+
+	return events
+}
+
+// count возвращает число событий в хранилище
+func count(t *testing.T, s *EventInMemoryStorage) int {
+	events, err := s.ListAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return len(events)
+}
+
+// TestDurableEventInMemoryStorage_Conformance проверяет хранилище с журналом общим набором тестов
+func TestDurableEventInMemoryStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) usecases.Storage {
+		s := openDurable(t, t.TempDir(), 3)
+		t.Cleanup(func() { s.Close() })
+
+		return s
+	})
+}
+
+// TestDurableEventInMemoryStorage_Replay проверяет восстановление изменений из журнала после аварийного завершения
+func TestDurableEventInMemoryStorage_Replay(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := openDurable(t, dir, 0)
+	events := createEvents(t, s, 3)
+
+	events[0].Title = "Измененное событие"
+	if err := s.Update(ctx, &events[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteByID(ctx, &events[1].ID, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Разделение пишется одной записью с обеими сериями
+	tailID, _ := entities.NewEventID("")
+	tail := entities.Event{ID: tailID, Title: "Продолжение", Start: events[2].End, End: events[2].End.Add(time.Hour)}
+	if err := s.SplitIfFree(ctx, &events[2], &tail); err != nil {
+		t.Fatal(err)
+	}
+	crash(t, s)
+
+	s = openDurable(t, dir, 0)
+	defer s.Close()
+
+	if n := count(t, s); n != 3 {
+		t.Fatalf("expected 3 events, got %d", n)
+	}
+	if found, err := s.FindByID(ctx, tail.ID); err != nil || found.Version != 1 {
+		t.Fatalf("split tail is lost: %+v, %v", found, err)
+	}
+	if found, err := s.FindByID(ctx, events[2].ID); err != nil || found.Version != 2 {
+		t.Fatalf("split head is lost: %+v, %v", found, err)
+	}
+
+	found, err := s.FindByID(ctx, events[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Title != "Измененное событие" {
+		t.Errorf("update is lost, got %q", found.Title)
+	}
+
+	// Индекс восстанавливается вместе с данными
+	if events, _ := s.FindBySpan(ctx, entities.DefaultCalendarID, events[2].Start, events[2].End); len(events) != 1 {
+		t.Errorf("expected 1 event in span, got %d", len(events))
+	}
+}
+
+// TestDurableEventInMemoryStorage_Snapshot проверяет сжатие журнала в снимок
+func TestDurableEventInMemoryStorage_Snapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	s := openDurable(t, dir, 5)
+	createEvents(t, s, 12)
+
+	if s.wal.records != 2 {
+		t.Errorf("expected 2 records after the last snapshot, got %d", s.wal.records)
+	}
+	if _, err := os.Stat(filepath.Join(dir, snapshotFile)); err != nil {
+		t.Fatal(err)
+	}
+	crash(t, s)
+
+	s = openDurable(t, dir, 5)
+	if n := count(t, s); n != 12 {
+		t.Fatalf("expected 12 events, got %d", n)
+	}
+
+	// При закрытии журнал целиком уходит в снимок
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, walFile)); err != nil || info.Size() != 0 {
+		t.Errorf("log must be empty after close: %v %v", info, err)
+	}
+
+	s = openDurable(t, dir, 5)
+	defer s.Close()
+	if n := count(t, s); n != 12 {
+		t.Fatalf("expected 12 events, got %d", n)
+	}
+}
+
+// TestDurableEventInMemoryStorage_TornTail проверяет, что оборванная последняя запись отбрасывается
+func TestDurableEventInMemoryStorage_TornTail(t *testing.T) {
+	tails := map[string][]byte{
+		"header":   {0, 0, 1},
+		"payload":  {0, 0, 0, 100, 1, 2, 3, 4, '{', '"'},
+		"checksum": append([]byte{0, 0, 0, 2, 0, 0, 0, 0}, '{', '}'),
+	}
+
+	for name, tail := range tails {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, walFile)
+
+			s := openDurable(t, dir, 0)
+			createEvents(t, s, 2)
+			crash(t, s)
+
+			info, _ := os.Stat(path)
+			valid := info.Size()
+
+			f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+			f.Write(tail)
+			f.Close()
+
+			s = openDurable(t, dir, 0)
+			if n := count(t, s); n != 2 {
+				t.Fatalf("expected 2 events, got %d", n)
+			}
+			if info, _ = os.Stat(path); info.Size() != valid {
+				t.Errorf("torn record must be truncated: size %d, expected %d", info.Size(), valid)
+			}
+
+			// Журнал продолжает дописываться после усечения
+			createEvents(t, s, 1)
+			crash(t, s)
+
+			s = openDurable(t, dir, 0)
+			defer s.Close()
+			if n := count(t, s); n != 3 {
+				t.Fatalf("expected 3 events, got %d", n)
+			}
+		})
+	}
+}
+
+// TestDurableEventInMemoryStorage_Corrupted проверяет отказ открывать журнал, поврежденный не в конце
+func TestDurableEventInMemoryStorage_Corrupted(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, walFile)
+
+	s := openDurable(t, dir, 0)
+	createEvents(t, s, 3)
+	crash(t, s)
+
+	data, _ := os.ReadFile(path)
+	data[recordHeaderSize+5] ^= 0xff
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewDurableEventInMemoryStorage(Persistence{Dir: dir, Sync: SyncAlways}); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("expected ErrCorrupted, got %v", err)
+	}
+}
+
+// TestDurableEventInMemoryStorage_SyncInterval проверяет сброс журнала по таймеру
+func TestDurableEventInMemoryStorage_SyncInterval(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := NewDurableEventInMemoryStorage(Persistence{Dir: dir, Sync: SyncInterval, SyncInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	createEvents(t, s, 3)
+	time.Sleep(10 * time.Millisecond)
+	crash(t, s)
+
+	s = openDurable(t, dir, 0)
+	defer s.Close()
+	if n := count(t, s); n != 3 {
+		t.Fatalf("expected 3 events, got %d", n)
+	}
+
+	for _, p := range []Persistence{{Dir: dir, Sync: "sometimes"}, {Dir: dir, Sync: SyncInterval}} {
+		if _, err = NewDurableEventInMemoryStorage(p); err == nil {
+			t.Errorf("%+v: expected error", p)
+		}
+	}
+}
+
+// TestDurableEventInMemoryStorage_Busy проверяет, что отклоненная запись не попадает в журнал
+func TestDurableEventInMemoryStorage_Busy(t *testing.T) {
+	dir := t.TempDir()
+
+	s := openDurable(t, dir, 0)
+	events := createEvents(t, s, 1)
+
+	id, _ := entities.NewEventID("")
+	busy := entities.Event{ID: id, Title: "Пересекается", Start: events[0].Start, End: events[0].End}
+	if err := s.CreateIfFree(context.Background(), &busy); err != storage.EntitySpanBusy {
+		t.Fatalf("expected EntitySpanBusy, got %v", err)
+	}
+	if s.wal.records != 1 {
+		t.Errorf("expected 1 record, got %d", s.wal.records)
+	}
+	crash(t, s)
+}
@@ -4,88 +4,362 @@ import (
 	"context"
 	"github.com/mzelenkin/go-calendar/internal/domain/entities"
 	"github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	"sync"
 	"time"
 )
 
 // EventInMemoryStorage хранилище пользователей в памяти
+// Безопасно для одновременного использования: чтения выполняются параллельно, записи - по одной
 type EventInMemoryStorage struct {
-	data map[string]entities.Event
+	// mu защищает data, indexes, calendars и apiKeys, а также делает атомарными проверку пересечений и запись
+	// в CreateIfFree, UpdateIfFree и SplitIfFree
+	mu        sync.RWMutex
+	data      map[string]record
+	indexes   map[spanKey]*spanIndex // Промежутки событий для FindBySpan, отдельно по календарям каждого арендатора
+	calendars map[string]entities.Calendar
+	apiKeys   map[string]entities.APIKey // Ключи API по хэшу
+
+	// Журнал и снимок, если хранилище сохраняется на диск (см. NewDurableEventInMemoryStorage)
+	wal           *wal
+	dir           string
+	snapshotEvery int
+}
+
+// record сохраненное событие вместе с промежутком, под которым оно лежит в индексе
+type record struct {
+	event      entities.Event
+	start, end time.Time
+}
+
+// spanKey календарь арендатора, у каждого из них свой индекс промежутков. Календарь по умолчанию есть у всех
+// арендаторов с одним идентификатором, поэтому одного идентификатора календаря недостаточно
+type spanKey struct {
+	tenant   string
+	calendar string
+}
+
+// keyOf ключ индекса, в котором лежит событие
+func keyOf(event *entities.Event) spanKey {
+	return spanKey{tenant: event.Tenant, calendar: event.CalendarID.String()}
 }
 
 func NewEventInMemoryStorage() (*EventInMemoryStorage, error) {
 	return &EventInMemoryStorage{
-		data: map[string]entities.Event{},
+		data:      map[string]record{},
+		indexes:   map[spanKey]*spanIndex{},
+		calendars: map[string]entities.Calendar{},
+		apiKeys:   map[string]entities.APIKey{},
 	}, nil
 }
 
 func (i *EventInMemoryStorage) Create(ctx context.Context, event *entities.Event) error {
-	id := event.ID.String()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	if _, ok := i.data[id]; ok {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	event.Tenant = tenant.FromContext(ctx)
+
+	return i.create(event)
+}
+
+// CreateIfFree создает событие, если оно не пересекается с сохраненными
+func (i *EventInMemoryStorage) CreateIfFree(ctx context.Context, event *entities.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if _, ok := i.data[event.ID.String()]; ok {
 		return storage.EntityAlreadyExists
 	}
 
-	i.data[id] = *event
+	event.Tenant = tenant.FromContext(ctx)
+	start, end := event.Bounds()
+	if storage.HasConflict(event, i.findBySpan(event.Tenant, event.CalendarID, start, end)) {
+		return storage.EntitySpanBusy
+	}
 
-	return nil
+	return i.create(event)
 }
 
 func (i *EventInMemoryStorage) Update(ctx context.Context, event *entities.Event) error {
-	eventIDString := event.ID.String()
-	if _, ok := i.data[eventIDString]; !ok {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	event.Tenant = tenant.FromContext(ctx)
+
+	return i.update(event)
+}
+
+// UpdateIfFree изменяет событие, если оно не пересекается с другими сохраненными
+func (i *EventInMemoryStorage) UpdateIfFree(ctx context.Context, event *entities.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	event.Tenant = tenant.FromContext(ctx)
+	item, ok := i.data[event.ID.String()]
+	if !ok || !owns(&item.event, event) {
+		return storage.EntityNotFound
+	}
+	if item.event.Version != event.Version {
+		return storage.EntityVersionConflict
+	}
+
+	start, end := event.Bounds()
+	if storage.HasConflict(event, i.findBySpan(event.Tenant, event.CalendarID, start, end)) {
+		return storage.EntitySpanBusy
+	}
+
+	return i.update(event)
+}
+
+// SplitIfFree изменяет серию head и создает отделенную от нее серию tail, если tail не пересекается с другими событиями
+func (i *EventInMemoryStorage) SplitIfFree(ctx context.Context, head, tail *entities.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	head.Tenant = tenant.FromContext(ctx)
+	tail.Tenant = head.Tenant
+	tail.CalendarID = head.CalendarID
+
+	item, ok := i.data[head.ID.String()]
+	if !ok || !owns(&item.event, head) {
 		return storage.EntityNotFound
 	}
+	if item.event.Version != head.Version {
+		return storage.EntityVersionConflict
+	}
+	if _, ok = i.data[tail.ID.String()]; ok {
+		return storage.EntityAlreadyExists
+	}
+
+	start, end := tail.Bounds()
+	if storage.HasSplitConflict(head, tail, i.findBySpan(tail.Tenant, tail.CalendarID, start, end)) {
+		return storage.EntitySpanBusy
+	}
+
+	updated, created := *head, *tail
+	updated.Version++
+	if created.Version < 1 {
+		created.Version = 1
+	}
+
+	// Обе серии пишутся в журнал одной записью, чтобы после сбоя не осталось усеченной серии без продолжения
+	if err := i.logSplit(&updated, &created); err != nil {
+		return err
+	}
 
-	i.data[eventIDString] = *event
+	i.unindex(head.ID.String(), &item)
+	i.put(head.ID.String(), &updated)
+	i.put(tail.ID.String(), &created)
+	i.maybeSnapshot()
+	head.Version, tail.Version = updated.Version, created.Version
 
 	return nil
 }
 
 func (i *EventInMemoryStorage) ListAll(ctx context.Context) ([]entities.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
 	var ret []entities.Event
 
 	for _, v := range i.data {
-		ret = append(ret, v)
+		ret = append(ret, v.event)
 	}
 
 	return ret, nil
 }
 
-// FindBySpan возвращает все события, лежащие в указанном временном диапазоне start..end
-// Параметры page и itemsPerPage
-func (i *EventInMemoryStorage) FindBySpan(ctx context.Context, start time.Time, end time.Time) ([]entities.Event, error) {
-	var ret []entities.Event
-	for _, v := range i.data {
-		if overlaps(start, end, v.Start, v.End) {
-			ret = append(ret, v)
-		}
+// FindBySpan возвращает все события календаря, лежащие в указанном временном диапазоне start..end
+// Повторяющиеся события попадают в выборку, если диапазон пересекается с промежутком всей серии
+func (i *EventInMemoryStorage) FindBySpan(ctx context.Context, calendar entities.CalendarID, start time.Time, end time.Time) ([]entities.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	return ret, nil
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return i.findBySpan(tenant.FromContext(ctx), calendar, start, end), nil
+}
+
+// FindPage возвращает страницу событий, пересекающихся с промежутком запроса, в порядке запроса
+func (i *EventInMemoryStorage) FindPage(ctx context.Context, q storage.SpanQuery) ([]entities.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return storage.Page(i.findBySpan(tenant.FromContext(ctx), q.Calendar, q.Start, q.End), q), nil
 }
 
 func (i *EventInMemoryStorage) FindByID(ctx context.Context, id entities.EventID) (*entities.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
 	eventIDString := id.String()
 	item, ok := i.data[eventIDString]
-	if !ok {
+	if !ok || item.event.Tenant != tenant.FromContext(ctx) {
 		return nil, storage.EntityNotFound
 	}
 
-	return &item, nil
+	return &item.event, nil
 }
 
-func (i *EventInMemoryStorage) DeleteByID(ctx context.Context, id *entities.EventID) error {
+func (i *EventInMemoryStorage) DeleteByID(ctx context.Context, id *entities.EventID, version int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
 	eventIDString := id.String()
-	if _, ok := i.data[eventIDString]; !ok {
+	item, ok := i.data[eventIDString]
+	if !ok || item.event.Tenant != tenant.FromContext(ctx) {
 		return storage.EntityNotFound
 	}
+	if version != 0 && item.event.Version != version {
+		return storage.EntityVersionConflict
+	}
 
+	if err := i.logDelete(eventIDString); err != nil {
+		return err
+	}
+
+	i.unindex(eventIDString, &item)
 	delete(i.data, eventIDString)
+	i.maybeSnapshot()
+
+	return nil
+}
+
+// create сохраняет новое событие (сначала в журнал, если он есть), вызывается под блокировкой
+func (i *EventInMemoryStorage) create(event *entities.Event) error {
+	id := event.ID.String()
+
+	if _, ok := i.data[id]; ok {
+		return storage.EntityAlreadyExists
+	}
+
+	created := *event
+	if created.Version < 1 {
+		created.Version = 1
+	}
+
+	if err := i.logEvent(opCreate, &created); err != nil {
+		return err
+	}
+
+	i.put(id, &created)
+	i.maybeSnapshot()
+	event.Version = created.Version
 
 	return nil
 }
 
-// overlaps проверяет пересечение двух диапазонов дат
-func overlaps(start1, end1, start2, end2 time.Time) bool {
-	return start1.Before(end2) && end1.After(start2)
+// update заменяет существующее событие той же версии и увеличивает версию, вызывается под блокировкой
+func (i *EventInMemoryStorage) update(event *entities.Event) error {
+	eventIDString := event.ID.String()
+	item, ok := i.data[eventIDString]
+	if !ok || !owns(&item.event, event) {
+		return storage.EntityNotFound
+	}
+	if item.event.Version != event.Version {
+		return storage.EntityVersionConflict
+	}
+
+	updated := *event
+	updated.Version++
+
+	if err := i.logEvent(opUpdate, &updated); err != nil {
+		return err
+	}
+
+	i.unindex(eventIDString, &item)
+	i.put(eventIDString, &updated)
+	i.maybeSnapshot()
+	event.Version = updated.Version
+
+	return nil
+}
+
+// put сохраняет событие и добавляет его промежуток в индекс, вызывается под блокировкой
+func (i *EventInMemoryStorage) put(id string, event *entities.Event) {
+	start, end := event.Bounds()
+
+	i.data[id] = record{event: *event, start: start, end: end}
+
+	key := keyOf(event)
+	index, ok := i.indexes[key]
+	if !ok {
+		index = newSpanIndex()
+		i.indexes[key] = index
+	}
+	index.insert(id, start, end)
+}
+
+// unindex убирает промежуток сохраненного события item из индекса, вызывается под блокировкой.
+// Опустевший индекс удаляется, чтобы не копить индексы удаленных календарей
+func (i *EventInMemoryStorage) unindex(id string, item *record) {
+	key := keyOf(&item.event)
+	index, ok := i.indexes[key]
+	if !ok {
+		return
+	}
+
+	index.remove(id, item.start)
+	if index.empty() {
+		delete(i.indexes, key)
+	}
+}
+
+// owns проверяет, что изменение event относится к сохраненному событию stored: тот же арендатор и календарь
+func owns(stored, event *entities.Event) bool {
+	return stored.Tenant == event.Tenant && stored.CalendarID.Equal(event.CalendarID)
+}
+
+// findBySpan выбирает события календаря арендатора, пересекающиеся с промежутком start..end, в порядке их начала.
+// Поиск идет только по индексу этого календаря, события других не просматриваются. Вызывается под блокировкой
+func (i *EventInMemoryStorage) findBySpan(owner string, calendar entities.CalendarID, start time.Time, end time.Time) []entities.Event {
+	index, ok := i.indexes[spanKey{tenant: owner, calendar: calendar.String()}]
+	if !ok {
+		return nil
+	}
+
+	var ret []entities.Event
+	index.find(start, end, func(id string) {
+		ret = append(ret, i.data[id].event)
+	})
+
+	return ret
 }
@@ -2,9 +2,14 @@ package inmemory
 
 import (
 	"context"
+	"fmt"
 	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
 	"github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/storage/storagetest"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 )
@@ -88,7 +93,7 @@ func TestEventInMemoryStorage_Update(t *testing.T) {
 		t.Fail()
 	}
 
-	err = s.DeleteByID(context.Background(), &event.ID)
+	err = s.DeleteByID(context.Background(), &event.ID, 0)
 	if err != nil {
 		t.Error(err)
 	}
@@ -151,7 +156,7 @@ func TestEventInMemoryStorage_GetByRange(t *testing.T) {
 	}
 
 	// При выборке за час, в результат
-	events, err := s.FindBySpan(ctx, time.Now(), time.Now().Add(1*time.Hour))
+	events, err := s.FindBySpan(ctx, entities.DefaultCalendarID, time.Now(), time.Now().Add(1*time.Hour))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -160,7 +165,7 @@ func TestEventInMemoryStorage_GetByRange(t *testing.T) {
 	}
 
 	// При выборе за 1:15 в выборку попадет 2 события
-	events, err = s.FindBySpan(ctx, time.Now(), time.Now().Add(1*time.Hour+15*time.Minute))
+	events, err = s.FindBySpan(ctx, entities.DefaultCalendarID, time.Now(), time.Now().Add(1*time.Hour+15*time.Minute))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -168,3 +173,239 @@ func TestEventInMemoryStorage_GetByRange(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// TestEventInMemoryStorage_Conformance проверяет хранилище общим набором тестов
+func TestEventInMemoryStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) usecases.Storage {
+		s, err := NewEventInMemoryStorage()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return s
+	})
+}
+
+// TestEventInMemoryStorage_Concurrent проверяет одновременные чтения и записи (имеет смысл с флагом -race)
+func TestEventInMemoryStorage_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	s, _ := NewEventInMemoryStorage()
+	base := time.Date(2020, 5, 12, 10, 0, 0, 0, time.UTC)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < 100; i++ {
+				start := base.Add(time.Duration(w*100+i) * time.Hour)
+				id, _ := entities.NewEventID("")
+				event := entities.Event{ID: id, Title: "Событие", Start: start, End: start.Add(time.Hour)}
+
+				if err := s.Create(ctx, &event); err != nil {
+					t.Error(err)
+					return
+				}
+
+				event.End = start.Add(30 * time.Minute)
+				if err := s.Update(ctx, &event); err != nil {
+					t.Error(err)
+					return
+				}
+
+				if _, err := s.FindBySpan(ctx, entities.DefaultCalendarID, base, start.Add(time.Hour)); err != nil {
+					t.Error(err)
+					return
+				}
+
+				if i%2 == 0 {
+					if err := s.DeleteByID(ctx, &event.ID, 0); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	events, err := s.FindBySpan(ctx, entities.DefaultCalendarID, base, base.AddDate(1, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 400 {
+		t.Errorf("expected 400 events, got %d", len(events))
+	}
+}
+
+// TestEventInMemoryStorage_IndexPerCalendar проверяет, что у календаря каждого арендатора свой индекс промежутков
+// и что индексы удаленных событий и календарей не остаются в хранилище
+func TestEventInMemoryStorage_IndexPerCalendar(t *testing.T) {
+	s, _ := NewEventInMemoryStorage()
+	alice, bob := tenant.NewContext(context.Background(), "alice"), tenant.NewContext(context.Background(), "bob")
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	weekly, _ := entities.ParseRecurrence("FREQ=WEEKLY")
+
+	calendarID, _ := entities.NewCalendarID("")
+	calendar := entities.Calendar{ID: calendarID, Name: "Работа"}
+	if err := s.CreateCalendar(alice, &calendar); err != nil {
+		t.Fatal(err)
+	}
+
+	series := func(ctx context.Context, calendar entities.CalendarID) entities.Event {
+		id, _ := entities.NewEventID("")
+		event := entities.Event{ID: id, CalendarID: calendar, Title: "Стендап", Start: start, End: start.Add(time.Hour), Recurrence: weekly}
+		if err := s.Create(ctx, &event); err != nil {
+			t.Fatal(err)
+		}
+		return event
+	}
+	series(alice, entities.DefaultCalendarID)
+	series(alice, calendarID)
+	own := series(bob, entities.DefaultCalendarID)
+
+	if len(s.indexes) != 3 {
+		t.Fatalf("expected 3 indexes, got %d", len(s.indexes))
+	}
+	if found, _ := s.FindBySpan(bob, entities.DefaultCalendarID, start, start.AddDate(1, 0, 0)); len(found) != 1 || !found[0].ID.Equal(own.ID) {
+		t.Errorf("unexpected events %v", found)
+	}
+
+	if err := s.DeleteByID(bob, &own.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteCalendar(alice, calendarID); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.indexes) != 1 || len(s.data) != 1 {
+		t.Errorf("expected 1 index and 1 event, got %d and %d", len(s.indexes), len(s.data))
+	}
+}
+
+// newBenchmarkStorage создает хранилище с n событиями по часу, идущими друг за другом с перерывом в час
+func newBenchmarkStorage(b *testing.B, n int) (*EventInMemoryStorage, time.Time) {
+	s, _ := NewEventInMemoryStorage()
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < n; i++ {
+		id, _ := entities.NewEventID("")
+		start := base.Add(time.Duration(2*i) * time.Hour)
+		event := entities.Event{ID: id, Title: "Событие", Start: start, End: start.Add(time.Hour)}
+
+		if err := s.Create(context.Background(), &event); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	return s, base
+}
+
+// findBySpanLinear поиск полным перебором, как до появления индекса, для сравнения в бенчмарках
+func (i *EventInMemoryStorage) findBySpanLinear(start, end time.Time) []entities.Event {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	var ret []entities.Event
+	for _, v := range i.data {
+		if start.Before(v.end) && end.After(v.start) {
+			ret = append(ret, v.event)
+		}
+	}
+
+	return ret
+}
+
+// BenchmarkEventInMemoryStorage_FindBySpan сравнивает выборку за неделю по индексу и полным перебором
+func BenchmarkEventInMemoryStorage_FindBySpan(b *testing.B) {
+	for _, n := range []int{1000, 10000, 100000} {
+		s, base := newBenchmarkStorage(b, n)
+		middle := base.Add(time.Duration(n) * time.Hour)
+
+		b.Run(fmt.Sprintf("index-%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := s.FindBySpan(context.Background(), entities.DefaultCalendarID, middle, middle.AddDate(0, 0, 7)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("linear-%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				s.findBySpanLinear(middle, middle.AddDate(0, 0, 7))
+			}
+		})
+	}
+}
+
+// BenchmarkEventInMemoryStorage_FindBySpanTenants измеряет выборку из календаря рядом с бесконечными сериями
+// других арендаторов: их индексы не просматриваются, поэтому время не зависит от их числа
+func BenchmarkEventInMemoryStorage_FindBySpanTenants(b *testing.B) {
+	weekly, _ := entities.ParseRecurrence("FREQ=WEEKLY")
+
+	for _, n := range []int{1000, 10000, 100000} {
+		s, base := newBenchmarkStorage(b, 1000)
+		for i := 0; i < n; i++ {
+			ctx := tenant.NewContext(context.Background(), fmt.Sprintf("tenant-%d", i))
+			id, _ := entities.NewEventID("")
+			event := entities.Event{ID: id, Title: "Стендап", Start: base, End: base.Add(time.Hour), Recurrence: weekly}
+			if err := s.Create(ctx, &event); err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		b.Run(fmt.Sprintf("tenants-%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := s.FindBySpan(context.Background(), entities.DefaultCalendarID, base, base.AddDate(0, 0, 7)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkEventInMemoryStorage_CreateIfFree измеряет создание с проверкой пересечений в заполненном хранилище
+func BenchmarkEventInMemoryStorage_CreateIfFree(b *testing.B) {
+	s, base := newBenchmarkStorage(b, 100000)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Свободный час между существующими событиями
+		start := base.Add(time.Duration(2*(i%100000)+1) * time.Hour)
+		id, _ := entities.NewEventID("")
+		event := entities.Event{ID: id, Title: "Событие", Start: start, End: start.Add(time.Hour)}
+
+		if err := s.CreateIfFree(ctx, &event); err != nil && err != storage.EntitySpanBusy {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkEventInMemoryStorage_Parallel измеряет одновременные выборки на фоне записей
+func BenchmarkEventInMemoryStorage_Parallel(b *testing.B) {
+	s, base := newBenchmarkStorage(b, 100000)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			i++
+			day := base.Add(time.Duration(i%100000) * time.Hour)
+
+			if i%10 == 0 {
+				id, _ := entities.NewEventID("")
+				event := entities.Event{ID: id, Title: "Событие", Start: day, End: day.Add(time.Minute)}
+				if err := s.Create(ctx, &event); err != nil {
+					b.Fatal(err)
+				}
+				continue
+			}
+
+			if _, err := s.FindBySpan(ctx, entities.DefaultCalendarID, day, day.AddDate(0, 0, 1)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
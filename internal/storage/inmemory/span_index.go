@@ -0,0 +1,166 @@
+package inmemory
+
+import (
+	"math/rand"
+	"time"
+)
+
+// spanIndex интервальное дерево промежутков событий: декартово дерево (treap), упорядоченное по началу промежутка,
+// в узлах которого хранится максимальное окончание по поддереву. Поиск пересечений с промежутком
+// отбрасывает поддеревья, которые целиком закончились до его начала или начинаются после его окончания,
+// поэтому занимает O(log n + k), где k - число найденных промежутков
+//
+// Индекс не синхронизирован, доступ к нему защищается блокировкой хранилища
+type spanIndex struct {
+	root *spanNode
+	rnd  *rand.Rand
+}
+
+// spanNode узел дерева, ключ узла - пара (start, id)
+type spanNode struct {
+	id         string
+	start, end time.Time
+	priority   int64
+	maxEnd     time.Time // Максимальное окончание промежутков поддерева
+	left       *spanNode
+	right      *spanNode
+}
+
+func newSpanIndex() *spanIndex {
+	return &spanIndex{rnd: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// insert добавляет промежуток события id
+func (x *spanIndex) insert(id string, start, end time.Time) {
+	n := &spanNode{id: id, start: start, end: end, maxEnd: end, priority: x.rnd.Int63()}
+
+	left, right := split(x.root, start, id)
+	x.root = merge(merge(left, n), right)
+}
+
+// remove удаляет промежуток события id, начинающийся в start
+func (x *spanIndex) remove(id string, start time.Time) {
+	x.root = remove(x.root, start, id)
+}
+
+// empty сообщает, что в индексе нет промежутков
+func (x *spanIndex) empty() bool {
+	return x.root == nil
+}
+
+// each вызывает fn для каждого промежутка индекса в порядке возрастания начала
+func (x *spanIndex) each(fn func(id string)) {
+	each(x.root, fn)
+}
+
+func each(n *spanNode, fn func(id string)) {
+	if n == nil {
+		return
+	}
+
+	each(n.left, fn)
+	fn(n.id)
+	each(n.right, fn)
+}
+
+// find вызывает fn для каждого промежутка, пересекающегося с start..end, в порядке возрастания начала.
+// Касание границами пересечением не считается
+func (x *spanIndex) find(start, end time.Time, fn func(id string)) {
+	find(x.root, start, end, fn)
+}
+
+func find(n *spanNode, start, end time.Time, fn func(id string)) {
+	// В поддереве нет промежутков, заканчивающихся после start
+	if n == nil || !n.maxEnd.After(start) {
+		return
+	}
+
+	find(n.left, start, end, fn)
+
+	// Узел и все правое поддерево начинаются не раньше end
+	if !n.start.Before(end) {
+		return
+	}
+
+	if n.end.After(start) {
+		fn(n.id)
+	}
+
+	find(n.right, start, end, fn)
+}
+
+// less сравнивает ключи (start, id)
+func less(start1 time.Time, id1 string, start2 time.Time, id2 string) bool {
+	if start1.Equal(start2) {
+		return id1 < id2
+	}
+
+	return start1.Before(start2)
+}
+
+// split разделяет дерево на узлы с ключами меньше (start, id) и все остальные
+func split(n *spanNode, start time.Time, id string) (*spanNode, *spanNode) {
+	if n == nil {
+		return nil, nil
+	}
+
+	if less(n.start, n.id, start, id) {
+		left, right := split(n.right, start, id)
+		n.right = left
+		n.update()
+		return n, right
+	}
+
+	left, right := split(n.left, start, id)
+	n.left = right
+	n.update()
+	return left, n
+}
+
+// merge объединяет деревья, все ключи левого из которых меньше ключей правого
+func merge(left, right *spanNode) *spanNode {
+	switch {
+	case left == nil:
+		return right
+	case right == nil:
+		return left
+	case left.priority > right.priority:
+		left.right = merge(left.right, right)
+		left.update()
+		return left
+	default:
+		right.left = merge(left, right.left)
+		right.update()
+		return right
+	}
+}
+
+// remove удаляет узел с ключом (start, id)
+func remove(n *spanNode, start time.Time, id string) *spanNode {
+	if n == nil {
+		return nil
+	}
+
+	switch {
+	case less(start, id, n.start, n.id):
+		n.left = remove(n.left, start, id)
+	case less(n.start, n.id, start, id):
+		n.right = remove(n.right, start, id)
+	default:
+		return merge(n.left, n.right)
+	}
+
+	n.update()
+	return n
+}
+
+// update пересчитывает максимальное окончание поддерева после изменения потомков
+func (n *spanNode) update() {
+	n.maxEnd = n.end
+	if n.left != nil && n.left.maxEnd.After(n.maxEnd) {
+		n.maxEnd = n.left.maxEnd
+	}
+	if n.right != nil && n.right.maxEnd.After(n.maxEnd) {
+		n.maxEnd = n.right.maxEnd
+	}
+}
@@ -0,0 +1,68 @@
+package inmemory
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestSpanIndex сверяет поиск по индексу с полным перебором на случайных промежутках,
+// в том числе после удаления части из них
+func TestSpanIndex(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	type span struct{ start, end time.Time }
+	spans := map[string]span{}
+	index := newSpanIndex()
+
+	randomSpan := func() span {
+		start := base.Add(time.Duration(rnd.Intn(1000)) * time.Hour)
+		return span{start, start.Add(time.Duration(rnd.Intn(100)) * time.Hour)}
+	}
+
+	for i := 0; i < 2000; i++ {
+		id := strconv.Itoa(i)
+		s := randomSpan()
+		spans[id] = s
+		index.insert(id, s.start, s.end)
+	}
+
+	for i := 0; i < 2000; i += 3 {
+		id := strconv.Itoa(i)
+		index.remove(id, spans[id].start)
+		delete(spans, id)
+	}
+
+	for i := 0; i < 500; i++ {
+		q := randomSpan()
+
+		var expected []string
+		for id, s := range spans {
+			if q.start.Before(s.end) && q.end.After(s.start) {
+				expected = append(expected, id)
+			}
+		}
+
+		var actual []string
+		index.find(q.start, q.end, func(id string) {
+			actual = append(actual, id)
+		})
+
+		// Индекс возвращает промежутки в порядке начала
+		if !sort.SliceIsSorted(actual, func(i, j int) bool {
+			return less(spans[actual[i]].start, actual[i], spans[actual[j]].start, actual[j])
+		}) {
+			t.Fatalf("%s..%s: result is not ordered by start", q.start, q.end)
+		}
+
+		sort.Strings(expected)
+		sort.Strings(actual)
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("%s..%s: expected %v, got %v", q.start, q.end, expected, actual)
+		}
+	}
+}
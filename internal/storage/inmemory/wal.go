@@ -0,0 +1,238 @@
+package inmemory
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mzelenkin/go-calendar/internal/storage/eventjson"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Записи журнала и снимка имеют вид: длина данных (4 байта, big endian) | CRC-32C данных (4 байта) | данные JSON
+const (
+	recordHeaderSize = 8
+	maxRecordSize    = 16 << 20
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrCorrupted журнал или снимок повреждены. Оборванная последняя запись журнала повреждением не считается:
+// она остается от сбоя во время записи и отбрасывается при восстановлении
+var ErrCorrupted = errors.New("inmemory: storage files are corrupted")
+
+// logOp операция, записанная в журнал
+type logOp string
+
+const (
+	opCreate logOp = "create"
+	opUpdate logOp = "update"
+	opDelete logOp = "delete"
+	// Изменение серии вместе с созданием отделенной от нее серии (SplitIfFree)
+	opSplit logOp = "split"
+
+	// Сохранение календаря и его удаление вместе со всеми событиями
+	opCalendar       logOp = "calendar"
+	opCalendarDelete logOp = "calendar_delete"
+
+	// Сохранение ключа API, в том числе его отзыв
+	opAPIKey logOp = "apikey"
+)
+
+// logRecord запись журнала. Для создания и изменения хранится событие, календарь или ключ API целиком,
+// для удаления - его идентификатор, для разделения серии - обе серии
+type logRecord struct {
+	Op       logOp               `json:"op"`
+	ID       string              `json:"id,omitempty"`
+	Event    *eventjson.Event    `json:"event,omitempty"`
+	Tail     *eventjson.Event    `json:"tail,omitempty"`
+	Calendar *eventjson.Calendar `json:"calendar,omitempty"`
+	APIKey   *eventjson.APIKey   `json:"apikey,omitempty"`
+}
+
+// encodeRecord сериализует запись вместе с заголовком
+func encodeRecord(r logRecord) ([]byte, error) {
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(payload, crcTable))
+	copy(buf[recordHeaderSize:], payload)
+
+	return buf, nil
+}
+
+// readRecords читает записи из f и передает их в fn. Возвращает размер прочитанной целостной части файла
+// и признак torn - файл заканчивается оборванной записью, которую следует отбросить.
+// Повреждение, за которым в файле еще есть данные, возвращается как ErrCorrupted
+func readRecords(f *os.File, fn func(r logRecord) error) (valid int64, torn bool, err error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, false, err
+	}
+	size := info.Size()
+
+	r := bufio.NewReader(f)
+	header := make([]byte, recordHeaderSize)
+
+	for valid < size {
+		if _, err = io.ReadFull(r, header); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return valid, true, nil
+			}
+			return valid, false, err
+		}
+
+		length := int64(binary.BigEndian.Uint32(header[0:4]))
+		end := valid + recordHeaderSize + length
+		if end > size {
+			return valid, true, nil
+		}
+		if length > maxRecordSize {
+			return valid, false, fmt.Errorf("%w: record at offset %d is too large", ErrCorrupted, valid)
+		}
+
+		payload := make([]byte, length)
+		if _, err = io.ReadFull(r, payload); err != nil {
+			return valid, false, err
+		}
+
+		if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+			if end == size {
+				return valid, true, nil
+			}
+			return valid, false, fmt.Errorf("%w: checksum mismatch at offset %d", ErrCorrupted, valid)
+		}
+
+		var rec logRecord
+		if err = json.Unmarshal(payload, &rec); err != nil {
+			return valid, false, fmt.Errorf("%w: record at offset %d: %v", ErrCorrupted, valid, err)
+		}
+
+		if err = fn(rec); err != nil {
+			return valid, false, err
+		}
+
+		valid = end
+	}
+
+	return valid, false, nil
+}
+
+// wal журнал операций хранилища (write-ahead log): запись попадает в журнал до изменения данных в памяти.
+// Дописывается под блокировкой записи хранилища, сброс на диск по SyncInterval идет в отдельной горутине
+type wal struct {
+	policy SyncPolicy
+
+	mu      sync.Mutex // Защищает f от одновременных fsync и усечения при снимке
+	f       *os.File
+	dirty   int32 // Есть записи, не сброшенные на диск (для SyncInterval)
+	records int   // Число записей с последнего снимка
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// openWAL открывает журнал для дописывания. Журнал уже должен быть прочитан и при необходимости усечен
+func openWAL(path string, policy SyncPolicy, interval time.Duration, records int) (*wal, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &wal{policy: policy, f: f, records: records}
+
+	if policy == SyncInterval {
+		w.stop = make(chan struct{})
+		w.done = make(chan struct{})
+		go w.syncLoop(interval)
+	}
+
+	return w, nil
+}
+
+// append дописывает запись в журнал и, в зависимости от политики, сбрасывает ее на диск
+func (w *wal) append(r logRecord) error {
+	data, err := encodeRecord(r)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err = w.f.Write(data); err != nil {
+		return err
+	}
+	w.records++
+
+	switch w.policy {
+	case SyncAlways:
+		return w.f.Sync()
+	case SyncInterval:
+		atomic.StoreInt32(&w.dirty, 1)
+	}
+
+	return nil
+}
+
+// reset очищает журнал после того, как его записи вошли в снимок
+func (w *wal) reset() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.f.Truncate(0); err != nil {
+		return err
+	}
+	w.records = 0
+
+	return w.f.Sync()
+}
+
+// syncLoop раз в interval сбрасывает журнал на диск, если в него что-то записано
+func (w *wal) syncLoop(interval time.Duration) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if atomic.SwapInt32(&w.dirty, 0) == 1 {
+				w.mu.Lock()
+				_ = w.f.Sync()
+				w.mu.Unlock()
+			}
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// close сбрасывает журнал на диск и закрывает его
+func (w *wal) close() error {
+	if w.stop != nil {
+		close(w.stop)
+		<-w.done
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.f.Sync(); err != nil {
+		w.f.Close()
+		return err
+	}
+
+	return w.f.Close()
+}
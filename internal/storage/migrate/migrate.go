@@ -0,0 +1,335 @@
+// Пакет применяет и откатывает версионированные миграции схемы SQL-хранилищ.
+//
+// Миграция версии N состоит из пары файлов <N>_<название>.up.sql и <N>_<название>.down.sql,
+// номера примененных версий хранятся в таблице schema_migrations.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrLocked миграции уже выполняет другой процесс
+var ErrLocked = errors.New("migrate: migrations are locked by another process")
+
+var (
+	// fileName имя файла миграции: версия, название и направление
+	fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+	// migrationName допустимое название миграции
+	migrationName = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
+// Migration версия схемы
+type Migration struct {
+	Version int
+	Name    string
+	Up      string // SQL применения
+	Down    string // SQL отката
+}
+
+// Status состояние версии схемы в базе
+type Status struct {
+	Version int
+	Name    string // Пустое, если версия применена, но ее файлов нет (база новее приложения)
+	Applied bool
+	// AppliedAt время применения в представлении базы
+	AppliedAt string
+}
+
+// Dialect запросы и блокировка, которые отличаются в разных базах.
+// Параметр запросов с версией - номер версии
+type Dialect struct {
+	CreateTable   string // Создает таблицу schema_migrations (version, applied_at), если ее нет
+	InsertVersion string
+	DeleteVersion string
+	// Lock берет блокировку миграций до конца транзакции tx. Если блокировку держит другой процесс,
+	// при wait ждет ее, иначе возвращает ErrLocked
+	Lock func(ctx context.Context, tx *sql.Tx, wait bool) error
+}
+
+// Migrator применяет миграции к базе
+// Каждый запуск Up или Down выполняется в одной транзакции: при ошибке база остается в исходном состоянии,
+// а одновременный запуск из другого процесса исключается блокировкой
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+
+	// Wait ждать, пока миграции выполняет другой процесс (при запуске сервиса), вместо ошибки ErrLocked
+	Wait bool
+}
+
+// New создает Migrator для миграций, упорядоченных по версии (см. Load)
+func New(db *sql.DB, dialect Dialect, migrations []Migration) *Migrator {
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}
+}
+
+// Up применяет все еще не примененные миграции и возвращает их
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+
+	err := m.inTx(ctx, func(tx *sql.Tx, applied map[int]string) error {
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			if err := m.exec(ctx, tx, migration.Up, m.dialect.InsertVersion, migration); err != nil {
+				return fmt.Errorf("migrate: up %04d_%s: %w", migration.Version, migration.Name, err)
+			}
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return done, nil
+}
+
+// Down откатывает steps последних примененных миграций и возвращает их в порядке отката
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+
+	err := m.inTx(ctx, func(tx *sql.Tx, applied map[int]string) error {
+		// База новее приложения: откат известных версий из-под неизвестных сломал бы схему
+		for version := range applied {
+			if version > m.latest() {
+				return fmt.Errorf("migrate: version %d is applied, but its migration is unknown", version)
+			}
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			if err := m.exec(ctx, tx, migration.Down, m.dialect.DeleteVersion, migration); err != nil {
+				return fmt.Errorf("migrate: down %04d_%s: %w", migration.Version, migration.Name, err)
+			}
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return done, nil
+}
+
+// Status возвращает состояние всех известных и всех примененных версий по возрастанию
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if _, err := m.db.ExecContext(ctx, m.dialect.CreateTable); err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedVersions(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []Status
+	for _, migration := range m.migrations {
+		appliedAt, ok := applied[migration.Version]
+		ret = append(ret, Status{Version: migration.Version, Name: migration.Name, Applied: ok, AppliedAt: appliedAt})
+		delete(applied, migration.Version)
+	}
+
+	for version, appliedAt := range applied {
+		ret = append(ret, Status{Version: version, Applied: true, AppliedAt: appliedAt})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Version < ret[j].Version
+	})
+
+	return ret, nil
+}
+
+// inTx выполняет fn в транзакции под блокировкой миграций и передает ей примененные версии
+func (m *Migrator) inTx(ctx context.Context, fn func(tx *sql.Tx, applied map[int]string) error) error {
+	if _, err := m.db.ExecContext(ctx, m.dialect.CreateTable); err != nil {
+		return err
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if m.dialect.Lock != nil {
+		if err = m.dialect.Lock(ctx, tx, m.Wait); err != nil {
+			return err
+		}
+	}
+
+	// Версии читаются под блокировкой, иначе их мог изменить другой процесс
+	applied, err := appliedVersions(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	if err = fn(tx, applied); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// exec выполняет SQL миграции и отмечает версию запросом versionQuery
+func (m *Migrator) exec(ctx context.Context, tx *sql.Tx, script string, versionQuery string, migration Migration) error {
+	if strings.TrimSpace(script) != "" {
+		if _, err := tx.ExecContext(ctx, script); err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, versionQuery, migration.Version)
+
+	return err
+}
+
+// latest наибольшая известная версия
+func (m *Migrator) latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// querier общая часть *sql.DB и *sql.Tx
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// appliedVersions возвращает примененные версии и время их применения
+func appliedVersions(ctx context.Context, q querier) (map[int]string, error) {
+	rows, err := q.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]string{}
+	for rows.Next() {
+		var version int
+		var appliedAt string
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// Load читает миграции из каталога dir и упорядочивает их по версии. У каждой версии должны быть оба файла
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	files := map[int]int{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migrate: malformed migration name %q", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migrate: version %d has different names %q and %q", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+		files[version]++
+	}
+
+	var list []Migration
+	for version, migration := range byVersion {
+		if files[version] != 2 {
+			return nil, fmt.Errorf("migrate: version %d must have exactly one up and one down file", version)
+		}
+		list = append(list, *migration)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+
+	return list, nil
+}
+
+// Create создает в каталоге dir пустые файлы миграции name со следующей по порядку версией
+// и возвращает их пути
+func Create(dir string, name string) ([]string, error) {
+	name = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), " ", "_"))
+	if !migrationName.MatchString(name) {
+		return nil, fmt.Errorf("migrate: migration name %q must consist of latin letters, digits and underscores", name)
+	}
+
+	list, err := Load(os.DirFS(dir), ".")
+	if err != nil {
+		return nil, err
+	}
+
+	version := 1
+	if len(list) > 0 {
+		version = list[len(list)-1].Version + 1
+	}
+
+	var paths []string
+	for _, direction := range []string{"up", "down"} {
+		p := filepath.Join(dir, fmt.Sprintf("%04d_%s.%s.sql", version, name, direction))
+
+		// O_EXCL не дает перезаписать файл, созданный одновременно
+		f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return paths, err
+		}
+		_, err = fmt.Fprintf(f, "-- %s (%s)\n", strings.ReplaceAll(name, "_", " "), direction)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return paths, err
+		}
+
+		paths = append(paths, p)
+	}
+
+	return paths, nil
+}
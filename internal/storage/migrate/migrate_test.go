@@ -0,0 +1,228 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	_ "modernc.org/sqlite"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// testDialect диалект SQLite без блокировки
+var testDialect = Dialect{
+	CreateTable:   `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP)`,
+	InsertVersion: `INSERT INTO schema_migrations (version) VALUES (?)`,
+	DeleteVersion: `DELETE FROM schema_migrations WHERE version = ?`,
+}
+
+// testFiles каталог migrations с тремя версиями (последняя с ошибкой), файлы перечислены не по порядку,
+// и каталоги с ошибками в именах файлов
+var testFiles = fstest.MapFS{
+	"migrations/0002_add_rooms.up.sql":    {Data: []byte(`CREATE TABLE rooms (id TEXT PRIMARY KEY)`)},
+	"migrations/0002_add_rooms.down.sql":  {Data: []byte(`DROP TABLE rooms`)},
+	"migrations/0001_add_events.up.sql":   {Data: []byte(`CREATE TABLE events (id TEXT PRIMARY KEY)`)},
+	"migrations/0001_add_events.down.sql": {Data: []byte(`DROP TABLE events`)},
+	"migrations/0003_broken.up.sql":       {Data: []byte(`CREATE TABLE rooms (id TEXT PRIMARY KEY)`)},
+	"migrations/0003_broken.down.sql":     {Data: []byte(``)},
+	"unpaired/0001_add_events.up.sql":     {Data: []byte(`SELECT 1`)},
+	"malformed/0001_Add events.up.sql":    {Data: []byte(`SELECT 1`)},
+	"malformed/0001_Add events.down.sql":  {Data: []byte(`SELECT 1`)},
+	"conflicting/0001_first.up.sql":       {Data: []byte(`SELECT 1`)},
+	"conflicting/0001_first.down.sql":     {Data: []byte(`SELECT 1`)},
+	"conflicting/0001_second.up.sql":      {Data: []byte(`SELECT 1`)},
+	"conflicting/0001_second.down.sql":    {Data: []byte(`SELECT 1`)},
+}
+
+// newTestMigrator возвращает Migrator первых n тестовых миграций для новой базы
+func newTestMigrator(t *testing.T, n int) *Migrator {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	list, err := Load(testFiles, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return New(db, testDialect, list[:n])
+}
+
+// versions возвращает версии миграций
+func versions(list []Migration) []int {
+	var ret []int
+	for _, m := range list {
+		ret = append(ret, m.Version)
+	}
+
+	return ret
+}
+
+// assertVersions сравнивает списки версий
+func assertVersions(t *testing.T, got []Migration, want ...int) {
+	t.Helper()
+
+	g := versions(got)
+	if len(g) != len(want) {
+		t.Fatalf("got versions %v, want %v", g, want)
+	}
+	for i := range g {
+		if g[i] != want[i] {
+			t.Fatalf("got versions %v, want %v", g, want)
+		}
+	}
+}
+
+// TestLoad проверяет порядок миграций и ошибки в именах файлов
+func TestLoad(t *testing.T) {
+	list, err := Load(testFiles, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertVersions(t, list, 1, 2, 3)
+	if list[0].Name != "add_events" || !strings.HasPrefix(list[0].Down, "DROP") {
+		t.Errorf("unexpected migration %+v", list[0])
+	}
+
+	for _, dir := range []string{"unpaired", "malformed", "conflicting"} {
+		if _, err = Load(testFiles, dir); err == nil {
+			t.Errorf("%s: expected error", dir)
+		}
+	}
+}
+
+// TestMigrator_UpDown проверяет применение, откат и повторное применение
+func TestMigrator_UpDown(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMigrator(t, 2)
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertVersions(t, applied, 1, 2)
+
+	// Повторный запуск ничего не применяет
+	if applied, err = m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	assertVersions(t, applied)
+
+	rolledBack, err := m.Down(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertVersions(t, rolledBack, 2)
+
+	if _, err = m.db.Exec(`SELECT * FROM rooms`); err == nil {
+		t.Error("table rooms must be dropped")
+	}
+
+	if rolledBack, err = m.Down(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	assertVersions(t, rolledBack, 1)
+
+	if applied, err = m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	assertVersions(t, applied, 1, 2)
+}
+
+// TestMigrator_Status проверяет состояние версий, в том числе примененной, но неизвестной приложению
+func TestMigrator_Status(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMigrator(t, 2)
+
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Приложение старой версии знает только о первой миграции
+	old := New(m.db, testDialect, m.migrations[:1])
+	status, err := old.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(status) != 2 || !status[0].Applied || status[0].AppliedAt == "" || status[1].Name != "" || !status[1].Applied {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	if _, err = old.Down(ctx, 1); err == nil {
+		t.Error("down must refuse to roll back under an unknown version")
+	}
+}
+
+// TestMigrator_Atomic проверяет, что при ошибке миграции не применяется ни одна версия
+func TestMigrator_Atomic(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMigrator(t, 3)
+
+	if _, err := m.Up(ctx); err == nil || !strings.Contains(err.Error(), "0003_broken") {
+		t.Fatalf("expected error of migration 3, got %v", err)
+	}
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range status {
+		if s.Applied {
+			t.Errorf("version %d must not be applied", s.Version)
+		}
+	}
+}
+
+// TestMigrator_Lock проверяет, что занятая блокировка останавливает миграции до изменения базы
+func TestMigrator_Lock(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMigrator(t, 2)
+	m.dialect.Lock = func(ctx context.Context, tx *sql.Tx, wait bool) error {
+		if wait {
+			t.Error("wait must be false by default")
+		}
+		return ErrLocked
+	}
+
+	if _, err := m.Up(ctx); err != ErrLocked {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	if _, err := m.db.Exec(`SELECT * FROM events`); err == nil {
+		t.Error("migrations must not be applied without the lock")
+	}
+}
+
+// TestCreate проверяет создание файлов следующей версии
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+
+	paths, err := Create(dir, "Add rooms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || filepath.Base(paths[0]) != "0001_add_rooms.up.sql" || filepath.Base(paths[1]) != "0001_add_rooms.down.sql" {
+		t.Fatalf("unexpected files %v", paths)
+	}
+
+	if paths, err = Create(dir, "add_events"); err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(paths[0]) != "0002_add_events.up.sql" {
+		t.Fatalf("unexpected files %v", paths)
+	}
+
+	list, err := Load(os.DirFS(dir), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertVersions(t, list, 1, 2)
+
+	if _, err = Create(dir, "drop;table"); err == nil {
+		t.Error("expected error for invalid name")
+	}
+}
@@ -0,0 +1,87 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	"strings"
+	"time"
+)
+
+// apiKeyColumns колонки ключа API в порядке, в котором их читает scanAPIKey
+const apiKeyColumns = `id, hash, prefix, name, scopes, tenant, created, revoked`
+
+// CreateAPIKey сохраняет новый ключ API
+func (s *EventPostgresStorage) CreateAPIKey(ctx context.Context, key *entities.APIKey) error {
+	key.Tenant = tenant.FromContext(ctx)
+
+	var revoked sql.NullTime
+	if key.IsRevoked() {
+		revoked = sql.NullTime{Time: key.Revoked, Valid: true}
+	}
+
+	_, err := s.db.ExecContext(ctx, `INSERT INTO api_keys (`+apiKeyColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		key.ID.String(), key.Hash, key.Prefix, key.Name, strings.Join(key.Scopes, " "), key.Tenant, key.Created, revoked)
+
+	return mapError(err)
+}
+
+// FindAPIKeyByHash ищет ключ API по хэшу среди ключей всех арендаторов
+func (s *EventPostgresStorage) FindAPIKeyByHash(ctx context.Context, hash string) (*entities.APIKey, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE hash = $1`, hash)
+
+	return scanAPIKey(row)
+}
+
+// FindAPIKeys возвращает ключи API арендатора по времени создания
+func (s *EventPostgresStorage) FindAPIKeys(ctx context.Context) ([]entities.APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE tenant = $1 ORDER BY created, id`,
+		tenant.FromContext(ctx))
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var ret []entities.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, *key)
+	}
+
+	return ret, mapError(rows.Err())
+}
+
+// RevokeAPIKey отмечает ключ API отозванным
+func (s *EventPostgresStorage) RevokeAPIKey(ctx context.Context, id entities.APIKeyID, at time.Time) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE api_keys SET revoked = COALESCE(revoked, $1) WHERE id = $2 AND tenant = $3`,
+		at, id.String(), tenant.FromContext(ctx))
+
+	return affected(res, err)
+}
+
+// scanAPIKey читает ключ API из строки результата с колонками apiKeyColumns
+func scanAPIKey(s scanner) (*entities.APIKey, error) {
+	var id, scopes string
+	var revoked sql.NullTime
+	var key entities.APIKey
+
+	if err := s.Scan(&id, &key.Hash, &key.Prefix, &key.Name, &scopes, &key.Tenant, &key.Created, &revoked); err != nil {
+		return nil, mapError(err)
+	}
+
+	var err error
+	if key.ID, err = entities.NewAPIKeyID(id); err != nil {
+		return nil, err
+	}
+	if revoked.Valid {
+		key.Revoked = revoked.Time
+	}
+	key.Scopes = strings.Fields(scopes)
+
+	return &key, nil
+}
@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+)
+
+// calendarColumns колонки календаря в порядке, в котором их читает scanCalendar
+const calendarColumns = `id, name, color, owner, timezone, tenant`
+
+// CreateCalendar сохраняет новый календарь
+func (s *EventPostgresStorage) CreateCalendar(ctx context.Context, calendar *entities.Calendar) error {
+	calendar.Tenant = tenant.FromContext(ctx)
+	_, err := s.db.ExecContext(ctx, `INSERT INTO calendars (`+calendarColumns+`) VALUES ($1, $2, $3, $4, $5, $6)`,
+		calendar.ID.String(), calendar.Name, calendar.Color, calendar.Owner, calendar.Timezone, calendar.Tenant)
+
+	return mapError(err)
+}
+
+func (s *EventPostgresStorage) FindCalendarByID(ctx context.Context, id entities.CalendarID) (*entities.Calendar, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+calendarColumns+` FROM calendars WHERE id = $1 AND tenant = $2`,
+		id.String(), tenant.FromContext(ctx))
+
+	return scanCalendar(row)
+}
+
+// FindCalendars возвращает календари владельца, пустой owner - всех владельцев арендатора
+func (s *EventPostgresStorage) FindCalendars(ctx context.Context, owner string) ([]entities.Calendar, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+calendarColumns+` FROM calendars
+		WHERE tenant = $2 AND ($1 = '' OR owner = $1) ORDER BY name, id`, owner, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var ret []entities.Calendar
+	for rows.Next() {
+		calendar, err := scanCalendar(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, *calendar)
+	}
+
+	return ret, mapError(rows.Err())
+}
+
+func (s *EventPostgresStorage) UpdateCalendar(ctx context.Context, calendar *entities.Calendar) error {
+	calendar.Tenant = tenant.FromContext(ctx)
+	res, err := s.db.ExecContext(ctx, `UPDATE calendars SET name = $1, color = $2, owner = $3, timezone = $4 WHERE id = $5 AND tenant = $6`,
+		calendar.Name, calendar.Color, calendar.Owner, calendar.Timezone, calendar.ID.String(), calendar.Tenant)
+
+	return affected(res, err)
+}
+
+// DeleteCalendar удаляет календарь и его события в одной транзакции
+func (s *EventPostgresStorage) DeleteCalendar(ctx context.Context, id entities.CalendarID) error {
+	owner := tenant.FromContext(ctx)
+
+	return s.inSpanTx(ctx, id, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM events WHERE calendar_id = $1 AND tenant = $2`, id.String(), owner); err != nil {
+			return mapError(err)
+		}
+
+		res, err := tx.ExecContext(ctx, `DELETE FROM calendars WHERE id = $1 AND tenant = $2`, id.String(), owner)
+
+		return affected(res, err)
+	})
+}
+
+// scanCalendar читает календарь из строки результата с колонками calendarColumns
+func scanCalendar(s scanner) (*entities.Calendar, error) {
+	var id string
+	var calendar entities.Calendar
+
+	if err := s.Scan(&id, &calendar.Name, &calendar.Color, &calendar.Owner, &calendar.Timezone, &calendar.Tenant); err != nil {
+		return nil, mapError(err)
+	}
+
+	var err error
+	if calendar.ID, err = entities.NewCalendarID(id); err != nil {
+		return nil, err
+	}
+
+	return &calendar, nil
+}
+
+// affected возвращает EntityNotFound, если запрос не затронул ни одной строки
+func affected(res sql.Result, err error) error {
+	if err != nil {
+		return mapError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return storage.EntityNotFound
+	}
+
+	return nil
+}
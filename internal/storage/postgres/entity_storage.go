@@ -0,0 +1,362 @@
+// Пакет реализует хранилище событий в PostgreSQL.
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	"hash/fnv"
+	"time"
+)
+
+// uniqueViolation код ошибки PostgreSQL при нарушении уникальности
+const uniqueViolation = "23505"
+
+// spanLockID первая часть ключа advisory-блокировки, под которой проверяются пересечения при записи (см. inSpanTx)
+const spanLockID = 7879002
+
+// eventColumns колонки события в порядке, в котором их читает scanEvent
+const eventColumns = `id, title, start_at, end_at, timezone, description, rrule, ex_dates, overrides, version, calendar_id, tenant`
+
+// EventPostgresStorage хранилище событий в PostgreSQL
+type EventPostgresStorage struct {
+	db *sql.DB
+}
+
+// NewEventPostgresStorage подключается к базе по строке подключения dsn и применяет миграции
+func NewEventPostgresStorage(ctx context.Context, dsn string) (*EventPostgresStorage, error) {
+	db, err := OpenDB(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = Migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &EventPostgresStorage{db: db}, nil
+}
+
+// OpenDB подключается к базе по строке подключения dsn, не применяя миграции
+func OpenDB(ctx context.Context, dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Close закрывает подключения к базе
+func (s *EventPostgresStorage) Close() error {
+	return s.db.Close()
+}
+
+// Ping проверяет доступность базы
+func (s *EventPostgresStorage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *EventPostgresStorage) Create(ctx context.Context, event *entities.Event) error {
+	return create(ctx, s.db, event)
+}
+
+// CreateIfFree создает событие, если оно не пересекается с сохраненными
+func (s *EventPostgresStorage) CreateIfFree(ctx context.Context, event *entities.Event) error {
+	return s.inSpanTx(ctx, event.CalendarID, func(tx *sql.Tx) error {
+		if err := checkFree(ctx, tx, event); err != nil {
+			return err
+		}
+
+		return create(ctx, tx, event)
+	})
+}
+
+func (s *EventPostgresStorage) Update(ctx context.Context, event *entities.Event) error {
+	return update(ctx, s.db, event)
+}
+
+// UpdateIfFree изменяет событие, если оно не пересекается с другими сохраненными
+func (s *EventPostgresStorage) UpdateIfFree(ctx context.Context, event *entities.Event) error {
+	return s.inSpanTx(ctx, event.CalendarID, func(tx *sql.Tx) error {
+		// Событие другого календаря не найдено, даже если его время занято в календаре изменения
+		if err := exists(ctx, tx, event); err != nil {
+			return err
+		}
+		if err := checkFree(ctx, tx, event); err != nil {
+			return err
+		}
+
+		return update(ctx, tx, event)
+	})
+}
+
+// SplitIfFree изменяет серию head и создает отделенную от нее серию tail, если tail не пересекается с другими событиями.
+// Усеченная head записывается первой, поэтому проверка tail в той же транзакции видит уже ее.
+// Если tail пересекается, транзакция откатывается вместе с изменением head
+func (s *EventPostgresStorage) SplitIfFree(ctx context.Context, head, tail *entities.Event) error {
+	tail.CalendarID = head.CalendarID
+	headVersion, tailVersion := head.Version, tail.Version
+
+	err := s.inSpanTx(ctx, head.CalendarID, func(tx *sql.Tx) error {
+		if err := update(ctx, tx, head); err != nil {
+			return err
+		}
+		if err := checkFree(ctx, tx, tail); err != nil {
+			return err
+		}
+
+		return create(ctx, tx, tail)
+	})
+	if err != nil {
+		// Транзакция откатилась, поэтому версии остаются прежними
+		head.Version, tail.Version = headVersion, tailVersion
+	}
+
+	return err
+}
+
+// FindBySpan возвращает все события календаря, лежащие в указанном временном диапазоне start..end
+// Оператор && отбирает кандидатов по GiST индексу, а сравнение границ исключает события,
+// которые только касаются диапазона (как и в остальных хранилищах, касание не считается пересечением)
+func (s *EventPostgresStorage) FindBySpan(ctx context.Context, calendar entities.CalendarID, start time.Time, end time.Time) ([]entities.Event, error) {
+	return findBySpan(ctx, s.db, calendar, start, end)
+}
+
+// FindPage возвращает страницу событий, пересекающихся с промежутком запроса, в порядке запроса
+func (s *EventPostgresStorage) FindPage(ctx context.Context, q storage.SpanQuery) ([]entities.Event, error) {
+	return findPage(ctx, s.db, q)
+}
+
+func (s *EventPostgresStorage) FindByID(ctx context.Context, id entities.EventID) (*entities.Event, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+eventColumns+` FROM events WHERE id = $1 AND tenant = $2`,
+		id.String(), tenant.FromContext(ctx))
+
+	return scanEvent(row)
+}
+
+func (s *EventPostgresStorage) DeleteByID(ctx context.Context, id *entities.EventID, version int64) error {
+	owner := tenant.FromContext(ctx)
+	res, err := s.db.ExecContext(ctx, `DELETE FROM events WHERE id = $1 AND tenant = $2 AND ($3 = 0 OR version = $3)`,
+		id.String(), owner, version)
+
+	return changed(ctx, s.db, res, err, `id = $1 AND tenant = $2`, id.String(), owner)
+}
+
+// inSpanTx выполняет fn в транзакции под advisory-блокировкой календаря событий, фиксируя ее, если fn не вернула ошибку.
+// Блокировка упорядочивает проверки пересечений с записью: при READ COMMITTED две транзакции иначе
+// не увидели бы незафиксированные события друг друга и обе сохранили бы пересекающиеся события.
+// Пересечения проверяются внутри календаря арендатора, поэтому записи в разные календари друг друга не ждут
+func (s *EventPostgresStorage) inSpanTx(ctx context.Context, calendar entities.CalendarID, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1, $2)`, spanLockID, spanLockKey(ctx, calendar)); err != nil {
+		return mapError(err)
+	}
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	return mapError(tx.Commit())
+}
+
+// spanLockKey вторая часть ключа блокировки inSpanTx: хэш арендатора и календаря.
+// Совпадение хэшей разных календарей лишь заставляет их записи ждать друг друга
+func spanLockKey(ctx context.Context, calendar entities.CalendarID) int32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(tenant.FromContext(ctx) + "/" + calendar.String()))
+
+	return int32(h.Sum32())
+}
+
+// querier общий интерфейс sql.DB и sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// create сохраняет новое событие арендатора из контекста
+func create(ctx context.Context, q querier, event *entities.Event) error {
+	event.Tenant = tenant.FromContext(ctx)
+	row, err := newEventRow(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(ctx, `INSERT INTO events (`+eventColumns+`, span)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, tstzrange($13, $14, '[]'))`,
+		row.id, row.title, row.start, row.end, row.timezone, row.description, row.rrule, row.exDates, row.overrides,
+		row.version, row.calendarID, row.tenant, row.spanStart, row.spanEnd)
+	if err != nil {
+		return mapError(err)
+	}
+
+	event.Version = row.version
+
+	return nil
+}
+
+// update изменяет событие арендатора из контекста
+func update(ctx context.Context, q querier, event *entities.Event) error {
+	event.Tenant = tenant.FromContext(ctx)
+	row, err := newEventRow(event)
+	if err != nil {
+		return err
+	}
+
+	res, err := q.ExecContext(ctx, `UPDATE events SET
+		title = $2, start_at = $3, end_at = $4, timezone = $5, description = $6, rrule = $7,
+		ex_dates = $8, overrides = $9, span = tstzrange($10, $11, '[]'), version = version + 1
+		WHERE id = $1 AND calendar_id = $13 AND tenant = $14 AND version = $12`,
+		row.id, row.title, row.start, row.end, row.timezone, row.description, row.rrule, row.exDates, row.overrides,
+		row.spanStart, row.spanEnd, event.Version, row.calendarID, row.tenant)
+	// Событие другого календаря или арендатора не изменяется и считается не найденным
+	if err = changed(ctx, q, res, err, `id = $1 AND calendar_id = $2 AND tenant = $3`, row.id, row.calendarID, row.tenant); err != nil {
+		return err
+	}
+
+	event.Version++
+
+	return nil
+}
+
+// findBySpan выбирает события календаря арендатора из контекста, пересекающиеся с промежутком start..end
+func findBySpan(ctx context.Context, q querier, calendar entities.CalendarID, start time.Time, end time.Time) ([]entities.Event, error) {
+	return queryEvents(ctx, q, `SELECT `+eventColumns+` FROM events
+		WHERE span && tstzrange($1, $2, '[]') AND lower(span) < $2 AND upper(span) > $1 AND calendar_id = $3 AND tenant = $4`,
+		start, end, calendar.String(), tenant.FromContext(ctx))
+}
+
+// findPage выбирает страницу событий по запросу. Позиция q.After задается условием на ключ сортировки,
+// а не смещением, поэтому следующая страница не сдвигается при добавлении и удалении событий.
+// События отбираются индексом промежутка, а сортируются уже отобранные, их немного
+func findPage(ctx context.Context, q querier, query storage.SpanQuery) ([]entities.Event, error) {
+	bound, order := "lower(span)", "lower(span), id"
+	if query.Order == storage.SortDesc {
+		bound, order = "upper(span)", "upper(span) DESC, id DESC"
+	}
+
+	stmt := `SELECT ` + eventColumns + ` FROM events
+		WHERE span && tstzrange($1, $2, '[]') AND lower(span) < $2 AND upper(span) > $1 AND calendar_id = $3 AND tenant = $4`
+	args := []interface{}{query.Start, query.End, query.Calendar.String(), tenant.FromContext(ctx)}
+
+	if query.After != nil {
+		cmp := ">"
+		if query.Order == storage.SortDesc {
+			cmp = "<"
+		}
+
+		stmt += ` AND (` + bound + `, id) ` + cmp + ` ($5, $6)`
+		args = append(args, query.After.Bound, query.After.ID)
+	}
+
+	stmt += ` ORDER BY ` + order
+	if query.Limit > 0 {
+		args = append(args, query.Limit)
+		stmt += fmt.Sprintf(` LIMIT $%d`, len(args))
+	}
+
+	return queryEvents(ctx, q, stmt, args...)
+}
+
+// queryEvents выполняет запрос, возвращающий колонки eventColumns, и читает события
+func queryEvents(ctx context.Context, q querier, query string, args ...interface{}) ([]entities.Event, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var ret []entities.Event
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, *event)
+	}
+
+	return ret, mapError(rows.Err())
+}
+
+// exists возвращает EntityNotFound, если в календаре события у арендатора из контекста нет события с его идентификатором
+func exists(ctx context.Context, q querier, event *entities.Event) error {
+	var found int
+	err := q.QueryRowContext(ctx, `SELECT 1 FROM events WHERE id = $1 AND calendar_id = $2 AND tenant = $3`,
+		event.ID.String(), event.CalendarID.String(), tenant.FromContext(ctx)).Scan(&found)
+
+	return mapError(err)
+}
+
+// checkFree возвращает EntitySpanBusy, если событие пересекается с другими сохраненными
+func checkFree(ctx context.Context, q querier, event *entities.Event) error {
+	start, end := event.Bounds()
+
+	candidates, err := findBySpan(ctx, q, event.CalendarID, start, end)
+	if err != nil {
+		return err
+	}
+
+	if storage.HasConflict(event, candidates) {
+		return storage.EntitySpanBusy
+	}
+
+	return nil
+}
+
+// changed проверяет, что запрос к событию с условием на версию затронул строку.
+// Иначе возвращает EntityNotFound, если нет события, подходящего под условие where без версии,
+// или EntityVersionConflict, если у него другая версия
+func changed(ctx context.Context, q querier, res sql.Result, err error, where string, args ...interface{}) error {
+	if err != nil {
+		return mapError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	var exists int
+	err = q.QueryRowContext(ctx, `SELECT 1 FROM events WHERE `+where, args...).Scan(&exists)
+	if err != nil {
+		return mapError(err)
+	}
+
+	return storage.EntityVersionConflict
+}
+
+// mapError приводит ошибки базы к ошибкам хранилища
+func mapError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.EntityNotFound
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return storage.EntityAlreadyExists
+	}
+
+	return err
+}
@@ -0,0 +1,161 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/storage/migrate"
+	"github.com/mzelenkin/go-calendar/internal/storage/storagetest"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testDSNEnv переменная окружения со строкой подключения к тестовой базе.
+// Тесты, которым нужна база, без нее пропускаются
+const testDSNEnv = "CALENDAR_TEST_POSTGRES_DSN"
+
+// newTestStorage подключается к тестовой базе и очищает таблицы событий, календарей и ключей API.
+// Тесты ключей создают ключи с постоянными хэшами, поэтому без очистки повторный запуск нарушил бы UNIQUE(hash)
+func newTestStorage(t *testing.T) *EventPostgresStorage {
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skip(testDSNEnv + " is not set")
+	}
+
+	s, err := NewEventPostgresStorage(context.Background(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	if _, err = s.db.Exec(`TRUNCATE events, calendars, api_keys`); err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// newRecurringEvent возвращает серию с исключениями в именованной зоне
+func newRecurringEvent(t *testing.T) entities.Event {
+	loc, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skip("timezone database is not available")
+	}
+
+	id, _ := entities.NewEventID("")
+	rule, _ := entities.ParseRecurrence("FREQ=WEEKLY;BYDAY=MO;COUNT=4")
+	start := time.Date(2020, 1, 6, 10, 0, 0, 0, loc)
+
+	return entities.Event{
+		ID:          id,
+		Title:       "Стендап",
+		Start:       start,
+		End:         start.Add(15 * time.Minute),
+		Description: "Еженедельный стендап",
+		Recurrence:  rule,
+		ExDates:     []time.Time{start.AddDate(0, 0, 7)},
+		Overrides: []entities.Override{{
+			OriginalStart: start.AddDate(0, 0, 14),
+			Title:         "Перенесенный стендап",
+			Start:         start.AddDate(0, 0, 15),
+			End:           start.AddDate(0, 0, 15).Add(15 * time.Minute),
+		}},
+	}
+}
+
+// TestEventRow проверяет, что событие восстанавливается из колонок без потерь, включая зону
+func TestEventRow(t *testing.T) {
+	event := newRecurringEvent(t)
+
+	row, err := newEventRow(&event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// База возвращает моменты времени в своей зоне
+	row.start, row.end = row.start.UTC(), row.end.UTC()
+
+	restored, err := row.event()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(restored.Occurrences(event.Bounds()), event.Occurrences(event.Bounds())) {
+		t.Errorf("occurrences differ:\n%+v\n%+v", restored.Occurrences(event.Bounds()), event.Occurrences(event.Bounds()))
+	}
+	if restored.Start.Location().String() != "Europe/Moscow" {
+		t.Errorf("unexpected location %s", restored.Start.Location())
+	}
+
+	if start, end := event.Bounds(); !row.spanStart.Equal(start) || !row.spanEnd.Equal(end) {
+		t.Errorf("unexpected span %s..%s", row.spanStart, row.spanEnd)
+	}
+}
+
+// TestMapError проверяет приведение ошибок базы к ошибкам хранилища
+func TestMapError(t *testing.T) {
+	if mapError(sql.ErrNoRows) != storage.EntityNotFound {
+		t.Error("sql.ErrNoRows must be mapped to EntityNotFound")
+	}
+	if mapError(&pq.Error{Code: uniqueViolation}) != storage.EntityAlreadyExists {
+		t.Error("unique violation must be mapped to EntityAlreadyExists")
+	}
+	if mapError(nil) != nil {
+		t.Error("nil must stay nil")
+	}
+}
+
+// TestSpanLockKey проверяет, что записи разных арендаторов и календарей блокируются разными ключами
+func TestSpanLockKey(t *testing.T) {
+	calendar, _ := entities.NewCalendarID("")
+	alice := tenant.NewContext(context.Background(), "alice")
+	bob := tenant.NewContext(context.Background(), "bob")
+
+	keys := map[int32]string{}
+	for name, key := range map[string]int32{
+		"default":          spanLockKey(context.Background(), entities.DefaultCalendarID),
+		"default calendar": spanLockKey(context.Background(), calendar),
+		"alice":            spanLockKey(alice, entities.DefaultCalendarID),
+		"alice calendar":   spanLockKey(alice, calendar),
+		"bob calendar":     spanLockKey(bob, calendar),
+	} {
+		if other, ok := keys[key]; ok {
+			t.Errorf("%s and %s share lock key %d", name, other, key)
+		}
+		keys[key] = name
+	}
+
+	if spanLockKey(alice, calendar) != spanLockKey(tenant.NewContext(context.Background(), "alice"), calendar) {
+		t.Error("lock key must not depend on context instance")
+	}
+}
+
+// TestNewMigrator проверяет, что встроенные миграции читаются и у каждой есть откат
+func TestNewMigrator(t *testing.T) {
+	list, err := migrate.Load(migrations, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) == 0 || list[0].Version != 1 {
+		t.Fatalf("unexpected migrations %+v", list)
+	}
+	for _, m := range list {
+		if m.Down == "" {
+			t.Errorf("migration %d has empty down script", m.Version)
+		}
+	}
+}
+
+// TestEventPostgresStorage_Conformance проверяет хранилище общим набором тестов
+func TestEventPostgresStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) usecases.Storage {
+		return newTestStorage(t)
+	})
+}
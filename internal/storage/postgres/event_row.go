@@ -0,0 +1,159 @@
+package postgres
+
+import (
+	"encoding/json"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"time"
+)
+
+// eventRow событие в виде значений колонок таблицы events
+type eventRow struct {
+	id          string
+	title       string
+	start       time.Time
+	end         time.Time
+	timezone    string // Зона, в которой заданы время события и правило повторения
+	description string
+	rrule       string
+	exDates     []byte
+	overrides   []byte
+	version     int64
+	calendarID  string
+	tenant      string
+	spanStart   time.Time
+	spanEnd     time.Time
+}
+
+// overrideRow измененное повторение в колонке overrides
+type overrideRow struct {
+	OriginalStart time.Time `json:"original_start"`
+	Title         string    `json:"title"`
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+	Description   string    `json:"description,omitempty"`
+}
+
+// scanner общий интерфейс sql.Row и sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// newEventRow переводит событие в значения колонок
+func newEventRow(event *entities.Event) (*eventRow, error) {
+	row := &eventRow{
+		id:          event.ID.String(),
+		title:       event.Title,
+		start:       event.Start,
+		end:         event.End,
+		timezone:    event.Start.Location().String(),
+		description: event.Description,
+		version:     event.Version,
+		calendarID:  event.CalendarID.String(),
+		tenant:      event.Tenant,
+	}
+
+	// Новое событие без версии сохраняется первой версией
+	if row.version < 1 {
+		row.version = 1
+	}
+
+	if event.Recurrence != nil {
+		row.rrule = event.Recurrence.String()
+	}
+
+	exDates := event.ExDates
+	if exDates == nil {
+		exDates = []time.Time{}
+	}
+
+	overrides := make([]overrideRow, 0, len(event.Overrides))
+	for _, o := range event.Overrides {
+		overrides = append(overrides, overrideRow(o))
+	}
+
+	var err error
+	if row.exDates, err = json.Marshal(exDates); err != nil {
+		return nil, err
+	}
+	if row.overrides, err = json.Marshal(overrides); err != nil {
+		return nil, err
+	}
+
+	row.spanStart, row.spanEnd = event.Bounds()
+
+	return row, nil
+}
+
+// scanEvent читает событие из строки результата с колонками eventColumns
+func scanEvent(s scanner) (*entities.Event, error) {
+	var row eventRow
+
+	err := s.Scan(&row.id, &row.title, &row.start, &row.end, &row.timezone, &row.description, &row.rrule,
+		&row.exDates, &row.overrides, &row.version, &row.calendarID, &row.tenant)
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	return row.event()
+}
+
+// event восстанавливает событие из значений колонок.
+// База хранит моменты времени без зоны, поэтому времена переводятся обратно в зону события:
+// от нее зависит развертывание повторений (дни недели, переход на летнее время)
+func (r *eventRow) event() (*entities.Event, error) {
+	id, err := entities.NewEventID(r.id)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := time.LoadLocation(r.timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	calendarID, err := entities.NewCalendarID(r.calendarID)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &entities.Event{
+		ID:          id,
+		CalendarID:  calendarID,
+		Tenant:      r.tenant,
+		Title:       r.title,
+		Start:       r.start.In(loc),
+		End:         r.end.In(loc),
+		Description: r.description,
+		Version:     r.version,
+	}
+
+	if r.rrule != "" {
+		if event.Recurrence, err = entities.ParseRecurrence(r.rrule); err != nil {
+			return nil, err
+		}
+	}
+
+	var exDates []time.Time
+	if err = json.Unmarshal(r.exDates, &exDates); err != nil {
+		return nil, err
+	}
+	for _, t := range exDates {
+		event.ExDates = append(event.ExDates, t.In(loc))
+	}
+
+	var overrides []overrideRow
+	if err = json.Unmarshal(r.overrides, &overrides); err != nil {
+		return nil, err
+	}
+	for _, o := range overrides {
+		event.Overrides = append(event.Overrides, entities.Override{
+			OriginalStart: o.OriginalStart.In(loc),
+			Title:         o.Title,
+			Start:         o.Start.In(loc),
+			End:           o.End.In(loc),
+			Description:   o.Description,
+		})
+	}
+
+	return event, nil
+}
@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"github.com/mzelenkin/go-calendar/internal/storage/migrate"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// migrationLockID ключ advisory-блокировки, не дающей нескольким процессам мигрировать схему одновременно
+const migrationLockID = 7879001
+
+// dialect запросы таблицы версий и блокировка миграций в PostgreSQL
+var dialect = migrate.Dialect{
+	CreateTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    integer PRIMARY KEY,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`,
+	InsertVersion: `INSERT INTO schema_migrations (version) VALUES ($1)`,
+	DeleteVersion: `DELETE FROM schema_migrations WHERE version = $1`,
+	Lock:          lock,
+}
+
+// NewMigrator возвращает Migrator встроенных миграций для базы db
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	list, err := migrate.Load(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.New(db, dialect, list), nil
+}
+
+// Migrate применяет к базе еще не примененные миграции. Если их применяет другой экземпляр сервиса, ждет его
+func Migrate(ctx context.Context, db *sql.DB) error {
+	m, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	m.Wait = true
+	_, err = m.Up(ctx)
+
+	return err
+}
+
+// lock берет advisory-блокировку, которая снимается вместе с завершением транзакции
+func lock(ctx context.Context, tx *sql.Tx, wait bool) error {
+	if wait {
+		_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockID)
+		return err
+	}
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, migrationLockID).Scan(&locked); err != nil {
+		return err
+	}
+	if !locked {
+		return migrate.ErrLocked
+	}
+
+	return nil
+}
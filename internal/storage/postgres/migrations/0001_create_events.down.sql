@@ -0,0 +1,2 @@
+-- Откат удаляет все события
+DROP TABLE events;
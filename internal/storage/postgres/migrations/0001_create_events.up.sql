@@ -0,0 +1,16 @@
+-- События календаря. Исключения серии хранятся в jsonb, т.к. всегда читаются и пишутся вместе с событием
+CREATE TABLE events (
+    id          uuid PRIMARY KEY,
+    title       text        NOT NULL,
+    start_at    timestamptz NOT NULL,
+    end_at      timestamptz NOT NULL,
+    timezone    text        NOT NULL DEFAULT 'UTC',
+    description text        NOT NULL DEFAULT '',
+    rrule       text        NOT NULL DEFAULT '',
+    ex_dates    jsonb       NOT NULL DEFAULT '[]',
+    overrides   jsonb       NOT NULL DEFAULT '[]',
+    -- Промежуток, который занимает событие вместе со всеми повторениями (entities.Event.Bounds)
+    span        tstzrange   NOT NULL
+);
+
+CREATE INDEX events_span_idx ON events USING gist (span);
@@ -0,0 +1,4 @@
+-- Откат сливает события всех календарей в один
+DROP INDEX events_calendar_idx;
+ALTER TABLE events DROP COLUMN calendar_id;
+DROP TABLE calendars;
@@ -0,0 +1,15 @@
+-- Календари. Календарь по умолчанию не хранится: у его событий нулевой calendar_id,
+-- поэтому события, созданные до появления календарей, попадают в него
+CREATE TABLE calendars (
+    id       uuid PRIMARY KEY,
+    name     text NOT NULL,
+    color    text NOT NULL DEFAULT '',
+    owner    text NOT NULL DEFAULT '',
+    timezone text NOT NULL DEFAULT ''
+);
+
+CREATE INDEX calendars_owner_idx ON calendars (owner, name);
+
+ALTER TABLE events ADD COLUMN calendar_id uuid NOT NULL DEFAULT '00000000-0000-0000-0000-000000000000';
+
+CREATE INDEX events_calendar_idx ON events (calendar_id);
@@ -0,0 +1,10 @@
+-- Арендаторы. Данные, созданные до их появления, принадлежат арендатору по умолчанию с пустым идентификатором
+ALTER TABLE events ADD COLUMN tenant text NOT NULL DEFAULT '';
+ALTER TABLE calendars ADD COLUMN tenant text NOT NULL DEFAULT '';
+
+-- Выборки по промежутку и списки календарей теперь всегда ограничены арендатором
+DROP INDEX events_calendar_idx;
+CREATE INDEX events_calendar_idx ON events (tenant, calendar_id);
+
+DROP INDEX calendars_owner_idx;
+CREATE INDEX calendars_owner_idx ON calendars (tenant, owner, name);
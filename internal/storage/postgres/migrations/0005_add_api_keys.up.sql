@@ -0,0 +1,13 @@
+-- Ключи API. Сам ключ не хранится, только его хэш SHA-256; разрешения записаны через пробел
+CREATE TABLE api_keys (
+    id      uuid PRIMARY KEY,
+    hash    text NOT NULL UNIQUE,
+    prefix  text NOT NULL,
+    name    text NOT NULL DEFAULT '',
+    scopes  text NOT NULL DEFAULT '',
+    tenant  text NOT NULL DEFAULT '',
+    created timestamptz NOT NULL,
+    revoked timestamptz
+);
+
+CREATE INDEX api_keys_tenant_idx ON api_keys (tenant, created);
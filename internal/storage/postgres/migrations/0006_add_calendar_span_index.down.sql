@@ -0,0 +1,3 @@
+-- Расширение btree_gist не удаляется: его могут использовать и другие объекты базы
+DROP INDEX events_span_idx;
+CREATE INDEX events_span_idx ON events USING gist (span);
@@ -0,0 +1,6 @@
+-- Выборки по промежутку всегда ограничены арендатором и календарем: составной GiST индекс отбирает кандидатов
+-- сразу по всем условиям. Равенство по text и uuid в GiST индексе дает расширение btree_gist
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+DROP INDEX events_span_idx;
+CREATE INDEX events_span_idx ON events USING gist (tenant, calendar_id, span);
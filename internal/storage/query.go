@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"sort"
+	"time"
+)
+
+// SortOrder порядок событий в выборке FindPage
+type SortOrder int
+
+const (
+	// SortAsc по возрастанию начала промежутка события (entities.Event.Bounds)
+	SortAsc SortOrder = iota
+	// SortDesc по убыванию окончания промежутка события
+	SortDesc
+)
+
+// Reverse возвращает обратный порядок
+func (o SortOrder) Reverse() SortOrder {
+	if o == SortDesc {
+		return SortAsc
+	}
+
+	return SortDesc
+}
+
+// SpanKey позиция события в выборке: граница промежутка, по которой идет сортировка
+// (начало для SortAsc, окончание для SortDesc), и идентификатор, различающий события с одной границей
+type SpanKey struct {
+	Bound time.Time
+	ID    string
+}
+
+// SpanQuery запрос страницы событий календаря Calendar, пересекающихся с промежутком Start..End
+type SpanQuery struct {
+	Calendar entities.CalendarID
+	Start    time.Time
+	End      time.Time
+	Order    SortOrder
+	Limit    int      // Максимальное число событий, 0 - без ограничения
+	After    *SpanKey // Если задан, выборка начинается со следующего за ним события
+}
+
+// Key возвращает позицию события в выборке с порядком order
+func Key(event *entities.Event, order SortOrder) SpanKey {
+	start, end := event.Bounds()
+	if order == SortDesc {
+		return SpanKey{Bound: end, ID: event.ID.String()}
+	}
+
+	return SpanKey{Bound: start, ID: event.ID.String()}
+}
+
+// Before проверяет, что в выборке с порядком order позиция k идет раньше other
+func (k SpanKey) Before(other SpanKey, order SortOrder) bool {
+	if order == SortDesc {
+		k, other = other, k
+	}
+
+	if !k.Bound.Equal(other.Bound) {
+		return k.Bound.Before(other.Bound)
+	}
+
+	return k.ID < other.ID
+}
+
+// Page упорядочивает события, найденные по промежутку запроса, и вырезает из них страницу.
+// Используется хранилищами, которые не умеют сортировать сами
+func Page(events []entities.Event, q SpanQuery) []entities.Event {
+	keys := make(map[string]SpanKey, len(events))
+	for i := range events {
+		keys[events[i].ID.String()] = Key(&events[i], q.Order)
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return keys[events[i].ID.String()].Before(keys[events[j].ID.String()], q.Order)
+	})
+
+	if q.After != nil {
+		i := sort.Search(len(events), func(i int) bool {
+			return q.After.Before(keys[events[i].ID.String()], q.Order)
+		})
+		events = events[i:]
+	}
+
+	if q.Limit > 0 && len(events) > q.Limit {
+		events = events[:q.Limit]
+	}
+
+	return events
+}
+
+// SortCalendars упорядочивает календари по названию, а календари с одинаковым названием - по идентификатору
+func SortCalendars(calendars []entities.Calendar) {
+	sort.Slice(calendars, func(i, j int) bool {
+		if calendars[i].Name != calendars[j].Name {
+			return calendars[i].Name < calendars[j].Name
+		}
+
+		return calendars[i].ID.String() < calendars[j].ID.String()
+	})
+}
+
+// SortAPIKeys упорядочивает ключи API по времени создания, а ключи, созданные одновременно, - по идентификатору
+func SortAPIKeys(keys []entities.APIKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].Created.Equal(keys[j].Created) {
+			return keys[i].Created.Before(keys[j].Created)
+		}
+
+		return keys[i].ID.String() < keys[j].ID.String()
+	})
+}
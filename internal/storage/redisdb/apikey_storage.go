@@ -0,0 +1,176 @@
+package redisdb
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/storage/eventjson"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	"time"
+)
+
+// createAPIKeyScript сохраняет документ ключа API ARGV[1] с идентификатором ARGV[2] арендатора ARGV[3]: хеш ключа,
+// ссылку на него по хэшу и идентификатор в множестве ключей арендатора. Ключ с тем же идентификатором или хэшем
+// не должен существовать, иначе возвращает exists
+var createAPIKeyScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 or redis.call('EXISTS', KEYS[2]) == 1 then return 'exists' end
+redis.call('HSET', KEYS[1], 'data', ARGV[1], 'tenant', ARGV[3])
+redis.call('SET', KEYS[2], ARGV[2])
+redis.call('SADD', KEYS[3], ARGV[2])
+return 'ok'
+`)
+
+// revokeAPIKeyScript заменяет документ ключа API на ARGV[1], если ключ принадлежит арендатору ARGV[2]
+// и его документ не изменился с чтения (ARGV[3]), иначе возвращает not_found или stale
+var revokeAPIKeyScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then return 'not_found' end
+if (redis.call('HGET', KEYS[1], 'tenant') or '') ~= ARGV[2] then return 'not_found' end
+if redis.call('HGET', KEYS[1], 'data') ~= ARGV[3] then return 'stale' end
+redis.call('HSET', KEYS[1], 'data', ARGV[1])
+return 'ok'
+`)
+
+// CreateAPIKey сохраняет новый ключ API
+func (s *EventRedisStorage) CreateAPIKey(ctx context.Context, key *entities.APIKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	key.Tenant = tenant.FromContext(ctx)
+
+	data, err := eventjson.MarshalAPIKey(key)
+	if err != nil {
+		return err
+	}
+
+	id := key.ID.String()
+	keys := []string{s.apiKeyPrefix + id, s.apiKeyHash + key.Hash, s.apiKeySet(key.Tenant)}
+	status, err := createAPIKeyScript.Run(ctx, s.client, keys, data, id, key.Tenant).Text()
+	if err != nil {
+		return err
+	}
+
+	return statusError(status)
+}
+
+// FindAPIKeyByHash ищет ключ API по хэшу среди ключей всех арендаторов
+func (s *EventRedisStorage) FindAPIKeyByHash(ctx context.Context, hash string) (*entities.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	id, err := s.client.Get(ctx, s.apiKeyHash+hash).Result()
+	if err == redis.Nil {
+		return nil, storage.EntityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.client.HGet(ctx, s.apiKeyPrefix+id, "data").Bytes()
+	if err == redis.Nil {
+		return nil, storage.EntityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return eventjson.UnmarshalAPIKey(data)
+}
+
+// FindAPIKeys возвращает ключи API арендатора по времени создания
+func (s *EventRedisStorage) FindAPIKeys(ctx context.Context) ([]entities.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ids, err := s.client.SMembers(ctx, s.apiKeySet(tenant.FromContext(ctx))).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := s.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGet(ctx, s.apiKeyPrefix+id, "data")
+	}
+	if _, err = pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	var ret []entities.APIKey
+	for _, cmd := range cmds {
+		data, err := cmd.Bytes()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := eventjson.UnmarshalAPIKey(data)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, *key)
+	}
+
+	storage.SortAPIKeys(ret)
+
+	return ret, nil
+}
+
+// RevokeAPIKey отмечает ключ API отозванным. Документ ключа читается и заменяется скриптом revokeAPIKeyScript,
+// который повторяется, если документ успели изменить между чтением и записью
+func (s *EventRedisStorage) RevokeAPIKey(ctx context.Context, id entities.APIKeyID, at time.Time) error {
+	owner := tenant.FromContext(ctx)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		fields, err := s.client.HMGet(ctx, s.apiKeyPrefix+id.String(), "data", "tenant").Result()
+		if err != nil {
+			return err
+		}
+
+		current, ok := fields[0].(string)
+		if keyOwner, _ := fields[1].(string); !ok || keyOwner != owner {
+			return storage.EntityNotFound
+		}
+
+		key, err := eventjson.UnmarshalAPIKey([]byte(current))
+		if err != nil {
+			return err
+		}
+		if key.IsRevoked() {
+			return nil
+		}
+
+		key.Revoked = at
+		data, err := eventjson.MarshalAPIKey(key)
+		if err != nil {
+			return err
+		}
+
+		status, err := revokeAPIKeyScript.Run(ctx, s.client, []string{s.apiKeyPrefix + id.String()}, data, owner, current).Text()
+		if err != nil {
+			return err
+		}
+		if err = statusError(status); err != errStale {
+			return err
+		}
+	}
+}
+
+// apiKeySet возвращает ключ множества идентификаторов ключей API арендатора
+func (s *EventRedisStorage) apiKeySet(owner string) string {
+	if owner == "" {
+		return s.apiKeys
+	}
+
+	return s.tenantPrefix + owner + ":apikeys"
+}
@@ -0,0 +1,189 @@
+package redisdb
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/storage/eventjson"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+)
+
+// putCalendarScript сохраняет документ календаря ARGV[2] арендатора ARGV[4] и добавляет его идентификатор ARGV[3]
+// в множество календарей арендатора. При создании (ARGV[1] = create) календарь не должен существовать, иначе возвращает exists,
+// при изменении - должен принадлежать тому же арендатору, иначе возвращает not_found
+var putCalendarScript = redis.NewScript(`
+local exists = redis.call('EXISTS', KEYS[1]) == 1
+if ARGV[1] == 'create' and exists then return 'exists' end
+if ARGV[1] == 'update' and not exists then return 'not_found' end
+if ARGV[1] == 'update' and (redis.call('HGET', KEYS[1], 'tenant') or '') ~= ARGV[4] then return 'not_found' end
+redis.call('HSET', KEYS[1], 'data', ARGV[2], 'tenant', ARGV[4])
+redis.call('SADD', KEYS[2], ARGV[3])
+return 'ok'
+`)
+
+// deleteCalendarScript удаляет календарь ARGV[1] арендатора ARGV[2], его индексы, счетчик ревизии и хеши событий
+// KEYS[6]..KEYS[n], прочитанные из индекса на ревизии ARGV[3]. Если события календаря с тех пор изменились, возвращает stale
+var deleteCalendarScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then return 'not_found' end
+if (redis.call('HGET', KEYS[1], 'tenant') or '') ~= ARGV[2] then return 'not_found' end
+if (redis.call('GET', KEYS[5]) or '0') ~= ARGV[3] then return 'stale' end
+for i = 6, #KEYS do
+	redis.call('DEL', KEYS[i])
+end
+redis.call('DEL', KEYS[1], KEYS[3], KEYS[4], KEYS[5])
+redis.call('SREM', KEYS[2], ARGV[1])
+return 'ok'
+`)
+
+// CreateCalendar сохраняет новый календарь
+func (s *EventRedisStorage) CreateCalendar(ctx context.Context, calendar *entities.Calendar) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	calendar.Tenant = tenant.FromContext(ctx)
+
+	return s.putCalendar(ctx, modeCreate, calendar)
+}
+
+func (s *EventRedisStorage) FindCalendarByID(ctx context.Context, id entities.CalendarID) (*entities.Calendar, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	fields, err := s.client.HMGet(ctx, s.calendarPrefix+id.String(), "data", "tenant").Result()
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := fields[0].(string)
+	if owner, _ := fields[1].(string); !ok || owner != tenant.FromContext(ctx) {
+		return nil, storage.EntityNotFound
+	}
+
+	return eventjson.UnmarshalCalendar([]byte(data))
+}
+
+// FindCalendars возвращает календари владельца, пустой owner - всех владельцев арендатора
+func (s *EventRedisStorage) FindCalendars(ctx context.Context, owner string) ([]entities.Calendar, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ids, err := s.client.SMembers(ctx, s.calendarSet(tenant.FromContext(ctx))).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := s.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGet(ctx, s.calendarPrefix+id, "data")
+	}
+	if _, err = pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	var ret []entities.Calendar
+	for _, cmd := range cmds {
+		data, err := cmd.Bytes()
+		// Календарь удален между чтением множества и документов
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		calendar, err := eventjson.UnmarshalCalendar(data)
+		if err != nil {
+			return nil, err
+		}
+
+		if owner == "" || calendar.Owner == owner {
+			ret = append(ret, *calendar)
+		}
+	}
+
+	storage.SortCalendars(ret)
+
+	return ret, nil
+}
+
+func (s *EventRedisStorage) UpdateCalendar(ctx context.Context, calendar *entities.Calendar) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	calendar.Tenant = tenant.FromContext(ctx)
+
+	return s.putCalendar(ctx, modeUpdate, calendar)
+}
+
+// DeleteCalendar удаляет календарь вместе с событиями одним скриптом. События читаются из индекса до запуска скрипта,
+// поэтому, если они изменились между этими шагами, удаление повторяется
+func (s *EventRedisStorage) DeleteCalendar(ctx context.Context, id entities.CalendarID) error {
+	owner := tenant.FromContext(ctx)
+
+	return retryStale(ctx, func() error {
+		revision, ids, err := s.calendarEvents(ctx, owner, id)
+		if err != nil {
+			return err
+		}
+
+		return s.deleteCalendar(ctx, owner, id, revision, ids)
+	})
+}
+
+// calendarEvents возвращает ревизию календаря и идентификаторы его событий, прочитанные в одной транзакции
+func (s *EventRedisStorage) calendarEvents(ctx context.Context, owner string, id entities.CalendarID) (string, []string, error) {
+	byStart, _, revisionKey := s.indexes(owner, calendarField(id))
+
+	pipe := s.client.TxPipeline()
+	revision := pipe.Get(ctx, revisionKey)
+	ids := pipe.ZRange(ctx, byStart, 0, -1)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return "", nil, err
+	}
+
+	// У календаря без изменений событий счетчика нет
+	if revision.Err() == redis.Nil {
+		return "0", ids.Val(), nil
+	}
+
+	return revision.Val(), ids.Val(), nil
+}
+
+// deleteCalendar удаляет календарь и события ids скриптом deleteCalendarScript, если ревизия календаря все еще revision
+func (s *EventRedisStorage) deleteCalendar(ctx context.Context, owner string, id entities.CalendarID, revision string, ids []string) error {
+	byStart, byEnd, revisionKey := s.indexes(owner, calendarField(id))
+	keys := []string{s.calendarPrefix + id.String(), s.calendarSet(owner), byStart, byEnd, revisionKey}
+	for _, event := range ids {
+		keys = append(keys, s.eventPrefix+event)
+	}
+
+	status, err := deleteCalendarScript.Run(ctx, s.client, keys, id.String(), owner, revision).Text()
+	if err != nil {
+		return err
+	}
+
+	return statusError(status)
+}
+
+// putCalendar сохраняет календарь скриптом putCalendarScript
+func (s *EventRedisStorage) putCalendar(ctx context.Context, mode string, calendar *entities.Calendar) error {
+	data, err := eventjson.MarshalCalendar(calendar)
+	if err != nil {
+		return err
+	}
+
+	id := calendar.ID.String()
+	keys := []string{s.calendarPrefix + id, s.calendarSet(calendar.Tenant)}
+	status, err := putCalendarScript.Run(ctx, s.client, keys, mode, data, id, calendar.Tenant).Text()
+	if err != nil {
+		return err
+	}
+
+	return statusError(status)
+}
@@ -0,0 +1,571 @@
+// Пакет реализует хранилище событий в Redis.
+package redisdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/storage/eventjson"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Режимы записи события скриптом putScript
+const (
+	modeCreate = "create"
+	modeUpdate = "update"
+)
+
+// maxAttempts наибольшее число попыток проверить пересечения и записать событие, пока события календаря меняются
+const maxAttempts = 16
+
+// errStale данные изменились между выборкой пересечений и записью, проверку нужно повторить
+var errStale = errors.New("redisdb: events changed concurrently")
+
+// findScript выбирает события, промежутки которых пересекаются с ARGV[1]..ARGV[2] (в секундах, включительно),
+// и возвращает номер ревизии календаря, а за ним идентификаторы событий.
+// Из двух индексов просматривается тот, в котором под условие попадает меньше событий:
+// начавшиеся до окончания диапазона или закончившиеся после его начала.
+// Скрипт читает только индексы и ревизию: хеши событий становятся известны из индекса и читаются после него
+// (см. findBySpan), а изменение между этими шагами обнаруживается по ревизии при записи
+var findScript = redis.NewScript(`
+local lo, hi = tonumber(ARGV[1]), tonumber(ARGV[2])
+local ids, index, match
+if redis.call('ZCOUNT', KEYS[1], '-inf', hi) <= redis.call('ZCOUNT', KEYS[2], lo, '+inf') then
+	ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', hi)
+	index, match = KEYS[2], function(score) return score >= lo end
+else
+	ids = redis.call('ZRANGEBYSCORE', KEYS[2], lo, '+inf')
+	index, match = KEYS[1], function(score) return score <= hi end
+end
+
+local ret = {redis.call('GET', KEYS[3]) or '0'}
+for _, id in ipairs(ids) do
+	if match(tonumber(redis.call('ZSCORE', index, id))) then
+		table.insert(ret, id)
+	end
+end
+return ret
+`)
+
+// putScript сохраняет событие календаря ARGV[12] арендатора ARGV[13] с версией ARGV[11] и обновляет индексы календаря.
+// При изменении событие должно принадлежать тому же календарю и арендатору, иначе возвращает not_found,
+// а сохраненная версия - совпадать с ARGV[10], иначе возвращает conflict. Если передана ревизия календаря (ARGV[3]),
+// а его события с тех пор изменились, возвращает stale; если передан признак пересечения (ARGV[4]), найденного на этой ревизии, возвращает busy
+var putScript = redis.NewScript(`
+local exists = redis.call('EXISTS', KEYS[1]) == 1
+if ARGV[1] == 'create' and exists then return 'exists' end
+if ARGV[1] == 'update' and not exists then return 'not_found' end
+if ARGV[1] == 'update' and (redis.call('HGET', KEYS[1], 'calendar') or '') ~= ARGV[12] then return 'not_found' end
+if ARGV[1] == 'update' and (redis.call('HGET', KEYS[1], 'tenant') or '') ~= ARGV[13] then return 'not_found' end
+if ARGV[1] == 'update' and (redis.call('HGET', KEYS[1], 'version') or '1') ~= ARGV[10] then return 'conflict' end
+if ARGV[3] ~= '' and (redis.call('GET', KEYS[4]) or '0') ~= ARGV[3] then return 'stale' end
+if ARGV[4] == '1' then return 'busy' end
+
+redis.call('HSET', KEYS[1], 'data', ARGV[5], 'start', ARGV[6], 'end', ARGV[7], 'version', ARGV[11], 'calendar', ARGV[12], 'tenant', ARGV[13])
+redis.call('ZADD', KEYS[2], ARGV[8], ARGV[2])
+redis.call('ZADD', KEYS[3], ARGV[9], ARGV[2])
+redis.call('INCR', KEYS[4])
+return 'ok'
+`)
+
+// splitScript изменяет серию ARGV[5] календаря ARGV[3] арендатора ARGV[4] и создает отделенную от нее серию ARGV[13]
+// в том же календаре. Проверки те же, что в putScript: изменяемая серия должна существовать в этом календаре
+// и иметь версию ARGV[11], создаваемой не должно быть, ревизия ARGV[1] не должна измениться, а признак
+// пересечения ARGV[2] - быть снят. Обе серии записываются только вместе
+var splitScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then return 'not_found' end
+if (redis.call('HGET', KEYS[1], 'calendar') or '') ~= ARGV[3] then return 'not_found' end
+if (redis.call('HGET', KEYS[1], 'tenant') or '') ~= ARGV[4] then return 'not_found' end
+if (redis.call('HGET', KEYS[1], 'version') or '1') ~= ARGV[11] then return 'conflict' end
+if redis.call('EXISTS', KEYS[2]) == 1 then return 'exists' end
+if (redis.call('GET', KEYS[5]) or '0') ~= ARGV[1] then return 'stale' end
+if ARGV[2] == '1' then return 'busy' end
+
+redis.call('HSET', KEYS[1], 'data', ARGV[6], 'start', ARGV[7], 'end', ARGV[8], 'version', ARGV[12], 'calendar', ARGV[3], 'tenant', ARGV[4])
+redis.call('ZADD', KEYS[3], ARGV[9], ARGV[5])
+redis.call('ZADD', KEYS[4], ARGV[10], ARGV[5])
+redis.call('HSET', KEYS[2], 'data', ARGV[14], 'start', ARGV[15], 'end', ARGV[16], 'version', ARGV[19], 'calendar', ARGV[3], 'tenant', ARGV[4])
+redis.call('ZADD', KEYS[3], ARGV[17], ARGV[13])
+redis.call('ZADD', KEYS[4], ARGV[18], ARGV[13])
+redis.call('INCR', KEYS[5])
+return 'ok'
+`)
+
+// deleteScript удаляет событие арендатора ARGV[3] вместе с записями в индексах. Если версия ARGV[2] не 0,
+// удаляет только событие этой версии, иначе возвращает conflict
+var deleteScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then return 'not_found' end
+if (redis.call('HGET', KEYS[1], 'tenant') or '') ~= ARGV[3] then return 'not_found' end
+if ARGV[2] ~= '0' and (redis.call('HGET', KEYS[1], 'version') or '1') ~= ARGV[2] then return 'conflict' end
+redis.call('DEL', KEYS[1])
+redis.call('ZREM', KEYS[2], ARGV[1])
+redis.call('ZREM', KEYS[3], ARGV[1])
+redis.call('INCR', KEYS[4])
+return 'ok'
+`)
+
+// EventRedisStorage хранилище событий в Redis
+//
+// Событие хранится в хеше <prefix>:event:<id> (документ, версия, календарь, арендатор и точные границы промежутка),
+// а его промежуток - в двух отсортированных множествах календаря по началу и окончанию в секундах. Индексы календаря
+// по умолчанию называются так же, как до появления календарей, остальных - <prefix>:calendar:<id>:events:by_start
+// и by_end. Календарь хранится в хеше <prefix>:calendar:<id>, идентификаторы календарей - в множестве
+// <prefix>:calendars. Так называются ключи арендатора по умолчанию, у остальных арендаторов индексы и множество
+// календарей лежат под <prefix>:tenant:<tenant>, а чужие хеши событий и календарей считаются не найденными.
+// Ключ API хранится в хеше <prefix>:apikey:<id>, его идентификатор - под хэшем ключа в <prefix>:apikey_hash:<hash>
+// и в множестве ключей арендатора <prefix>:apikeys (у остальных арендаторов - под <prefix>:tenant:<tenant>).
+// Каждое изменение событий календаря увеличивает счетчик ревизии календаря, лежащий рядом с его индексами (revision):
+// CreateIfFree, UpdateIfFree и SplitIfFree проверяют пересечения на прочитанной ревизии и записывают событие, только если
+// она не изменилась, иначе повторяют проверку, но не больше maxAttempts раз. Записи в разные календари друг другу
+// не мешают. Скрипты обращаются только к ключам, переданным в KEYS. Префикс заключается в фигурные скобки,
+// чтобы в Redis Cluster все ключи хранилища попадали в один слот и скрипт мог менять хеш события вместе с индексами
+type EventRedisStorage struct {
+	client *redis.Client
+
+	eventPrefix    string // Префикс ключей хешей событий
+	byStart        string // Индекс календаря по умолчанию по началу промежутка
+	byEnd          string // Индекс календаря по умолчанию по окончанию промежутка
+	revision       string // Счетчик изменений календаря по умолчанию
+	calendarPrefix string // Префикс ключей хешей и индексов календарей
+	calendars      string // Множество идентификаторов календарей арендатора по умолчанию
+	tenantPrefix   string // Префикс ключей индексов и множеств календарей остальных арендаторов
+	apiKeyPrefix   string // Префикс ключей хешей ключей API
+	apiKeyHash     string // Префикс ключей идентификаторов ключей API по хэшу
+	apiKeys        string // Множество идентификаторов ключей API арендатора по умолчанию
+}
+
+// NewEventRedisStorage подключается к Redis по адресу url (redis://[:password@]host:port/db)
+// и хранит события под ключами с префиксом prefix
+func NewEventRedisStorage(ctx context.Context, url string, prefix string) (*EventRedisStorage, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(opts)
+	if err = client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	prefix = "{" + prefix + "}"
+
+	return &EventRedisStorage{
+		client:         client,
+		eventPrefix:    prefix + ":event:",
+		byStart:        prefix + ":events:by_start",
+		byEnd:          prefix + ":events:by_end",
+		revision:       prefix + ":events:revision",
+		calendarPrefix: prefix + ":calendar:",
+		calendars:      prefix + ":calendars",
+		tenantPrefix:   prefix + ":tenant:",
+		apiKeyPrefix:   prefix + ":apikey:",
+		apiKeyHash:     prefix + ":apikey_hash:",
+		apiKeys:        prefix + ":apikeys",
+	}, nil
+}
+
+// Close закрывает подключения к Redis
+func (s *EventRedisStorage) Close() error {
+	return s.client.Close()
+}
+
+// Ping проверяет доступность Redis
+func (s *EventRedisStorage) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+func (s *EventRedisStorage) Create(ctx context.Context, event *entities.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	event.Tenant = tenant.FromContext(ctx)
+
+	return s.put(ctx, modeCreate, event, "", false)
+}
+
+// CreateIfFree создает событие, если оно не пересекается с сохраненными
+func (s *EventRedisStorage) CreateIfFree(ctx context.Context, event *entities.Event) error {
+	return s.putIfFree(ctx, modeCreate, event)
+}
+
+func (s *EventRedisStorage) Update(ctx context.Context, event *entities.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	event.Tenant = tenant.FromContext(ctx)
+
+	return s.put(ctx, modeUpdate, event, "", false)
+}
+
+// UpdateIfFree изменяет событие, если оно не пересекается с другими сохраненными
+func (s *EventRedisStorage) UpdateIfFree(ctx context.Context, event *entities.Event) error {
+	return s.putIfFree(ctx, modeUpdate, event)
+}
+
+// SplitIfFree изменяет серию head и создает отделенную от нее серию tail, если tail не пересекается с другими событиями
+func (s *EventRedisStorage) SplitIfFree(ctx context.Context, head, tail *entities.Event) error {
+	head.Tenant = tenant.FromContext(ctx)
+	tail.Tenant = head.Tenant
+	tail.CalendarID = head.CalendarID
+	start, end := tail.Bounds()
+
+	return retryStale(ctx, func() error {
+		revision, candidates, err := s.findBySpan(ctx, tail.Tenant, tail.CalendarID, start, end)
+		if err != nil {
+			return err
+		}
+
+		return s.split(ctx, head, tail, revision, storage.HasSplitConflict(head, tail, candidates))
+	})
+}
+
+// FindBySpan возвращает все события календаря, лежащие в указанном временном диапазоне start..end
+func (s *EventRedisStorage) FindBySpan(ctx context.Context, calendar entities.CalendarID, start time.Time, end time.Time) ([]entities.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	_, events, err := s.findBySpan(ctx, tenant.FromContext(ctx), calendar, start, end)
+
+	return events, err
+}
+
+// FindPage возвращает страницу событий, пересекающихся с промежутком запроса, в порядке запроса.
+// Индексы не хранят идентификатор рядом с границей, поэтому страница вырезается из всей выборки по промежутку
+func (s *EventRedisStorage) FindPage(ctx context.Context, q storage.SpanQuery) ([]entities.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	_, events, err := s.findBySpan(ctx, tenant.FromContext(ctx), q.Calendar, q.Start, q.End)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.Page(events, q), nil
+}
+
+func (s *EventRedisStorage) FindByID(ctx context.Context, id entities.EventID) (*entities.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	fields, err := s.client.HMGet(ctx, s.eventPrefix+id.String(), "data", "tenant").Result()
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := fields[0].(string)
+	if owner, _ := fields[1].(string); !ok || owner != tenant.FromContext(ctx) {
+		return nil, storage.EntityNotFound
+	}
+
+	return eventjson.Unmarshal([]byte(data))
+}
+
+func (s *EventRedisStorage) DeleteByID(ctx context.Context, id *entities.EventID, version int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Календарь события не меняется, поэтому его индексы можно узнать до удаления.
+	// Событие другого арендатора скрипт не удаляет, поэтому его индексы не важны
+	calendar, err := s.client.HGet(ctx, s.eventPrefix+id.String(), "calendar").Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	owner := tenant.FromContext(ctx)
+	byStart, byEnd, revision := s.indexes(owner, calendar)
+	keys := []string{s.eventPrefix + id.String(), byStart, byEnd, revision}
+	status, err := deleteScript.Run(ctx, s.client, keys, id.String(), version, owner).Text()
+	if err != nil {
+		return err
+	}
+
+	return statusError(status)
+}
+
+// putIfFree проверяет пересечения и записывает событие, повторяя попытку, если события календаря изменились между этими шагами
+func (s *EventRedisStorage) putIfFree(ctx context.Context, mode string, event *entities.Event) error {
+	event.Tenant = tenant.FromContext(ctx)
+	start, end := event.Bounds()
+
+	return retryStale(ctx, func() error {
+		revision, candidates, err := s.findBySpan(ctx, event.Tenant, event.CalendarID, start, end)
+		if err != nil {
+			return err
+		}
+
+		return s.put(ctx, mode, event, revision, storage.HasConflict(event, candidates))
+	})
+}
+
+// retryStale выполняет attempt, пока она возвращает errStale, но не больше maxAttempts раз.
+// Если данные менялись при каждой попытке, возвращает storage.EntitySpanLocked
+func retryStale(ctx context.Context, attempt func() error) error {
+	for i := 0; i < maxAttempts; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := attempt(); err != errStale {
+			return err
+		}
+	}
+
+	return storage.EntitySpanLocked
+}
+
+// put сохраняет событие скриптом putScript и записывает в него сохраненную версию
+func (s *EventRedisStorage) put(ctx context.Context, mode string, event *entities.Event, revision string, busy bool) error {
+	// Документ сохраняется сразу с новой версией: при создании первой, если она не задана, при изменении следующей
+	stored := *event
+	expected := ""
+	if mode == modeUpdate {
+		expected = strconv.FormatInt(event.Version, 10)
+		stored.Version++
+	} else if stored.Version < 1 {
+		stored.Version = 1
+	}
+
+	data, err := eventjson.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+
+	id := event.ID.String()
+	start, end := event.Bounds()
+	busyFlag := "0"
+	if busy {
+		busyFlag = "1"
+	}
+
+	calendar := calendarField(event.CalendarID)
+	byStart, byEnd, revisionKey := s.indexes(event.Tenant, calendar)
+	keys := []string{s.eventPrefix + id, byStart, byEnd, revisionKey}
+	status, err := putScript.Run(ctx, s.client, keys,
+		mode, id, revision, busyFlag, data,
+		formatBound(start), formatBound(end), score(start), score(end),
+		expected, stored.Version, calendar, event.Tenant,
+	).Text()
+	if err != nil {
+		return err
+	}
+
+	if err = statusError(status); err != nil {
+		return err
+	}
+
+	event.Version = stored.Version
+
+	return nil
+}
+
+// split сохраняет обе серии скриптом splitScript и записывает в них сохраненные версии
+func (s *EventRedisStorage) split(ctx context.Context, head, tail *entities.Event, revision string, busy bool) error {
+	updated, created := *head, *tail
+	updated.Version++
+	if created.Version < 1 {
+		created.Version = 1
+	}
+
+	headData, err := eventjson.Marshal(&updated)
+	if err != nil {
+		return err
+	}
+	tailData, err := eventjson.Marshal(&created)
+	if err != nil {
+		return err
+	}
+
+	busyFlag := "0"
+	if busy {
+		busyFlag = "1"
+	}
+
+	headStart, headEnd := head.Bounds()
+	tailStart, tailEnd := tail.Bounds()
+	calendar := calendarField(head.CalendarID)
+	byStart, byEnd, revisionKey := s.indexes(head.Tenant, calendar)
+	keys := []string{s.eventPrefix + head.ID.String(), s.eventPrefix + tail.ID.String(), byStart, byEnd, revisionKey}
+	status, err := splitScript.Run(ctx, s.client, keys,
+		revision, busyFlag, calendar, head.Tenant,
+		head.ID.String(), headData, formatBound(headStart), formatBound(headEnd), score(headStart), score(headEnd),
+		strconv.FormatInt(head.Version, 10), updated.Version,
+		tail.ID.String(), tailData, formatBound(tailStart), formatBound(tailEnd), score(tailStart), score(tailEnd),
+		created.Version,
+	).Text()
+	if err != nil {
+		return err
+	}
+
+	if err = statusError(status); err != nil {
+		return err
+	}
+
+	head.Version, tail.Version = updated.Version, created.Version
+
+	return nil
+}
+
+// findBySpan выбирает события календаря арендатора owner, пересекающиеся с промежутком start..end, в порядке их начала,
+// и возвращает ревизию календаря, на которой сделана выборка. Индексы и ревизия читаются скриптом, хеши найденных
+// событий - следом одним конвейером; событие, удаленное между этими шагами, пропускается.
+// Индексы хранят время с точностью до секунды, поэтому выборка скрипта уточняется по точным границам
+func (s *EventRedisStorage) findBySpan(ctx context.Context, owner string, calendar entities.CalendarID, start time.Time, end time.Time) (string, []entities.Event, error) {
+	byStart, byEnd, revisionKey := s.indexes(owner, calendarField(calendar))
+	keys := []string{byStart, byEnd, revisionKey}
+	reply, err := findScript.Run(ctx, s.client, keys, score(start), score(end)).StringSlice()
+	if err != nil {
+		return "", nil, err
+	}
+
+	revision, ids := reply[0], reply[1:]
+	if len(ids) == 0 {
+		return revision, nil, nil
+	}
+
+	pipe := s.client.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HMGet(ctx, s.eventPrefix+id, "data", "start", "end")
+	}
+	if _, err = pipe.Exec(ctx); err != nil {
+		return "", nil, err
+	}
+
+	type found struct {
+		event entities.Event
+		start time.Time
+	}
+	var items []found
+
+	for _, cmd := range cmds {
+		fields := cmd.Val()
+		data, ok := fields[0].(string)
+		if !ok {
+			continue
+		}
+
+		eventStart, err := parseBound(fields[1])
+		if err != nil {
+			return "", nil, err
+		}
+		eventEnd, err := parseBound(fields[2])
+		if err != nil {
+			return "", nil, err
+		}
+
+		// Касание границами пересечением не считается
+		if !eventStart.Before(end) || !eventEnd.After(start) {
+			continue
+		}
+
+		event, err := eventjson.Unmarshal([]byte(data))
+		if err != nil {
+			return "", nil, err
+		}
+
+		items = append(items, found{event: *event, start: eventStart})
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].start.Before(items[j].start)
+	})
+
+	var ret []entities.Event
+	for _, item := range items {
+		ret = append(ret, item.event)
+	}
+
+	return revision, ret, nil
+}
+
+// indexes возвращает ключи индексов и счетчика ревизии календаря по значениям полей tenant и calendar в хеше события
+func (s *EventRedisStorage) indexes(owner, calendar string) (byStart, byEnd, revision string) {
+	var prefix string
+	switch {
+	case owner == "" && calendar == "":
+		return s.byStart, s.byEnd, s.revision
+	case owner == "":
+		prefix = s.calendarPrefix + calendar + ":events:"
+	case calendar == "":
+		prefix = s.tenantPrefix + owner + ":events:"
+	default:
+		prefix = s.tenantPrefix + owner + ":calendar:" + calendar + ":events:"
+	}
+
+	return prefix + "by_start", prefix + "by_end", prefix + "revision"
+}
+
+// calendarSet возвращает ключ множества идентификаторов календарей арендатора
+func (s *EventRedisStorage) calendarSet(owner string) string {
+	if owner == "" {
+		return s.calendars
+	}
+
+	return s.tenantPrefix + owner + ":calendars"
+}
+
+// calendarField значение поля calendar хеша события: пустое для календаря по умолчанию,
+// как у событий, сохраненных до появления календарей
+func calendarField(calendar entities.CalendarID) string {
+	if calendar.IsDefault() {
+		return ""
+	}
+
+	return calendar.String()
+}
+
+// statusError переводит ответ скрипта в ошибку хранилища
+func statusError(status string) error {
+	switch status {
+	case "ok":
+		return nil
+	case "exists":
+		return storage.EntityAlreadyExists
+	case "not_found":
+		return storage.EntityNotFound
+	case "busy":
+		return storage.EntitySpanBusy
+	case "conflict":
+		return storage.EntityVersionConflict
+	case "stale":
+		return errStale
+	default:
+		return fmt.Errorf("redisdb: unexpected script reply %q", status)
+	}
+}
+
+// score вес промежутка в индексе: секунды Unix, округленные вниз
+// Секунды до 9999 года точно представимы в double, которым Redis хранит вес
+func score(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// formatBound сериализует точную границу промежутка
+func formatBound(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// parseBound разбирает точную границу промежутка из хеша события
+func parseBound(v interface{}) (time.Time, error) {
+	s, _ := v.(string)
+
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("redisdb: invalid span bound %q: %v", s, err)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,229 @@
+package redisdb
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/storage/storagetest"
+	"os"
+	"testing"
+	"time"
+)
+
+// testURL возвращает адрес Redis из CALENDAR_TEST_REDIS_URL, а если он не задан - запускает для теста miniredis
+func testURL(t *testing.T) string {
+	if url := os.Getenv("CALENDAR_TEST_REDIS_URL"); url != "" {
+		return url
+	}
+
+	m, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.Close)
+
+	return "redis://" + m.Addr()
+}
+
+// newTestStorage создает хранилище в пустой базе Redis (база по адресу из CALENDAR_TEST_REDIS_URL очищается)
+func newTestStorage(t *testing.T, url string, prefix string) *EventRedisStorage {
+	s, err := NewEventRedisStorage(context.Background(), url, prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	if err = s.client.FlushDB(context.Background()).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// newEvent возвращает одиночное событие длительностью d, начинающееся в start
+func newEvent(title string, start time.Time, d time.Duration) entities.Event {
+	id, _ := entities.NewEventID("")
+
+	return entities.Event{ID: id, Title: title, Start: start, End: start.Add(d)}
+}
+
+// TestEventRedisStorage_Conformance проверяет хранилище общим набором тестов
+func TestEventRedisStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) usecases.Storage {
+		return newTestStorage(t, testURL(t), "calendar")
+	})
+}
+
+// TestEventRedisStorage_FindBySpan проверяет выборку по обоим индексам и уточнение по точным границам
+func TestEventRedisStorage_FindBySpan(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, testURL(t), "calendar")
+	base := time.Date(2020, 5, 12, 10, 0, 0, 0, time.UTC)
+
+	// Выборка самого раннего промежутка идет по индексу начала, самого позднего - по индексу окончания
+	var past, future []entities.Event
+	for i := 1; i <= 5; i++ {
+		past = append(past, newEvent("Прошедшее", base.AddDate(0, 0, -i), time.Hour))
+	}
+	future = append(future, newEvent("Будущее", base.AddDate(0, 0, 1), time.Hour))
+	// Граница в середине секунды: индекс ее не различает
+	touching := newEvent("Вплотную", base.Add(-time.Hour+500*time.Millisecond), time.Hour-500*time.Millisecond)
+
+	for _, events := range [][]entities.Event{past, future, {touching}} {
+		for i := range events {
+			if err := s.Create(ctx, &events[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name       string
+		start, end time.Time
+		want       []entities.EventID
+	}{
+		{"past", base.AddDate(0, 0, -5), base.AddDate(0, 0, -5).Add(time.Minute), []entities.EventID{past[4].ID}},
+		{"future", base.AddDate(0, 0, 1), base.AddDate(0, 0, 2), []entities.EventID{future[0].ID}},
+		{"touching", base, base.Add(time.Hour), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := s.FindBySpan(ctx, entities.DefaultCalendarID, tt.start, tt.end)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(found) != len(tt.want) {
+				t.Fatalf("got %d events, want %d", len(found), len(tt.want))
+			}
+			for i := range found {
+				if !found[i].ID.Equal(tt.want[i]) {
+					t.Errorf("event %d: got %s, want %s", i, found[i].ID, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestEventRedisStorage_Prefix проверяет, что хранилища с разными префиксами в одной базе не видят событий друг друга
+func TestEventRedisStorage_Prefix(t *testing.T) {
+	ctx := context.Background()
+	url := testURL(t)
+	first := newTestStorage(t, url, "first")
+
+	second, err := NewEventRedisStorage(ctx, url, "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	start := time.Date(2020, 5, 12, 10, 0, 0, 0, time.UTC)
+	event := newEvent("Событие", start, time.Hour)
+	if err = first.Create(ctx, &event); err != nil {
+		t.Fatal(err)
+	}
+
+	// То же время в другом хранилище свободно
+	if err = second.CreateIfFree(ctx, &event); err != nil {
+		t.Fatal(err)
+	}
+	if err = second.DeleteByID(ctx, &event.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = first.FindByID(ctx, event.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestEventRedisStorage_CalendarRevision проверяет, что запись в календарь меняет только его ревизию
+func TestEventRedisStorage_CalendarRevision(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, testURL(t), "calendar")
+
+	calendar, _ := entities.NewCalendarID("")
+	event := newEvent("Событие", time.Date(2020, 5, 12, 10, 0, 0, 0, time.UTC), time.Hour)
+	event.CalendarID = calendar
+	if err := s.CreateIfFree(ctx, &event); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, revision := s.indexes("", calendarField(calendar))
+	if n, err := s.client.Get(ctx, revision).Int(); err != nil || n != 1 {
+		t.Fatalf("expected calendar revision 1, got %d, %v", n, err)
+	}
+	if n, err := s.client.Exists(ctx, s.revision).Result(); err != nil || n != 0 {
+		t.Fatalf("default calendar revision must not change, got %d, %v", n, err)
+	}
+}
+
+// TestEventRedisStorage_DeleteCalendarStale проверяет, что календарь не удаляется по устаревшему списку событий:
+// событие, созданное после чтения индекса, осталось бы без календаря
+func TestEventRedisStorage_DeleteCalendarStale(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, testURL(t), "calendar")
+
+	calendar := entities.Calendar{Name: "Работа"}
+	calendar.ID, _ = entities.NewCalendarID("")
+	if err := s.CreateCalendar(ctx, &calendar); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2020, 5, 12, 10, 0, 0, 0, time.UTC)
+	first := newEvent("Первое", start, time.Hour)
+	first.CalendarID = calendar.ID
+	if err := s.CreateIfFree(ctx, &first); err != nil {
+		t.Fatal(err)
+	}
+
+	revision, ids, err := s.calendarEvents(ctx, "", calendar.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second := newEvent("Второе", start.Add(time.Hour), time.Hour)
+	second.CalendarID = calendar.ID
+	if err = s.CreateIfFree(ctx, &second); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.deleteCalendar(ctx, "", calendar.ID, revision, ids); err != errStale {
+		t.Fatalf("expected errStale, got %v", err)
+	}
+
+	if err = s.DeleteCalendar(ctx, calendar.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []entities.EventID{first.ID, second.ID} {
+		if _, err = s.FindByID(ctx, id); err != storage.EntityNotFound {
+			t.Fatalf("event %s: expected EntityNotFound, got %v", id, err)
+		}
+	}
+}
+
+// TestRetryStale проверяет, что попытки при постоянно меняющихся данных ограничены
+func TestRetryStale(t *testing.T) {
+	attempts := 0
+	err := retryStale(context.Background(), func() error {
+		attempts++
+		return errStale
+	})
+	if err != storage.EntitySpanLocked || attempts != maxAttempts {
+		t.Fatalf("expected EntitySpanLocked after %d attempts, got %v after %d", maxAttempts, err, attempts)
+	}
+
+	attempts = 0
+	err = retryStale(context.Background(), func() error {
+		attempts++
+		if attempts < 3 {
+			return errStale
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Fatalf("expected success on attempt 3, got %v after %d", err, attempts)
+	}
+}
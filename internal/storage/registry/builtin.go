@@ -0,0 +1,156 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/lib/pq"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"github.com/mzelenkin/go-calendar/internal/storage/boltdb"
+	"github.com/mzelenkin/go-calendar/internal/storage/inmemory"
+	"github.com/mzelenkin/go-calendar/internal/storage/migrate"
+	"github.com/mzelenkin/go-calendar/internal/storage/postgres"
+	"github.com/mzelenkin/go-calendar/internal/storage/redisdb"
+	"github.com/mzelenkin/go-calendar/internal/storage/sqlite"
+	"io"
+)
+
+// Builtin возвращает набор со всеми драйверами из этого репозитория
+//
+// Драйверы перечислены здесь, а не регистрируются из init() своих пакетов: тесты пакета usecases используют
+// хранилище в памяти, и импорт registry (а с ним usecases) из пакета хранилища образовал бы цикл
+func Builtin() *Registry {
+	r := New()
+	r.Register("memory", Driver{Validate: validateMemory, Open: openMemory})
+	r.Register("sqlite", Driver{
+		Validate:      validateSQLite,
+		Open:          openSQLite,
+		Migrator:      sqliteMigrator,
+		MigrationsDir: "internal/storage/sqlite/migrations",
+	})
+	r.Register("bolt", Driver{Validate: validateBolt, Open: openBolt})
+	r.Register("redis", Driver{Validate: validateRedis, Open: openRedis})
+	r.Register("postgres", Driver{
+		Validate:      validatePostgres,
+		Open:          openPostgres,
+		Migrator:      postgresMigrator,
+		MigrationsDir: "internal/storage/postgres/migrations",
+	})
+
+	return r
+}
+
+// persistence переводит настройки хранилища в памяти в настройки его сохранения на диск
+func persistence(cfg MemoryConfig) inmemory.Persistence {
+	return inmemory.Persistence{
+		Dir:           cfg.Dir,
+		Sync:          inmemory.SyncPolicy(cfg.Fsync),
+		SyncInterval:  cfg.FsyncInterval,
+		SnapshotEvery: cfg.SnapshotEvery,
+	}
+}
+
+func validateMemory(cfg Config) error {
+	// Без каталога журнала хранилище не сохраняется на диск и остальные настройки не используются
+	if cfg.Memory.Dir == "" {
+		return nil
+	}
+
+	return persistence(cfg.Memory).Validate()
+}
+
+func openMemory(_ context.Context, cfg Config) (usecases.Storage, error) {
+	if cfg.Memory.Dir == "" {
+		return inmemory.NewEventInMemoryStorage()
+	}
+
+	return inmemory.NewDurableEventInMemoryStorage(persistence(cfg.Memory))
+}
+
+func validateSQLite(cfg Config) error {
+	if cfg.SQLite.Path == "" {
+		return errors.New("path is required")
+	}
+
+	return nil
+}
+
+func openSQLite(ctx context.Context, cfg Config) (usecases.Storage, error) {
+	return sqlite.NewEventSQLiteStorage(ctx, cfg.SQLite.Path)
+}
+
+func sqliteMigrator(_ context.Context, cfg Config) (*migrate.Migrator, io.Closer, error) {
+	db, err := sqlite.OpenDB(cfg.SQLite.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m, err := sqlite.NewMigrator(db)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	return m, db, nil
+}
+
+func validateBolt(cfg Config) error {
+	if cfg.Bolt.Path == "" {
+		return errors.New("path is required")
+	}
+
+	return nil
+}
+
+func openBolt(_ context.Context, cfg Config) (usecases.Storage, error) {
+	return boltdb.NewEventBoltStorage(cfg.Bolt.Path)
+}
+
+func validateRedis(cfg Config) error {
+	if cfg.Redis.Prefix == "" {
+		return errors.New("prefix is required")
+	}
+
+	if _, err := redis.ParseURL(cfg.Redis.URL); err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+
+	return nil
+}
+
+func openRedis(ctx context.Context, cfg Config) (usecases.Storage, error) {
+	return redisdb.NewEventRedisStorage(ctx, cfg.Redis.URL, cfg.Redis.Prefix)
+}
+
+func validatePostgres(cfg Config) error {
+	if cfg.Postgres.DSN == "" {
+		return errors.New("dsn is required")
+	}
+
+	// Строка подключения разбирается без подключения к базе
+	if _, err := pq.NewConnector(cfg.Postgres.DSN); err != nil {
+		return fmt.Errorf("invalid dsn: %w", err)
+	}
+
+	return nil
+}
+
+func openPostgres(ctx context.Context, cfg Config) (usecases.Storage, error) {
+	return postgres.NewEventPostgresStorage(ctx, cfg.Postgres.DSN)
+}
+
+func postgresMigrator(ctx context.Context, cfg Config) (*migrate.Migrator, io.Closer, error) {
+	db, err := postgres.OpenDB(ctx, cfg.Postgres.DSN)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m, err := postgres.NewMigrator(db)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	return m, db, nil
+}
@@ -0,0 +1,204 @@
+// Пакет выбирает и создает хранилище событий по настройкам из раздела storage конфигурации.
+package registry
+
+import (
+	"context"
+	"fmt"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"github.com/mzelenkin/go-calendar/internal/storage/migrate"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Config настройки раздела storage. Каждый драйвер читает только свой подраздел
+type Config struct {
+	Driver string // Имя драйвера
+	// ConnectTimeout ограничивает подключение к хранилищу и проверку его доступности при запуске
+	ConnectTimeout time.Duration
+
+	Memory   MemoryConfig
+	SQLite   SQLiteConfig
+	Bolt     BoltConfig
+	Redis    RedisConfig
+	Postgres PostgresConfig
+}
+
+// MemoryConfig настройки хранилища в памяти
+type MemoryConfig struct {
+	Dir           string // Каталог журнала и снимков, пустой - без сохранения на диск
+	Fsync         string
+	FsyncInterval time.Duration
+	SnapshotEvery int
+}
+
+// SQLiteConfig настройки хранилища SQLite
+type SQLiteConfig struct {
+	Path string
+}
+
+// BoltConfig настройки хранилища bbolt
+type BoltConfig struct {
+	Path string
+}
+
+// RedisConfig настройки хранилища Redis
+type RedisConfig struct {
+	URL    string
+	Prefix string
+}
+
+// PostgresConfig настройки хранилища PostgreSQL
+type PostgresConfig struct {
+	DSN string
+}
+
+// Driver способ создания хранилища одного типа
+type Driver struct {
+	// Validate проверяет настройки драйвера (формат DSN, путь), не подключаясь к хранилищу
+	Validate func(cfg Config) error
+	// Open создает хранилище и подключается к нему
+	Open func(ctx context.Context, cfg Config) (usecases.Storage, error)
+
+	// Migrator подключается к базе, не применяя миграции, и возвращает Migrator ее встроенных миграций
+	// вместе с подключением, которое нужно закрыть. Есть только у SQL-хранилищ
+	Migrator func(ctx context.Context, cfg Config) (*migrate.Migrator, io.Closer, error)
+	// MigrationsDir каталог исходных файлов миграций относительно корня репозитория
+	MigrationsDir string
+}
+
+// Pinger хранилище, доступность которого можно проверить (сетевые и SQL базы)
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Registry набор драйверов хранилищ по именам
+type Registry struct {
+	drivers map[string]Driver
+}
+
+// New создает пустой набор драйверов, встроенные драйверы возвращает Builtin
+func New() *Registry {
+	return &Registry{drivers: map[string]Driver{}}
+}
+
+// Register добавляет драйвер. Повторная регистрация имени - ошибка программиста, поэтому вызывает панику
+func (r *Registry) Register(name string, driver Driver) {
+	if _, ok := r.drivers[name]; ok {
+		panic(fmt.Sprintf("registry: driver %q is already registered", name))
+	}
+
+	r.drivers[name] = driver
+}
+
+// Names возвращает имена зарегистрированных драйверов по алфавиту
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.drivers))
+	for name := range r.drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Validate проверяет, что драйвер из настроек зарегистрирован и его настройки корректны
+func (r *Registry) Validate(cfg Config) error {
+	driver, ok := r.drivers[cfg.Driver]
+	if !ok {
+		return fmt.Errorf("unknown storage.driver %q, expected one of: %s", cfg.Driver, strings.Join(r.Names(), ", "))
+	}
+
+	if driver.Validate == nil {
+		return nil
+	}
+
+	if err := driver.Validate(cfg); err != nil {
+		return fmt.Errorf("storage.%s: %w", cfg.Driver, err)
+	}
+
+	return nil
+}
+
+// Open проверяет настройки, создает хранилище выбранного драйвера и проверяет его доступность.
+// Подключение и проверка ограничены cfg.ConnectTimeout. Хранилище с ресурсами реализует io.Closer
+func (r *Registry) Open(ctx context.Context, cfg Config) (usecases.Storage, error) {
+	if err := r.Validate(cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.ConnectTimeout)
+		defer cancel()
+	}
+
+	s, err := r.drivers[cfg.Driver].Open(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("storage.%s: open: %w", cfg.Driver, err)
+	}
+
+	if p, ok := s.(Pinger); ok {
+		if err = p.Ping(ctx); err != nil {
+			Close(s)
+			return nil, fmt.Errorf("storage.%s: health check: %w", cfg.Driver, err)
+		}
+	}
+
+	return s, nil
+}
+
+// Migrator возвращает Migrator выбранного в настройках SQL-хранилища и подключение к базе, которое нужно закрыть
+func (r *Registry) Migrator(ctx context.Context, cfg Config) (*migrate.Migrator, io.Closer, error) {
+	driver, err := r.migrationDriver(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cfg.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.ConnectTimeout)
+		defer cancel()
+	}
+
+	m, closer, err := driver.Migrator(ctx, cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("storage.%s: open: %w", cfg.Driver, err)
+	}
+
+	return m, closer, nil
+}
+
+// MigrationsDir возвращает каталог исходных файлов миграций выбранного в настройках SQL-хранилища
+func (r *Registry) MigrationsDir(cfg Config) (string, error) {
+	driver, err := r.migrationDriver(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	return driver.MigrationsDir, nil
+}
+
+// migrationDriver проверяет настройки и возвращает драйвер, если у хранилища есть миграции
+func (r *Registry) migrationDriver(cfg Config) (Driver, error) {
+	if err := r.Validate(cfg); err != nil {
+		return Driver{}, err
+	}
+
+	driver := r.drivers[cfg.Driver]
+	if driver.Migrator == nil {
+		return Driver{}, fmt.Errorf("storage.driver %q has no schema migrations", cfg.Driver)
+	}
+
+	return driver, nil
+}
+
+// Close освобождает ресурсы хранилища, если они у него есть
+func Close(s usecases.Storage) error {
+	if c, ok := s.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
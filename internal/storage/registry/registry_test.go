@@ -0,0 +1,123 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"github.com/mzelenkin/go-calendar/internal/storage/inmemory"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validConfig возвращает настройки, корректные для всех встроенных драйверов
+func validConfig(t *testing.T, driver string) Config {
+	dir := t.TempDir()
+
+	return Config{
+		Driver:         driver,
+		ConnectTimeout: time.Second,
+		Memory:         MemoryConfig{Fsync: "always"},
+		SQLite:         SQLiteConfig{Path: filepath.Join(dir, "calendar.db")},
+		Bolt:           BoltConfig{Path: filepath.Join(dir, "calendar.bolt")},
+		Redis:          RedisConfig{URL: "redis://localhost:6379/0", Prefix: "calendar"},
+		Postgres:       PostgresConfig{DSN: "postgres://localhost:5432/calendar?sslmode=disable"},
+	}
+}
+
+// TestRegistry_Validate проверяет разбор настроек встроенных драйверов без подключения
+func TestRegistry_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		driver string
+		modify func(cfg *Config)
+		err    string
+	}{
+		{"memory", "memory", nil, ""},
+		{"memory durable", "memory", func(cfg *Config) { cfg.Memory.Dir = "runtime/memory" }, ""},
+		{"memory sync policy", "memory", func(cfg *Config) { cfg.Memory.Dir, cfg.Memory.Fsync = "runtime/memory", "sometimes" }, "sync policy"},
+		{"sqlite", "sqlite", nil, ""},
+		{"sqlite path", "sqlite", func(cfg *Config) { cfg.SQLite.Path = "" }, "path is required"},
+		{"bolt path", "bolt", func(cfg *Config) { cfg.Bolt.Path = "" }, "path is required"},
+		{"redis", "redis", nil, ""},
+		{"redis url", "redis", func(cfg *Config) { cfg.Redis.URL = "http://localhost" }, "invalid url"},
+		{"redis prefix", "redis", func(cfg *Config) { cfg.Redis.Prefix = "" }, "prefix is required"},
+		{"postgres url", "postgres", nil, ""},
+		{"postgres key=value", "postgres", func(cfg *Config) { cfg.Postgres.DSN = "host=localhost dbname=calendar" }, ""},
+		{"postgres dsn", "postgres", func(cfg *Config) { cfg.Postgres.DSN = "localhost" }, "invalid dsn"},
+		{"unknown", "mongo", nil, "expected one of: bolt, memory, postgres, redis, sqlite"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig(t, tt.driver)
+			if tt.modify != nil {
+				tt.modify(&cfg)
+			}
+
+			err := Builtin().Validate(cfg)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("unexpected error %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+// TestRegistry_Open проверяет создание встраиваемых хранилищ
+func TestRegistry_Open(t *testing.T) {
+	for _, driver := range []string{"memory", "sqlite", "bolt"} {
+		t.Run(driver, func(t *testing.T) {
+			s, err := Builtin().Open(context.Background(), validConfig(t, driver))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = Close(s); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// pingStorage хранилище с заданным результатом проверки доступности
+type pingStorage struct {
+	*inmemory.EventInMemoryStorage
+	ping   error
+	closed bool
+}
+
+func (s *pingStorage) Ping(context.Context) error {
+	return s.ping
+}
+
+func (s *pingStorage) Close() error {
+	s.closed = true
+	return nil
+}
+
+// TestRegistry_HealthCheck проверяет, что недоступное хранилище закрывается и не возвращается
+func TestRegistry_HealthCheck(t *testing.T) {
+	unavailable := errors.New("connection refused")
+	memory, _ := inmemory.NewEventInMemoryStorage()
+	s := &pingStorage{EventInMemoryStorage: memory, ping: unavailable}
+
+	r := New()
+	r.Register("fake", Driver{Open: func(ctx context.Context, cfg Config) (usecases.Storage, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("open must be limited by ConnectTimeout")
+		}
+		return s, nil
+	}})
+
+	_, err := r.Open(context.Background(), Config{Driver: "fake", ConnectTimeout: time.Second})
+	if !errors.Is(err, unavailable) {
+		t.Fatalf("expected health check error, got %v", err)
+	}
+	if !s.closed {
+		t.Error("unavailable storage must be closed")
+	}
+}
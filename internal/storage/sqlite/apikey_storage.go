@@ -0,0 +1,94 @@
+package sqlite
+
+import (
+	"context"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	"strings"
+	"time"
+)
+
+// apiKeyColumns колонки ключа API в порядке, в котором их читает scanAPIKey
+const apiKeyColumns = `id, hash, prefix, name, scopes, tenant, created, revoked`
+
+// CreateAPIKey сохраняет новый ключ API
+func (s *EventSQLiteStorage) CreateAPIKey(ctx context.Context, key *entities.APIKey) error {
+	key.Tenant = tenant.FromContext(ctx)
+	_, err := s.db.ExecContext(ctx, `INSERT INTO api_keys (`+apiKeyColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		key.ID.String(), key.Hash, key.Prefix, key.Name, strings.Join(key.Scopes, " "), key.Tenant,
+		formatSpan(key.Created), formatRevoked(key.Revoked))
+
+	return mapError(err)
+}
+
+// FindAPIKeyByHash ищет ключ API по хэшу среди ключей всех арендаторов
+func (s *EventSQLiteStorage) FindAPIKeyByHash(ctx context.Context, hash string) (*entities.APIKey, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE hash = ?`, hash)
+
+	return scanAPIKey(row)
+}
+
+// FindAPIKeys возвращает ключи API арендатора по времени создания
+func (s *EventSQLiteStorage) FindAPIKeys(ctx context.Context) ([]entities.APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE tenant = ? ORDER BY created, id`,
+		tenant.FromContext(ctx))
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var ret []entities.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, *key)
+	}
+
+	return ret, mapError(rows.Err())
+}
+
+// RevokeAPIKey отмечает ключ API отозванным
+func (s *EventSQLiteStorage) RevokeAPIKey(ctx context.Context, id entities.APIKeyID, at time.Time) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE api_keys SET revoked = CASE WHEN revoked = '' THEN ? ELSE revoked END
+		WHERE id = ? AND tenant = ?`, formatSpan(at), id.String(), tenant.FromContext(ctx))
+
+	return affected(res, err)
+}
+
+// scanAPIKey читает ключ API из строки результата с колонками apiKeyColumns
+func scanAPIKey(s scanner) (*entities.APIKey, error) {
+	var id, scopes, created, revoked string
+	var key entities.APIKey
+
+	if err := s.Scan(&id, &key.Hash, &key.Prefix, &key.Name, &scopes, &key.Tenant, &created, &revoked); err != nil {
+		return nil, mapError(err)
+	}
+
+	var err error
+	if key.ID, err = entities.NewAPIKeyID(id); err != nil {
+		return nil, err
+	}
+	if key.Created, err = time.Parse(spanLayout, created); err != nil {
+		return nil, err
+	}
+	if revoked != "" {
+		if key.Revoked, err = time.Parse(spanLayout, revoked); err != nil {
+			return nil, err
+		}
+	}
+	key.Scopes = strings.Fields(scopes)
+
+	return &key, nil
+}
+
+// formatRevoked переводит время отзыва в значение колонки, нулевое время - пустая строка
+func formatRevoked(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return formatSpan(t)
+}
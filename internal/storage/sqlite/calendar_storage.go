@@ -0,0 +1,107 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+)
+
+// calendarColumns колонки календаря в порядке, в котором их читает scanCalendar
+const calendarColumns = `id, name, color, owner, timezone, tenant`
+
+// CreateCalendar сохраняет новый календарь
+func (s *EventSQLiteStorage) CreateCalendar(ctx context.Context, calendar *entities.Calendar) error {
+	calendar.Tenant = tenant.FromContext(ctx)
+	_, err := s.db.ExecContext(ctx, `INSERT INTO calendars (`+calendarColumns+`) VALUES (?, ?, ?, ?, ?, ?)`,
+		calendar.ID.String(), calendar.Name, calendar.Color, calendar.Owner, calendar.Timezone, calendar.Tenant)
+
+	return mapError(err)
+}
+
+func (s *EventSQLiteStorage) FindCalendarByID(ctx context.Context, id entities.CalendarID) (*entities.Calendar, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+calendarColumns+` FROM calendars WHERE id = ? AND tenant = ?`,
+		id.String(), tenant.FromContext(ctx))
+
+	return scanCalendar(row)
+}
+
+// FindCalendars возвращает календари владельца, пустой owner - всех владельцев арендатора
+func (s *EventSQLiteStorage) FindCalendars(ctx context.Context, owner string) ([]entities.Calendar, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+calendarColumns+` FROM calendars
+		WHERE tenant = ? AND (? = '' OR owner = ?) ORDER BY name, id`, tenant.FromContext(ctx), owner, owner)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var ret []entities.Calendar
+	for rows.Next() {
+		calendar, err := scanCalendar(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, *calendar)
+	}
+
+	return ret, mapError(rows.Err())
+}
+
+func (s *EventSQLiteStorage) UpdateCalendar(ctx context.Context, calendar *entities.Calendar) error {
+	calendar.Tenant = tenant.FromContext(ctx)
+	res, err := s.db.ExecContext(ctx, `UPDATE calendars SET name = ?, color = ?, owner = ?, timezone = ? WHERE id = ? AND tenant = ?`,
+		calendar.Name, calendar.Color, calendar.Owner, calendar.Timezone, calendar.ID.String(), calendar.Tenant)
+
+	return affected(res, err)
+}
+
+// DeleteCalendar удаляет календарь и его события в одной транзакции
+func (s *EventSQLiteStorage) DeleteCalendar(ctx context.Context, id entities.CalendarID) error {
+	owner := tenant.FromContext(ctx)
+
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM events WHERE tenant = ? AND calendar_id = ?`, owner, id.String()); err != nil {
+			return mapError(err)
+		}
+
+		res, err := tx.ExecContext(ctx, `DELETE FROM calendars WHERE id = ? AND tenant = ?`, id.String(), owner)
+
+		return affected(res, err)
+	})
+}
+
+// scanCalendar читает календарь из строки результата с колонками calendarColumns
+func scanCalendar(s scanner) (*entities.Calendar, error) {
+	var id string
+	var calendar entities.Calendar
+
+	if err := s.Scan(&id, &calendar.Name, &calendar.Color, &calendar.Owner, &calendar.Timezone, &calendar.Tenant); err != nil {
+		return nil, mapError(err)
+	}
+
+	var err error
+	if calendar.ID, err = entities.NewCalendarID(id); err != nil {
+		return nil, err
+	}
+
+	return &calendar, nil
+}
+
+// affected возвращает EntityNotFound, если запрос не затронул ни одной строки
+func affected(res sql.Result, err error) error {
+	if err != nil {
+		return mapError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return storage.EntityNotFound
+	}
+
+	return nil
+}
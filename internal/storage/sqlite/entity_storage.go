@@ -0,0 +1,348 @@
+// Пакет реализует хранилище событий во встраиваемой базе SQLite (без cgo).
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// eventColumns колонки события в порядке, в котором их читает scanEvent
+const eventColumns = `id, title, start_at, end_at, timezone, description, rrule, ex_dates, overrides, version, calendar_id, tenant`
+
+// EventSQLiteStorage хранилище событий в файле базы SQLite
+type EventSQLiteStorage struct {
+	db *sql.DB
+}
+
+// NewEventSQLiteStorage открывает (или создает) базу в файле path и применяет миграции.
+// Путь ":memory:" открывает временную базу в памяти
+func NewEventSQLiteStorage(ctx context.Context, path string) (*EventSQLiteStorage, error) {
+	db, err := OpenDB(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = Migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &EventSQLiteStorage{db: db}, nil
+}
+
+// OpenDB открывает (или создает) базу в файле path, не применяя миграции
+func OpenDB(path string) (*sql.DB, error) {
+	if path != ":memory:" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite допускает только одного писателя, а база ":memory:" существует в рамках одного подключения,
+	// поэтому все запросы идут через единственное подключение
+	db.SetMaxOpenConns(1)
+
+	return db, nil
+}
+
+// Close закрывает базу
+func (s *EventSQLiteStorage) Close() error {
+	return s.db.Close()
+}
+
+// Ping проверяет доступность базы
+func (s *EventSQLiteStorage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *EventSQLiteStorage) Create(ctx context.Context, event *entities.Event) error {
+	return create(ctx, s.db, event)
+}
+
+// CreateIfFree создает событие, если оно не пересекается с сохраненными.
+// Транзакции начинаются с блокировки записи (_txlock=immediate), поэтому проверка и запись не перемежаются
+// с записями других подключений и процессов
+func (s *EventSQLiteStorage) CreateIfFree(ctx context.Context, event *entities.Event) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if err := checkFree(ctx, tx, event); err != nil {
+			return err
+		}
+
+		return create(ctx, tx, event)
+	})
+}
+
+func (s *EventSQLiteStorage) Update(ctx context.Context, event *entities.Event) error {
+	return update(ctx, s.db, event)
+}
+
+// UpdateIfFree изменяет событие, если оно не пересекается с другими сохраненными
+func (s *EventSQLiteStorage) UpdateIfFree(ctx context.Context, event *entities.Event) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		// Событие другого календаря не найдено, даже если его время занято в календаре изменения
+		if err := exists(ctx, tx, event); err != nil {
+			return err
+		}
+		if err := checkFree(ctx, tx, event); err != nil {
+			return err
+		}
+
+		return update(ctx, tx, event)
+	})
+}
+
+// SplitIfFree изменяет серию head и создает отделенную от нее серию tail, если tail не пересекается с другими событиями.
+// Усеченная head записывается первой, поэтому проверка tail в той же транзакции видит уже ее.
+// Если tail пересекается, транзакция откатывается вместе с изменением head
+func (s *EventSQLiteStorage) SplitIfFree(ctx context.Context, head, tail *entities.Event) error {
+	tail.CalendarID = head.CalendarID
+	headVersion, tailVersion := head.Version, tail.Version
+
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		if err := update(ctx, tx, head); err != nil {
+			return err
+		}
+		if err := checkFree(ctx, tx, tail); err != nil {
+			return err
+		}
+
+		return create(ctx, tx, tail)
+	})
+	if err != nil {
+		// Транзакция откатилась, поэтому версии остаются прежними
+		head.Version, tail.Version = headVersion, tailVersion
+	}
+
+	return err
+}
+
+// FindBySpan возвращает все события календаря, лежащие в указанном временном диапазоне start..end
+func (s *EventSQLiteStorage) FindBySpan(ctx context.Context, calendar entities.CalendarID, start time.Time, end time.Time) ([]entities.Event, error) {
+	return findBySpan(ctx, s.db, calendar, start, end)
+}
+
+// FindPage возвращает страницу событий, пересекающихся с промежутком запроса, в порядке запроса
+func (s *EventSQLiteStorage) FindPage(ctx context.Context, q storage.SpanQuery) ([]entities.Event, error) {
+	return findPage(ctx, s.db, q)
+}
+
+func (s *EventSQLiteStorage) FindByID(ctx context.Context, id entities.EventID) (*entities.Event, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+eventColumns+` FROM events WHERE id = ? AND tenant = ?`,
+		id.String(), tenant.FromContext(ctx))
+
+	return scanEvent(row)
+}
+
+func (s *EventSQLiteStorage) DeleteByID(ctx context.Context, id *entities.EventID, version int64) error {
+	owner := tenant.FromContext(ctx)
+	res, err := s.db.ExecContext(ctx, `DELETE FROM events WHERE id = ? AND tenant = ? AND (? = 0 OR version = ?)`,
+		id.String(), owner, version, version)
+
+	return changed(ctx, s.db, res, err, `id = ? AND tenant = ?`, id.String(), owner)
+}
+
+// inTx выполняет fn в транзакции, фиксируя ее, если fn не вернула ошибку
+func (s *EventSQLiteStorage) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	return mapError(tx.Commit())
+}
+
+// querier общий интерфейс sql.DB и sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// create сохраняет новое событие арендатора из контекста
+func create(ctx context.Context, q querier, event *entities.Event) error {
+	event.Tenant = tenant.FromContext(ctx)
+	row, err := newEventRow(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(ctx, `INSERT INTO events (`+eventColumns+`, span_start, span_end)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		row.id, row.title, row.start, row.end, row.timezone, row.description, row.rrule, row.exDates, row.overrides,
+		row.version, row.calendarID, row.tenant, row.spanStart, row.spanEnd)
+	if err != nil {
+		return mapError(err)
+	}
+
+	event.Version = row.version
+
+	return nil
+}
+
+// update изменяет событие арендатора из контекста
+func update(ctx context.Context, q querier, event *entities.Event) error {
+	event.Tenant = tenant.FromContext(ctx)
+	row, err := newEventRow(event)
+	if err != nil {
+		return err
+	}
+
+	res, err := q.ExecContext(ctx, `UPDATE events SET
+		title = ?, start_at = ?, end_at = ?, timezone = ?, description = ?, rrule = ?,
+		ex_dates = ?, overrides = ?, span_start = ?, span_end = ?, version = version + 1
+		WHERE id = ? AND tenant = ? AND calendar_id = ? AND version = ?`,
+		row.title, row.start, row.end, row.timezone, row.description, row.rrule, row.exDates, row.overrides,
+		row.spanStart, row.spanEnd, row.id, row.tenant, row.calendarID, event.Version)
+	// Событие другого календаря или арендатора не изменяется и считается не найденным
+	if err = changed(ctx, q, res, err, `id = ? AND tenant = ? AND calendar_id = ?`, row.id, row.tenant, row.calendarID); err != nil {
+		return err
+	}
+
+	event.Version++
+
+	return nil
+}
+
+// findBySpan выбирает события календаря арендатора из контекста, пересекающиеся с промежутком start..end
+func findBySpan(ctx context.Context, q querier, calendar entities.CalendarID, start time.Time, end time.Time) ([]entities.Event, error) {
+	return queryEvents(ctx, q, `SELECT `+eventColumns+` FROM events
+		WHERE tenant = ? AND calendar_id = ? AND span_end > ? AND span_start < ?`,
+		tenant.FromContext(ctx), calendar.String(), formatSpan(start), formatSpan(end))
+}
+
+// findPage выбирает страницу событий по запросу. Позиция q.After задается условием на ключ сортировки,
+// а не смещением, поэтому следующая страница не сдвигается при добавлении и удалении событий.
+// События отбираются индексом промежутка, а сортируются уже отобранные, их немного
+func findPage(ctx context.Context, q querier, query storage.SpanQuery) ([]entities.Event, error) {
+	bound, order := "span_start", "span_start, id"
+	if query.Order == storage.SortDesc {
+		bound, order = "span_end", "span_end DESC, id DESC"
+	}
+
+	stmt := `SELECT ` + eventColumns + ` FROM events WHERE tenant = ? AND calendar_id = ? AND span_end > ? AND span_start < ?`
+	args := []interface{}{tenant.FromContext(ctx), query.Calendar.String(), formatSpan(query.Start), formatSpan(query.End)}
+
+	if query.After != nil {
+		cmp := ">"
+		if query.Order == storage.SortDesc {
+			cmp = "<"
+		}
+
+		after := formatSpan(query.After.Bound)
+		stmt += ` AND (` + bound + ` ` + cmp + ` ? OR (` + bound + ` = ? AND id ` + cmp + ` ?))`
+		args = append(args, after, after, query.After.ID)
+	}
+
+	stmt += ` ORDER BY ` + order
+	if query.Limit > 0 {
+		stmt += ` LIMIT ?`
+		args = append(args, query.Limit)
+	}
+
+	return queryEvents(ctx, q, stmt, args...)
+}
+
+// queryEvents выполняет запрос, возвращающий колонки eventColumns, и читает события
+func queryEvents(ctx context.Context, q querier, query string, args ...interface{}) ([]entities.Event, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var ret []entities.Event
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, *event)
+	}
+
+	return ret, mapError(rows.Err())
+}
+
+// exists возвращает EntityNotFound, если в календаре события у арендатора из контекста нет события с его идентификатором
+func exists(ctx context.Context, q querier, event *entities.Event) error {
+	var found int
+	err := q.QueryRowContext(ctx, `SELECT 1 FROM events WHERE id = ? AND tenant = ? AND calendar_id = ?`,
+		event.ID.String(), tenant.FromContext(ctx), event.CalendarID.String()).Scan(&found)
+
+	return mapError(err)
+}
+
+// checkFree возвращает EntitySpanBusy, если событие пересекается с другими сохраненными
+func checkFree(ctx context.Context, q querier, event *entities.Event) error {
+	start, end := event.Bounds()
+
+	candidates, err := findBySpan(ctx, q, event.CalendarID, start, end)
+	if err != nil {
+		return err
+	}
+
+	if storage.HasConflict(event, candidates) {
+		return storage.EntitySpanBusy
+	}
+
+	return nil
+}
+
+// changed проверяет, что запрос к событию с условием на версию затронул строку.
+// Иначе возвращает EntityNotFound, если нет события, подходящего под условие where без версии,
+// или EntityVersionConflict, если у него другая версия
+func changed(ctx context.Context, q querier, res sql.Result, err error, where string, args ...interface{}) error {
+	if err != nil {
+		return mapError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	var exists int
+	err = q.QueryRowContext(ctx, `SELECT 1 FROM events WHERE `+where, args...).Scan(&exists)
+	if err != nil {
+		return mapError(err)
+	}
+
+	return storage.EntityVersionConflict
+}
+
+// mapError приводит ошибки базы к ошибкам хранилища
+func mapError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.EntityNotFound
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && (sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY ||
+		sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE) {
+		return storage.EntityAlreadyExists
+	}
+
+	return err
+}
@@ -0,0 +1,141 @@
+package sqlite
+
+import (
+	"context"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"github.com/mzelenkin/go-calendar/internal/storage/storagetest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestStorage создает хранилище во временном каталоге теста
+func newTestStorage(t *testing.T) *EventSQLiteStorage {
+	s, err := NewEventSQLiteStorage(context.Background(), filepath.Join(t.TempDir(), "calendar.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+// newRecurringEvent возвращает серию с исключениями в именованной зоне
+func newRecurringEvent(t *testing.T) entities.Event {
+	loc, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skip("timezone database is not available")
+	}
+
+	id, _ := entities.NewEventID("")
+	rule, _ := entities.ParseRecurrence("FREQ=WEEKLY;BYDAY=MO;COUNT=4")
+	start := time.Date(2020, 1, 6, 10, 0, 0, 0, loc)
+
+	return entities.Event{
+		ID:          id,
+		Title:       "Стендап",
+		Start:       start,
+		End:         start.Add(15 * time.Minute),
+		Description: "Еженедельный стендап",
+		Recurrence:  rule,
+		ExDates:     []time.Time{start.AddDate(0, 0, 7)},
+		Overrides: []entities.Override{{
+			OriginalStart: start.AddDate(0, 0, 14),
+			Title:         "Перенесенный стендап",
+			Start:         start.AddDate(0, 0, 15),
+			End:           start.AddDate(0, 0, 15).Add(15 * time.Minute),
+		}},
+	}
+}
+
+// TestEventSQLiteStorage_Conformance проверяет хранилище общим набором тестов
+func TestEventSQLiteStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) usecases.Storage {
+		return newTestStorage(t)
+	})
+}
+
+// TestEventSQLiteStorage_Reopen проверяет, что события переживают повторное открытие базы
+func TestEventSQLiteStorage_Reopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "calendar.db")
+	event := newRecurringEvent(t)
+
+	s, err := NewEventSQLiteStorage(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Create(ctx, &event); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// Миграции при повторном открытии не применяются заново
+	s, err = NewEventSQLiteStorage(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, err = s.FindByID(ctx, event.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestEventSQLiteStorage_SpanIndex проверяет, что выборка по промежутку идет по индексу
+func TestEventSQLiteStorage_SpanIndex(t *testing.T) {
+	s := newTestStorage(t)
+
+	rows, err := s.db.Query(`EXPLAIN QUERY PLAN SELECT `+eventColumns+` FROM events WHERE tenant = ? AND calendar_id = ? AND span_end > ? AND span_start < ?`,
+		"", entities.DefaultCalendarID.String(), formatSpan(time.Now()), formatSpan(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var plan []string
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		if err = rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			t.Fatal(err)
+		}
+		plan = append(plan, detail)
+	}
+
+	if !strings.Contains(strings.Join(plan, "\n"), "events_span_idx") {
+		t.Errorf("span index is not used:\n%s", strings.Join(plan, "\n"))
+	}
+}
+
+// TestMigrations проверяет, что встроенные миграции откатываются и применяются повторно
+func TestMigrations(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	m, err := NewMigrator(s.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rolledBack, err := m.Down(ctx, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rolledBack) == 0 {
+		t.Fatal("no migrations rolled back")
+	}
+	if _, err = s.db.ExecContext(ctx, `SELECT 1 FROM events`); err == nil {
+		t.Error("table events must be dropped")
+	}
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(rolledBack) {
+		t.Errorf("applied %d migrations, rolled back %d", len(applied), len(rolledBack))
+	}
+}
@@ -0,0 +1,45 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"github.com/mzelenkin/go-calendar/internal/storage/migrate"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// dialect запросы таблицы версий в SQLite
+// Отдельная блокировка не нужна: транзакции начинаются с BEGIN IMMEDIATE (см. dsn) и сразу берут блокировку
+// записи базы, поэтому второй процесс ждет busy_timeout и получает ошибку "database is locked"
+var dialect = migrate.Dialect{
+	CreateTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+	InsertVersion: `INSERT INTO schema_migrations (version) VALUES (?)`,
+	DeleteVersion: `DELETE FROM schema_migrations WHERE version = ?`,
+}
+
+// NewMigrator возвращает Migrator встроенных миграций для базы db
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	list, err := migrate.Load(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.New(db, dialect, list), nil
+}
+
+// Migrate применяет к базе еще не примененные миграции
+func Migrate(ctx context.Context, db *sql.DB) error {
+	m, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.Up(ctx)
+
+	return err
+}
@@ -0,0 +1,19 @@
+-- События календаря. Время хранится текстом RFC 3339 в зоне события, а границы промежутка span_start..span_end -
+-- текстом фиксированной ширины в UTC, поэтому их лексикографический порядок совпадает с хронологическим
+CREATE TABLE events (
+    id          TEXT PRIMARY KEY,
+    title       TEXT NOT NULL,
+    start_at    TEXT NOT NULL,
+    end_at      TEXT NOT NULL,
+    timezone    TEXT NOT NULL DEFAULT 'UTC',
+    description TEXT NOT NULL DEFAULT '',
+    rrule       TEXT NOT NULL DEFAULT '',
+    ex_dates    TEXT NOT NULL DEFAULT '[]',
+    overrides   TEXT NOT NULL DEFAULT '[]',
+    span_start  TEXT NOT NULL,
+    span_end    TEXT NOT NULL
+) WITHOUT ROWID;
+
+-- Выборки по промежутку обычно касаются текущих и будущих дат, поэтому индекс начинается с окончания:
+-- span_end > start отсекает прошедшие события, число которых со временем только растет
+CREATE INDEX events_span_idx ON events (span_end, span_start);
@@ -0,0 +1,2 @@
+-- Версия события для оптимистичной блокировки: увеличивается при каждом изменении
+ALTER TABLE events ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
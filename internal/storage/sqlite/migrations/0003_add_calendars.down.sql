@@ -0,0 +1,6 @@
+-- Откат сливает события всех календарей в один
+DROP INDEX events_span_idx;
+CREATE INDEX events_span_idx ON events (span_end, span_start);
+
+ALTER TABLE events DROP COLUMN calendar_id;
+DROP TABLE calendars;
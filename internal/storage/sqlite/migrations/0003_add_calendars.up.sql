@@ -0,0 +1,17 @@
+-- Календари. Календарь по умолчанию не хранится: у его событий нулевой calendar_id,
+-- поэтому события, созданные до появления календарей, попадают в него
+CREATE TABLE calendars (
+    id       TEXT PRIMARY KEY,
+    name     TEXT NOT NULL,
+    color    TEXT NOT NULL DEFAULT '',
+    owner    TEXT NOT NULL DEFAULT '',
+    timezone TEXT NOT NULL DEFAULT ''
+) WITHOUT ROWID;
+
+CREATE INDEX calendars_owner_idx ON calendars (owner, name);
+
+ALTER TABLE events ADD COLUMN calendar_id TEXT NOT NULL DEFAULT '00000000-0000-0000-0000-000000000000';
+
+-- Выборки по промежутку теперь всегда ограничены календарем
+DROP INDEX events_span_idx;
+CREATE INDEX events_span_idx ON events (calendar_id, span_end, span_start);
@@ -0,0 +1,9 @@
+-- Откат сливает данные всех арендаторов вместе
+DROP INDEX calendars_owner_idx;
+CREATE INDEX calendars_owner_idx ON calendars (owner, name);
+
+DROP INDEX events_span_idx;
+CREATE INDEX events_span_idx ON events (calendar_id, span_end, span_start);
+
+ALTER TABLE calendars DROP COLUMN tenant;
+ALTER TABLE events DROP COLUMN tenant;
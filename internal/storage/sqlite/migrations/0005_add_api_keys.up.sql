@@ -0,0 +1,15 @@
+-- Ключи API. Сам ключ не хранится, только его хэш SHA-256; разрешения записаны через пробел.
+-- Время создания и отзыва хранится в формате границ промежутка, чтобы строки сравнивались как моменты времени,
+-- пустое время отзыва - ключ действует
+CREATE TABLE api_keys (
+    id      TEXT PRIMARY KEY,
+    hash    TEXT NOT NULL UNIQUE,
+    prefix  TEXT NOT NULL,
+    name    TEXT NOT NULL DEFAULT '',
+    scopes  TEXT NOT NULL DEFAULT '',
+    tenant  TEXT NOT NULL DEFAULT '',
+    created TEXT NOT NULL,
+    revoked TEXT NOT NULL DEFAULT ''
+) WITHOUT ROWID;
+
+CREATE INDEX api_keys_tenant_idx ON api_keys (tenant, created);
@@ -0,0 +1,1344 @@
+// Пакет содержит общий набор тестов, которому должна соответствовать каждая реализация usecases.Storage.
+//
+// Использование в тестах хранилища:
+//
+//	func TestConformance(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) usecases.Storage {
+//			return newTestStorage(t)
+//		})
+//	}
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"github.com/mzelenkin/go-calendar/internal/domain/entities"
+	"github.com/mzelenkin/go-calendar/internal/domain/usecases"
+	"github.com/mzelenkin/go-calendar/internal/storage"
+	"github.com/mzelenkin/go-calendar/internal/tenant"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Factory создает новое пустое хранилище для одного теста.
+// Освобождение ресурсов хранилища регистрируется фабрикой через t.Cleanup
+type Factory func(t *testing.T) usecases.Storage
+
+// Run выполняет все тесты набора на хранилищах, созданных фабрикой newStorage
+func Run(t *testing.T, newStorage Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s usecases.Storage)
+	}{
+		{"Create", testCreate},
+		{"CreateDuplicate", testCreateDuplicate},
+		{"FindByIDNotFound", testFindByIDNotFound},
+		{"Update", testUpdate},
+		{"UpdateNotFound", testUpdateNotFound},
+		{"DeleteByID", testDeleteByID},
+		{"DeleteByIDNotFound", testDeleteByIDNotFound},
+		{"Version", testVersion},
+		{"VersionPreserved", testVersionPreserved},
+		{"FindBySpanBoundaries", testFindBySpanBoundaries},
+		{"FindBySpanRecurring", testFindBySpanRecurring},
+		{"FindBySpanUpdated", testFindBySpanUpdated},
+		{"FindPage", testFindPage},
+		{"FindPageAfter", testFindPageAfter},
+		{"RoundTrip", testRoundTrip},
+		{"Isolation", testIsolation},
+		{"CreateIfFree", testCreateIfFree},
+		{"UpdateIfFree", testUpdateIfFree},
+		{"CreateIfFreeConcurrent", testCreateIfFreeConcurrent},
+		{"SplitIfFree", testSplitIfFree},
+		{"ContextCanceled", testContextCanceled},
+		{"Calendars", testCalendars},
+		{"CalendarScope", testCalendarScope},
+		{"DeleteCalendar", testDeleteCalendar},
+		{"Tenants", testTenants},
+		{"TenantCalendars", testTenantCalendars},
+		{"APIKeys", testAPIKeys},
+		{"TenantAPIKeys", testTenantAPIKeys},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStorage(t))
+		})
+	}
+}
+
+// base начало тестовых событий
+var base = time.Date(2020, 5, 12, 10, 0, 0, 0, time.UTC)
+
+// newEvent возвращает событие с новым идентификатором в промежутке start..end
+func newEvent(t *testing.T, title string, start, end time.Time) entities.Event {
+	id, err := entities.NewEventID("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return entities.Event{ID: id, Title: title, Start: start, End: end, Description: "Тестовое событие"}
+}
+
+// mustCreate сохраняет события в хранилище. Сохраненная версия записывается в события
+func mustCreate(t *testing.T, s usecases.Storage, events ...*entities.Event) {
+	for _, event := range events {
+		if err := s.Create(context.Background(), event); err != nil {
+			t.Fatalf("create %s: %v", event.Title, err)
+		}
+	}
+}
+
+// assertEqual проверяет, что события совпадают. Время сравнивается как момент, без учета зоны
+func assertEqual(t *testing.T, expected, actual *entities.Event) {
+	t.Helper()
+
+	if !actual.ID.Equal(expected.ID) || !actual.CalendarID.Equal(expected.CalendarID) || actual.Tenant != expected.Tenant ||
+		actual.Title != expected.Title || actual.Description != expected.Description ||
+		!actual.Start.Equal(expected.Start) || !actual.End.Equal(expected.End) || actual.Version != expected.Version {
+		t.Fatalf("events differ:\nexpected %+v\nactual   %+v", expected, actual)
+	}
+
+	if (expected.Recurrence == nil) != (actual.Recurrence == nil) ||
+		expected.Recurrence != nil && expected.Recurrence.String() != actual.Recurrence.String() {
+		t.Fatalf("recurrences differ: expected %v, actual %v", expected.Recurrence, actual.Recurrence)
+	}
+
+	start, end := expected.Bounds()
+	if !reflect.DeepEqual(occurrencesUTC(expected, start, end), occurrencesUTC(actual, start, end)) {
+		t.Fatalf("occurrences differ:\nexpected %+v\nactual   %+v", expected.Occurrences(start, end), actual.Occurrences(start, end))
+	}
+}
+
+// occurrencesUTC возвращает повторения события с временем в UTC, чтобы их можно было сравнить целиком
+func occurrencesUTC(e *entities.Event, start, end time.Time) []entities.Occurrence {
+	var ret []entities.Occurrence
+	for _, o := range e.Occurrences(start, end) {
+		o.OriginalStart, o.Start, o.End = o.OriginalStart.UTC(), o.Start.UTC(), o.End.UTC()
+		ret = append(ret, o)
+	}
+
+	return ret
+}
+
+// titles возвращает множество названий событий
+func titles(events []entities.Event) map[string]bool {
+	ret := map[string]bool{}
+	for _, e := range events {
+		ret[e.Title] = true
+	}
+
+	return ret
+}
+
+func testCreate(t *testing.T, s usecases.Storage) {
+	event := newEvent(t, "Событие", base, base.Add(time.Hour))
+	mustCreate(t, s, &event)
+
+	found, err := s.FindByID(context.Background(), event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, &event, found)
+}
+
+func testCreateDuplicate(t *testing.T, s usecases.Storage) {
+	event := newEvent(t, "Событие", base, base.Add(time.Hour))
+	mustCreate(t, s, &event)
+
+	event.Title = "Другое событие"
+	if err := s.Create(context.Background(), &event); err != storage.EntityAlreadyExists {
+		t.Fatalf("expected EntityAlreadyExists, got %v", err)
+	}
+
+	found, err := s.FindByID(context.Background(), event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Title != "Событие" {
+		t.Errorf("duplicate create must not change the event, got %q", found.Title)
+	}
+}
+
+func testFindByIDNotFound(t *testing.T, s usecases.Storage) {
+	id, _ := entities.NewEventID("")
+
+	if _, err := s.FindByID(context.Background(), id); err != storage.EntityNotFound {
+		t.Fatalf("expected EntityNotFound, got %v", err)
+	}
+}
+
+func testUpdate(t *testing.T, s usecases.Storage) {
+	event := newEvent(t, "Событие", base, base.Add(time.Hour))
+	mustCreate(t, s, &event)
+
+	event.Title = "Измененное событие"
+	event.Description = ""
+	event.Start = base.Add(2 * time.Hour)
+	event.End = base.Add(3 * time.Hour)
+	if err := s.Update(context.Background(), &event); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := s.FindByID(context.Background(), event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, &event, found)
+}
+
+func testUpdateNotFound(t *testing.T, s usecases.Storage) {
+	event := newEvent(t, "Событие", base, base.Add(time.Hour))
+
+	if err := s.Update(context.Background(), &event); err != storage.EntityNotFound {
+		t.Fatalf("expected EntityNotFound, got %v", err)
+	}
+
+	// Update не создает событие
+	if _, err := s.FindByID(context.Background(), event.ID); err != storage.EntityNotFound {
+		t.Fatalf("expected EntityNotFound, got %v", err)
+	}
+}
+
+func testDeleteByID(t *testing.T, s usecases.Storage) {
+	event := newEvent(t, "Событие", base, base.Add(time.Hour))
+	other := newEvent(t, "Другое событие", base.Add(time.Hour), base.Add(2*time.Hour))
+	mustCreate(t, s, &event, &other)
+
+	if err := s.DeleteByID(context.Background(), &event.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.FindByID(context.Background(), event.ID); err != storage.EntityNotFound {
+		t.Fatalf("expected EntityNotFound, got %v", err)
+	}
+	if _, err := s.FindByID(context.Background(), other.ID); err != nil {
+		t.Fatalf("other event must stay, got %v", err)
+	}
+
+	events, err := s.FindBySpan(context.Background(), entities.DefaultCalendarID, base, base.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Errorf("deleted event must not be found by span, got %+v", events)
+	}
+}
+
+func testDeleteByIDNotFound(t *testing.T, s usecases.Storage) {
+	id, _ := entities.NewEventID("")
+
+	if err := s.DeleteByID(context.Background(), &id, 0); err != storage.EntityNotFound {
+		t.Fatalf("expected EntityNotFound, got %v", err)
+	}
+}
+
+// testVersion проверяет оптимистичную блокировку: изменение и удаление устаревшей версии отклоняются
+func testVersion(t *testing.T, s usecases.Storage) {
+	ctx := context.Background()
+
+	event := newEvent(t, "Событие", base, base.Add(time.Hour))
+	mustCreate(t, s, &event)
+	if event.Version != 1 {
+		t.Fatalf("new event must get version 1, got %d", event.Version)
+	}
+
+	stale := event
+	event.Title = "Измененное событие"
+	if err := s.Update(ctx, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Version != 2 {
+		t.Fatalf("update must increment version, got %d", event.Version)
+	}
+
+	stale.Title = "Потерянное изменение"
+	if err := s.Update(ctx, &stale); err != storage.EntityVersionConflict {
+		t.Fatalf("Update: expected EntityVersionConflict, got %v", err)
+	}
+	if err := s.UpdateIfFree(ctx, &stale); err != storage.EntityVersionConflict {
+		t.Fatalf("UpdateIfFree: expected EntityVersionConflict, got %v", err)
+	}
+	if err := s.DeleteByID(ctx, &event.ID, stale.Version); err != storage.EntityVersionConflict {
+		t.Fatalf("DeleteByID: expected EntityVersionConflict, got %v", err)
+	}
+
+	found, err := s.FindByID(ctx, event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, &event, found)
+
+	event.End = base.Add(2 * time.Hour)
+	if err = s.UpdateIfFree(ctx, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Version != 3 {
+		t.Fatalf("UpdateIfFree must increment version, got %d", event.Version)
+	}
+
+	if err = s.DeleteByID(ctx, &event.ID, event.Version); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.DeleteByID(ctx, &event.ID, event.Version); err != storage.EntityNotFound {
+		t.Fatalf("expected EntityNotFound, got %v", err)
+	}
+}
+
+// testVersionPreserved проверяет, что созданное с версией событие (например, из резервной копии) ее сохраняет
+func testVersionPreserved(t *testing.T, s usecases.Storage) {
+	event := newEvent(t, "Событие", base, base.Add(time.Hour))
+	event.Version = 5
+	mustCreate(t, s, &event)
+
+	found, err := s.FindByID(context.Background(), event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Version != 5 {
+		t.Fatalf("expected version 5, got %d", found.Version)
+	}
+
+	events, err := s.FindBySpan(context.Background(), entities.DefaultCalendarID, base, base.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Version != 5 {
+		t.Fatalf("expected 1 event of version 5, got %+v", events)
+	}
+}
+
+// testFindBySpanBoundaries проверяет, что промежутки пересекаются только при общей части ненулевой длины:
+// событие, которое заканчивается в момент начала выборки (или начинается в момент ее окончания), не попадает в нее
+func testFindBySpanBoundaries(t *testing.T, s usecases.Storage) {
+	event := newEvent(t, "Событие", base, base.Add(time.Hour))
+	mustCreate(t, s, &event)
+
+	cases := []struct {
+		name       string
+		start, end time.Time
+		found      bool
+	}{
+		{"before", base.Add(-2 * time.Hour), base.Add(-time.Hour), false},
+		{"ends at start", base.Add(-time.Hour), base, false},
+		{"overlaps start", base.Add(-time.Hour), base.Add(time.Nanosecond), true},
+		{"inside", base.Add(10 * time.Minute), base.Add(20 * time.Minute), true},
+		{"same", base, base.Add(time.Hour), true},
+		{"contains", base.Add(-time.Hour), base.Add(2 * time.Hour), true},
+		{"overlaps end", base.Add(time.Hour - time.Nanosecond), base.Add(2 * time.Hour), true},
+		{"starts at end", base.Add(time.Hour), base.Add(2 * time.Hour), false},
+		{"after", base.Add(2 * time.Hour), base.Add(3 * time.Hour), false},
+	}
+
+	for _, c := range cases {
+		events, err := s.FindBySpan(context.Background(), entities.DefaultCalendarID, c.start, c.end)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if found := len(events) == 1; found != c.found || len(events) > 1 {
+			t.Errorf("%s: expected found=%v, got %d events", c.name, c.found, len(events))
+		}
+	}
+}
+
+// testFindBySpanRecurring проверяет, что серия находится по промежутку, который она занимает целиком,
+// включая бесконечные серии и повторения, перенесенные за ее пределы
+func testFindBySpanRecurring(t *testing.T, s usecases.Storage) {
+	daily, _ := entities.ParseRecurrence("FREQ=DAILY;COUNT=5")
+	forever, _ := entities.ParseRecurrence("FREQ=WEEKLY")
+
+	counted := newEvent(t, "Пять дней", base, base.Add(time.Hour))
+	counted.Recurrence = daily
+
+	infinite := newEvent(t, "Каждую неделю", base.AddDate(0, 0, 1), base.AddDate(0, 0, 1).Add(time.Hour))
+	infinite.Recurrence = forever
+
+	moved := newEvent(t, "Перенесенное", base.AddDate(0, 0, 2), base.AddDate(0, 0, 2).Add(time.Hour))
+	moved.Recurrence = daily
+	moved.SetOverride(entities.Override{
+		OriginalStart: moved.Start,
+		Title:         "Перенесенное",
+		Start:         base.AddDate(0, 1, 0),
+		End:           base.AddDate(0, 1, 0).Add(time.Hour),
+	})
+
+	mustCreate(t, s, &counted, &infinite, &moved)
+
+	cases := []struct {
+		name       string
+		start, end time.Time
+		expected   []string
+	}{
+		{"last occurrence", base.AddDate(0, 0, 4), base.AddDate(0, 0, 4).Add(time.Minute), []string{"Пять дней", "Каждую неделю", "Перенесенное"}},
+		{"after series", base.AddDate(0, 0, 5), base.AddDate(0, 0, 6), []string{"Каждую неделю", "Перенесенное"}},
+		{"moved occurrence", base.AddDate(0, 1, 0), base.AddDate(0, 1, 1), []string{"Каждую неделю", "Перенесенное"}},
+		{"far future", base.AddDate(100, 0, 0), base.AddDate(100, 0, 1), []string{"Каждую неделю"}},
+		{"before", base.AddDate(0, 0, -1), base, nil},
+	}
+
+	for _, c := range cases {
+		events, err := s.FindBySpan(context.Background(), entities.DefaultCalendarID, c.start, c.end)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := map[string]bool{}
+		for _, title := range c.expected {
+			expected[title] = true
+		}
+		if got := titles(events); len(events) != len(c.expected) || !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, got)
+		}
+	}
+}
+
+// testFindBySpanUpdated проверяет, что выборка по промежутку учитывает изменение времени события
+func testFindBySpanUpdated(t *testing.T, s usecases.Storage) {
+	event := newEvent(t, "Событие", base, base.Add(time.Hour))
+	mustCreate(t, s, &event)
+
+	event.Start = base.AddDate(0, 0, 1)
+	event.End = event.Start.Add(time.Hour)
+	if err := s.Update(context.Background(), &event); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := s.FindBySpan(context.Background(), entities.DefaultCalendarID, base, base.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Errorf("event must not be found at its old time, got %+v", events)
+	}
+
+	events, err = s.FindBySpan(context.Background(), entities.DefaultCalendarID, event.Start, event.End)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("event must be found at its new time, got %+v", events)
+	}
+
+	assertEqual(t, &event, &events[0])
+}
+
+// testFindPage проверяет порядок событий в выборке и ограничение ее размера
+func testFindPage(t *testing.T, s usecases.Storage) {
+	long := newEvent(t, "Длинное", base, base.Add(5*time.Hour))
+	first := newEvent(t, "Первое", base.Add(time.Hour), base.Add(2*time.Hour))
+	second := newEvent(t, "Второе", base.Add(2*time.Hour), base.Add(3*time.Hour))
+	outside := newEvent(t, "Вне промежутка", base.Add(-2*time.Hour), base.Add(-time.Hour))
+	mustCreate(t, s, &second, &outside, &long, &first)
+
+	cases := []struct {
+		name     string
+		order    storage.SortOrder
+		limit    int
+		expected []string
+	}{
+		{"asc", storage.SortAsc, 0, []string{"Длинное", "Первое", "Второе"}},
+		{"desc", storage.SortDesc, 0, []string{"Длинное", "Второе", "Первое"}},
+		{"asc limit", storage.SortAsc, 2, []string{"Длинное", "Первое"}},
+		{"desc limit", storage.SortDesc, 1, []string{"Длинное"}},
+	}
+
+	for _, c := range cases {
+		events, err := s.FindPage(context.Background(), storage.SpanQuery{
+			Start: base, End: base.Add(24 * time.Hour), Order: c.order, Limit: c.limit,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := orderedTitles(events); !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, got)
+		}
+	}
+}
+
+// testFindPageAfter проверяет, что страницы по позиции последнего события покрывают выборку без повторов,
+// в том числе когда у событий одинаковые границы
+func testFindPageAfter(t *testing.T, s usecases.Storage) {
+	var expected []string
+	for i := 0; i < 7; i++ {
+		// По два события на каждое начало, их порядок определяет идентификатор
+		start := base.Add(time.Duration(i/2) * time.Hour)
+		event := newEvent(t, "Событие "+string(rune('A'+i)), start, start.Add(time.Hour))
+		mustCreate(t, s, &event)
+	}
+
+	all, err := s.FindPage(context.Background(), storage.SpanQuery{Start: base, End: base.Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = orderedTitles(all)
+
+	for _, order := range []storage.SortOrder{storage.SortAsc, storage.SortDesc} {
+		var got []string
+		var after *storage.SpanKey
+		for page := 0; ; page++ {
+			events, err := s.FindPage(context.Background(), storage.SpanQuery{
+				Start: base, End: base.Add(24 * time.Hour), Order: order, Limit: 3, After: after,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) == 0 || page > 3 {
+				break
+			}
+
+			got = append(got, orderedTitles(events)...)
+			key := storage.Key(&events[len(events)-1], order)
+			after = &key
+		}
+
+		want := expected
+		if order == storage.SortDesc {
+			want = make([]string, len(expected))
+			for i := range expected {
+				want[i] = expected[len(expected)-1-i]
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("order %d: expected %v, got %v", order, want, got)
+		}
+	}
+}
+
+// orderedTitles возвращает названия событий в порядке выборки
+func orderedTitles(events []entities.Event) []string {
+	var ret []string
+	for _, e := range events {
+		ret = append(ret, e.Title)
+	}
+
+	return ret
+}
+
+// testRoundTrip проверяет сохранение серии с исключениями в именованной зоне:
+// от зоны зависит развертывание повторений, поэтому хранилище обязано ее сохранить
+func testRoundTrip(t *testing.T, s usecases.Storage) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("timezone database is not available")
+	}
+
+	// Серия пересекает переход на летнее время 8 марта 2020 года
+	start := time.Date(2020, 3, 2, 9, 0, 0, 0, loc)
+	rule, _ := entities.ParseRecurrence("FREQ=WEEKLY;BYDAY=MO,TH;UNTIL=20200401T000000Z")
+
+	event := newEvent(t, "Стендап", start, start.Add(15*time.Minute))
+	event.Recurrence = rule
+	event.Exclude(start.AddDate(0, 0, 3))
+	event.SetOverride(entities.Override{
+		OriginalStart: start.AddDate(0, 0, 7),
+		Title:         "Перенесенный стендап",
+		Start:         start.AddDate(0, 0, 8),
+		End:           start.AddDate(0, 0, 8).Add(30 * time.Minute),
+		Description:   "Во вторник",
+	})
+	mustCreate(t, s, &event)
+
+	found, err := s.FindByID(context.Background(), event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, &event, found)
+
+	if found.Start.Location().String() != loc.String() {
+		t.Errorf("location must be preserved, got %s", found.Start.Location())
+	}
+	for _, o := range found.Occurrences(found.Bounds()) {
+		if h, m, _ := o.Start.In(loc).Clock(); o.Title == "Стендап" && (h != 9 || m != 0) {
+			t.Errorf("occurrence %s must start at 9:00 local time", o.Start)
+		}
+	}
+
+	events, err := s.FindBySpan(context.Background(), entities.DefaultCalendarID, start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+
+	assertEqual(t, &event, &events[0])
+}
+
+// testIsolation проверяет, что изменение события вызывающим кодом не меняет сохраненное событие
+func testIsolation(t *testing.T, s usecases.Storage) {
+	event := newEvent(t, "Событие", base, base.Add(time.Hour))
+	mustCreate(t, s, &event)
+
+	event.Title = "Измененное после сохранения"
+
+	found, err := s.FindByID(context.Background(), event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found.Title = "Измененное после чтения"
+
+	found, err = s.FindByID(context.Background(), event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Title != "Событие" {
+		t.Errorf("stored event must not change, got %q", found.Title)
+	}
+}
+
+// testCreateIfFree проверяет создание с проверкой пересечений, в том числе с повторениями серий
+func testCreateIfFree(t *testing.T, s usecases.Storage) {
+	ctx := context.Background()
+	weekly, _ := entities.ParseRecurrence("FREQ=WEEKLY;COUNT=3")
+
+	series := newEvent(t, "Серия", base, base.Add(time.Hour))
+	series.Recurrence = weekly
+	if err := s.CreateIfFree(ctx, &series); err != nil {
+		t.Fatal(err)
+	}
+
+	busy := newEvent(t, "Пересекается с повторением", base.AddDate(0, 0, 7).Add(30*time.Minute), base.AddDate(0, 0, 7).Add(2*time.Hour))
+	if err := s.CreateIfFree(ctx, &busy); err != storage.EntitySpanBusy {
+		t.Fatalf("expected EntitySpanBusy, got %v", err)
+	}
+	if _, err := s.FindByID(ctx, busy.ID); err != storage.EntityNotFound {
+		t.Fatalf("busy event must not be created, got %v", err)
+	}
+
+	// Между повторениями и вплотную к ним время свободно
+	free := []entities.Event{
+		newEvent(t, "Между повторениями", base.AddDate(0, 0, 3), base.AddDate(0, 0, 3).Add(time.Hour)),
+		newEvent(t, "Сразу после", base.Add(time.Hour), base.Add(2*time.Hour)),
+		newEvent(t, "Сразу до", base.AddDate(0, 0, 14).Add(-time.Hour), base.AddDate(0, 0, 14)),
+	}
+	for i := range free {
+		if err := s.CreateIfFree(ctx, &free[i]); err != nil {
+			t.Fatalf("%s: %v", free[i].Title, err)
+		}
+	}
+
+	if err := s.CreateIfFree(ctx, &free[0]); err != storage.EntityAlreadyExists {
+		t.Fatalf("expected EntityAlreadyExists, got %v", err)
+	}
+}
+
+// testUpdateIfFree проверяет изменение с проверкой пересечений: с самим собой событие не пересекается
+func testUpdateIfFree(t *testing.T, s usecases.Storage) {
+	ctx := context.Background()
+
+	event := newEvent(t, "Событие", base, base.Add(time.Hour))
+	other := newEvent(t, "Другое событие", base.Add(2*time.Hour), base.Add(3*time.Hour))
+	mustCreate(t, s, &event, &other)
+
+	// Продление на свое же прежнее время
+	event.End = base.Add(2 * time.Hour)
+	if err := s.UpdateIfFree(ctx, &event); err != nil {
+		t.Fatal(err)
+	}
+
+	moved := event
+	moved.Start = base.Add(90 * time.Minute)
+	moved.End = base.Add(150 * time.Minute)
+	if err := s.UpdateIfFree(ctx, &moved); err != storage.EntitySpanBusy {
+		t.Fatalf("expected EntitySpanBusy, got %v", err)
+	}
+
+	found, err := s.FindByID(ctx, event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, &event, found)
+
+	missing := newEvent(t, "Несуществующее", base.AddDate(0, 0, 1), base.AddDate(0, 0, 1).Add(time.Hour))
+	if err = s.UpdateIfFree(ctx, &missing); err != storage.EntityNotFound {
+		t.Fatalf("expected EntityNotFound, got %v", err)
+	}
+}
+
+// testCreateIfFreeConcurrent проверяет, что из одновременных попыток занять одно время удается ровно одна
+func testCreateIfFreeConcurrent(t *testing.T, s usecases.Storage) {
+	const n = 10
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+
+	for i := 0; i < n; i++ {
+		event := newEvent(t, "Событие", base.Add(time.Duration(i)*time.Minute), base.Add(time.Hour))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.CreateIfFree(context.Background(), &event)
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		switch err {
+		case nil:
+			created++
+		case storage.EntitySpanBusy:
+		default:
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+
+	if created != 1 {
+		t.Fatalf("expected exactly 1 created event, got %d", created)
+	}
+
+	events, err := s.FindBySpan(context.Background(), entities.DefaultCalendarID, base, base.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Errorf("expected 1 stored event, got %d", len(events))
+	}
+}
+
+// testSplitIfFree проверяет разделение серии: новая серия может занять время, освобожденное усечением исходной,
+// а при пересечении или устаревшей версии не сохраняется ни одна из серий
+func testSplitIfFree(t *testing.T, s usecases.Storage) {
+	ctx := context.Background()
+	daily, _ := entities.ParseRecurrence("FREQ=DAILY;COUNT=4")
+
+	series := newEvent(t, "Серия", base, base.Add(time.Hour))
+	series.Recurrence = daily
+	other := newEvent(t, "Другое событие", base.AddDate(0, 0, 3).Add(90*time.Minute), base.AddDate(0, 0, 3).Add(3*time.Hour))
+	mustCreate(t, s, &series, &other)
+
+	// Продолжение с третьего дня на час позже пересекается с другим событием
+	head := series
+	tail := head.Split(base.AddDate(0, 0, 2))
+	tail.ID = newEvent(t, "Продолжение", base, base).ID
+	tail.Title = "Продолжение"
+	tail.Version = 0
+	tail.Shift(time.Hour, time.Hour)
+	if err := s.SplitIfFree(ctx, &head, &tail); err != storage.EntitySpanBusy {
+		t.Fatalf("expected EntitySpanBusy, got %v", err)
+	}
+	if head.Version != series.Version {
+		t.Fatalf("failed split must keep version %d, got %d", series.Version, head.Version)
+	}
+
+	found, err := s.FindByID(ctx, series.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, &series, found)
+	if _, err = s.FindByID(ctx, tail.ID); err != storage.EntityNotFound {
+		t.Fatalf("busy tail must not be created, got %v", err)
+	}
+
+	// Продолжение в то же время занимает только повторения, освобожденные усечением
+	tail.Shift(-time.Hour, time.Hour)
+	stale := head
+	if err = s.SplitIfFree(ctx, &head, &tail); err != nil {
+		t.Fatal(err)
+	}
+	if head.Version != series.Version+1 || tail.Version != 1 {
+		t.Fatalf("unexpected versions after split: head %d, tail %d", head.Version, tail.Version)
+	}
+
+	found, err = s.FindByID(ctx, head.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, &head, found)
+	found, err = s.FindByID(ctx, tail.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, &tail, found)
+
+	// Серию, уже измененную другим запросом, разделить нельзя
+	retry := newEvent(t, "Повтор", base.AddDate(0, 0, 10), base.AddDate(0, 0, 10).Add(time.Hour))
+	if err = s.SplitIfFree(ctx, &stale, &retry); err != storage.EntityVersionConflict {
+		t.Fatalf("expected EntityVersionConflict, got %v", err)
+	}
+	if _, err = s.FindByID(ctx, retry.ID); err != storage.EntityNotFound {
+		t.Fatalf("tail of stale series must not be created, got %v", err)
+	}
+}
+
+// testContextCanceled проверяет, что операции с отмененным контекстом возвращают ошибку контекста
+// и не изменяют данные
+func testContextCanceled(t *testing.T, s usecases.Storage) {
+	event := newEvent(t, "Событие", base, base.Add(time.Hour))
+	mustCreate(t, s, &event)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	created := newEvent(t, "Новое событие", base.Add(time.Hour), base.Add(2*time.Hour))
+	updated := event
+	updated.Title = "Измененное событие"
+
+	operations := map[string]func() error{
+		"Create":       func() error { return s.Create(ctx, &created) },
+		"CreateIfFree": func() error { return s.CreateIfFree(ctx, &created) },
+		"FindByID": func() error {
+			_, err := s.FindByID(ctx, event.ID)
+			return err
+		},
+		"FindBySpan": func() error {
+			_, err := s.FindBySpan(ctx, entities.DefaultCalendarID, base, base.Add(time.Hour))
+			return err
+		},
+		"FindPage": func() error {
+			_, err := s.FindPage(ctx, storage.SpanQuery{Start: base, End: base.Add(time.Hour)})
+			return err
+		},
+		"Update":       func() error { return s.Update(ctx, &updated) },
+		"UpdateIfFree": func() error { return s.UpdateIfFree(ctx, &updated) },
+		"SplitIfFree": func() error {
+			tail := newEvent(t, "Продолжение", base.Add(time.Hour), base.Add(2*time.Hour))
+			return s.SplitIfFree(ctx, &updated, &tail)
+		},
+		"DeleteByID": func() error { return s.DeleteByID(ctx, &event.ID, 0) },
+		"CreateCalendar": func() error {
+			return s.CreateCalendar(ctx, &entities.Calendar{ID: newCalendarID(t), Name: "Календарь"})
+		},
+		"FindCalendars": func() error {
+			_, err := s.FindCalendars(ctx, "")
+			return err
+		},
+		"DeleteCalendar": func() error { return s.DeleteCalendar(ctx, newCalendarID(t)) },
+	}
+
+	for name, op := range operations {
+		if err := op(); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: expected context.Canceled, got %v", name, err)
+		}
+	}
+
+	found, err := s.FindByID(context.Background(), event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Title != event.Title {
+		t.Errorf("event must not change, got %q", found.Title)
+	}
+	if _, err = s.FindByID(context.Background(), created.ID); err != storage.EntityNotFound {
+		t.Errorf("event must not be created, got %v", err)
+	}
+}
+
+// newCalendarID возвращает новый идентификатор календаря
+func newCalendarID(t *testing.T) entities.CalendarID {
+	id, err := entities.NewCalendarID("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+// mustCreateCalendar сохраняет календарь с указанным названием и владельцем
+func mustCreateCalendar(t *testing.T, s usecases.Storage, name, owner string) entities.Calendar {
+	calendar := entities.Calendar{ID: newCalendarID(t), Name: name, Color: "#3366cc", Owner: owner, Timezone: "Europe/Moscow"}
+	if err := s.CreateCalendar(context.Background(), &calendar); err != nil {
+		t.Fatalf("create calendar %s: %v", name, err)
+	}
+
+	return calendar
+}
+
+// calendarNames возвращает названия календарей по порядку
+func calendarNames(calendars []entities.Calendar) []string {
+	var ret []string
+	for _, c := range calendars {
+		ret = append(ret, c.Name)
+	}
+
+	return ret
+}
+
+// testCalendars проверяет создание, чтение, выборку по владельцу, изменение и удаление календарей
+func testCalendars(t *testing.T, s usecases.Storage) {
+	ctx := context.Background()
+
+	work := mustCreateCalendar(t, s, "Работа", "alice")
+	home := mustCreateCalendar(t, s, "Дом", "alice")
+	mustCreateCalendar(t, s, "Спорт", "bob")
+
+	if err := s.CreateCalendar(ctx, &work); err != storage.EntityAlreadyExists {
+		t.Fatalf("expected EntityAlreadyExists, got %v", err)
+	}
+
+	found, err := s.FindCalendarByID(ctx, work.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*found, work) {
+		t.Fatalf("calendars differ:\nexpected %+v\nactual   %+v", work, *found)
+	}
+
+	calendars, err := s.FindCalendars(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := calendarNames(calendars); !reflect.DeepEqual(names, []string{"Дом", "Работа"}) {
+		t.Fatalf("unexpected calendars of alice %v", names)
+	}
+
+	calendars, err = s.FindCalendars(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calendars) != 3 {
+		t.Fatalf("expected 3 calendars, got %d", len(calendars))
+	}
+
+	home.Name, home.Color = "Семья", "#ff0000"
+	if err = s.UpdateCalendar(ctx, &home); err != nil {
+		t.Fatal(err)
+	}
+	if found, err = s.FindCalendarByID(ctx, home.ID); err != nil || found.Name != "Семья" || found.Color != "#ff0000" {
+		t.Fatalf("calendar must be updated, got %+v, %v", found, err)
+	}
+
+	missing := entities.Calendar{ID: newCalendarID(t), Name: "Несуществующий"}
+	if err = s.UpdateCalendar(ctx, &missing); err != storage.EntityNotFound {
+		t.Fatalf("expected EntityNotFound, got %v", err)
+	}
+	if _, err = s.FindCalendarByID(ctx, missing.ID); err != storage.EntityNotFound {
+		t.Fatalf("expected EntityNotFound, got %v", err)
+	}
+
+	if err = s.DeleteCalendar(ctx, work.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.FindCalendarByID(ctx, work.ID); err != storage.EntityNotFound {
+		t.Fatalf("expected EntityNotFound after delete, got %v", err)
+	}
+	if err = s.DeleteCalendar(ctx, work.ID); err != storage.EntityNotFound {
+		t.Fatalf("expected EntityNotFound, got %v", err)
+	}
+}
+
+// testCalendarScope проверяет, что выборки и пересечения ограничены календарем,
+// а событие нельзя изменить от имени другого календаря
+func testCalendarScope(t *testing.T, s usecases.Storage) {
+	ctx := context.Background()
+	work := mustCreateCalendar(t, s, "Работа", "")
+
+	defaultEvent := newEvent(t, "Без календаря", base, base.Add(time.Hour))
+	if err := s.CreateIfFree(ctx, &defaultEvent); err != nil {
+		t.Fatal(err)
+	}
+
+	// То же время в другом календаре свободно
+	workEvent := newEvent(t, "Совещание", base, base.Add(time.Hour))
+	workEvent.CalendarID = work.ID
+	if err := s.CreateIfFree(ctx, &workEvent); err != nil {
+		t.Fatalf("event in another calendar must not conflict: %v", err)
+	}
+
+	busy := newEvent(t, "Пересекается", base.Add(30*time.Minute), base.Add(2*time.Hour))
+	busy.CalendarID = work.ID
+	if err := s.CreateIfFree(ctx, &busy); err != storage.EntitySpanBusy {
+		t.Fatalf("expected EntitySpanBusy, got %v", err)
+	}
+
+	found, err := s.FindByID(ctx, workEvent.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, &workEvent, found)
+
+	for _, c := range []struct {
+		calendar entities.CalendarID
+		title    string
+	}{
+		{entities.DefaultCalendarID, defaultEvent.Title},
+		{work.ID, workEvent.Title},
+	} {
+		events, err := s.FindBySpan(ctx, c.calendar, base, base.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 || events[0].Title != c.title {
+			t.Fatalf("calendar %s: expected only %q, got %v", c.calendar, c.title, titles(events))
+		}
+
+		for _, order := range []storage.SortOrder{storage.SortAsc, storage.SortDesc} {
+			events, err = s.FindPage(ctx, storage.SpanQuery{Calendar: c.calendar, Start: base, End: base.Add(time.Hour), Order: order, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != 1 || events[0].Title != c.title {
+				t.Fatalf("calendar %s, order %d: expected only %q, got %v", c.calendar, order, c.title, titles(events))
+			}
+		}
+	}
+
+	moved := workEvent
+	moved.CalendarID = entities.DefaultCalendarID
+	moved.Title = "Перенесенное"
+	if err = s.Update(ctx, &moved); err != storage.EntityNotFound {
+		t.Fatalf("update from another calendar: expected EntityNotFound, got %v", err)
+	}
+	if err = s.UpdateIfFree(ctx, &moved); err != storage.EntityNotFound {
+		t.Fatalf("update if free from another calendar: expected EntityNotFound, got %v", err)
+	}
+
+	if found, err = s.FindByID(ctx, workEvent.ID); err != nil || found.Title != workEvent.Title {
+		t.Fatalf("event must not change, got %+v, %v", found, err)
+	}
+}
+
+// testDeleteCalendar проверяет, что календарь удаляется вместе со своими событиями и только с ними
+func testDeleteCalendar(t *testing.T, s usecases.Storage) {
+	ctx := context.Background()
+	work := mustCreateCalendar(t, s, "Работа", "")
+	home := mustCreateCalendar(t, s, "Дом", "")
+
+	var workEvents []entities.Event
+	for i := 0; i < 3; i++ {
+		start := base.AddDate(0, 0, i)
+		event := newEvent(t, "Работа", start, start.Add(time.Hour))
+		event.CalendarID = work.ID
+		workEvents = append(workEvents, event)
+	}
+	homeEvent := newEvent(t, "Дом", base, base.Add(time.Hour))
+	homeEvent.CalendarID = home.ID
+	defaultEvent := newEvent(t, "Без календаря", base, base.Add(time.Hour))
+	mustCreate(t, s, &workEvents[0], &workEvents[1], &workEvents[2], &homeEvent, &defaultEvent)
+
+	if err := s.DeleteCalendar(ctx, work.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, event := range workEvents {
+		if _, err := s.FindByID(ctx, event.ID); err != storage.EntityNotFound {
+			t.Fatalf("event of deleted calendar must be deleted, got %v", err)
+		}
+	}
+	events, err := s.FindBySpan(ctx, work.ID, base, base.AddDate(0, 0, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected no events of deleted calendar, got %v", titles(events))
+	}
+
+	for _, event := range []entities.Event{homeEvent, defaultEvent} {
+		if _, err = s.FindByID(ctx, event.ID); err != nil {
+			t.Fatalf("%s: event of another calendar must stay, got %v", event.Title, err)
+		}
+	}
+	if _, err = s.FindCalendarByID(ctx, home.ID); err != nil {
+		t.Fatalf("another calendar must stay, got %v", err)
+	}
+}
+
+// testTenants проверяет, что события одного арендатора недоступны другому ни для чтения, ни для записи,
+// а время, занятое одним арендатором, свободно у другого
+func testTenants(t *testing.T, s usecases.Storage) {
+	alice := tenant.NewContext(context.Background(), "alice")
+	bob := tenant.NewContext(context.Background(), "bob")
+	anonymous := context.Background()
+
+	event := newEvent(t, "Совещание alice", base, base.Add(time.Hour))
+	if err := s.CreateIfFree(alice, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Tenant != "alice" {
+		t.Fatalf("created event must belong to alice, got %q", event.Tenant)
+	}
+
+	// То же время у другого арендатора свободно
+	other := newEvent(t, "Совещание bob", base, base.Add(time.Hour))
+	if err := s.CreateIfFree(bob, &other); err != nil {
+		t.Fatalf("event of another tenant must not conflict: %v", err)
+	}
+
+	found, err := s.FindByID(alice, event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, &event, found)
+
+	for _, ctx := range []context.Context{bob, anonymous} {
+		name := tenant.FromContext(ctx)
+
+		if _, err = s.FindByID(ctx, event.ID); err != storage.EntityNotFound {
+			t.Fatalf("tenant %q: find by id: expected EntityNotFound, got %v", name, err)
+		}
+
+		events, err := s.FindBySpan(ctx, entities.DefaultCalendarID, base, base.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if titles(events)[event.Title] {
+			t.Fatalf("tenant %q: find by span must not return events of alice, got %v", name, titles(events))
+		}
+
+		for _, order := range []storage.SortOrder{storage.SortAsc, storage.SortDesc} {
+			events, err = s.FindPage(ctx, storage.SpanQuery{Start: base, End: base.Add(time.Hour), Order: order, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if titles(events)[event.Title] {
+				t.Fatalf("tenant %q, order %d: find page must not return events of alice, got %v", name, order, titles(events))
+			}
+		}
+
+		changed := event
+		changed.Title = "Чужое изменение"
+		if err = s.Update(ctx, &changed); err != storage.EntityNotFound {
+			t.Fatalf("tenant %q: update: expected EntityNotFound, got %v", name, err)
+		}
+		changed = event
+		changed.Title = "Чужое изменение"
+		if err = s.UpdateIfFree(ctx, &changed); err != storage.EntityNotFound {
+			t.Fatalf("tenant %q: update if free: expected EntityNotFound, got %v", name, err)
+		}
+		if err = s.DeleteByID(ctx, &event.ID, 0); err != storage.EntityNotFound {
+			t.Fatalf("tenant %q: delete: expected EntityNotFound, got %v", name, err)
+		}
+		if err = s.Create(ctx, &entities.Event{ID: event.ID, Title: "Чужое", Start: base, End: base.Add(time.Hour)}); err != storage.EntityAlreadyExists {
+			t.Fatalf("tenant %q: create with taken id: expected EntityAlreadyExists, got %v", name, err)
+		}
+	}
+
+	if found, err = s.FindByID(alice, event.ID); err != nil {
+		t.Fatalf("event must stay, got %v", err)
+	}
+	assertEqual(t, &event, found)
+
+	events, err := s.FindBySpan(bob, entities.DefaultCalendarID, base, base.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Title != other.Title {
+		t.Fatalf("bob must see only own event, got %v", titles(events))
+	}
+
+	// Свой арендатор изменяет и удаляет событие как обычно
+	event.Title = "Перенесенное совещание"
+	if err = s.UpdateIfFree(alice, &event); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.DeleteByID(alice, &event.ID, event.Version); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.FindByID(alice, event.ID); err != storage.EntityNotFound {
+		t.Fatalf("expected EntityNotFound after delete, got %v", err)
+	}
+}
+
+// testTenantCalendars проверяет, что календари одного арендатора недоступны другому,
+// а удаление календаря не затрагивает события других арендаторов
+func testTenantCalendars(t *testing.T, s usecases.Storage) {
+	alice := tenant.NewContext(context.Background(), "alice")
+	bob := tenant.NewContext(context.Background(), "bob")
+
+	work := entities.Calendar{ID: newCalendarID(t), Name: "Работа", Owner: "alice"}
+	if err := s.CreateCalendar(alice, &work); err != nil {
+		t.Fatal(err)
+	}
+	if work.Tenant != "alice" {
+		t.Fatalf("created calendar must belong to alice, got %q", work.Tenant)
+	}
+	event := newEvent(t, "Совещание", base, base.Add(time.Hour))
+	event.CalendarID = work.ID
+	if err := s.Create(alice, &event); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ctx := range []context.Context{bob, context.Background()} {
+		name := tenant.FromContext(ctx)
+
+		if _, err := s.FindCalendarByID(ctx, work.ID); err != storage.EntityNotFound {
+			t.Fatalf("tenant %q: find calendar: expected EntityNotFound, got %v", name, err)
+		}
+
+		calendars, err := s.FindCalendars(ctx, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(calendars) != 0 {
+			t.Fatalf("tenant %q: expected no calendars, got %v", name, calendarNames(calendars))
+		}
+
+		renamed := work
+		renamed.Name = "Чужое изменение"
+		if err = s.UpdateCalendar(ctx, &renamed); err != storage.EntityNotFound {
+			t.Fatalf("tenant %q: update calendar: expected EntityNotFound, got %v", name, err)
+		}
+		if err = s.DeleteCalendar(ctx, work.ID); err != storage.EntityNotFound {
+			t.Fatalf("tenant %q: delete calendar: expected EntityNotFound, got %v", name, err)
+		}
+	}
+
+	found, err := s.FindCalendarByID(alice, work.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*found, work) {
+		t.Fatalf("calendars differ:\nexpected %+v\nactual   %+v", work, *found)
+	}
+	if _, err = s.FindByID(alice, event.ID); err != nil {
+		t.Fatalf("event of calendar must stay, got %v", err)
+	}
+
+	calendars, err := s.FindCalendars(alice, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := calendarNames(calendars); !reflect.DeepEqual(names, []string{"Работа"}) {
+		t.Fatalf("unexpected calendars of alice %v", names)
+	}
+
+	if err = s.DeleteCalendar(alice, work.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.FindByID(alice, event.ID); err != storage.EntityNotFound {
+		t.Fatalf("event of deleted calendar must be deleted, got %v", err)
+	}
+}
+
+// newAPIKey создает ключ API с хэшем hash, созданный в момент created
+func newAPIKey(t *testing.T, name, hash string, created time.Time, scopes ...string) entities.APIKey {
+	t.Helper()
+
+	id, err := entities.NewAPIKeyID("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return entities.APIKey{ID: id, Name: name, Prefix: hash[:4], Hash: hash, Scopes: scopes, Created: created}
+}
+
+// assertAPIKey проверяет, что ключи API совпадают
+func assertAPIKey(t *testing.T, expected, actual *entities.APIKey) {
+	t.Helper()
+
+	if !actual.ID.Equal(expected.ID) || actual.Name != expected.Name || actual.Prefix != expected.Prefix ||
+		actual.Hash != expected.Hash || !reflect.DeepEqual(actual.Scopes, expected.Scopes) ||
+		actual.Tenant != expected.Tenant || !actual.Created.Equal(expected.Created) || !actual.Revoked.Equal(expected.Revoked) {
+		t.Fatalf("api keys differ:\nexpected %+v\nactual   %+v", *expected, *actual)
+	}
+}
+
+// apiKeyNames возвращает названия ключей API по порядку
+func apiKeyNames(keys []entities.APIKey) []string {
+	var ret []string
+	for _, k := range keys {
+		ret = append(ret, k.Name)
+	}
+
+	return ret
+}
+
+func testAPIKeys(t *testing.T, s usecases.Storage) {
+	ctx := context.Background()
+
+	later := newAPIKey(t, "Поздний", "bbbb1111", base.Add(time.Hour), entities.ScopeEventsRead)
+	first := newAPIKey(t, "Ранний", "aaaa2222", base, entities.ScopeEventsRead, entities.ScopeEventsWrite)
+	for _, k := range []*entities.APIKey{&later, &first} {
+		if err := s.CreateAPIKey(ctx, k); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	duplicate := newAPIKey(t, "Дубликат", first.Hash, base)
+	if err := s.CreateAPIKey(ctx, &duplicate); err != storage.EntityAlreadyExists {
+		t.Fatalf("duplicate hash: expected EntityAlreadyExists, got %v", err)
+	}
+
+	found, err := s.FindAPIKeyByHash(ctx, first.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertAPIKey(t, &first, found)
+
+	if _, err = s.FindAPIKeyByHash(ctx, "cccc3333"); err != storage.EntityNotFound {
+		t.Fatalf("unknown hash: expected EntityNotFound, got %v", err)
+	}
+
+	keys, err := s.FindAPIKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := apiKeyNames(keys); !reflect.DeepEqual(names, []string{"Ранний", "Поздний"}) {
+		t.Fatalf("unexpected api keys %v", names)
+	}
+
+	// Повторный отзыв не меняет время отзыва
+	first.Revoked = base.Add(2 * time.Hour)
+	if err = s.RevokeAPIKey(ctx, first.ID, first.Revoked); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.RevokeAPIKey(ctx, first.ID, first.Revoked.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if found, err = s.FindAPIKeyByHash(ctx, first.Hash); err != nil {
+		t.Fatal(err)
+	}
+	assertAPIKey(t, &first, found)
+
+	unknown, _ := entities.NewAPIKeyID("")
+	if err = s.RevokeAPIKey(ctx, unknown, base); err != storage.EntityNotFound {
+		t.Fatalf("revoke unknown: expected EntityNotFound, got %v", err)
+	}
+}
+
+func testTenantAPIKeys(t *testing.T, s usecases.Storage) {
+	alice := tenant.NewContext(context.Background(), "alice")
+	bob := tenant.NewContext(context.Background(), "bob")
+
+	key := newAPIKey(t, "Сервис", "aaaa1111", base, entities.ScopeCalendarsRead)
+	if err := s.CreateAPIKey(alice, &key); err != nil {
+		t.Fatal(err)
+	}
+	if key.Tenant != "alice" {
+		t.Fatalf("created api key must belong to alice, got %q", key.Tenant)
+	}
+
+	// По хэшу ключ находится из любого контекста: арендатор запроса известен только по ключу
+	for _, ctx := range []context.Context{bob, context.Background()} {
+		name := tenant.FromContext(ctx)
+
+		found, err := s.FindAPIKeyByHash(ctx, key.Hash)
+		if err != nil {
+			t.Fatalf("tenant %q: find by hash: %v", name, err)
+		}
+		assertAPIKey(t, &key, found)
+
+		keys, err := s.FindAPIKeys(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != 0 {
+			t.Fatalf("tenant %q: expected no api keys, got %v", name, apiKeyNames(keys))
+		}
+
+		if err = s.RevokeAPIKey(ctx, key.ID, base); err != storage.EntityNotFound {
+			t.Fatalf("tenant %q: revoke: expected EntityNotFound, got %v", name, err)
+		}
+	}
+
+	keys, err := s.FindAPIKeys(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].IsRevoked() {
+		t.Fatalf("unexpected api keys of alice %+v", keys)
+	}
+}
@@ -0,0 +1,37 @@
+// Пакет передает арендатора (команду, которой принадлежат данные) в контексте запроса от HTTP слоя до хранилища.
+//
+// Хранилища берут арендатора из контекста каждой операции: сохраняют с ним новые календари и события
+// и не видят чужих. Контекст без арендатора относится к арендатору по умолчанию (Default) - в нем лежат данные
+// установок с одной командой и данные, созданные до появления арендаторов.
+package tenant
+
+import (
+	"context"
+	"regexp"
+)
+
+// Default арендатор по умолчанию
+const Default = ""
+
+// pattern допустимый идентификатор арендатора: он входит в ключи хранилищ, поэтому без разделителей и пробелов
+var pattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// contextKey ключ контекста, под которым лежит арендатор
+type contextKey struct{}
+
+// NewContext возвращает контекст с арендатором id
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext возвращает арендатора из контекста, без арендатора - Default
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+
+	return id
+}
+
+// Valid проверяет, что id - допустимый идентификатор арендатора, кроме Default
+func Valid(id string) bool {
+	return pattern.MatchString(id)
+}
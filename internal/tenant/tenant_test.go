@@ -0,0 +1,35 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+)
+
+// TestContext проверяет передачу арендатора в контексте
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if id := FromContext(ctx); id != Default {
+		t.Errorf("expected default tenant, got %q", id)
+	}
+
+	if id := FromContext(NewContext(ctx, "team-a")); id != "team-a" {
+		t.Errorf("expected team-a, got %q", id)
+	}
+}
+
+// TestValid проверяет допустимые идентификаторы арендаторов
+func TestValid(t *testing.T) {
+	for id, valid := range map[string]bool{
+		"team-a":      true,
+		"Acme.Corp_1": true,
+		"":            false,
+		"-team":       false,
+		"team a":      false,
+		"team:a":      false,
+		"team/a":      false,
+	} {
+		if Valid(id) != valid {
+			t.Errorf("%q: expected valid %v", id, valid)
+		}
+	}
+}